@@ -0,0 +1,124 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// OperatorConfigName is the name of the singleton OperatorConfig the
+// operator watches.
+const OperatorConfigName = "default"
+
+// OperatorConfigSpec holds operator settings that take effect without a
+// restart. Unset fields keep the value from the operator's command-line
+// flags.
+type OperatorConfigSpec struct {
+	// PendingRequeueInterval is how often bindings waiting for their pod are
+	// re-checked. Defaults to 10s.
+	// +optional
+	PendingRequeueInterval *metav1.Duration `json:"pendingRequeueInterval,omitempty"`
+	// ErrorRequeueInterval is how often failed or denied bindings are
+	// retried. Defaults to 1m.
+	// +optional
+	ErrorRequeueInterval *metav1.Duration `json:"errorRequeueInterval,omitempty"`
+	// RouteResyncInterval is how often the route of a bound binding is
+	// re-verified with Cloudflare. Defaults to 5m.
+	// +optional
+	RouteResyncInterval *metav1.Duration `json:"routeResyncInterval,omitempty"`
+	// DefaultTTLSeconds is applied by the defaulting webhook to bindings
+	// without spec.ttlSeconds; 0 leaves them without a TTL. Overrides
+	// --default-ttl-seconds.
+	// +kubebuilder:validation:XValidation:rule="self == 0 || self >= 60",message="defaultTTLSeconds must be 0 or at least 60"
+	// +optional
+	DefaultTTLSeconds *int64 `json:"defaultTTLSeconds,omitempty"`
+	// RouteHostnameTemplate is the route hostname for bindings without
+	// spec.route.hostname. "{sessionID}" is replaced with the session ID.
+	// +optional
+	RouteHostnameTemplate string `json:"routeHostnameTemplate,omitempty"`
+	// KVNamespaceID is the Workers KV namespace new routes are written to;
+	// empty uses CLOUDFLARE_KV_NAMESPACE_ID.
+	// +optional
+	KVNamespaceID string `json:"kvNamespaceID,omitempty"`
+	// MaxConcurrentReconciles bounds how many SessionBindings are reconciled
+	// at once. Overrides --max-concurrent-reconciles.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=32
+	// +optional
+	MaxConcurrentReconciles *int32 `json:"maxConcurrentReconciles,omitempty"`
+	// DefaultTTLSecondsAfterFinished is the retention of finished bindings
+	// without spec.ttlSecondsAfterFinished; 0 keeps them until deleted.
+	// Overrides --default-ttl-seconds-after-finished.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	DefaultTTLSecondsAfterFinished *int64 `json:"defaultTTLSecondsAfterFinished,omitempty"`
+	// DrainGracePeriod is how long the pod of an expired or deleted binding
+	// keeps running after its route is removed, so in-flight requests can
+	// finish; 0 deletes it right away. Overrides --drain-grace-period.
+	// +optional
+	DrainGracePeriod *metav1.Duration `json:"drainGracePeriod,omitempty"`
+	// NetworkPolicy, when set, isolates every session pod with a
+	// NetworkPolicy of its own. Removing it deletes those policies.
+	// +optional
+	NetworkPolicy *SessionNetworkPolicy `json:"networkPolicy,omitempty"`
+}
+
+// SessionNetworkPolicy describes the NetworkPolicy created per session pod.
+type SessionNetworkPolicy struct {
+	// IngressNamespaces are the namespaces allowed to reach session pods,
+	// typically where cloudflared or the ingress controller runs.
+	// +kubebuilder:validation:MinItems=1
+	IngressNamespaces []string `json:"ingressNamespaces"`
+	// EgressCIDRs are the IP blocks session pods may connect to. When
+	// neither this nor EgressNamespaces is set, egress is not restricted.
+	// DNS is always allowed once egress is restricted.
+	// +optional
+	EgressCIDRs []string `json:"egressCIDRs,omitempty"`
+	// EgressNamespaces are the namespaces session pods may connect to.
+	// +optional
+	EgressNamespaces []string `json:"egressNamespaces,omitempty"`
+}
+
+// OperatorConfigStatus defines the observed state of OperatorConfig.
+type OperatorConfigStatus struct {
+	// ObservedGeneration is the generation the operator last applied.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions represent the latest available observations of the config.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster,categories=cloudflare
+//+kubebuilder:validation:XValidation:rule="self.metadata.name == 'default'",message="the OperatorConfig must be named default"
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// OperatorConfig tunes the running operator. Only the object named
+// OperatorConfigName is used.
+type OperatorConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   OperatorConfigSpec   `json:"spec,omitempty"`
+	Status OperatorConfigStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// OperatorConfigList contains a list of OperatorConfig.
+type OperatorConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []OperatorConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&OperatorConfig{}, &OperatorConfigList{})
+}
+
+// ConditionConfigApplied is True once the operator runs with the
+// OperatorConfig's current generation.
+const ConditionConfigApplied = "Applied"
+
+// ConditionCloudflareAvailable is False while the operator's Cloudflare
+// circuit breaker is open, i.e. Cloudflare calls fail fast after a run of
+// failures.
+const ConditionCloudflareAvailable = "CloudflareAvailable"
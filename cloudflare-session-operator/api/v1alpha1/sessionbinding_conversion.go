@@ -0,0 +1,144 @@
+package v1alpha1
+
+import (
+	"fmt"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// ConvertTo converts this SessionBinding to the hub version (v1beta1).
+func (src *SessionBinding) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v1beta1.SessionBinding)
+	if !ok {
+		return fmt.Errorf("unsupported conversion target %T", dstRaw)
+	}
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+
+	spec := src.Spec.DeepCopy()
+	dst.Spec.SessionID = spec.SessionID
+	dst.Spec.UserID = spec.UserID
+	if spec.TargetRef != nil || spec.TargetDeployment != "" {
+		ref := v1beta1.TargetReference(spec.Target())
+		dst.Spec.TargetRef = &ref
+	}
+	dst.Spec.PodSelector = spec.PodSelector
+	dst.Spec.PoolRef = spec.PoolRef
+	dst.Spec.TTLSeconds = spec.TTLSeconds
+	dst.Spec.IdleTimeoutSeconds = spec.IdleTimeoutSeconds
+	dst.Spec.TTLSecondsAfterFinished = spec.TTLSecondsAfterFinished
+	dst.Spec.Profile = spec.Profile
+	dst.Spec.PodOverrides = (*v1beta1.PodOverrides)(spec.PodOverrides)
+	dst.Spec.NodeSelector = spec.NodeSelector
+	dst.Spec.Tolerations = spec.Tolerations
+	dst.Spec.Affinity = spec.Affinity
+	dst.Spec.TopologySpreadConstraints = spec.TopologySpreadConstraints
+	dst.Spec.PriorityClassName = spec.PriorityClassName
+	dst.Spec.CredentialsSecretRef = spec.CredentialsSecretRef
+	dst.Spec.NotificationSecretRef = spec.NotificationSecretRef
+	dst.Spec.Paused = spec.Paused
+	if spec.Route != nil {
+		dst.Spec.Route = &v1beta1.RouteSpec{
+			Hostname:             spec.Route.Hostname,
+			PathPrefix:           spec.Route.PathPrefix,
+			TLSMode:              v1beta1.RouteTLSMode(spec.Route.TLSMode),
+			TunnelTokenSecretRef: spec.Route.TunnelTokenSecretRef,
+		}
+	}
+	dst.Spec.Replicas = spec.Replicas
+
+	status := src.Status.DeepCopy()
+	dst.Status = v1beta1.SessionBindingStatus{
+		Phase:               v1beta1.SessionBindingPhase(status.Phase),
+		PhaseTransitionTime: status.PhaseTransitionTime,
+		BoundPod:            status.BoundPod,
+		BoundPodUID:         status.BoundPodUID,
+		BoundNode:           status.BoundNode,
+		TemplateHash:        status.TemplateHash,
+		RouteEndpoint:       status.RouteEndpoint,
+		RouteID:             status.RouteID,
+		RouteVersion:        status.RouteVersion,
+		Profile:             status.Profile,
+		ObservedGeneration:  status.ObservedGeneration,
+		Conditions:          status.Conditions,
+		ExpiresAt:           status.ExpiresAt,
+		SessionExpiresAt:    status.SessionExpiresAt,
+		LastActivityTime:    status.LastActivityTime,
+		LastReconcileTime:   status.LastReconcileTime,
+		CleanupAttempts:     status.CleanupAttempts,
+		FinishedAt:          status.FinishedAt,
+		DrainStartedAt:      status.DrainStartedAt,
+		Replicas:            status.Replicas,
+		ReadyReplicas:       status.ReadyReplicas,
+		Selector:            status.Selector,
+		Provider:            (*v1beta1.ProviderStatus)(status.Provider),
+	}
+	return nil
+}
+
+// ConvertFrom converts from the hub version (v1beta1) to this version.
+func (dst *SessionBinding) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*v1beta1.SessionBinding)
+	if !ok {
+		return fmt.Errorf("unsupported conversion source %T", srcRaw)
+	}
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+
+	spec := src.Spec.DeepCopy()
+	dst.Spec.SessionID = spec.SessionID
+	dst.Spec.UserID = spec.UserID
+	// The deprecated targetDeployment field is normalised to targetRef.
+	dst.Spec.TargetRef = (*TargetReference)(spec.TargetRef)
+	dst.Spec.PodSelector = spec.PodSelector
+	dst.Spec.PoolRef = spec.PoolRef
+	dst.Spec.TTLSeconds = spec.TTLSeconds
+	dst.Spec.IdleTimeoutSeconds = spec.IdleTimeoutSeconds
+	dst.Spec.TTLSecondsAfterFinished = spec.TTLSecondsAfterFinished
+	dst.Spec.Profile = spec.Profile
+	dst.Spec.PodOverrides = (*PodOverrides)(spec.PodOverrides)
+	dst.Spec.NodeSelector = spec.NodeSelector
+	dst.Spec.Tolerations = spec.Tolerations
+	dst.Spec.Affinity = spec.Affinity
+	dst.Spec.TopologySpreadConstraints = spec.TopologySpreadConstraints
+	dst.Spec.PriorityClassName = spec.PriorityClassName
+	dst.Spec.CredentialsSecretRef = spec.CredentialsSecretRef
+	dst.Spec.NotificationSecretRef = spec.NotificationSecretRef
+	dst.Spec.Paused = spec.Paused
+	if spec.Route != nil {
+		dst.Spec.Route = &RouteSpec{
+			Hostname:             spec.Route.Hostname,
+			PathPrefix:           spec.Route.PathPrefix,
+			TLSMode:              RouteTLSMode(spec.Route.TLSMode),
+			TunnelTokenSecretRef: spec.Route.TunnelTokenSecretRef,
+		}
+	}
+	dst.Spec.Replicas = spec.Replicas
+
+	status := src.Status.DeepCopy()
+	dst.Status = SessionBindingStatus{
+		Phase:               SessionBindingPhase(status.Phase),
+		PhaseTransitionTime: status.PhaseTransitionTime,
+		BoundPod:            status.BoundPod,
+		BoundPodUID:         status.BoundPodUID,
+		BoundNode:           status.BoundNode,
+		TemplateHash:        status.TemplateHash,
+		RouteEndpoint:       status.RouteEndpoint,
+		RouteID:             status.RouteID,
+		RouteVersion:        status.RouteVersion,
+		Profile:             status.Profile,
+		ObservedGeneration:  status.ObservedGeneration,
+		Conditions:          status.Conditions,
+		ExpiresAt:           status.ExpiresAt,
+		SessionExpiresAt:    status.SessionExpiresAt,
+		LastActivityTime:    status.LastActivityTime,
+		LastReconcileTime:   status.LastReconcileTime,
+		CleanupAttempts:     status.CleanupAttempts,
+		FinishedAt:          status.FinishedAt,
+		DrainStartedAt:      status.DrainStartedAt,
+		Replicas:            status.Replicas,
+		ReadyReplicas:       status.ReadyReplicas,
+		Selector:            status.Selector,
+		Provider:            (*ProviderStatus)(status.Provider),
+	}
+	return nil
+}
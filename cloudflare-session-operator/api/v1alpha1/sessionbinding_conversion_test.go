@@ -0,0 +1,163 @@
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func int64Ptr(v int64) *int64 { return &v }
+
+func int32Ptr(v int32) *int32 { return &v }
+
+// fullSessionBinding sets every spec and status field, so a field the
+// conversion forgets shows up in the round trip.
+func fullSessionBinding() *SessionBinding {
+	now := metav1.NewTime(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	later := metav1.NewTime(now.Add(time.Hour))
+	return &SessionBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "session-a",
+			Namespace:   "default",
+			Labels:      map[string]string{"app": "web"},
+			Annotations: map[string]string{"note": "kept"},
+			Finalizers:  []string{"sessions.cloudflare.io/finalizer"},
+			Generation:  3,
+		},
+		Spec: SessionBindingSpec{
+			SessionID:               "a",
+			UserID:                  "user",
+			TargetRef:               &TargetReference{Kind: TargetKindStatefulSet, Name: "web", Namespace: "apps"},
+			PodSelector:             &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			PoolRef:                 &corev1.LocalObjectReference{Name: "pool"},
+			TTLSeconds:              int64Ptr(3600),
+			IdleTimeoutSeconds:      int64Ptr(600),
+			TTLSecondsAfterFinished: int64Ptr(60),
+			Profile:                 "large",
+			PodOverrides: &PodOverrides{
+				Resources: &corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+				},
+				Env:                []corev1.EnvVar{{Name: "MODE", Value: "session"}},
+				Labels:             map[string]string{"tier": "gold"},
+				Annotations:        map[string]string{"a": "b"},
+				ImageTag:           "v2",
+				ServiceAccountName: "session",
+				PodSecurityContext: &corev1.PodSecurityContext{RunAsUser: int64Ptr(1000)},
+				SecurityContext:    &corev1.SecurityContext{RunAsNonRoot: new(bool)},
+			},
+			NodeSelector:              map[string]string{"pool": "sessions"},
+			Tolerations:               []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}},
+			Affinity:                  &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{}},
+			TopologySpreadConstraints: []corev1.TopologySpreadConstraint{{MaxSkew: 1, TopologyKey: "zone"}},
+			PriorityClassName:         "high",
+			CredentialsSecretRef:      &corev1.LocalObjectReference{Name: "cloudflare"},
+			NotificationSecretRef:     &corev1.LocalObjectReference{Name: "webhook"},
+			Paused:                    true,
+			Route: &RouteSpec{
+				Hostname:             "a.example.com",
+				PathPrefix:           "/app",
+				TLSMode:              RouteTLSModeStrict,
+				TunnelTokenSecretRef: &corev1.LocalObjectReference{Name: "tunnel"},
+			},
+			Replicas: int32Ptr(2),
+		},
+		Status: SessionBindingStatus{
+			Phase:               SessionBindingPhaseDraining,
+			PhaseTransitionTime: &now,
+			BoundPod:            "session-a-pod",
+			BoundPodUID:         "uid",
+			BoundNode:           "node",
+			TemplateHash:        "hash",
+			RouteEndpoint:       "10.0.0.1:8080",
+			RouteID:             "routes/session:a",
+			RouteVersion:        "1",
+			Provider:            &ProviderStatus{Type: "WorkersKV", LastRouteSyncTime: &now, LastVerifiedTime: &later},
+			ObservedGeneration:  3,
+			Profile:             "large",
+			Conditions: []metav1.Condition{{
+				Type: ConditionRouteConfigured, Status: metav1.ConditionTrue, Reason: "RouteReady", LastTransitionTime: now,
+			}},
+			ExpiresAt:         &later,
+			SessionExpiresAt:  &later,
+			LastActivityTime:  &now,
+			LastReconcileTime: &now,
+			CleanupAttempts:   2,
+			FinishedAt:        &now,
+			DrainStartedAt:    &now,
+			Replicas:          2,
+			ReadyReplicas:     1,
+			Selector:          "app=web",
+		},
+	}
+}
+
+func TestSessionBindingConversionRoundTrip(t *testing.T) {
+	src := fullSessionBinding()
+	hub := &v1beta1.SessionBinding{}
+	if err := src.ConvertTo(hub); err != nil {
+		t.Fatalf("ConvertTo: %v", err)
+	}
+	got := &SessionBinding{}
+	if err := got.ConvertFrom(hub); err != nil {
+		t.Fatalf("ConvertFrom: %v", err)
+	}
+	if !equality.Semantic.DeepEqual(got.ObjectMeta, src.ObjectMeta) {
+		t.Errorf("metadata = %+v\nwant %+v", got.ObjectMeta, src.ObjectMeta)
+	}
+	if !equality.Semantic.DeepEqual(got.Spec, src.Spec) {
+		t.Errorf("spec = %+v\nwant %+v", got.Spec, src.Spec)
+	}
+	if !equality.Semantic.DeepEqual(got.Status, src.Status) {
+		t.Errorf("status = %+v\nwant %+v", got.Status, src.Status)
+	}
+}
+
+func TestSessionBindingConversionNormalisesTargetDeployment(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		spec SessionBindingSpec
+		want *TargetReference
+	}{
+		{
+			name: "targetDeployment",
+			spec: SessionBindingSpec{SessionID: "a", TargetDeployment: "web"},
+			want: &TargetReference{Kind: TargetKindDeployment, Name: "web"},
+		},
+		{
+			name: "targetRef takes precedence",
+			spec: SessionBindingSpec{SessionID: "a", TargetDeployment: "old", TargetRef: &TargetReference{Name: "web"}},
+			want: &TargetReference{Kind: TargetKindDeployment, Name: "web"},
+		},
+		{
+			name: "no target",
+			spec: SessionBindingSpec{SessionID: "a"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hub := &v1beta1.SessionBinding{}
+			if err := (&SessionBinding{Spec: tc.spec}).ConvertTo(hub); err != nil {
+				t.Fatalf("ConvertTo: %v", err)
+			}
+			if !equality.Semantic.DeepEqual((*TargetReference)(hub.Spec.TargetRef), tc.want) {
+				t.Fatalf("v1beta1 targetRef = %+v want %+v", hub.Spec.TargetRef, tc.want)
+			}
+
+			got := &SessionBinding{}
+			if err := got.ConvertFrom(hub); err != nil {
+				t.Fatalf("ConvertFrom: %v", err)
+			}
+			if got.Spec.TargetDeployment != "" || !equality.Semantic.DeepEqual(got.Spec.TargetRef, tc.want) {
+				t.Fatalf("v1alpha1 targetDeployment = %q, targetRef = %+v; want only targetRef %+v", got.Spec.TargetDeployment, got.Spec.TargetRef, tc.want)
+			}
+			if got.Spec.Target() != (&SessionBindingSpec{TargetDeployment: tc.spec.TargetDeployment, TargetRef: tc.spec.TargetRef}).Target() {
+				t.Fatalf("target changed in the round trip: %+v", got.Spec.Target())
+			}
+		})
+	}
+}
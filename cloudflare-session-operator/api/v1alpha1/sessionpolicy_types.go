@@ -0,0 +1,62 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SessionPolicySpec defines the limits a SessionPolicy places on the
+// SessionBindings in the namespaces it selects.
+type SessionPolicySpec struct {
+	// NamespaceSelector selects the namespaces the policy applies to; an
+	// empty selector selects all namespaces.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// MaxSessionsPerNamespace caps the active SessionBindings in each
+	// selected namespace.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxSessionsPerNamespace *int32 `json:"maxSessionsPerNamespace,omitempty"`
+	// MaxSessionsPerUser caps the active SessionBindings with the same
+	// spec.userID across all selected namespaces.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxSessionsPerUser *int32 `json:"maxSessionsPerUser,omitempty"`
+	// MaxTTLSeconds is the longest spec.ttlSeconds allowed. Bindings without
+	// a TTL are denied while it is set.
+	// +kubebuilder:validation:Minimum=60
+	// +optional
+	MaxTTLSeconds *int64 `json:"maxTTLSeconds,omitempty"`
+	// AllowedProfiles restricts spec.profile; empty allows every profile.
+	// Bindings without spec.profile are always allowed.
+	// +optional
+	AllowedProfiles []string `json:"allowedProfiles,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster,shortName=spol,categories=cloudflare;sessions
+//+kubebuilder:printcolumn:name="PerNamespace",type=integer,JSONPath=`.spec.maxSessionsPerNamespace`
+//+kubebuilder:printcolumn:name="PerUser",type=integer,JSONPath=`.spec.maxSessionsPerUser`
+//+kubebuilder:printcolumn:name="MaxTTL",type=integer,JSONPath=`.spec.maxTTLSeconds`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// SessionPolicy limits the SessionBindings of the namespaces it selects.
+// Every policy selecting a namespace applies, so the strictest limit wins.
+type SessionPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec SessionPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SessionPolicyList contains a list of SessionPolicy.
+type SessionPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SessionPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SessionPolicy{}, &SessionPolicyList{})
+}
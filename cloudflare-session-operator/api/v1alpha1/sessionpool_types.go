@@ -0,0 +1,77 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Labels on pods managed by a SessionPool.
+const (
+	// PoolLabelKey names the SessionPool a pod was created by.
+	PoolLabelKey = "cloudflare.example.com/pool"
+	// PoolStateLabelKey is PoolStateWarm while the pod is on standby and
+	// PoolStateClaimed once a SessionBinding has taken it over.
+	PoolStateLabelKey = "cloudflare.example.com/pool-state"
+
+	PoolStateWarm    = "warm"
+	PoolStateClaimed = "claimed"
+)
+
+// SessionPoolSpec defines the desired state of SessionPool.
+type SessionPoolSpec struct {
+	// TargetRef references the workload whose pod template is cloned for
+	// standby pods.
+	TargetRef TargetReference `json:"targetRef"`
+	// Replicas is the number of ready, unbound pods to keep on standby.
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas"`
+	// PodOverrides customise the standby pods cloned from the target.
+	// +optional
+	PodOverrides *PodOverrides `json:"podOverrides,omitempty"`
+}
+
+// SessionPoolStatus defines the observed state of SessionPool.
+type SessionPoolStatus struct {
+	// Replicas is the number of standby pods that currently exist.
+	Replicas int32 `json:"replicas,omitempty"`
+	// ReadyReplicas is the number of standby pods ready to be claimed.
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+	// ObservedGeneration tracks the latest processed generation.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions represent the latest available observations of the pool state.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:shortName=sp,categories=cloudflare;sessions
+//+kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.spec.replicas`
+//+kubebuilder:printcolumn:name="Current",type=integer,JSONPath=`.status.replicas`
+//+kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyReplicas`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// SessionPool keeps pre-created standby pods that SessionBindings can claim
+// instead of waiting for a cold start.
+type SessionPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SessionPoolSpec   `json:"spec,omitempty"`
+	Status SessionPoolStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SessionPoolList contains a list of SessionPool.
+type SessionPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SessionPool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SessionPool{}, &SessionPoolList{})
+}
+
+// ConditionPoolReady is True on a SessionPool while all desired standby pods
+// are ready.
+const ConditionPoolReady = "Ready"
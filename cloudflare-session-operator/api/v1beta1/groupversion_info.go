@@ -0,0 +1,15 @@
+// Package v1beta1 contains API Schema definitions for the cloudflare v1beta1 API group.
+// +kubebuilder:object:generate=true
+// +groupName=cloudflare.example.com
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+	GroupVersion  = schema.GroupVersion{Group: "cloudflare.example.com", Version: "v1beta1"}
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+	AddToScheme   = SchemeBuilder.AddToScheme
+)
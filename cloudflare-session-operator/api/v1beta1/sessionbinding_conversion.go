@@ -0,0 +1,5 @@
+package v1beta1
+
+// Hub marks v1beta1 as the conversion hub; other versions convert to and
+// from it.
+func (*SessionBinding) Hub() {}
@@ -0,0 +1,302 @@
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// SessionBindingPhase represents the lifecycle phase of a session binding.
+type SessionBindingPhase string
+
+const (
+	SessionBindingPhasePending SessionBindingPhase = "Pending"
+	SessionBindingPhaseBound   SessionBindingPhase = "Bound"
+	SessionBindingPhaseExpired SessionBindingPhase = "Expired"
+	SessionBindingPhaseError   SessionBindingPhase = "Error"
+	// SessionBindingPhaseTerminating is set while a deleted binding's pod
+	// and route are being removed.
+	SessionBindingPhaseTerminating SessionBindingPhase = "Terminating"
+	// SessionBindingPhaseDraining is set while an expired or deleted
+	// binding's route is gone and its pod finishes in-flight requests.
+	SessionBindingPhaseDraining SessionBindingPhase = "Draining"
+)
+
+// TargetReference identifies the workload whose pod template is cloned for session pods.
+type TargetReference struct {
+	// Kind of the target workload.
+	// +kubebuilder:validation:Enum=Deployment;StatefulSet;ReplicaSet
+	// +kubebuilder:default=Deployment
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// Name of the target workload.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Namespace of the target workload; defaults to the binding's namespace.
+	// Other namespaces require the operator's --allow-cross-namespace-targets
+	// flag and a cloudflare.example.com/allowed-namespaces annotation on the
+	// target listing the binding's namespace (or "*").
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// PodOverrides are merged into the cloned pod template.
+type PodOverrides struct {
+	// Resources replaces the requests/limits of every container.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// Env is appended to every container, replacing variables of the same name.
+	// +optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+	// Labels are added to the session pod.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are added to the session pod.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// ImageTag replaces the tag of every container image.
+	// +optional
+	ImageTag string `json:"imageTag,omitempty"`
+	// ServiceAccountName runs the session pod under a different identity than
+	// the target deployment.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// PodSecurityContext replaces the pod-level security context.
+	// +optional
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+	// SecurityContext replaces the security context of every container.
+	// +optional
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+}
+
+// RouteTLSMode selects how Cloudflare terminates TLS for the session route.
+type RouteTLSMode string
+
+const (
+	RouteTLSModeFlexible RouteTLSMode = "Flexible"
+	RouteTLSModeFull     RouteTLSMode = "Full"
+	RouteTLSModeStrict   RouteTLSMode = "Strict"
+)
+
+// RouteSpec describes how the session is exposed through Cloudflare.
+type RouteSpec struct {
+	// Hostname is a template for the session hostname; {sessionID} is replaced
+	// with spec.sessionID, e.g. "{sessionID}.sessions.example.com".
+	// +optional
+	Hostname string `json:"hostname,omitempty"`
+	// PathPrefix restricts the route to requests under this path.
+	// +optional
+	PathPrefix string `json:"pathPrefix,omitempty"`
+	// TLSMode for the route.
+	// +kubebuilder:validation:Enum=Flexible;Full;Strict
+	// +optional
+	TLSMode RouteTLSMode `json:"tlsMode,omitempty"`
+	// TunnelTokenSecretRef names a Secret in the binding's namespace whose
+	// "token" key holds the token of the Cloudflare Tunnel serving the
+	// session. Required when the operator runs in Tunnel routing mode, where
+	// a cloudflared sidecar in the session pod runs the tunnel.
+	// +optional
+	TunnelTokenSecretRef *corev1.LocalObjectReference `json:"tunnelTokenSecretRef,omitempty"`
+}
+
+// SessionBindingSpec defines the desired state of SessionBinding.
+// +kubebuilder:validation:XValidation:rule="[has(self.targetRef), has(self.podSelector), has(self.poolRef)].filter(x, x).size() == 1",message="exactly one of targetRef, podSelector or poolRef must be set"
+// +kubebuilder:validation:XValidation:rule="!has(self.replicas) || self.replicas == 1 || has(self.targetRef)",message="replicas above 1 require targetRef"
+type SessionBindingSpec struct {
+	// SessionID is the Cloudflare session identifier to bind.
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="sessionID is immutable"
+	SessionID string `json:"sessionID"`
+	// UserID is an optional identifier for the user owning the session.
+	// +optional
+	UserID string `json:"userID,omitempty"`
+	// TargetRef references the workload that should be cloned for session pods.
+	// +optional
+	TargetRef *TargetReference `json:"targetRef,omitempty"`
+	// PodSelector switches the binding to routing to an existing ready pod
+	// matching the selector instead of cloning a new one, for workloads that
+	// manage their own pod lifecycle. Mutually exclusive with targetRef and
+	// poolRef.
+	// +optional
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+	// PoolRef names a SessionPool in the binding's namespace to claim a
+	// standby pod from; when none is ready a pod is cloned from the pool's
+	// target. Mutually exclusive with targetRef and podSelector.
+	// +optional
+	PoolRef *corev1.LocalObjectReference `json:"poolRef,omitempty"`
+	// TTLSeconds defines how long the binding should remain active after creation.
+	// +kubebuilder:validation:XValidation:rule="self >= 60",message="ttlSeconds must be at least 60"
+	// +optional
+	TTLSeconds *int64 `json:"ttlSeconds,omitempty"`
+	// IdleTimeoutSeconds expires the binding once the session pod has not
+	// reported activity for this long, independent of ttlSeconds. Workloads
+	// report activity by setting the cloudflare.example.com/last-activity
+	// annotation on their pod to an RFC 3339 timestamp.
+	// +kubebuilder:validation:XValidation:rule="self >= 60",message="idleTimeoutSeconds must be at least 60"
+	// +optional
+	IdleTimeoutSeconds *int64 `json:"idleTimeoutSeconds,omitempty"`
+	// TTLSecondsAfterFinished deletes the binding once it has been in the
+	// Expired or Error phase for this long; 0 deletes it as soon as it
+	// finishes. Unset uses the operator's default retention, if any.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	TTLSecondsAfterFinished *int64 `json:"ttlSecondsAfterFinished,omitempty"`
+	// Profile picks an operator-configured resource size for the session pod.
+	// podOverrides.resources, when set, takes precedence.
+	// +kubebuilder:validation:Enum=small;medium;large
+	// +optional
+	Profile string `json:"profile,omitempty"`
+	// PodOverrides customise the session pod cloned from the target.
+	// +optional
+	PodOverrides *PodOverrides `json:"podOverrides,omitempty"`
+	// NodeSelector is merged into the template's node selector, so session
+	// pods can be pinned to a node pool (e.g. GPU nodes) per session tier.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations are appended to the template's tolerations.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// Affinity replaces the template's affinity (node, pod and anti-affinity).
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// TopologySpreadConstraints replace the template's spread constraints.
+	// +optional
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	// PriorityClassName sets the session pod's priority class, overriding
+	// the operator default and the template's own. Use a high-priority class
+	// to let sessions preempt batch workloads, or a low one with
+	// preemptionPolicy Never to make them yield.
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	// CredentialsSecretRef names a Secret in the binding's namespace holding
+	// the Cloudflare "accountID" and "apiToken" to use for this session
+	// instead of the operator's own credentials. A Global API Key, as
+	// "apiKey" and "email", or zone-scoped tokens, as "zoneTokens" listing
+	// zoneID=token pairs, can be used instead of or besides the token.
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+	// NotificationSecretRef names a Secret in the binding's namespace
+	// configuring the webhook told when the session is bound, about to
+	// expire, expired or failed. Without it, the namespace's
+	// cloudflare-session-notifications Secret is used, if any.
+	// +optional
+	NotificationSecretRef *corev1.LocalObjectReference `json:"notificationSecretRef,omitempty"`
+	// Paused suspends reconciliation: the session pod is not recreated and the
+	// route is not updated until it is cleared. Deletion is still handled.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+	// Route configures the Cloudflare route for the session.
+	// +optional
+	Route *RouteSpec `json:"route,omitempty"`
+	// Replicas is the number of pods backing the session. Above 1 the
+	// session is routed to its Service, which balances across the pods, so
+	// it needs a cloned target. Scalable through the scale subresource.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+}
+
+// ProviderStatus is the provider-specific part of the route status.
+type ProviderStatus struct {
+	// Type of the route backend, e.g. WorkersKV.
+	Type string `json:"type,omitempty"`
+	// LastRouteSyncTime is when the route was last written successfully.
+	LastRouteSyncTime *metav1.Time `json:"lastRouteSyncTime,omitempty"`
+	// LastVerifiedTime is when the route was last read back and compared
+	// with the session's endpoint.
+	LastVerifiedTime *metav1.Time `json:"lastVerifiedTime,omitempty"`
+}
+
+// SessionBindingStatus defines the observed state of SessionBinding.
+type SessionBindingStatus struct {
+	Phase SessionBindingPhase `json:"phase,omitempty"`
+	// PhaseTransitionTime is when the binding entered its current phase.
+	PhaseTransitionTime *metav1.Time `json:"phaseTransitionTime,omitempty"`
+	// BoundPod is the name of the pod created for this session.
+	BoundPod string `json:"boundPod,omitempty"`
+	// BoundPodUID is the UID of the bound pod. A pod found under BoundPod
+	// with another UID was recreated outside the operator.
+	BoundPodUID types.UID `json:"boundPodUID,omitempty"`
+	// BoundNode is the node the bound pod is scheduled to.
+	BoundNode string `json:"boundNode,omitempty"`
+	// TemplateHash identifies the resolved pod template the bound pod was
+	// created from. A different hash for the current template triggers a
+	// rolling replacement of the pod.
+	TemplateHash string `json:"templateHash,omitempty"`
+	// RouteEndpoint is the endpoint programmed in Cloudflare for this session.
+	RouteEndpoint string `json:"routeEndpoint,omitempty"`
+	// RouteID is the provider's identifier for the programmed route, used for
+	// cleanup and drift detection instead of re-deriving it from the session.
+	RouteID string `json:"routeID,omitempty"`
+	// RouteVersion is the version of the route as last written or read,
+	// which the next write is conditional on so it does not overwrite a
+	// newer one; empty when the provider does not version routes.
+	RouteVersion string `json:"routeVersion,omitempty"`
+	// Provider describes the backend holding the route.
+	Provider *ProviderStatus `json:"provider,omitempty"`
+	// ObservedGeneration tracks the latest processed generation.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Profile is the resource profile applied to the session pod, after
+	// the operator's default profile is taken into account.
+	Profile string `json:"profile,omitempty"`
+	// Conditions represent the latest available observations of the binding state.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// ExpiresAt is when the TTL elapses; unset for bindings without a TTL.
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+	// SessionExpiresAt is when the Cloudflare session ends, as reported by
+	// the session store; unset when the store does not say.
+	SessionExpiresAt *metav1.Time `json:"sessionExpiresAt,omitempty"`
+	// LastActivityTime is the latest activity observed for the session;
+	// only tracked when spec.idleTimeoutSeconds is set.
+	LastActivityTime *metav1.Time `json:"lastActivityTime,omitempty"`
+	// LastReconcileTime records the last time the controller reconciled the resource.
+	LastReconcileTime *metav1.Time `json:"lastReconcileTime,omitempty"`
+	// CleanupAttempts counts the failed attempts to remove the route of a
+	// deleted binding.
+	CleanupAttempts int32 `json:"cleanupAttempts,omitempty"`
+	// FinishedAt is when the binding entered the Expired or Error phase;
+	// unset while it is in any other phase.
+	FinishedAt *metav1.Time `json:"finishedAt,omitempty"`
+	// DrainStartedAt is when the route of an expiring or deleted binding
+	// was removed; the session pod is deleted after the drain grace period.
+	DrainStartedAt *metav1.Time `json:"drainStartedAt,omitempty"`
+	// Replicas is the number of live pods backing the session.
+	Replicas int32 `json:"replicas,omitempty"`
+	// ReadyReplicas is the number of those pods that are ready.
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+	// Selector selects the session's pods, for the scale subresource.
+	Selector string `json:"selector,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas,selectorpath=.status.selector
+//+kubebuilder:resource:shortName=sb,categories=cloudflare;sessions
+//+kubebuilder:printcolumn:name="Session",type=string,JSONPath=`.spec.sessionID`,priority=1
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="BoundPod",type=string,JSONPath=`.status.boundPod`
+//+kubebuilder:printcolumn:name="RouteEndpoint",type=string,JSONPath=`.status.routeEndpoint`
+//+kubebuilder:printcolumn:name="ExpiresAt",type=date,JSONPath=`.status.expiresAt`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// SessionBinding is the Schema for the sessionbindings API.
+type SessionBinding struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SessionBindingSpec   `json:"spec,omitempty"`
+	Status SessionBindingStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SessionBindingList contains a list of SessionBinding.
+type SessionBindingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SessionBinding `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SessionBinding{}, &SessionBindingList{})
+}
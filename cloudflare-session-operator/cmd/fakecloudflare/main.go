@@ -0,0 +1,32 @@
+// Command fakecloudflare serves an in-memory Cloudflare API for local
+// development, which the operator and the other commands use when pointed
+// at it:
+//
+//	fakecloudflare --addr :8787
+//	CLOUDFLARE_API_BASE_URL=http://localhost:8787 CLOUDFLARE_ACCOUNT_ID=dev CLOUDFLARE_API_TOKEN=dev manager
+//
+// Its state is lost when it stops. See package fake for what it serves.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare/fake"
+)
+
+func main() {
+	var addr string
+	flag.StringVar(&addr, "addr", ":8787", "Address to serve the fake Cloudflare API on.")
+	flag.Parse()
+
+	srv := &http.Server{Addr: addr, Handler: fake.NewServer(), ReadHeaderTimeout: 10 * time.Second}
+	fmt.Fprintln(os.Stderr, "serving a fake Cloudflare API on", addr)
+	if err := srv.ListenAndServe(); err != nil {
+		fmt.Fprintln(os.Stderr, "fakecloudflare:", err)
+		os.Exit(1)
+	}
+}
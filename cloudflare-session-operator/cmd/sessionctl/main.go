@@ -0,0 +1,356 @@
+// Command sessionctl inspects and manages SessionBindings:
+//
+//	sessionctl list [-n NAMESPACE | -A]
+//	sessionctl describe NAME [-n NAMESPACE]
+//	sessionctl extend NAME --by DURATION [-n NAMESPACE]
+//	sessionctl expire NAME [-n NAMESPACE]
+//
+// Installed as kubectl-sessionbinding on the PATH, it also runs as
+// "kubectl sessionbinding". It uses the current kubeconfig context, and
+// describe reads the session's route from Cloudflare with the binding's
+// credentials Secret or the CLOUDFLARE_* environment variables.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/duration"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const usage = `Usage:
+  sessionctl list [-n NAMESPACE | -A]
+  sessionctl describe NAME [-n NAMESPACE]
+  sessionctl extend NAME --by DURATION [-n NAMESPACE]
+  sessionctl expire NAME [-n NAMESPACE]
+`
+
+const fieldManager = "sessionctl"
+
+// options are the flags of every command.
+type options struct {
+	namespace     string
+	allNamespaces bool
+	kubeconfig    string
+	context       string
+	by            time.Duration
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	command := os.Args[1]
+	var opts options
+	fs := flag.NewFlagSet("sessionctl "+command, flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	fs.StringVar(&opts.namespace, "n", "", "Namespace; defaults to the kubeconfig context's.")
+	fs.StringVar(&opts.namespace, "namespace", "", "Namespace; defaults to the kubeconfig context's.")
+	fs.StringVar(&opts.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file.")
+	fs.StringVar(&opts.context, "context", "", "Kubeconfig context to use.")
+	switch command {
+	case "list":
+		fs.BoolVar(&opts.allNamespaces, "A", false, "List bindings in all namespaces.")
+		fs.BoolVar(&opts.allNamespaces, "all-namespaces", false, "List bindings in all namespaces.")
+	case "extend":
+		fs.DurationVar(&opts.by, "by", 0, "How much to extend the TTL by, e.g. 30m.")
+	case "describe", "expire":
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "sessionctl: unknown command %q\n%s", command, usage)
+		os.Exit(2)
+	}
+	args := parseInterspersed(fs, os.Args[2:])
+
+	c, namespace, err := newClient(opts)
+	if err != nil {
+		fail(err)
+	}
+	if opts.namespace != "" {
+		namespace = opts.namespace
+	}
+	ctx := ctrl.SetupSignalHandler()
+
+	if command == "list" {
+		if len(args) != 0 {
+			fail(errors.New("list takes no arguments"))
+		}
+		if opts.allNamespaces {
+			namespace = ""
+		}
+		err = list(ctx, c, namespace)
+	} else {
+		if len(args) != 1 {
+			fail(fmt.Errorf("%s takes exactly one binding name", command))
+		}
+		key := types.NamespacedName{Namespace: namespace, Name: args[0]}
+		switch command {
+		case "describe":
+			err = describe(ctx, c, key)
+		case "extend":
+			err = extend(ctx, c, key, opts.by)
+		case "expire":
+			err = expire(ctx, c, key)
+		}
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "sessionctl:", err)
+	os.Exit(1)
+}
+
+// parseInterspersed parses flags placed before and after the positional
+// arguments, as kubectl does, and returns the latter.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		_ = fs.Parse(args)
+		if fs.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// newClient builds a client from the kubeconfig and returns it with the
+// context's namespace.
+func newClient(opts options) (client.Client, string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = opts.kubeconfig
+	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: opts.context})
+	namespace, _, err := config.Namespace()
+	if err != nil {
+		return nil, "", err
+	}
+	restConfig, err := config.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(v1alpha1.AddToScheme(scheme))
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	return c, namespace, err
+}
+
+func list(ctx context.Context, c client.Client, namespace string) error {
+	bindings := &v1alpha1.SessionBindingList{}
+	if err := c.List(ctx, bindings, client.InNamespace(namespace)); err != nil {
+		return err
+	}
+	sort.Slice(bindings.Items, func(i, j int) bool {
+		a, b := bindings.Items[i], bindings.Items[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tSESSION\tPHASE\tTTL\tENDPOINT\tAGE")
+	now := time.Now()
+	for _, b := range bindings.Items {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", b.Namespace, b.Name, b.Spec.SessionID, orNone(string(b.Status.Phase)),
+			ttlRemaining(&b, now), orNone(b.Status.RouteEndpoint), duration.HumanDuration(now.Sub(b.CreationTimestamp.Time)))
+	}
+	return w.Flush()
+}
+
+// ttlRemaining is how long until the binding expires, for display.
+func ttlRemaining(b *v1alpha1.SessionBinding, now time.Time) string {
+	switch {
+	case b.Status.Phase == v1alpha1.SessionBindingPhaseExpired:
+		return "expired"
+	case b.Status.ExpiresAt == nil:
+		return "<none>"
+	}
+	remaining := b.Status.ExpiresAt.Sub(now)
+	if remaining <= 0 {
+		return "expiring"
+	}
+	return duration.HumanDuration(remaining)
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
+
+func describe(ctx context.Context, c client.Client, key types.NamespacedName) error {
+	b := &v1alpha1.SessionBinding{}
+	if err := c.Get(ctx, key, b); err != nil {
+		return err
+	}
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	field := func(name, value string) { fmt.Fprintf(w, "%s:\t%s\n", name, value) }
+	field("Name", b.Name)
+	field("Namespace", b.Namespace)
+	field("Session", b.Spec.SessionID)
+	field("User", orNone(b.Spec.UserID))
+	switch {
+	case b.Spec.TargetRef != nil:
+		field("Target", b.Spec.TargetRef.Kind+"/"+b.Spec.TargetRef.Name)
+	case b.Spec.PoolRef != nil:
+		field("Pool", b.Spec.PoolRef.Name)
+	case b.Spec.PodSelector != nil:
+		field("Pod selector", metav1.FormatLabelSelector(b.Spec.PodSelector))
+	}
+	field("Phase", orNone(string(b.Status.Phase)))
+	field("Age", duration.HumanDuration(now.Sub(b.CreationTimestamp.Time)))
+	if b.Status.ExpiresAt != nil {
+		field("Expires", fmt.Sprintf("%s (%s)", b.Status.ExpiresAt.UTC().Format(time.RFC3339), ttlRemaining(b, now)))
+	} else {
+		field("Expires", ttlRemaining(b, now))
+	}
+	if at := b.Status.SessionExpiresAt; at != nil {
+		remaining := "ended"
+		if d := at.Sub(now); d > 0 {
+			remaining = "in " + duration.HumanDuration(d)
+		}
+		field("Session ends", fmt.Sprintf("%s (%s)", at.UTC().Format(time.RFC3339), remaining))
+	}
+	field("Pod", orNone(b.Status.BoundPod))
+	field("Node", orNone(b.Status.BoundNode))
+	field("Endpoint", orNone(b.Status.RouteEndpoint))
+	field("Route", orNone(b.Status.RouteID))
+	field("Route health", routeHealth(ctx, c, b))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(b.Status.Conditions) > 0 {
+		fmt.Println("Conditions:")
+		w = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "  TYPE\tSTATUS\tREASON\tAGE\tMESSAGE")
+		for _, cond := range b.Status.Conditions {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", cond.Type, cond.Status, cond.Reason, duration.HumanDuration(now.Sub(cond.LastTransitionTime.Time)), cond.Message)
+		}
+		return w.Flush()
+	}
+	return nil
+}
+
+// routeHealth reads the binding's route back from Cloudflare and compares it
+// with the endpoint in its status.
+func routeHealth(ctx context.Context, c client.Client, b *v1alpha1.SessionBinding) string {
+	if b.Status.Provider == nil || b.Status.Provider.Type != cloudflare.ProviderWorkersKV {
+		return "<not routed through Cloudflare>"
+	}
+	cf, err := cloudflare.NewClientFromEnv()
+	if err != nil {
+		return "unknown: " + err.Error()
+	}
+	if ref := b.Spec.CredentialsSecretRef; ref != nil && ref.Name != "" {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: b.Namespace, Name: ref.Name}, secret); err != nil {
+			return "unknown: " + err.Error()
+		}
+		zoneTokens, err := cloudflare.ParseZoneTokens(string(secret.Data["zoneTokens"]))
+		if err != nil {
+			return "unknown: " + err.Error()
+		}
+		cf = cloudflare.NewClientWithCredentials(cloudflare.Credentials{
+			AccountID:  string(secret.Data["accountID"]),
+			APIToken:   string(secret.Data["apiToken"]),
+			APIKey:     string(secret.Data["apiKey"]),
+			Email:      string(secret.Data["email"]),
+			ZoneTokens: zoneTokens,
+		})
+	}
+
+	record, err := cf.GetRoute(ctx, b.Spec.SessionID, b.Status.RouteID)
+	switch {
+	case errors.Is(err, cloudflare.ErrUnsupported):
+		return "unknown: the route cannot be read back with these credentials"
+	case errors.Is(err, cloudflare.ErrRouteNotFound):
+		return "missing"
+	case err != nil:
+		return "unknown: " + err.Error()
+	case record.Route.Endpoint != b.Status.RouteEndpoint:
+		return fmt.Sprintf("drifted: points at %s", record.Route.Endpoint)
+	}
+	health := "in sync"
+	if verified := b.Status.Provider.LastVerifiedTime; verified != nil {
+		health += fmt.Sprintf(" (operator last verified %s ago)", duration.HumanDuration(time.Since(verified.Time)))
+	}
+	return health
+}
+
+// extend adds by to the binding's TTL; a binding without a TTL gets one
+// ending by from now.
+func extend(ctx context.Context, c client.Client, key types.NamespacedName, by time.Duration) error {
+	if by <= 0 {
+		return errors.New("--by must be positive")
+	}
+	b := &v1alpha1.SessionBinding{}
+	if err := c.Get(ctx, key, b); err != nil {
+		return err
+	}
+	if b.Status.Phase == v1alpha1.SessionBindingPhaseExpired {
+		return fmt.Errorf("SessionBinding %s has already expired", key)
+	}
+	patch := client.MergeFrom(b.DeepCopy())
+	var ttl int64
+	if b.Spec.TTLSeconds != nil {
+		ttl = *b.Spec.TTLSeconds + int64(by.Seconds())
+	} else {
+		ttl = int64(time.Since(b.CreationTimestamp.Time).Seconds() + by.Seconds())
+	}
+	b.Spec.TTLSeconds = &ttl
+	if err := c.Patch(ctx, b, patch, client.FieldOwner(fieldManager)); err != nil {
+		return err
+	}
+	expiresAt := b.CreationTimestamp.Add(time.Duration(ttl) * time.Second)
+	fmt.Printf("sessionbinding %s extended; expires at %s\n", key, expiresAt.UTC().Format(time.RFC3339))
+	return nil
+}
+
+// expire has the operator expire the binding right away.
+func expire(ctx context.Context, c client.Client, key types.NamespacedName) error {
+	b := &v1alpha1.SessionBinding{}
+	if err := c.Get(ctx, key, b); err != nil {
+		return err
+	}
+	if b.Status.Phase == v1alpha1.SessionBindingPhaseExpired {
+		fmt.Printf("sessionbinding %s already expired\n", key)
+		return nil
+	}
+	patch := client.MergeFrom(b.DeepCopy())
+	if b.Annotations == nil {
+		b.Annotations = map[string]string{}
+	}
+	b.Annotations[v1alpha1.ExpireAnnotation] = "true"
+	if err := c.Patch(ctx, b, patch, client.FieldOwner(fieldManager)); err != nil {
+		return err
+	}
+	fmt.Printf("sessionbinding %s marked for expiry\n", key)
+	return nil
+}
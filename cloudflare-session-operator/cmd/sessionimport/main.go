@@ -0,0 +1,315 @@
+// Command sessionimport onboards sessions that predate the operator by
+// creating a SessionBinding for each, read from the routes in a Workers KV
+// namespace, from the sessions of the session store or from a CSV export:
+//
+//	sessionimport --from-kv --target web
+//	sessionimport --from-sessions --session-kv-namespace-id 0f2ac74b --target web
+//	sessionimport --csv sessions.csv --namespace sessions --pool warm
+//
+// The CSV has a header row naming its columns: sessionID, and optionally
+// userID, namespace, target, pool, profile and ttlSeconds, which override
+// the flags of the same name for their row.
+//
+// Importing is idempotent: sessions that already have a binding in their
+// namespace are skipped, so an interrupted import can simply be rerun.
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// provisionedBy is the v1alpha1.ProvisionedByLabelKey value of imported
+// bindings.
+const provisionedBy = "sessionimport"
+
+const fieldManager = "cloudflare-session-import"
+
+// record is one session to import.
+type record struct {
+	SessionID  string
+	UserID     string
+	Namespace  string
+	Target     string
+	Pool       string
+	Profile    string
+	TTLSeconds *int64
+}
+
+func main() {
+	var fromKV bool
+	var kvNamespaceID string
+	var fromSessions bool
+	var sessionKVNamespaceID string
+	var csvFile string
+	var defaults record
+	var ttlSeconds int64
+	var dryRun bool
+	flag.BoolVar(&fromKV, "from-kv", false, "Import the sessions routed in Workers KV, using the CLOUDFLARE_* environment variables.")
+	flag.StringVar(&kvNamespaceID, "kv-namespace-id", "", "Workers KV namespace to list with --from-kv. Defaults to CLOUDFLARE_KV_NAMESPACE_ID.")
+	flag.BoolVar(&fromSessions, "from-sessions", false, "Import the live sessions of the session store, using the CLOUDFLARE_* environment variables.")
+	flag.StringVar(&sessionKVNamespaceID, "session-kv-namespace-id", "", "Workers KV namespace with a key per live session to list with --from-sessions.")
+	flag.StringVar(&csvFile, "csv", "", "CSV export to import, or - for standard input.")
+	flag.StringVar(&defaults.Namespace, "namespace", "default", "Namespace of the created bindings.")
+	flag.StringVar(&defaults.Target, "target", "", "Deployment the sessions' pods are cloned from.")
+	flag.StringVar(&defaults.Pool, "pool", "", "SessionPool the sessions claim their pods from, instead of --target.")
+	flag.StringVar(&defaults.Profile, "profile", "", "Resource profile of the sessions.")
+	flag.Int64Var(&ttlSeconds, "ttl-seconds", 0, "TTL of the sessions in seconds; 0 leaves it to the operator.")
+	flag.BoolVar(&dryRun, "dry-run", false, "Validate the bindings with the API server without creating them.")
+	flag.Parse()
+
+	sources := 0
+	for _, set := range []bool{fromKV, fromSessions, csvFile != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		fail(errors.New("exactly one of --from-kv, --from-sessions and --csv is required"))
+	}
+	if fromSessions && sessionKVNamespaceID == "" {
+		fail(errors.New("--from-sessions requires --session-kv-namespace-id"))
+	}
+	if ttlSeconds > 0 {
+		defaults.TTLSeconds = &ttlSeconds
+	}
+
+	ctx := ctrl.SetupSignalHandler()
+	var records []record
+	var err error
+	var cf *cloudflare.APIClient
+	if fromKV || fromSessions {
+		if cf, err = cloudflare.NewClientFromEnv(); err != nil {
+			fail(err)
+		}
+		cf.SessionKVNamespaceID = sessionKVNamespaceID
+	}
+	switch {
+	case fromKV:
+		records, err = readKV(ctx, cf, kvNamespaceID, defaults)
+	case fromSessions:
+		records, err = readSessions(ctx, cf, defaults)
+	default:
+		records, err = readCSVFile(csvFile, defaults)
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(v1alpha1.AddToScheme(scheme))
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		fail(err)
+	}
+	if dryRun {
+		c = client.NewDryRunClient(c)
+	}
+
+	imported, skipped, failed := importRecords(ctx, c, records)
+	summary := fmt.Sprintf("%d imported, %d skipped, %d failed", imported, skipped, failed)
+	if dryRun {
+		summary += " (dry run, nothing was created)"
+	}
+	fmt.Println(summary)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "sessionimport:", err)
+	os.Exit(1)
+}
+
+// readKV lists the sessions routed in the KV namespace.
+func readKV(ctx context.Context, cf cloudflare.Client, kvNamespaceID string, defaults record) ([]record, error) {
+	routes, err := cloudflare.AllRoutes(ctx, cf, kvNamespaceID)
+	if err != nil {
+		return nil, fmt.Errorf("listing Workers KV routes: %w", err)
+	}
+	records := make([]record, 0, len(routes))
+	for _, route := range routes {
+		r := defaults
+		r.SessionID = route.SessionID
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// readSessions lists the live sessions of the session store.
+func readSessions(ctx context.Context, cf cloudflare.Client, defaults record) ([]record, error) {
+	sessions, err := cloudflare.AllSessions(ctx, cf)
+	if err != nil {
+		return nil, fmt.Errorf("listing sessions: %w", err)
+	}
+	records := make([]record, 0, len(sessions))
+	for _, session := range sessions {
+		r := defaults
+		r.SessionID = session.ID
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+func readCSVFile(name string, defaults record) ([]record, error) {
+	if name == "-" {
+		return readCSV(os.Stdin, defaults)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readCSV(f, defaults)
+}
+
+// readCSV reads records from a CSV export with a header row; empty cells
+// keep the defaults.
+func readCSV(in io.Reader, defaults record) ([]record, error) {
+	rows, err := csv.NewReader(in).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("CSV export is empty")
+	}
+	columns := map[string]int{}
+	for i, name := range rows[0] {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["sessionID"]; !ok {
+		return nil, errors.New("CSV header has no sessionID column")
+	}
+
+	records := make([]record, 0, len(rows)-1)
+	for n, row := range rows[1:] {
+		cell := func(name string, dst *string) {
+			if i, ok := columns[name]; ok && strings.TrimSpace(row[i]) != "" {
+				*dst = strings.TrimSpace(row[i])
+			}
+		}
+		r := defaults
+		cell("sessionID", &r.SessionID)
+		cell("userID", &r.UserID)
+		cell("namespace", &r.Namespace)
+		cell("target", &r.Target)
+		cell("pool", &r.Pool)
+		cell("profile", &r.Profile)
+		var ttl string
+		cell("ttlSeconds", &ttl)
+		if ttl != "" {
+			seconds, err := strconv.ParseInt(ttl, 10, 64)
+			if err != nil || seconds <= 0 {
+				return nil, fmt.Errorf("line %d: invalid ttlSeconds %q", n+2, ttl)
+			}
+			r.TTLSeconds = &seconds
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// importRecords creates a binding for each record whose session has none in
+// its namespace yet.
+func importRecords(ctx context.Context, c client.Client, records []record) (imported, skipped, failed int) {
+	// Sessions with a binding, per namespace, whatever the binding's name.
+	existing := map[string]map[string]bool{}
+	for _, r := range records {
+		if r.SessionID == "" {
+			fmt.Fprintln(os.Stderr, "skipping record without a session ID")
+			failed++
+			continue
+		}
+		sessions, ok := existing[r.Namespace]
+		if !ok {
+			list := &v1alpha1.SessionBindingList{}
+			if err := c.List(ctx, list, client.InNamespace(r.Namespace)); err != nil {
+				fmt.Fprintf(os.Stderr, "session %s: listing bindings in %s: %v\n", r.SessionID, r.Namespace, err)
+				failed++
+				continue
+			}
+			sessions = map[string]bool{}
+			for _, b := range list.Items {
+				sessions[b.Spec.SessionID] = true
+			}
+			existing[r.Namespace] = sessions
+		}
+		if sessions[r.SessionID] {
+			skipped++
+			continue
+		}
+
+		binding, err := newBinding(r)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "session %s: %v\n", r.SessionID, err)
+			failed++
+			continue
+		}
+		err = c.Create(ctx, binding, client.FieldOwner(fieldManager))
+		switch {
+		case apierrors.IsAlreadyExists(err):
+			// A binding of another session took the name.
+			fmt.Fprintf(os.Stderr, "session %s: SessionBinding %s/%s already exists for another session\n", r.SessionID, binding.Namespace, binding.Name)
+			failed++
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "session %s: %v\n", r.SessionID, err)
+			failed++
+		default:
+			fmt.Printf("created SessionBinding %s/%s\n", binding.Namespace, binding.Name)
+			sessions[r.SessionID] = true
+			imported++
+		}
+	}
+	return imported, skipped, failed
+}
+
+// newBinding builds the binding of r, named after its session like those of
+// the provisioning API.
+func newBinding(r record) (*v1alpha1.SessionBinding, error) {
+	if errs := validation.IsDNS1123Subdomain(r.SessionID); len(errs) > 0 {
+		return nil, fmt.Errorf("session ID is not a valid SessionBinding name: %s", strings.Join(errs, "; "))
+	}
+	if (r.Target == "") == (r.Pool == "") {
+		return nil, errors.New("exactly one of target and pool is required")
+	}
+	binding := &v1alpha1.SessionBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: r.Namespace,
+			Name:      r.SessionID,
+			Labels:    map[string]string{v1alpha1.ProvisionedByLabelKey: provisionedBy},
+		},
+		Spec: v1alpha1.SessionBindingSpec{
+			SessionID:  r.SessionID,
+			UserID:     r.UserID,
+			Profile:    r.Profile,
+			TTLSeconds: r.TTLSeconds,
+		},
+	}
+	if r.Target != "" {
+		binding.Spec.TargetRef = &v1alpha1.TargetReference{Kind: v1alpha1.TargetKindDeployment, Name: r.Target}
+	} else {
+		binding.Spec.PoolRef = &corev1.LocalObjectReference{Name: r.Pool}
+	}
+	return binding, nil
+}
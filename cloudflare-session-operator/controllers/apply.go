@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// fieldManager is the field manager the operator writes with. Status is
+// server-side applied under it, so each reconcile states the whole status it
+// owns instead of overwriting whatever it last read.
+const fieldManager = "cloudflare-session-operator"
+
+// legacyFieldManager is the field manager the API server recorded for the
+// operator's writes before it used fieldManager: the binary name from the
+// default client-go user agent.
+var legacyFieldManager = filepath.Base(os.Args[0])
+
+// applyStatus server-side applies the status of obj, which must carry its
+// apiVersion, kind, name and namespace and nothing else but the status.
+// current is the object as last read; status fields written by the
+// operator's update-based releases are handed over to fieldManager first so
+// the apply can clear them.
+func applyStatus(ctx context.Context, c client.Client, current, obj client.Object) error {
+	if err := upgradeStatusManager(ctx, c, current); err != nil {
+		return err
+	}
+	return c.Status().Patch(ctx, obj, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+}
+
+// upgradeStatusManager converts the legacy update entry for the status
+// subresource in obj's managed fields into an apply entry of fieldManager.
+// Without it, fields the operator stops setting would stay owned by the
+// legacy manager and never be removed.
+func upgradeStatusManager(ctx context.Context, c client.Client, obj client.Object) error {
+	entries := obj.GetManagedFields()
+	legacy := -1
+	for i, entry := range entries {
+		if entry.Subresource != "status" {
+			continue
+		}
+		if entry.Manager == fieldManager && entry.Operation == metav1.ManagedFieldsOperationApply {
+			return nil
+		}
+		if entry.Manager == legacyFieldManager && entry.Operation == metav1.ManagedFieldsOperationUpdate {
+			legacy = i
+		}
+	}
+	if legacy < 0 {
+		return nil
+	}
+
+	upgraded := make([]metav1.ManagedFieldsEntry, len(entries))
+	copy(upgraded, entries)
+	upgraded[legacy].Manager = fieldManager
+	upgraded[legacy].Operation = metav1.ManagedFieldsOperationApply
+	// Replacing resourceVersion makes the patch fail with a conflict if
+	// the managed fields changed since obj was read.
+	patch, err := json.Marshal([]map[string]interface{}{
+		{"op": "replace", "path": "/metadata/managedFields", "value": upgraded},
+		{"op": "replace", "path": "/metadata/resourceVersion", "value": obj.GetResourceVersion()},
+	})
+	if err != nil {
+		return err
+	}
+	return c.Patch(ctx, obj, client.RawPatch(types.JSONPatchType, patch))
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/index"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Keys read from the Secret named by spec.credentialsSecretRef. Besides
+// the account ID, it holds an API token, a Global API Key and its email,
+// or zone-scoped tokens as parsed by cloudflare.ParseZoneTokens.
+const (
+	credentialsAccountIDKey  = "accountID"
+	credentialsAPITokenKey   = "apiToken"
+	credentialsAPIKeyKey     = "apiKey"
+	credentialsEmailKey      = "email"
+	credentialsZoneTokensKey = "zoneTokens"
+)
+
+// credentialClients caches one Cloudflare client per credentials Secret. An
+// entry is rebuilt when the Secret's resourceVersion changes and dropped when
+// the Secret is deleted.
+type credentialClients struct {
+	mu      sync.Mutex
+	clients map[types.NamespacedName]cachedClient
+}
+
+type cachedClient struct {
+	resourceVersion string
+	client          cloudflare.Client
+}
+
+func (c *credentialClients) get(secret *corev1.Secret, creds cloudflare.Credentials, build func(creds cloudflare.Credentials) cloudflare.Client) cloudflare.Client {
+	key := client.ObjectKeyFromObject(secret)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.clients[key]; ok && cached.resourceVersion == secret.ResourceVersion {
+		return cached.client
+	}
+	if c.clients == nil {
+		c.clients = map[types.NamespacedName]cachedClient{}
+	}
+	cf := build(creds)
+	c.clients[key] = cachedClient{resourceVersion: secret.ResourceVersion, client: cf}
+	return cf
+}
+
+func (c *credentialClients) forget(key types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.clients, key)
+}
+
+// cloudflareClientFor returns the client to use for binding: the operator-wide
+// client, or one built from the binding's credentials Secret.
+func (r *SessionBindingReconciler) cloudflareClientFor(ctx context.Context, binding *v1alpha1.SessionBinding) (cloudflare.Client, error) {
+	ref := binding.Spec.CredentialsSecretRef
+	if ref == nil || ref.Name == "" {
+		return r.withDryRun(r.CFClient), nil
+	}
+	key := types.NamespacedName{Namespace: binding.Namespace, Name: ref.Name}
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, key, secret); err != nil {
+		r.credentials.forget(key)
+		return nil, fmt.Errorf("get credentials secret %s: %w", key, err)
+	}
+	creds, err := credentialsFromSecret(secret)
+	if err != nil {
+		return nil, fmt.Errorf("credentials secret %s %w", key, err)
+	}
+	build := r.NewCloudflareClient
+	if build == nil {
+		build = func(creds cloudflare.Credentials) cloudflare.Client {
+			return cloudflare.NewClientWithCredentials(creds)
+		}
+	}
+	return r.withDryRun(r.credentials.get(secret, creds, build)), nil
+}
+
+// credentialsFromSecret reads the credentials in secret, which must have
+// an account ID and at least one way to authenticate.
+func credentialsFromSecret(secret *corev1.Secret) (cloudflare.Credentials, error) {
+	creds := cloudflare.Credentials{
+		AccountID: string(secret.Data[credentialsAccountIDKey]),
+		APIToken:  string(secret.Data[credentialsAPITokenKey]),
+		APIKey:    string(secret.Data[credentialsAPIKeyKey]),
+		Email:     string(secret.Data[credentialsEmailKey]),
+	}
+	if creds.AccountID == "" {
+		return cloudflare.Credentials{}, fmt.Errorf("is missing key %q", credentialsAccountIDKey)
+	}
+	if (creds.APIKey == "") != (creds.Email == "") {
+		return cloudflare.Credentials{}, fmt.Errorf("needs both %q and %q", credentialsAPIKeyKey, credentialsEmailKey)
+	}
+	zoneTokens, err := cloudflare.ParseZoneTokens(string(secret.Data[credentialsZoneTokensKey]))
+	if err != nil {
+		return cloudflare.Credentials{}, fmt.Errorf("has an invalid %q: %w", credentialsZoneTokensKey, err)
+	}
+	creds.ZoneTokens = zoneTokens
+	if creds.APIToken == "" && creds.APIKey == "" && len(creds.ZoneTokens) == 0 {
+		return cloudflare.Credentials{}, fmt.Errorf("is missing key %q, %q or %q", credentialsAPITokenKey, credentialsAPIKeyKey, credentialsZoneTokensKey)
+	}
+	return creds, nil
+}
+
+// bindingsForSecret maps a Secret event to the bindings that use it for
+// credentials, so rotated tokens are picked up without waiting for a resync.
+func (r *SessionBindingReconciler) bindingsForSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	list := &v1alpha1.SessionBindingList{}
+	if err := r.List(ctx, list, client.InNamespace(obj.GetNamespace()), client.MatchingFields{index.CredentialsSecretField: obj.GetName()}); err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for i := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+	}
+	return requests
+}
@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// drainGracePeriod returns how long the binding's pod keeps running once
+// its route is removed; zero when there is no bound pod to drain.
+func (r *SessionBindingReconciler) drainGracePeriod(binding *v1alpha1.SessionBinding) time.Duration {
+	if binding.Status.BoundPod == "" {
+		return 0
+	}
+	return r.Settings.Get().DrainGracePeriod
+}
+
+// drain moves a binding whose route has just been removed to the Draining
+// phase and returns how long until its pod may be deleted; zero once grace
+// has passed since the drain started.
+func (r *SessionBindingReconciler) drain(binding *v1alpha1.SessionBinding, grace time.Duration) time.Duration {
+	now := r.Clock.Now()
+	if binding.Status.DrainStartedAt == nil {
+		binding.Status.DrainStartedAt = &metav1.Time{Time: now}
+		r.Recorder.Event(binding, corev1.EventTypeNormal, "Draining", fmt.Sprintf("Route removed; deleting pod %s after %s", binding.Status.BoundPod, grace))
+	}
+	remaining := binding.Status.DrainStartedAt.Add(grace).Sub(now)
+	if remaining > 0 {
+		binding.Status.Phase = v1alpha1.SessionBindingPhaseDraining
+		return remaining
+	}
+	return 0
+}
@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// dryRunClient sends writes with DryRunAll, so the API server validates
+// them without persisting anything, and logs each as an intended action.
+// Status writes to the operator's own resources go through: they are where
+// a dry run reports what it would have done.
+type dryRunClient struct {
+	client.Client
+}
+
+// NewDryRunClient wraps c for the reconcilers' DryRun mode.
+func NewDryRunClient(c client.Client) client.Client {
+	return &dryRunClient{Client: c}
+}
+
+func (c *dryRunClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	recordDryRun(ctx, "create", c.describe(obj))
+	return c.Client.Create(ctx, obj, append(opts, client.DryRunAll)...)
+}
+
+func (c *dryRunClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	recordDryRun(ctx, "update", c.describe(obj))
+	return c.Client.Update(ctx, obj, append(opts, client.DryRunAll)...)
+}
+
+func (c *dryRunClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	recordDryRun(ctx, "apply", c.describe(obj))
+	return c.Client.Patch(ctx, obj, patch, append(opts, client.DryRunAll)...)
+}
+
+func (c *dryRunClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	recordDryRun(ctx, "delete", c.describe(obj))
+	return c.Client.Delete(ctx, obj, append(opts, client.DryRunAll)...)
+}
+
+func (c *dryRunClient) Status() client.SubResourceWriter {
+	return &dryRunStatusWriter{SubResourceWriter: c.Client.Status(), client: c}
+}
+
+// describe names obj as Kind namespace/name for the action log.
+func (c *dryRunClient) describe(obj client.Object) string {
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	if gvk, err := apiutil.GVKForObject(obj, c.Scheme()); err == nil {
+		kind = gvk.Kind
+	}
+	name := obj.GetName()
+	if name == "" {
+		name = obj.GetGenerateName() + "*"
+	}
+	if obj.GetNamespace() != "" {
+		name = obj.GetNamespace() + "/" + name
+	}
+	return kind + " " + name
+}
+
+type dryRunStatusWriter struct {
+	client.SubResourceWriter
+	client *dryRunClient
+}
+
+func (w *dryRunStatusWriter) ownResource(obj client.Object) bool {
+	gvk, err := apiutil.GVKForObject(obj, w.client.Scheme())
+	return err == nil && gvk.Group == v1alpha1.GroupVersion.Group
+}
+
+func (w *dryRunStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	if w.ownResource(obj) {
+		return w.SubResourceWriter.Update(ctx, obj, opts...)
+	}
+	recordDryRun(ctx, "update status of", w.client.describe(obj))
+	return w.SubResourceWriter.Update(ctx, obj, append(opts, client.DryRunAll)...)
+}
+
+func (w *dryRunStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	if w.ownResource(obj) {
+		return w.SubResourceWriter.Patch(ctx, obj, patch, opts...)
+	}
+	recordDryRun(ctx, "patch status of", w.client.describe(obj))
+	return w.SubResourceWriter.Patch(ctx, obj, patch, append(opts, client.DryRunAll)...)
+}
+
+// dryRunCloudflare only logs route writes; reads go to Cloudflare. It hides
+// any cloudflare.BatchClient of the wrapped client, so batches are logged
+// route by route.
+type dryRunCloudflare struct {
+	cloudflare.Client
+}
+
+func (c dryRunCloudflare) EnsureRoute(ctx context.Context, sessionID string, route cloudflare.Route, opts cloudflare.RouteOptions) (cloudflare.RouteRecord, error) {
+	recordDryRun(ctx, "configure", fmt.Sprintf("Cloudflare route of session %s to %s", sessionID, route.Endpoint))
+	return cloudflare.RouteRecord{ID: "dry-run/" + sessionID, Provider: cloudflare.ProviderWorkersKV}, nil
+}
+
+func (c dryRunCloudflare) DeleteRoute(ctx context.Context, sessionID, routeID string) error {
+	recordDryRun(ctx, "delete", fmt.Sprintf("Cloudflare route %s of session %s", routeID, sessionID))
+	return nil
+}
+
+// withDryRun wraps cf in dryRunCloudflare when the reconciler runs dry.
+func (r *SessionBindingReconciler) withDryRun(cf cloudflare.Client) cloudflare.Client {
+	if !r.DryRun {
+		return cf
+	}
+	return dryRunCloudflare{Client: cf}
+}
+
+type dryRunActionsKey struct{}
+
+// dryRunActions collects the actions a reconcile skipped, for the DryRun
+// condition.
+type dryRunActions struct {
+	mu      sync.Mutex
+	actions []string
+}
+
+func withDryRunActions(ctx context.Context) (context.Context, *dryRunActions) {
+	actions := &dryRunActions{}
+	return context.WithValue(ctx, dryRunActionsKey{}, actions), actions
+}
+
+func recordDryRun(ctx context.Context, verb, what string) {
+	log.FromContext(ctx).Info("dry run: skipping write", "action", verb, "object", what)
+	if actions, ok := ctx.Value(dryRunActionsKey{}).(*dryRunActions); ok {
+		actions.mu.Lock()
+		actions.actions = append(actions.actions, "would "+verb+" "+what)
+		actions.mu.Unlock()
+	}
+}
+
+// String summarises the collected actions.
+func (a *dryRunActions) String() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.actions) == 0 {
+		return "Dry run: no changes needed"
+	}
+	return "Dry run: " + strings.Join(a.actions, "; ")
+}
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/eventsink"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// eventDedupeWindow is how long an event identical to one already
+	// recorded for the same object is dropped.
+	eventDedupeWindow = 10 * time.Minute
+	// eventBurst and eventInterval rate-limit the distinct events recorded
+	// per object: up to eventBurst at once, then one per eventInterval.
+	eventBurst    = 10
+	eventInterval = 30 * time.Second
+)
+
+// Event reasons for the failure modes a binding can be stuck in.
+const (
+	reasonCloudflareError        = "CloudflareError"
+	reasonCloudflareRateLimited  = "CloudflareRateLimited"
+	reasonCloudflareUnauthorized = "CloudflareUnauthorized"
+	reasonCloudflareConflict     = "CloudflareConflict"
+	reasonCloudflareUnavailable  = "CloudflareUnavailable"
+	reasonTargetMissing          = "TargetMissing"
+	reasonQuotaExceeded          = "QuotaExceeded"
+	reasonRouteDrift             = "RouteDrift"
+)
+
+type eventKey struct {
+	uid       types.UID
+	eventtype string
+	reason    string
+	message   string
+}
+
+// eventThrottle keeps a binding that fails the same way on every requeue
+// from flooding its events: repeats of an event are dropped for
+// eventDedupeWindow, and each object gets a small budget of events on top.
+type eventThrottle struct {
+	recorder recordEventRecorder
+	clock    Clock
+
+	mu       sync.Mutex
+	sent     map[eventKey]time.Time
+	limiters map[types.UID]*rate.Limiter
+}
+
+func newEventThrottle(recorder recordEventRecorder, clock Clock) *eventThrottle {
+	return &eventThrottle{
+		recorder: recorder,
+		clock:    clock,
+		sent:     map[eventKey]time.Time{},
+		limiters: map[types.UID]*rate.Limiter{},
+	}
+}
+
+func (t *eventThrottle) Event(object runtime.Object, eventtype, reason, message string) {
+	obj, ok := object.(client.Object)
+	if !ok {
+		t.recorder.Event(object, eventtype, reason, message)
+		return
+	}
+	if t.allow(eventKey{uid: obj.GetUID(), eventtype: eventtype, reason: reason, message: message}) {
+		t.recorder.Event(object, eventtype, reason, message)
+	}
+}
+
+func (t *eventThrottle) allow(key eventKey) bool {
+	now := t.clock.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune(now)
+
+	if last, ok := t.sent[key]; ok && now.Sub(last) < eventDedupeWindow {
+		return false
+	}
+	limiter, ok := t.limiters[key.uid]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Every(eventInterval), eventBurst)
+		t.limiters[key.uid] = limiter
+	}
+	if !limiter.AllowN(now, 1) {
+		return false
+	}
+	t.sent[key] = now
+	return true
+}
+
+// prune forgets events past the dedupe window and limiters that have
+// refilled, so deleted objects do not accumulate.
+func (t *eventThrottle) prune(now time.Time) {
+	for key, last := range t.sent {
+		if now.Sub(last) >= eventDedupeWindow {
+			delete(t.sent, key)
+		}
+	}
+	for uid, limiter := range t.limiters {
+		if limiter.TokensAt(now) >= eventBurst {
+			delete(t.limiters, uid)
+		}
+	}
+}
+
+// exportTransition sends the binding's move from the previous phase to its
+// current one to the EventSink, so the lifecycle of a session can be
+// followed without its events.
+func (r *SessionBindingReconciler) exportTransition(binding *v1alpha1.SessionBinding, previous v1alpha1.SessionBindingPhase) {
+	if r.EventSink == nil {
+		return
+	}
+	eventtype := corev1.EventTypeNormal
+	if binding.Status.Phase == v1alpha1.SessionBindingPhaseError {
+		eventtype = corev1.EventTypeWarning
+	}
+	from := string(previous)
+	if from == "" {
+		from = "None"
+	}
+	r.EventSink.Emit(eventsink.Record{
+		Time:    r.Clock.Now(),
+		Kind:    eventsink.KindTransition,
+		Type:    eventtype,
+		Reason:  string(binding.Status.Phase),
+		Message: fmt.Sprintf("Session %s moved from %s to %s", binding.Spec.SessionID, from, binding.Status.Phase),
+		Object:  eventsink.Ref(binding, r.Scheme),
+		Attributes: map[string]string{
+			"session.id":             binding.Spec.SessionID,
+			"session.user_id":        binding.Spec.UserID,
+			"session.phase.previous": string(previous),
+			"session.phase":          string(binding.Status.Phase),
+			"session.route_endpoint": binding.Status.RouteEndpoint,
+			"session.bound_pod":      binding.Status.BoundPod,
+		},
+	})
+}
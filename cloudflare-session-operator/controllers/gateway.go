@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// RoutingModeGatewayAPI exposes each session through a Gateway API
+// HTTPRoute attached to SessionBindingReconciler.Gateway.
+const RoutingModeGatewayAPI = "GatewayAPI"
+
+// ProviderHTTPRoute identifies routes exposed as Gateway API HTTPRoutes.
+const ProviderHTTPRoute = "HTTPRoute"
+
+// httpRouteGVK is handled as unstructured so the operator does not depend on
+// the Gateway API module, and the HTTPRoute CRD is only needed in
+// RoutingModeGatewayAPI.
+var httpRouteGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "HTTPRoute"}
+
+// GatewayParentRef names the Gateway, and optionally its listener, session
+// HTTPRoutes attach to.
+type GatewayParentRef struct {
+	Namespace   string
+	Name        string
+	SectionName string
+}
+
+// ParseGatewayParentRef parses "namespace/name" or
+// "namespace/name/sectionName".
+func ParseGatewayParentRef(s string) (GatewayParentRef, error) {
+	parts := strings.Split(s, "/")
+	if (len(parts) != 2 && len(parts) != 3) || parts[0] == "" || parts[1] == "" {
+		return GatewayParentRef{}, fmt.Errorf("gateway %q must be namespace/name or namespace/name/sectionName", s)
+	}
+	ref := GatewayParentRef{Namespace: parts[0], Name: parts[1]}
+	if len(parts) == 3 {
+		ref.SectionName = parts[2]
+	}
+	return ref, nil
+}
+
+func newHTTPRoute() *unstructured.Unstructured {
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(httpRouteGVK)
+	return route
+}
+
+// ensureHTTPRoute applies the HTTPRoute routing opts.Hostname to the
+// binding's session Service through the configured Gateway, and records
+// whether the Gateway accepted it in the RouteAccepted condition.
+func (r *SessionBindingReconciler) ensureHTTPRoute(ctx context.Context, binding *v1alpha1.SessionBinding, port int32, opts cloudflare.RouteOptions) (cloudflare.RouteRecord, error) {
+	if opts.Hostname == "" {
+		return cloudflare.RouteRecord{}, errNoHostname
+	}
+	path := opts.PathPrefix
+	if path == "" {
+		path = "/"
+	}
+	parentRef := map[string]interface{}{
+		"group":     httpRouteGVK.Group,
+		"kind":      "Gateway",
+		"namespace": r.Gateway.Namespace,
+		"name":      r.Gateway.Name,
+	}
+	if r.Gateway.SectionName != "" {
+		parentRef["sectionName"] = r.Gateway.SectionName
+	}
+
+	route := newHTTPRoute()
+	route.SetNamespace(binding.Namespace)
+	route.SetName(sessionPodName(binding))
+	route.SetLabels(map[string]string{
+		podSessionLabelKey:             binding.Spec.SessionID,
+		"app.kubernetes.io/managed-by": "cloudflare-session-operator",
+	})
+	route.Object["spec"] = map[string]interface{}{
+		"parentRefs": []interface{}{parentRef},
+		"hostnames":  []interface{}{opts.Hostname},
+		"rules": []interface{}{map[string]interface{}{
+			"matches": []interface{}{map[string]interface{}{
+				"path": map[string]interface{}{"type": "PathPrefix", "value": path},
+			}},
+			"backendRefs": []interface{}{map[string]interface{}{
+				"name": sessionServiceName(binding),
+				"port": int64(port),
+			}},
+		}},
+	}
+	if err := controllerutil.SetControllerReference(binding, route, r.Scheme); err != nil {
+		return cloudflare.RouteRecord{}, err
+	}
+	if err := r.Patch(ctx, route, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership); err != nil {
+		return cloudflare.RouteRecord{}, fmt.Errorf("applying HTTPRoute %s: %w", route.GetName(), err)
+	}
+
+	status, reason, message := r.routeAcceptance(route)
+	r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionRouteAccepted, status, reason, message)
+	return cloudflare.RouteRecord{ID: binding.Namespace + "/" + route.GetName(), Provider: ProviderHTTPRoute}, nil
+}
+
+// routeAcceptance reads the configured Gateway's verdict on route from the
+// route's status: its Accepted condition, unless the backend reference
+// could not be resolved.
+func (r *SessionBindingReconciler) routeAcceptance(route *unstructured.Unstructured) (metav1.ConditionStatus, string, string) {
+	parents, _, _ := unstructured.NestedSlice(route.Object, "status", "parents")
+	for _, p := range parents {
+		parent, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		namespace, _, _ := unstructured.NestedString(parent, "parentRef", "namespace")
+		name, _, _ := unstructured.NestedString(parent, "parentRef", "name")
+		section, _, _ := unstructured.NestedString(parent, "parentRef", "sectionName")
+		if namespace == "" {
+			namespace = route.GetNamespace()
+		}
+		if namespace != r.Gateway.Namespace || name != r.Gateway.Name || section != r.Gateway.SectionName {
+			continue
+		}
+
+		conditions, _, _ := unstructured.NestedSlice(parent, "conditions")
+		var accepted, resolved map[string]interface{}
+		for _, c := range conditions {
+			cond, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch cond["type"] {
+			case "Accepted":
+				accepted = cond
+			case "ResolvedRefs":
+				resolved = cond
+			}
+		}
+		if resolved != nil && resolved["status"] == string(metav1.ConditionFalse) {
+			accepted = resolved
+		}
+		if accepted == nil {
+			break
+		}
+		status, _ := accepted["status"].(string)
+		reason, _ := accepted["reason"].(string)
+		message, _ := accepted["message"].(string)
+		if reason == "" {
+			reason = "Unknown"
+		}
+		return metav1.ConditionStatus(status), reason, fmt.Sprintf("Gateway %s/%s: %s", r.Gateway.Namespace, r.Gateway.Name, message)
+	}
+	return metav1.ConditionUnknown, "Pending", fmt.Sprintf("Gateway %s/%s has not processed the HTTPRoute yet", r.Gateway.Namespace, r.Gateway.Name)
+}
+
+// deleteHTTPRoute removes the binding's HTTPRoute.
+func (r *SessionBindingReconciler) deleteHTTPRoute(ctx context.Context, binding *v1alpha1.SessionBinding) error {
+	route := newHTTPRoute()
+	route.SetNamespace(binding.Namespace)
+	route.SetName(sessionPodName(binding))
+	if err := r.Delete(ctx, route); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
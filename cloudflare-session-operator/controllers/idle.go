@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// LastActivityAnnotation is set by session workloads on their own pod to an
+// RFC 3339 timestamp of the last user activity. Bindings with
+// spec.idleTimeoutSeconds expire once it is older than the timeout.
+const LastActivityAnnotation = "cloudflare.example.com/last-activity"
+
+func idleTimeout(binding *v1alpha1.SessionBinding) (time.Duration, bool) {
+	if binding.Spec.IdleTimeoutSeconds == nil || *binding.Spec.IdleTimeoutSeconds <= 0 {
+		return 0, false
+	}
+	return time.Duration(*binding.Spec.IdleTimeoutSeconds) * time.Second, true
+}
+
+// observeActivity returns the most recent activity seen for the binding and
+// records it in status.lastActivityTime. The binding's creation counts as
+// activity, so a pod that never reports is idle from the start; timestamps
+// only move forward, so an annotation lost with a replaced pod doesn't reset
+// the clock backwards.
+func (r *SessionBindingReconciler) observeActivity(ctx context.Context, binding *v1alpha1.SessionBinding) (time.Time, error) {
+	last := binding.CreationTimestamp.Time
+	if t := binding.Status.LastActivityTime; t != nil && t.After(last) {
+		last = t.Time
+	}
+
+	if binding.Status.BoundPod != "" {
+		pod := &corev1.Pod{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: binding.Namespace, Name: binding.Status.BoundPod}, pod)
+		switch {
+		case apierrors.IsNotFound(err):
+		case err != nil:
+			return time.Time{}, err
+		default:
+			if t, err := time.Parse(time.RFC3339, pod.Annotations[LastActivityAnnotation]); err == nil && t.After(last) {
+				last = t
+			}
+		}
+	}
+
+	binding.Status.LastActivityTime = &metav1.Time{Time: last}
+	return last, nil
+}
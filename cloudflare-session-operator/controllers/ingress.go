@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Values of SessionBindingReconciler.RoutingMode.
+const (
+	// RoutingModeCloudflare programs session routes through the Cloudflare
+	// API. It is the default.
+	RoutingModeCloudflare = "Cloudflare"
+	// RoutingModeIngress exposes each session through an Ingress for its
+	// hostname, for clusters whose Cloudflare tunnel ends at a shared
+	// ingress controller.
+	RoutingModeIngress = "Ingress"
+)
+
+// ProviderIngress identifies routes exposed as Ingress objects.
+const ProviderIngress = "Ingress"
+
+var errNoHostname = errors.New("no route hostname: set spec.route.hostname or the OperatorConfig routeHostnameTemplate")
+
+// routesThroughCluster reports whether session routes are Kubernetes
+// objects pointing at the per-session Service rather than Cloudflare
+// routes.
+func (r *SessionBindingReconciler) routesThroughCluster() bool {
+	return r.RoutingMode == RoutingModeIngress || r.RoutingMode == RoutingModeGatewayAPI
+}
+
+// ensureIngressRoute applies the Ingress routing opts.Hostname to the
+// binding's session Service.
+func (r *SessionBindingReconciler) ensureIngressRoute(ctx context.Context, binding *v1alpha1.SessionBinding, opts cloudflare.RouteOptions) (cloudflare.RouteRecord, error) {
+	if opts.Hostname == "" {
+		return cloudflare.RouteRecord{}, errNoHostname
+	}
+	path := opts.PathPrefix
+	if path == "" {
+		path = "/"
+	}
+	pathType := networkingv1.PathTypePrefix
+
+	ingress := &networkingv1.Ingress{
+		TypeMeta: metav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "Ingress"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: binding.Namespace,
+			Name:      sessionPodName(binding),
+			Labels: map[string]string{
+				podSessionLabelKey:             binding.Spec.SessionID,
+				"app.kubernetes.io/managed-by": "cloudflare-session-operator",
+			},
+		},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{
+				Host: opts.Hostname,
+				IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{{
+						Path:     path,
+						PathType: &pathType,
+						Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+							Name: sessionServiceName(binding),
+							Port: networkingv1.ServiceBackendPort{Name: sessionServicePortName},
+						}},
+					}},
+				}},
+			}},
+		},
+	}
+	if r.IngressClassName != "" {
+		ingress.Spec.IngressClassName = &r.IngressClassName
+	}
+	if err := controllerutil.SetControllerReference(binding, ingress, r.Scheme); err != nil {
+		return cloudflare.RouteRecord{}, err
+	}
+	if err := r.Patch(ctx, ingress, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership); err != nil {
+		return cloudflare.RouteRecord{}, fmt.Errorf("applying Ingress %s: %w", ingress.Name, err)
+	}
+	return cloudflare.RouteRecord{ID: binding.Namespace + "/" + ingress.Name, Provider: ProviderIngress}, nil
+}
+
+// deleteIngressRoute removes the binding's Ingress.
+func (r *SessionBindingReconciler) deleteIngressRoute(ctx context.Context, binding *v1alpha1.SessionBinding) error {
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: binding.Namespace, Name: sessionPodName(binding)}}
+	if err := r.Delete(ctx, ingress); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var janitorLog = ctrl.Log.WithName("route-janitor")
+
+// runRouteJanitor collects orphaned routes every RouteJanitorInterval
+// until ctx is done. Like the pod sweeper it only runs on the leader.
+func (r *SessionBindingReconciler) runRouteJanitor(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := r.collectOrphanedRoutes(ctx); err != nil {
+			janitorLog.Error(err, "failed to collect orphaned Cloudflare routes")
+		}
+	}, r.RouteJanitorInterval)
+	return nil
+}
+
+// collectOrphanedRoutes deletes the routes in the configured KV namespace
+// that belong to no binding: neither their ID is a binding's status.routeID
+// nor their session a binding's, which covers routes written just before
+// their status was. Routes are leaked this way by force-deleted bindings
+// and by bindings removed while the operator was not running.
+func (r *SessionBindingReconciler) collectOrphanedRoutes(ctx context.Context) error {
+	// Every page is listed before any route is deleted, so deletions do not
+	// shift the pages still to come.
+	routes, err := cloudflare.AllRoutes(ctx, r.CFClient, r.Settings.Get().KVNamespaceID)
+	if errors.Is(err, cloudflare.ErrUnsupported) {
+		janitorLog.V(1).Info("Cloudflare client cannot list routes; skipping")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Listed after the routes, so bindings that wrote a route since are
+	// included.
+	bindings := &v1alpha1.SessionBindingList{}
+	if err := r.List(ctx, bindings); err != nil {
+		return err
+	}
+	sessions := map[string]bool{}
+	routeIDs := map[string]bool{}
+	for i := range bindings.Items {
+		sessions[bindings.Items[i].Spec.SessionID] = true
+		if id := bindings.Items[i].Status.RouteID; id != "" {
+			routeIDs[id] = true
+		}
+	}
+
+	var orphans []cloudflare.RouteRecord
+	for _, route := range routes {
+		if route.SessionID == "" || sessions[route.SessionID] || routeIDs[route.ID] {
+			continue
+		}
+		orphanedRoutes.WithLabelValues("found").Inc()
+		if r.RouteJanitorDryRun || r.DryRun {
+			janitorLog.Info("dry run: not deleting orphaned route", "route", route.ID, "sessionID", route.SessionID)
+			continue
+		}
+		orphans = append(orphans, route)
+	}
+
+	// Deleted in a batch, so a mass expiry does not cost a call per route.
+	err = cloudflare.DeleteRoutes(ctx, r.CFClient, orphans)
+	var failed cloudflare.RouteErrors
+	if err != nil && !errors.As(err, &failed) {
+		return fmt.Errorf("deleting %d orphaned routes: %w", len(orphans), err)
+	}
+	for i, route := range orphans {
+		if err := failed[i]; err != nil {
+			janitorLog.Error(err, "failed to delete orphaned route", "route", route.ID, "sessionID", route.SessionID)
+			continue
+		}
+		janitorLog.Info("deleted orphaned route", "route", route.ID, "sessionID", route.SessionID)
+		orphanedRoutes.WithLabelValues("deleted").Inc()
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// sessionPodsRecreated counts session pods recreated after the bound pod
+	// was deleted out from under its binding.
+	sessionPodsRecreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cloudflare_session_pods_recreated_total",
+		Help: "Number of session pods recreated after the bound pod was deleted.",
+	})
+
+	// boundPodsRecreatedExternally counts bound pods found recreated under
+	// the same name by something other than the operator.
+	boundPodsRecreatedExternally = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cloudflare_session_bound_pods_recreated_externally_total",
+		Help: "Number of bound session pods found recreated under the same name outside the operator.",
+	})
+
+	// notificationsSent counts binding notifications by result: delivered,
+	// failed after every retry, or dropped with the queue full.
+	notificationsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloudflare_session_notifications_total",
+		Help: "Number of SessionBinding webhook notifications by result.",
+	}, []string{"result"})
+
+	// sessionAttachDuration observes how long bindings take from creation to
+	// their first Bound phase.
+	sessionAttachDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "cloudflare_session_attach_duration_seconds",
+		Help:    "Time from SessionBinding creation until it was first Bound.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	})
+
+	// routeSyncErrors counts failed attempts to configure a binding's
+	// Cloudflare route.
+	routeSyncErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cloudflare_session_route_sync_errors_total",
+		Help: "Number of failed attempts to configure a SessionBinding's Cloudflare route.",
+	})
+
+	// routeDriftRepairs counts session routes found out of sync with their
+	// endpoint and rewritten; a steady rate means something else writes
+	// them.
+	routeDriftRepairs = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cloudflare_session_route_drift_repairs_total",
+		Help: "Number of drifted SessionBinding routes that were repaired.",
+	})
+
+	// cleanupRetriesExhausted counts deleted bindings whose route cleanup
+	// failed CleanupRetryBudget times, which wait for the force-delete
+	// annotation from then on.
+	cleanupRetriesExhausted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cloudflare_session_cleanup_retries_exhausted_total",
+		Help: "Number of deleted SessionBindings whose route cleanup exhausted its retry budget.",
+	})
+
+	// sessionExpirations counts bindings expired by the operator, by the
+	// reason recorded on the binding (Expired for the TTL, IdleTimeout,
+	// ForceExpired, SessionExpired, SessionRevoked).
+	sessionExpirations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloudflare_session_expirations_total",
+		Help: "Number of SessionBindings expired by the operator, by reason.",
+	}, []string{"reason"})
+
+	// orphanedSessionPods counts session pods found without a controller,
+	// by whether they were adopted by their binding or deleted.
+	orphanedSessionPods = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloudflare_session_orphaned_pods_total",
+		Help: "Number of session pods found without a controlling SessionBinding, by action (adopted, deleted).",
+	}, []string{"action"})
+
+	// orphanedRoutes counts Cloudflare routes the route janitor found
+	// without a binding, and those it deleted.
+	orphanedRoutes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloudflare_session_orphaned_routes_total",
+		Help: "Number of Cloudflare routes found without a SessionBinding, by action (found, deleted).",
+	}, []string{"action"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(sessionPodsRecreated, boundPodsRecreatedExternally, notificationsSent, sessionAttachDuration, routeSyncErrors, routeDriftRepairs, cleanupRetriesExhausted, sessionExpirations, orphanedSessionPods, orphanedRoutes)
+}
+
+// sessionBindingPhases are reported by phaseCollector even when no binding
+// is in them, so the series do not disappear.
+var sessionBindingPhases = []v1alpha1.SessionBindingPhase{
+	v1alpha1.SessionBindingPhasePending,
+	v1alpha1.SessionBindingPhaseBound,
+	v1alpha1.SessionBindingPhaseExpired,
+	v1alpha1.SessionBindingPhaseError,
+	v1alpha1.SessionBindingPhaseDraining,
+	v1alpha1.SessionBindingPhaseTerminating,
+}
+
+// stuckPhases are the phases bindings are reported stuck in by
+// phaseCollector once they stayed in them for longer than its stuckAfter.
+var stuckPhases = []v1alpha1.SessionBindingPhase{
+	v1alpha1.SessionBindingPhasePending,
+	v1alpha1.SessionBindingPhaseError,
+}
+
+var (
+	bindingsDesc = prometheus.NewDesc(
+		"cloudflare_session_bindings",
+		"Number of SessionBindings by phase.",
+		[]string{"phase"}, nil,
+	)
+	stuckBindingsDesc = prometheus.NewDesc(
+		"cloudflare_session_bindings_stuck",
+		"Number of SessionBindings in the Pending or Error phase for longer than the stuck threshold, by phase.",
+		[]string{"phase"}, nil,
+	)
+	cleanupExhaustedDesc = prometheus.NewDesc(
+		"cloudflare_session_bindings_cleanup_exhausted",
+		"Number of deleted SessionBindings whose route cleanup exhausted its retry budget and that wait for the force-delete annotation.",
+		nil, nil,
+	)
+	routeDriftedDesc = prometheus.NewDesc(
+		"cloudflare_session_bindings_route_drifted",
+		"Number of SessionBindings whose route was found drifted and not repaired yet.",
+		nil, nil,
+	)
+)
+
+// phaseCollector reports SessionBindings by phase from the manager's cache
+// at scrape time, which stays accurate across restarts and deletions in a
+// way counting phase transitions would not. Bindings without a phase yet
+// count as Pending.
+//
+// Next to them it reports the bindings that need a human: stuck in Pending
+// or Error for longer than stuckAfter, whose route cleanup used up
+// cleanupBudget, or whose route drifted; alerts on these gauges being
+// above zero cover the bindings the operator cannot fix on its own.
+type phaseCollector struct {
+	reader        client.Reader
+	clock         Clock
+	stuckAfter    time.Duration
+	cleanupBudget int32
+}
+
+func (c *phaseCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- bindingsDesc
+	ch <- stuckBindingsDesc
+	ch <- cleanupExhaustedDesc
+	ch <- routeDriftedDesc
+}
+
+func (c *phaseCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	list := &v1alpha1.SessionBindingList{}
+	if err := c.reader.List(ctx, list); err != nil {
+		for _, desc := range []*prometheus.Desc{bindingsDesc, stuckBindingsDesc, cleanupExhaustedDesc, routeDriftedDesc} {
+			ch <- prometheus.NewInvalidMetric(desc, err)
+		}
+		return
+	}
+	now := c.clock.Now()
+	counts := map[v1alpha1.SessionBindingPhase]int{}
+	stuck := map[v1alpha1.SessionBindingPhase]int{}
+	var cleanupExhausted, routeDrifted int
+	for i := range list.Items {
+		binding := &list.Items[i]
+		phase := binding.Status.Phase
+		if phase == "" {
+			phase = v1alpha1.SessionBindingPhasePending
+		}
+		counts[phase]++
+		if (phase == v1alpha1.SessionBindingPhasePending || phase == v1alpha1.SessionBindingPhaseError) && now.Sub(phaseSince(binding)) > c.stuckAfter {
+			stuck[phase]++
+		}
+		if !binding.DeletionTimestamp.IsZero() && binding.Status.CleanupAttempts >= c.cleanupBudget {
+			cleanupExhausted++
+		}
+		if meta.IsStatusConditionTrue(binding.Status.Conditions, v1alpha1.ConditionRouteDrift) {
+			routeDrifted++
+		}
+	}
+	for _, phase := range sessionBindingPhases {
+		ch <- prometheus.MustNewConstMetric(bindingsDesc, prometheus.GaugeValue, float64(counts[phase]), string(phase))
+	}
+	for _, phase := range stuckPhases {
+		ch <- prometheus.MustNewConstMetric(stuckBindingsDesc, prometheus.GaugeValue, float64(stuck[phase]), string(phase))
+	}
+	ch <- prometheus.MustNewConstMetric(cleanupExhaustedDesc, prometheus.GaugeValue, float64(cleanupExhausted))
+	ch <- prometheus.MustNewConstMetric(routeDriftedDesc, prometheus.GaugeValue, float64(routeDrifted))
+}
+
+// phaseSince returns when the binding entered its phase. Bindings last
+// written before status.phaseTransitionTime existed fall back to when they
+// finished, or were created.
+func phaseSince(binding *v1alpha1.SessionBinding) time.Time {
+	switch {
+	case binding.Status.PhaseTransitionTime != nil:
+		return binding.Status.PhaseTransitionTime.Time
+	case binding.Status.FinishedAt != nil:
+		return binding.Status.FinishedAt.Time
+	}
+	return binding.CreationTimestamp.Time
+}
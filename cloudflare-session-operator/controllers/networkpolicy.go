@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// syncSessionNetworkPolicy applies the NetworkPolicy isolating the binding's
+// session pods when the OperatorConfig asks for one, and deletes it when it
+// no longer does. Pods picked through spec.podSelector are shared workload
+// pods and are left alone.
+func (r *SessionBindingReconciler) syncSessionNetworkPolicy(ctx context.Context, binding *v1alpha1.SessionBinding) error {
+	config := r.Settings.Get().NetworkPolicy
+	if config == nil || binding.Spec.PodSelector != nil {
+		return r.deleteSessionNetworkPolicy(ctx, binding)
+	}
+
+	policy := &networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: binding.Namespace,
+			Name:      sessionPodName(binding),
+			Labels: map[string]string{
+				podSessionLabelKey:             binding.Spec.SessionID,
+				"app.kubernetes.io/managed-by": "cloudflare-session-operator",
+			},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{podSessionLabelKey: binding.Spec.SessionID}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress:     []networkingv1.NetworkPolicyIngressRule{{From: namespacePeers(config.IngressNamespaces)}},
+		},
+	}
+	if len(config.EgressCIDRs) > 0 || len(config.EgressNamespaces) > 0 {
+		peers := namespacePeers(config.EgressNamespaces)
+		for _, cidr := range config.EgressCIDRs {
+			peers = append(peers, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}})
+		}
+		udp, tcp, dns := corev1.ProtocolUDP, corev1.ProtocolTCP, intstr.FromInt32(53)
+		policy.Spec.PolicyTypes = append(policy.Spec.PolicyTypes, networkingv1.PolicyTypeEgress)
+		policy.Spec.Egress = []networkingv1.NetworkPolicyEgressRule{
+			{To: peers},
+			{Ports: []networkingv1.NetworkPolicyPort{{Protocol: &udp, Port: &dns}, {Protocol: &tcp, Port: &dns}}},
+		}
+	}
+	if err := controllerutil.SetControllerReference(binding, policy, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.Patch(ctx, policy, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership); err != nil {
+		return fmt.Errorf("applying NetworkPolicy %s: %w", policy.Name, err)
+	}
+	return nil
+}
+
+// deleteSessionNetworkPolicy removes the binding's NetworkPolicy, if it has
+// one.
+func (r *SessionBindingReconciler) deleteSessionNetworkPolicy(ctx context.Context, binding *v1alpha1.SessionBinding) error {
+	policy := &networkingv1.NetworkPolicy{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: binding.Namespace, Name: sessionPodName(binding)}, policy); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(policy, binding) {
+		return nil
+	}
+	if err := r.Delete(ctx, policy); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// namespacePeers selects all pods in each of the namespaces.
+func namespacePeers(namespaces []string) []networkingv1.NetworkPolicyPeer {
+	peers := make([]networkingv1.NetworkPolicyPeer, 0, len(namespaces))
+	for _, ns := range namespaces {
+		peers = append(peers, networkingv1.NetworkPolicyPeer{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{corev1.LabelMetadataName: ns}},
+		})
+	}
+	return peers
+}
@@ -0,0 +1,342 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Keys read from a notification Secret: spec.notificationSecretRef or the
+// namespace's v1alpha1.NamespaceNotificationSecretName.
+const (
+	// notificationURLKey is the webhook URL.
+	notificationURLKey = "url"
+	// notificationFormatKey is NotificationFormatGeneric (the default) or
+	// NotificationFormatSlack.
+	notificationFormatKey = "format"
+	// notificationTemplateKey is an optional text/template rendering a
+	// notification: the whole body in the Generic format, the message text
+	// in the Slack one.
+	notificationTemplateKey = "template"
+)
+
+// Notification formats.
+const (
+	// NotificationFormatGeneric posts the notification as JSON.
+	NotificationFormatGeneric = "Generic"
+	// NotificationFormatSlack posts a Slack incoming webhook message.
+	NotificationFormatSlack = "Slack"
+)
+
+// Transitions a binding notifies about.
+const (
+	notificationBound    = "Bound"
+	notificationExpiring = "Expiring"
+	notificationExpired  = "Expired"
+	notificationError    = "Error"
+)
+
+const (
+	// notificationQueueSize bounds the notifications waiting for delivery;
+	// more are dropped.
+	notificationQueueSize = 100
+	notificationWorkers   = 4
+	// notificationAttempts are made per notification, notificationBackoff
+	// apart at first and twice as far apart after each failure.
+	notificationAttempts = 5
+	notificationBackoff  = time.Second
+	notificationTimeout  = 10 * time.Second
+)
+
+var notifierLog = ctrl.Log.WithName("notifier")
+
+// notification is what a binding's webhook is told, and the data of its
+// template.
+type notification struct {
+	Event         string     `json:"event"`
+	Namespace     string     `json:"namespace"`
+	Name          string     `json:"name"`
+	SessionID     string     `json:"sessionID"`
+	UserID        string     `json:"userID,omitempty"`
+	Phase         string     `json:"phase"`
+	RouteEndpoint string     `json:"routeEndpoint,omitempty"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
+	Message       string     `json:"message"`
+	Time          time.Time  `json:"time"`
+}
+
+// notificationEvents returns the transitions from previous to the binding's
+// current status that are notified about.
+func notificationEvents(previous, current *v1alpha1.SessionBindingStatus) []string {
+	var events []string
+	if current.Phase != previous.Phase {
+		switch current.Phase {
+		case v1alpha1.SessionBindingPhaseBound:
+			events = append(events, notificationBound)
+		case v1alpha1.SessionBindingPhaseExpired:
+			events = append(events, notificationExpired)
+		case v1alpha1.SessionBindingPhaseError:
+			events = append(events, notificationError)
+		}
+	}
+	if isExpiring(current) && !isExpiring(previous) {
+		events = append(events, notificationExpiring)
+	}
+	return events
+}
+
+func isExpiring(status *v1alpha1.SessionBindingStatus) bool {
+	cond := meta.FindStatusCondition(status.Conditions, v1alpha1.ConditionTTLExpiring)
+	return cond != nil && cond.Status == metav1.ConditionTrue && cond.Reason == "TTLExpiring"
+}
+
+// notificationMessage describes event for a person.
+func notificationMessage(binding *v1alpha1.SessionBinding, event string) string {
+	status := &binding.Status
+	switch event {
+	case notificationBound:
+		return fmt.Sprintf("Session %s is ready at %s", binding.Spec.SessionID, status.RouteEndpoint)
+	case notificationExpiring:
+		return meta.FindStatusCondition(status.Conditions, v1alpha1.ConditionTTLExpiring).Message
+	case notificationExpired:
+		if cond := meta.FindStatusCondition(status.Conditions, v1alpha1.ConditionPodReady); cond != nil {
+			return cond.Message
+		}
+		return fmt.Sprintf("Session %s expired", binding.Spec.SessionID)
+	}
+	for _, t := range []string{v1alpha1.ConditionSessionDiscovered, v1alpha1.ConditionPodReady, v1alpha1.ConditionRouteConfigured} {
+		if cond := meta.FindStatusCondition(status.Conditions, t); cond != nil && cond.Status != metav1.ConditionTrue {
+			return cond.Message
+		}
+	}
+	return fmt.Sprintf("Session %s failed", binding.Spec.SessionID)
+}
+
+// notificationConfig is the parsed content of a notification Secret.
+type notificationConfig struct {
+	url      string
+	format   string
+	template *template.Template
+}
+
+// notificationConfigFor reads the binding's notification Secret; nil when
+// neither the binding nor its namespace configure one.
+func (r *SessionBindingReconciler) notificationConfigFor(ctx context.Context, binding *v1alpha1.SessionBinding) (*notificationConfig, error) {
+	name := v1alpha1.NamespaceNotificationSecretName
+	if ref := binding.Spec.NotificationSecretRef; ref != nil && ref.Name != "" {
+		name = ref.Name
+	}
+	key := types.NamespacedName{Namespace: binding.Namespace, Name: name}
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, key, secret); err != nil {
+		if apierrors.IsNotFound(err) && binding.Spec.NotificationSecretRef == nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get notification secret %s: %w", key, err)
+	}
+
+	cfg := &notificationConfig{url: string(secret.Data[notificationURLKey]), format: string(secret.Data[notificationFormatKey])}
+	if cfg.url == "" {
+		return nil, fmt.Errorf("notification secret %s is missing key %q", key, notificationURLKey)
+	}
+	switch cfg.format {
+	case "":
+		cfg.format = NotificationFormatGeneric
+	case NotificationFormatGeneric, NotificationFormatSlack:
+	default:
+		return nil, fmt.Errorf("notification secret %s has unknown format %q", key, cfg.format)
+	}
+	if text := string(secret.Data[notificationTemplateKey]); text != "" {
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("notification secret %s has an invalid template: %w", key, err)
+		}
+		cfg.template = tmpl
+	}
+	return cfg, nil
+}
+
+// render builds the request body of n.
+func (c *notificationConfig) render(n notification) ([]byte, error) {
+	var text string
+	if c.template != nil {
+		var b strings.Builder
+		if err := c.template.Execute(&b, n); err != nil {
+			return nil, err
+		}
+		text = b.String()
+	}
+	switch {
+	case c.format == NotificationFormatSlack && text == "":
+		text = fmt.Sprintf("[%s/%s] %s", n.Namespace, n.Name, n.Message)
+		fallthrough
+	case c.format == NotificationFormatSlack:
+		return json.Marshal(map[string]string{"text": text})
+	case text != "":
+		return []byte(text), nil
+	}
+	return json.Marshal(n)
+}
+
+// notifyTransitions queues the notifications for the transitions from
+// previous to the binding's status, once that status has been written.
+// Problems are reported on the binding but never fail its reconcile.
+func (r *SessionBindingReconciler) notifyTransitions(ctx context.Context, previous *v1alpha1.SessionBindingStatus, binding *v1alpha1.SessionBinding) {
+	events := notificationEvents(previous, &binding.Status)
+	if len(events) == 0 || r.notifier == nil {
+		return
+	}
+	cfg, err := r.notificationConfigFor(ctx, binding)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "failed to load notification webhook")
+		r.Recorder.Event(binding, corev1.EventTypeWarning, "NotificationFailed", err.Error())
+		return
+	}
+	if cfg == nil {
+		return
+	}
+
+	for _, event := range events {
+		n := notification{
+			Event:         event,
+			Namespace:     binding.Namespace,
+			Name:          binding.Name,
+			SessionID:     binding.Spec.SessionID,
+			UserID:        binding.Spec.UserID,
+			Phase:         string(binding.Status.Phase),
+			RouteEndpoint: binding.Status.RouteEndpoint,
+			Message:       notificationMessage(binding, event),
+			Time:          r.Clock.Now().UTC(),
+		}
+		if binding.Status.ExpiresAt != nil {
+			expiresAt := binding.Status.ExpiresAt.UTC()
+			n.ExpiresAt = &expiresAt
+		}
+		body, err := cfg.render(n)
+		if err != nil {
+			r.Recorder.Event(binding, corev1.EventTypeWarning, "NotificationFailed", fmt.Sprintf("Failed to render %s notification: %v", event, err))
+			continue
+		}
+		if r.DryRun {
+			recordDryRun(ctx, "send", event+" notification")
+			continue
+		}
+		r.notifier.enqueue(delivery{binding: binding.DeepCopy(), event: event, url: cfg.url, body: body})
+	}
+}
+
+type delivery struct {
+	binding *v1alpha1.SessionBinding
+	event   string
+	url     string
+	body    []byte
+}
+
+// notifier posts notifications to their webhooks in the background, so a
+// slow webhook never holds up a reconcile, retrying failed deliveries with
+// exponential backoff. As a leader election runnable it only runs on the
+// leader, which is the only replica queueing notifications.
+type notifier struct {
+	client   *http.Client
+	recorder recordEventRecorder
+	queue    chan delivery
+}
+
+func newNotifier(recorder recordEventRecorder) *notifier {
+	return &notifier{
+		client:   &http.Client{Timeout: notificationTimeout},
+		recorder: recorder,
+		queue:    make(chan delivery, notificationQueueSize),
+	}
+}
+
+func (n *notifier) enqueue(d delivery) {
+	select {
+	case n.queue <- d:
+	default:
+		notifierLog.Info("notification queue full; dropping notification", "namespace", d.binding.Namespace, "binding", d.binding.Name, "event", d.event)
+		notificationsSent.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Start implements manager.Runnable.
+func (n *notifier) Start(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i := 0; i < notificationWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case d := <-n.queue:
+					n.deliver(ctx, d)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+func (n *notifier) deliver(ctx context.Context, d delivery) {
+	backoff := notificationBackoff
+	var err error
+	for attempt := 1; attempt <= notificationAttempts; attempt++ {
+		var retry bool
+		if retry, err = n.post(ctx, d); err == nil {
+			notificationsSent.WithLabelValues("delivered").Inc()
+			return
+		}
+		if !retry || attempt == notificationAttempts {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff *= 2
+	}
+	notifierLog.Error(err, "failed to deliver notification", "namespace", d.binding.Namespace, "binding", d.binding.Name, "event", d.event)
+	n.recorder.Event(d.binding, corev1.EventTypeWarning, "NotificationFailed", fmt.Sprintf("Failed to deliver %s notification: %v", d.event, err))
+	notificationsSent.WithLabelValues("failed").Inc()
+}
+
+// post makes one delivery attempt; retry reports whether a failure may be
+// transient.
+func (n *notifier) post(ctx context.Context, d delivery) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(d.body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return false, fmt.Errorf("webhook returned %s", resp.Status)
+}
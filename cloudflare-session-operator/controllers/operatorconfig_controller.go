@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/diagnostics"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/operatorconfig"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// OperatorConfigReconciler applies the singleton OperatorConfig to the
+// shared settings store. It runs on every replica, not just the leader, so
+// webhooks served by standby replicas see the same settings.
+type OperatorConfigReconciler struct {
+	client.Client
+	Settings *operatorconfig.Store
+	// Breaker, when set, is the Cloudflare circuit breaker whose state the
+	// leader reports in the CloudflareAvailable condition.
+	Breaker *cloudflare.CircuitBreaker
+}
+
+//+kubebuilder:rbac:groups=cloudflare.example.com,resources=operatorconfigs,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups=cloudflare.example.com,resources=operatorconfigs/status,verbs=get;update;patch
+
+func (r *OperatorConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithValues("operatorConfig", req.Name)
+	if req.Name != v1alpha1.OperatorConfigName {
+		return ctrl.Result{}, nil
+	}
+
+	config := &v1alpha1.OperatorConfig{}
+	if err := r.Get(ctx, req.NamespacedName, config); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.Settings.Update(nil)
+			logger.Info("OperatorConfig not found; using command-line settings")
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	settings := r.Settings.Update(&config.Spec)
+	logger.Info("applied OperatorConfig", "generation", config.Generation,
+		"pendingRequeueInterval", settings.PendingRequeueInterval, "errorRequeueInterval", settings.ErrorRequeueInterval,
+		"defaultTTLSeconds", settings.DefaultTTLSeconds, "maxConcurrentReconciles", settings.MaxConcurrentReconciles)
+
+	config.Status.ObservedGeneration = config.Generation
+	meta.SetStatusCondition(&config.Status.Conditions, metav1.Condition{
+		Type:    v1alpha1.ConditionConfigApplied,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Applied",
+		Message: "Settings are in effect",
+	})
+	return ctrl.Result{}, r.patchStatus(ctx, config)
+}
+
+func (r *OperatorConfigReconciler) patchStatus(ctx context.Context, config *v1alpha1.OperatorConfig) error {
+	current := &v1alpha1.OperatorConfig{}
+	if err := r.Get(ctx, types.NamespacedName{Name: config.Name}, current); err != nil {
+		return err
+	}
+
+	if equality.Semantic.DeepEqual(current.Status, config.Status) {
+		return nil
+	}
+
+	return applyStatus(ctx, r.Client, current, &v1alpha1.OperatorConfig{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v1alpha1.GroupVersion.String(), Kind: "OperatorConfig"},
+		ObjectMeta: metav1.ObjectMeta{Name: config.Name},
+		Status:     config.Status,
+	})
+}
+
+// reportBreaker keeps the OperatorConfig's CloudflareAvailable condition
+// in line with the circuit breaker, on every change of its state and every
+// breakerReportInterval, which catches an OperatorConfig created since. As
+// a leader election runnable it only runs on the leader, the replica making
+// Cloudflare calls.
+func (r *OperatorConfigReconciler) reportBreaker(ctx context.Context) error {
+	ticker := time.NewTicker(breakerReportInterval)
+	defer ticker.Stop()
+	for {
+		if err := r.setBreakerCondition(ctx); err != nil {
+			log.FromContext(ctx).Error(err, "failed to report the Cloudflare circuit breaker state")
+		}
+		select {
+		case <-r.Breaker.Changed():
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// breakerReportInterval is how often reportBreaker reports without a
+// change of state.
+const breakerReportInterval = time.Minute
+
+func (r *OperatorConfigReconciler) setBreakerCondition(ctx context.Context) error {
+	config := &v1alpha1.OperatorConfig{}
+	if err := r.Get(ctx, types.NamespacedName{Name: v1alpha1.OperatorConfigName}, config); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	cond := metav1.Condition{
+		Type:    v1alpha1.ConditionCloudflareAvailable,
+		Status:  metav1.ConditionTrue,
+		Reason:  "BreakerClosed",
+		Message: "Cloudflare calls go through",
+	}
+	switch state, until := r.Breaker.State(); state {
+	case cloudflare.BreakerOpen:
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "BreakerOpen"
+		cond.Message = fmt.Sprintf("Cloudflare calls fail fast after repeated failures until %s", until.UTC().Format(time.RFC3339))
+	case cloudflare.BreakerHalfOpen:
+		cond.Status = metav1.ConditionUnknown
+		cond.Reason = "BreakerHalfOpen"
+		cond.Message = "Probing whether Cloudflare recovered"
+	}
+	meta.SetStatusCondition(&config.Status.Conditions, cond)
+	return r.patchStatus(ctx, config)
+}
+
+func (r *OperatorConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Breaker != nil {
+		if err := mgr.Add(manager.RunnableFunc(r.reportBreaker)); err != nil {
+			return err
+		}
+	}
+	needLeaderElection := false
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.OperatorConfig{}).
+		WithOptions(controller.Options{NeedLeaderElection: &needLeaderElection}).
+		Complete(diagnostics.Track("operatorconfig", r))
+}
+
+// reconcileGate bounds concurrent reconciles by a limit that can change at
+// runtime, since controller-runtime fixes a controller's worker count when
+// it is built.
+type reconcileGate struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+}
+
+func newReconcileGate(limit int) *reconcileGate {
+	g := &reconcileGate{limit: limit}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+func (g *reconcileGate) acquire() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for g.active >= g.limit {
+		g.cond.Wait()
+	}
+	g.active++
+}
+
+func (g *reconcileGate) release() {
+	g.mu.Lock()
+	g.active--
+	g.mu.Unlock()
+	g.cond.Broadcast()
+}
+
+func (g *reconcileGate) resize(limit int) {
+	g.mu.Lock()
+	g.limit = limit
+	g.mu.Unlock()
+	g.cond.Broadcast()
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/index"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// orphanSweepInterval is how often session pods are checked against their
+// bindings, in step with the cache resync period.
+const orphanSweepInterval = 5 * time.Minute
+
+var sweeperLog = ctrl.Log.WithName("pod-sweeper")
+
+// runPodSweeper sweeps session pods once the caches have synced and then
+// every orphanSweepInterval until ctx is done. As a leader election
+// runnable it only runs on the leader.
+func (r *SessionBindingReconciler) runPodSweeper(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := r.sweepSessionPods(ctx); err != nil {
+			sweeperLog.Error(err, "failed to sweep session pods")
+		}
+	}, orphanSweepInterval)
+	return nil
+}
+
+// sweepSessionPods catches session pods that events alone would leak: pods
+// left without a controller, for instance by an orphaning delete, are
+// adopted by the active binding of their session or deleted when it is
+// gone, and bindings whose status does not know their live pod are
+// requeued.
+func (r *SessionBindingReconciler) sweepSessionPods(ctx context.Context) error {
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.HasLabels{podSessionLabelKey}); err != nil {
+		return err
+	}
+	stale := map[types.UID]*v1alpha1.SessionBinding{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !pod.DeletionTimestamp.IsZero() || isUnmanaged(pod) {
+			continue
+		}
+		ref := metav1.GetControllerOf(pod)
+		if ref == nil {
+			if err := r.adoptOrDeletePod(ctx, pod); err != nil {
+				sweeperLog.Error(err, "failed to collect orphaned session pod", "namespace", pod.Namespace, "pod", pod.Name)
+			}
+			continue
+		}
+		if ref.Kind != "SessionBinding" || ref.APIVersion != v1alpha1.GroupVersion.String() {
+			continue
+		}
+		binding := &v1alpha1.SessionBinding{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: ref.Name}, binding); err != nil {
+			// A missing owner is left to the garbage collector.
+			if !apierrors.IsNotFound(err) {
+				sweeperLog.Error(err, "failed to get SessionBinding of session pod", "namespace", pod.Namespace, "pod", pod.Name)
+			}
+			continue
+		}
+		if binding.UID == ref.UID && index.IsActive(binding) && binding.Status.BoundPod == "" {
+			stale[binding.UID] = binding
+		}
+	}
+	for _, binding := range stale {
+		sweeperLog.Info("requeueing SessionBinding with an unrecorded session pod", "namespace", binding.Namespace, "binding", binding.Name)
+		select {
+		case r.requeue <- event.GenericEvent{Object: binding}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+// adoptOrDeletePod hands a session pod without a controller to the active
+// binding of its session in the pod's namespace, or deletes it when there
+// is none. The adoption itself triggers a reconcile of the binding through
+// its pod watch.
+func (r *SessionBindingReconciler) adoptOrDeletePod(ctx context.Context, pod *corev1.Pod) error {
+	sessionID := pod.Labels[podSessionLabelKey]
+	active, err := index.ActiveBindingsForSession(ctx, r, sessionID)
+	if err != nil {
+		return err
+	}
+	var binding *v1alpha1.SessionBinding
+	for i := range active {
+		if active[i].Namespace == pod.Namespace {
+			binding = &active[i]
+			break
+		}
+	}
+
+	if binding == nil {
+		if err := r.Delete(ctx, pod, client.Preconditions{UID: &pod.UID}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		sweeperLog.Info("deleted orphaned session pod", "namespace", pod.Namespace, "pod", pod.Name, "sessionID", sessionID)
+		orphanedSessionPods.WithLabelValues("deleted").Inc()
+		return nil
+	}
+
+	if err := controllerutil.SetControllerReference(binding, pod, r.Scheme); err != nil {
+		return err
+	}
+	// The update carries the pod's resourceVersion, so it fails rather
+	// than adopt a pod another controller claimed in the meantime.
+	if err := r.Update(ctx, pod, client.FieldOwner(fieldManager)); err != nil {
+		return err
+	}
+	sweeperLog.Info("adopted orphaned session pod", "namespace", pod.Namespace, "pod", pod.Name, "binding", binding.Name)
+	r.Recorder.Event(binding, corev1.EventTypeNormal, "PodAdopted", fmt.Sprintf("Adopted orphaned pod %s", pod.Name))
+	orphanedSessionPods.WithLabelValues("adopted").Inc()
+	return nil
+}
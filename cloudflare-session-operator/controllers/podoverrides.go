@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"strings"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// applyPodOverrides merges spec.podOverrides into the template cloned from the
+// target deployment. It runs before the operator's own labels, annotations and
+// env vars are set so overrides cannot hijack them.
+func applyPodOverrides(template *corev1.PodTemplateSpec, overrides *v1alpha1.PodOverrides) {
+	if overrides == nil {
+		return
+	}
+	if len(overrides.Labels) > 0 && template.Labels == nil {
+		template.Labels = map[string]string{}
+	}
+	for k, v := range overrides.Labels {
+		template.Labels[k] = v
+	}
+	if len(overrides.Annotations) > 0 && template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	for k, v := range overrides.Annotations {
+		template.Annotations[k] = v
+	}
+
+	if overrides.ServiceAccountName != "" {
+		template.Spec.ServiceAccountName = overrides.ServiceAccountName
+		template.Spec.DeprecatedServiceAccount = ""
+	}
+	if overrides.PodSecurityContext != nil {
+		template.Spec.SecurityContext = overrides.PodSecurityContext.DeepCopy()
+	}
+
+	for i := range template.Spec.Containers {
+		c := &template.Spec.Containers[i]
+		if overrides.SecurityContext != nil {
+			c.SecurityContext = overrides.SecurityContext.DeepCopy()
+		}
+		if overrides.Resources != nil {
+			c.Resources = *overrides.Resources.DeepCopy()
+		}
+		for _, v := range overrides.Env {
+			c.Env = setEnvVar(c.Env, *v.DeepCopy())
+		}
+		if overrides.ImageTag != "" {
+			c.Image = withImageTag(c.Image, overrides.ImageTag)
+		}
+	}
+}
+
+// applyScheduling applies the binding's scheduling constraints to the cloned
+// template: node selectors are merged, tolerations appended, and affinity and
+// topology spread constraints replaced when set.
+func applyScheduling(template *corev1.PodTemplateSpec, spec *v1alpha1.SessionBindingSpec) {
+	if len(spec.NodeSelector) > 0 && template.Spec.NodeSelector == nil {
+		template.Spec.NodeSelector = map[string]string{}
+	}
+	for k, v := range spec.NodeSelector {
+		template.Spec.NodeSelector[k] = v
+	}
+	for _, t := range spec.Tolerations {
+		template.Spec.Tolerations = append(template.Spec.Tolerations, *t.DeepCopy())
+	}
+	if spec.Affinity != nil {
+		template.Spec.Affinity = spec.Affinity.DeepCopy()
+	}
+	if len(spec.TopologySpreadConstraints) > 0 {
+		template.Spec.TopologySpreadConstraints = nil
+		for _, c := range spec.TopologySpreadConstraints {
+			template.Spec.TopologySpreadConstraints = append(template.Spec.TopologySpreadConstraints, *c.DeepCopy())
+		}
+	}
+}
+
+// withImageTag replaces the tag or digest of image with tag, leaving a
+// registry port ("registry:5000/app") alone.
+func withImageTag(image, tag string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image + ":" + tag
+}
+
+// applyPriorityClass sets the pod's priority class to className, falling
+// back to defaultClassName and then the template's own. The template's
+// resolved priority is dropped so admission fills it in for the new class.
+func applyPriorityClass(template *corev1.PodTemplateSpec, className, defaultClassName string) {
+	if className == "" {
+		className = defaultClassName
+	}
+	if className == "" || className == template.Spec.PriorityClassName {
+		return
+	}
+	template.Spec.PriorityClassName = className
+	template.Spec.Priority = nil
+	template.Spec.PreemptionPolicy = nil
+}
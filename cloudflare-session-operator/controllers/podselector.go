@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// selectSessionPod picks a ready pod matching spec.podSelector for bindings
+// that route to existing pods instead of cloning one. The currently bound pod
+// is kept while it still matches and is ready, so routes don't flap; otherwise
+// the oldest ready pod wins. It returns nil when no pod is ready.
+func (r *SessionBindingReconciler) selectSessionPod(ctx context.Context, binding *v1alpha1.SessionBinding) (*corev1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(binding.Spec.PodSelector)
+	if err != nil {
+		return nil, err
+	}
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(binding.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+
+	var ready []*corev1.Pod
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !pod.DeletionTimestamp.IsZero() || !isPodReady(pod) {
+			continue
+		}
+		if pod.Name == binding.Status.BoundPod {
+			return pod, nil
+		}
+		ready = append(ready, pod)
+	}
+	if len(ready) == 0 {
+		return nil, nil
+	}
+	sort.Slice(ready, func(i, j int) bool {
+		a, b := ready[i], ready[j]
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			return a.CreationTimestamp.Before(&b.CreationTimestamp)
+		}
+		return a.Name < b.Name
+	})
+	return ready[0], nil
+}
+
+// bindingsForPod maps a pod event to the selector-mode bindings in its
+// namespace whose podSelector matches it, since those pods are not owned by
+// the binding and would otherwise not trigger a reconcile.
+func (r *SessionBindingReconciler) bindingsForPod(ctx context.Context, obj client.Object) []reconcile.Request {
+	list := &v1alpha1.SessionBindingList{}
+	if err := r.List(ctx, list, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range list.Items {
+		binding := &list.Items[i]
+		if binding.Spec.PodSelector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(binding.Spec.PodSelector)
+		if err != nil || !selector.Matches(labels.Set(obj.GetLabels())) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(binding)})
+	}
+	return requests
+}
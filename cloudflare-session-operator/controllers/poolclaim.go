@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// claimPoolPod returns the session pod of a binding with spec.poolRef: one it
+// already owns (claimed earlier or cloned on a cold start), otherwise the
+// oldest ready standby pod of the pool, which it takes over. It returns nil
+// when the pool has no ready standby pod, leaving the caller to cold start.
+//
+// A claimed pod keeps running as is, so unlike cloned pods it does not get
+// SESSION_ID injected; workloads can read the session from the pod's
+// cloudflare.example.com/session-id annotation via the downward API.
+func (r *SessionBindingReconciler) claimPoolPod(ctx context.Context, logger logr.Logger, binding *v1alpha1.SessionBinding) (*corev1.Pod, error) {
+	cold := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: binding.Namespace, Name: sessionPodName(binding)}, cold); err == nil {
+		if metav1.IsControlledBy(cold, binding) {
+			return cold, nil
+		}
+	} else if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	pods, err := r.poolPods(ctx, binding)
+	if err != nil {
+		return nil, err
+	}
+	var standby []*corev1.Pod
+	for i := range pods {
+		pod := &pods[i]
+		if metav1.IsControlledBy(pod, binding) {
+			return pod, nil
+		}
+		if pod.Labels[v1alpha1.PoolStateLabelKey] == v1alpha1.PoolStateWarm && pod.DeletionTimestamp.IsZero() && isPodReady(pod) && !isUnmanaged(pod) {
+			standby = append(standby, pod)
+		}
+	}
+	if len(standby) == 0 {
+		return nil, nil
+	}
+	sort.Slice(standby, func(i, j int) bool {
+		return standby[i].CreationTimestamp.Before(&standby[j].CreationTimestamp)
+	})
+
+	pod := standby[0]
+	owners := pod.OwnerReferences[:0]
+	for _, ref := range pod.OwnerReferences {
+		if ref.Controller == nil || !*ref.Controller {
+			owners = append(owners, ref)
+		}
+	}
+	pod.OwnerReferences = owners
+	if err := controllerutil.SetControllerReference(binding, pod, r.Scheme); err != nil {
+		return nil, err
+	}
+	pod.Labels[v1alpha1.PoolStateLabelKey] = v1alpha1.PoolStateClaimed
+	pod.Labels[podSessionLabelKey] = binding.Spec.SessionID
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[podSessionLabelKey] = binding.Spec.SessionID
+
+	// The update carries the pod's resourceVersion, so two bindings racing
+	// for the same standby pod cannot both win.
+	if err := r.Update(ctx, pod, client.FieldOwner(fieldManager)); err != nil {
+		return nil, err
+	}
+	logger.Info("claimed standby pod from pool", "pool", binding.Spec.PoolRef.Name, "pod", pod.Name)
+	r.Recorder.Event(binding, corev1.EventTypeNormal, "PodClaimed", fmt.Sprintf("Claimed standby pod %s from pool %s for session %s", pod.Name, binding.Spec.PoolRef.Name, binding.Spec.SessionID))
+	return pod, nil
+}
+
+// poolPods lists the pods of the binding's SessionPool, standby and claimed.
+func (r *SessionBindingReconciler) poolPods(ctx context.Context, binding *v1alpha1.SessionBinding) ([]corev1.Pod, error) {
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(binding.Namespace), client.MatchingLabels{v1alpha1.PoolLabelKey: binding.Spec.PoolRef.Name}); err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
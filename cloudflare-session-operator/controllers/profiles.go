@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+// ResourceProfiles maps a profile name (spec.profile) to the requests and
+// limits applied to every container of a session pod.
+type ResourceProfiles map[string]corev1.ResourceRequirements
+
+// DefaultResourceProfiles returns the built-in small/medium/large sizes used
+// when the operator is not given a profiles file.
+func DefaultResourceProfiles() ResourceProfiles {
+	size := func(reqCPU, reqMem, limCPU, limMem string) corev1.ResourceRequirements {
+		return corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(reqCPU),
+				corev1.ResourceMemory: resource.MustParse(reqMem),
+			},
+			Limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(limCPU),
+				corev1.ResourceMemory: resource.MustParse(limMem),
+			},
+		}
+	}
+	return ResourceProfiles{
+		"small":  size("100m", "128Mi", "500m", "512Mi"),
+		"medium": size("500m", "512Mi", "1", "1Gi"),
+		"large":  size("1", "2Gi", "2", "4Gi"),
+	}
+}
+
+// LoadResourceProfiles reads profiles from a YAML or JSON file of the form
+// {small: {requests: {...}, limits: {...}}, ...}.
+func LoadResourceProfiles(path string) (ResourceProfiles, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	profiles := ResourceProfiles{}
+	if err := yaml.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("parse resource profiles %s: %w", path, err)
+	}
+	return profiles, nil
+}
+
+// resolveProfile returns the profile that applies to binding: spec.profile,
+// or the operator default when unset. An empty name means no profile.
+func (r *SessionBindingReconciler) resolveProfile(binding *v1alpha1.SessionBinding) (string, *corev1.ResourceRequirements, error) {
+	name := binding.Spec.Profile
+	if name == "" {
+		name = r.DefaultProfile
+	}
+	if name == "" {
+		return "", nil, nil
+	}
+	profiles := r.ResourceProfiles
+	if profiles == nil {
+		profiles = DefaultResourceProfiles()
+	}
+	res, ok := profiles[name]
+	if !ok {
+		return name, nil, fmt.Errorf("resource profile %q is not configured", name)
+	}
+	return name, &res, nil
+}
+
+func applyProfileResources(template *corev1.PodTemplateSpec, res *corev1.ResourceRequirements) {
+	if res == nil {
+		return
+	}
+	for i := range template.Spec.Containers {
+		template.Spec.Containers[i].Resources = *res.DeepCopy()
+	}
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func hasRouteReadinessGate(pod *corev1.Pod) bool {
+	for _, gate := range pod.Spec.ReadinessGates {
+		if gate.ConditionType == v1alpha1.RouteReadinessGate {
+			return true
+		}
+	}
+	return false
+}
+
+// markRouteReady sets the route readiness gate of pod to True, letting the
+// kubelet report the pod Ready. Pods without the gate, and unmanaged pods,
+// are left alone.
+func (r *SessionBindingReconciler) markRouteReady(ctx context.Context, pod *corev1.Pod) error {
+	if !hasRouteReadinessGate(pod) || isUnmanaged(pod) {
+		return nil
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == v1alpha1.RouteReadinessGate && cond.Status == corev1.ConditionTrue {
+			return nil
+		}
+	}
+
+	base := pod.DeepCopy()
+	condition := corev1.PodCondition{
+		Type:               v1alpha1.RouteReadinessGate,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Time{Time: r.Clock.Now()},
+		Reason:             "RouteConfigured",
+		Message:            "Session route configured",
+	}
+	replaced := false
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == condition.Type {
+			pod.Status.Conditions[i] = condition
+			replaced = true
+		}
+	}
+	if !replaced {
+		pod.Status.Conditions = append(pod.Status.Conditions, condition)
+	}
+	// Pod conditions merge by type, so the patch leaves the kubelet's
+	// conditions alone.
+	return r.Status().Patch(ctx, pod, client.StrategicMergeFrom(base), client.FieldOwner(fieldManager))
+}
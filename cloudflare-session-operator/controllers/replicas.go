@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// replicaLabelKey carries the index of a session's additional pods, those
+// beyond the bound pod when spec.replicas is above 1.
+const replicaLabelKey = "cloudflare.example.com/session-replica"
+
+// desiredReplicas returns spec.replicas, which defaults to 1.
+func desiredReplicas(binding *v1alpha1.SessionBinding) int {
+	if binding.Spec.Replicas == nil || *binding.Spec.Replicas < 1 {
+		return 1
+	}
+	return int(*binding.Spec.Replicas)
+}
+
+// sessionReplicaName names the session's i-th additional pod.
+func sessionReplicaName(binding *v1alpha1.SessionBinding, i int) string {
+	return fmt.Sprintf("%s-replica-%d", sessionPodName(binding), i)
+}
+
+func isSessionReplica(pod *corev1.Pod) bool {
+	_, ok := pod.Labels[replicaLabelKey]
+	return ok
+}
+
+// usesSessionService reports whether the session is routed to its Service
+// rather than straight to the bound pod. Sessions with several replicas
+// always are, so the Service balances across them, except in
+// RoutingModeTunnel where their tunnel does.
+func (r *SessionBindingReconciler) usesSessionService(binding *v1alpha1.SessionBinding) bool {
+	if r.RoutingMode == RoutingModeTunnel {
+		return r.SessionServiceType != ""
+	}
+	return r.SessionServiceType != "" || r.routesThroughCluster() || desiredReplicas(binding) > 1
+}
+
+// syncReplicas creates the session's missing additional pods from the
+// current template and deletes those beyond spec.replicas, returning the
+// live ones. On a template change stale replicas are replaced one at a
+// time, once all others are ready.
+func (r *SessionBindingReconciler) syncReplicas(ctx context.Context, logger logr.Logger, binding *v1alpha1.SessionBinding, resources *corev1.ResourceRequirements) ([]*corev1.Pod, error) {
+	want := desiredReplicas(binding) - 1
+	pods, err := r.controlledSessionPods(ctx, binding)
+	if err != nil {
+		return nil, err
+	}
+	byIndex := map[int]*corev1.Pod{}
+	for _, pod := range pods {
+		if !isSessionReplica(pod) {
+			continue
+		}
+		if i, err := strconv.Atoi(pod.Labels[replicaLabelKey]); err == nil && i >= 1 && i <= want {
+			byIndex[i] = pod
+			continue
+		}
+		if !pod.DeletionTimestamp.IsZero() || isUnmanaged(pod) {
+			continue
+		}
+		if err := r.Delete(ctx, pod); err != nil && !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		logger.Info("deleted session replica beyond spec.replicas", "pod", pod.Name, "replicas", want+1)
+	}
+	if want == 0 {
+		return nil, nil
+	}
+
+	var live, stale []*corev1.Pod
+	settled := true
+	template, err := r.newSessionPod(ctx, binding, resources)
+	if err != nil {
+		// The bound pod reports the error; keep the replicas meanwhile.
+		logger.Error(err, "failed to resolve pod template; keeping session replicas as they are")
+		for _, pod := range byIndex {
+			if pod.DeletionTimestamp.IsZero() {
+				live = append(live, pod)
+			}
+		}
+		return live, nil
+	}
+	hash := template.Annotations[templateHashAnnotation]
+	for i := 1; i <= want; i++ {
+		pod := byIndex[i]
+		switch {
+		case pod == nil:
+			replica := template.DeepCopy()
+			replica.Name = sessionReplicaName(binding, i)
+			replica.Labels[replicaLabelKey] = strconv.Itoa(i)
+			// Already existing means the cache has not seen the pod yet.
+			if err := r.Create(ctx, replica, client.FieldOwner(fieldManager)); err != nil && !apierrors.IsAlreadyExists(err) {
+				return nil, err
+			}
+			settled = false
+		case !pod.DeletionTimestamp.IsZero():
+			// Recreated once it is gone.
+			settled = false
+		default:
+			live = append(live, pod)
+			if h := pod.Annotations[templateHashAnnotation]; h != "" && h != hash && !isUnmanaged(pod) {
+				stale = append(stale, pod)
+			} else if !isPodReady(pod) {
+				settled = false
+			}
+		}
+	}
+	if len(stale) > 0 && settled {
+		if err := r.Delete(ctx, stale[0]); err != nil && !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		r.Recorder.Event(binding, corev1.EventTypeNormal, "PodReplaced", fmt.Sprintf("Pod template changed; replacing session replica %s", stale[0].Name))
+	}
+	return live, nil
+}
+
+// setReplicaStatus records how many of pod and its replicas are live and
+// ready, and the selector of the session's pods.
+func setReplicaStatus(binding *v1alpha1.SessionBinding, pod *corev1.Pod, replicas []*corev1.Pod) {
+	binding.Status.Selector = labels.Set{podSessionLabelKey: binding.Spec.SessionID}.String()
+	binding.Status.Replicas, binding.Status.ReadyReplicas = 0, 0
+	if pod == nil {
+		return
+	}
+	for _, p := range append([]*corev1.Pod{pod}, replicas...) {
+		binding.Status.Replicas++
+		if isPodReady(p) {
+			binding.Status.ReadyReplicas++
+		}
+	}
+}
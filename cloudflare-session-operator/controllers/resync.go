@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"time"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare"
+)
+
+// DefaultResyncJitterFraction is used when the reconciler is not configured
+// with a ResyncJitterFraction.
+const DefaultResyncJitterFraction = 0.1
+
+// unauthorizedRequeueFactor stretches the error requeue interval of
+// bindings whose Cloudflare credentials were refused.
+const unauthorizedRequeueFactor = 10
+
+// resyncAfter stretches the periodic requeue interval d by a share of up to
+// the jitter fraction that is fixed per binding, so bindings created or
+// retried together drift apart instead of hitting Cloudflare in lockstep
+// every interval.
+func (r *SessionBindingReconciler) resyncAfter(binding *v1alpha1.SessionBinding, d time.Duration) time.Duration {
+	fraction := r.ResyncJitterFraction
+	if fraction <= 0 || fraction >= 1 {
+		fraction = DefaultResyncJitterFraction
+	}
+	h := fnv.New32a()
+	h.Write([]byte(binding.UID))
+	share := float64(h.Sum32()) / math.MaxUint32
+	return d + time.Duration(float64(d)*fraction*share)
+}
+
+// cloudflareRetry classifies an error of a Cloudflare call made for
+// binding: the reason it is reported under and when the binding is retried.
+// Calls rejected by the open circuit breaker wait until it lets calls
+// through again and rate limited ones as long as Cloudflare asks. Refused
+// credentials wait for a change of their Secret, which is watched, or a long
+// interval, and conflicting writes are retried soon, reading what they
+// clashed with. Any other error is retried after the error requeue interval.
+func (r *SessionBindingReconciler) cloudflareRetry(binding *v1alpha1.SessionBinding, err error) (reason string, after time.Duration) {
+	settings := r.Settings.Get()
+	switch {
+	case errors.Is(err, cloudflare.ErrCircuitOpen):
+		after = settings.ErrorRequeueInterval
+		if d, ok := cloudflare.RetryAfter(err); ok {
+			after = d
+		}
+		return reasonCloudflareUnavailable, r.resyncAfter(binding, after)
+	case errors.Is(err, cloudflare.ErrRateLimited):
+		after = settings.ErrorRequeueInterval
+		if d, ok := cloudflare.RetryAfter(err); ok {
+			after = d
+		}
+		return reasonCloudflareRateLimited, r.resyncAfter(binding, after)
+	case errors.Is(err, cloudflare.ErrUnauthorized):
+		return reasonCloudflareUnauthorized, r.resyncAfter(binding, unauthorizedRequeueFactor*settings.ErrorRequeueInterval)
+	case errors.Is(err, cloudflare.ErrConflict):
+		return reasonCloudflareConflict, settings.PendingRequeueInterval
+	}
+	return reasonCloudflareError, r.resyncAfter(binding, settings.ErrorRequeueInterval)
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// isFinished reports whether the binding is in a phase retention applies to.
+func isFinished(binding *v1alpha1.SessionBinding) bool {
+	return binding.Status.Phase == v1alpha1.SessionBindingPhaseExpired || binding.Status.Phase == v1alpha1.SessionBindingPhaseError
+}
+
+// recordFinished sets status.finishedAt when the binding enters a finished
+// phase and clears it when the binding leaves it, e.g. after recovering from
+// an error.
+func recordFinished(binding *v1alpha1.SessionBinding, now time.Time) {
+	switch {
+	case !isFinished(binding):
+		binding.Status.FinishedAt = nil
+	case binding.Status.FinishedAt == nil:
+		binding.Status.FinishedAt = &metav1.Time{Time: now}
+	}
+}
+
+// finishedRetention returns how long a finished binding is kept, from
+// spec.ttlSecondsAfterFinished or the operator default; ok is false when it
+// is kept until deleted.
+func (r *SessionBindingReconciler) finishedRetention(binding *v1alpha1.SessionBinding) (time.Duration, bool) {
+	if binding.Spec.TTLSecondsAfterFinished != nil {
+		return time.Duration(*binding.Spec.TTLSecondsAfterFinished) * time.Second, true
+	}
+	if seconds := r.Settings.Get().DefaultTTLSecondsAfterFinished; seconds > 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	return 0, false
+}
+
+// deleteAfterRetention deletes a finished binding whose retention has
+// elapsed, reporting whether it did, and otherwise makes sure result
+// requeues the binding by the time it elapses.
+func (r *SessionBindingReconciler) deleteAfterRetention(ctx context.Context, logger logr.Logger, binding *v1alpha1.SessionBinding, result ctrl.Result) (bool, ctrl.Result, error) {
+	if binding.Status.FinishedAt == nil {
+		return false, result, nil
+	}
+	retention, ok := r.finishedRetention(binding)
+	if !ok {
+		return false, result, nil
+	}
+	remaining := binding.Status.FinishedAt.Add(retention).Sub(r.Clock.Now())
+	if remaining > 0 {
+		return false, requeueBefore(result, remaining), nil
+	}
+
+	logger.Info("retention of finished SessionBinding elapsed; deleting it", "phase", binding.Status.Phase, "finishedAt", binding.Status.FinishedAt.Time)
+	// The finalizer still runs, so anything left of the session is cleaned
+	// up as for any other deletion.
+	if err := r.Delete(ctx, binding, client.Preconditions{UID: &binding.UID}); err != nil && !apierrors.IsNotFound(err) {
+		return false, result, err
+	}
+	r.Recorder.Event(binding, corev1.EventTypeNormal, "RetentionElapsed", fmt.Sprintf("Deleted %s after %s in phase %s", binding.Name, retention, binding.Status.Phase))
+	return true, ctrl.Result{}, nil
+}
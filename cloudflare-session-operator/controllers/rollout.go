@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// templateHashAnnotation records on a session pod the hash of the resolved
+// template it was created from.
+const templateHashAnnotation = "cloudflare.example.com/template-hash"
+
+// podTemplateHash hashes the parts of pod that come from the resolved
+// template, so a change to the target, overrides or operator defaults
+// yields a different hash.
+func podTemplateHash(pod *corev1.Pod) (string, error) {
+	data, err := json.Marshal(struct {
+		Labels      map[string]string `json:"labels"`
+		Annotations map[string]string `json:"annotations"`
+		Spec        corev1.PodSpec    `json:"spec"`
+	}{pod.Labels, pod.Annotations, pod.Spec})
+	if err != nil {
+		return "", err
+	}
+	h := fnv.New32a()
+	h.Write(data)
+	return fmt.Sprintf("%08x", h.Sum32()), nil
+}
+
+// replacementPodName names the pod that replaces a session pod for the
+// template with hash; the first pod keeps the plain sessionPodName.
+func replacementPodName(binding *v1alpha1.SessionBinding, hash string) string {
+	return sessionPodName(binding) + "-" + hash
+}
+
+// currentSessionPod returns the live pod the binding is bound to, falling
+// back to another live pod it controls before status has recorded one. It
+// returns nil when the binding has no live pod. nameTaken reports whether
+// a pod, possibly terminating, still holds sessionPodName.
+func (r *SessionBindingReconciler) currentSessionPod(ctx context.Context, binding *v1alpha1.SessionBinding) (current *corev1.Pod, nameTaken bool, err error) {
+	pods, err := r.controlledSessionPods(ctx, binding)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, pod := range pods {
+		if pod.Name == sessionPodName(binding) {
+			nameTaken = true
+		}
+		if !pod.DeletionTimestamp.IsZero() || isSessionReplica(pod) {
+			continue
+		}
+		switch {
+		case pod.Name == binding.Status.BoundPod:
+			current = pod
+		case current == nil, current.Name != binding.Status.BoundPod && pod.Name == sessionPodName(binding):
+			current = pod
+		}
+	}
+	return current, nameTaken, nil
+}
+
+// controlledSessionPods lists the pods the binding controls: cloned pods,
+// their replacements and replicas, and claimed pool pods.
+func (r *SessionBindingReconciler) controlledSessionPods(ctx context.Context, binding *v1alpha1.SessionBinding) ([]*corev1.Pod, error) {
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(binding.Namespace), client.MatchingLabels{podSessionLabelKey: binding.Spec.SessionID}); err != nil {
+		return nil, err
+	}
+	var controlled []*corev1.Pod
+	for i := range pods.Items {
+		if metav1.IsControlledBy(&pods.Items[i], binding) {
+			controlled = append(controlled, &pods.Items[i])
+		}
+	}
+	return controlled, nil
+}
+
+// deleteReplacedPods finishes a rollout once the route points at pod by
+// deleting the binding's other session pods, except its replicas and
+// unmanaged pods.
+func (r *SessionBindingReconciler) deleteReplacedPods(ctx context.Context, binding *v1alpha1.SessionBinding, pod *corev1.Pod) error {
+	pods, err := r.controlledSessionPods(ctx, binding)
+	if err != nil {
+		return err
+	}
+	for _, old := range pods {
+		if old.Name == pod.Name || !old.DeletionTimestamp.IsZero() || isSessionReplica(old) || isUnmanaged(old) {
+			continue
+		}
+		if err := r.Delete(ctx, old); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		r.Recorder.Event(binding, corev1.EventTypeNormal, "PodReplaced", fmt.Sprintf("Replaced pod %s with %s", old.Name, pod.Name))
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Values of SessionBindingReconciler.SessionServiceType.
+const (
+	// SessionServiceClusterIP fronts each session with a ClusterIP Service.
+	SessionServiceClusterIP = "ClusterIP"
+	// SessionServiceHeadless fronts each session with a headless Service,
+	// whose DNS name resolves straight to the bound pod.
+	SessionServiceHeadless = "Headless"
+)
+
+const sessionServicePortName = "session"
+
+// sessionServiceName is the name of the Service, and of its EndpointSlice,
+// fronting the binding's session pod.
+func sessionServiceName(binding *v1alpha1.SessionBinding) string {
+	return sessionPodName(binding)
+}
+
+// ensureSessionService applies the binding's Service and points it at pod
+// and its ready replicas, returning the Service endpoint to route the
+// session to. The Service has no selector: its EndpointSlice lists only
+// these pods, so a rollout's replacement pod or another pod matching
+// spec.podSelector never receives the session's traffic before the binding
+// moves to it. Both objects are owned by the binding and garbage collected
+// with it.
+func (r *SessionBindingReconciler) ensureSessionService(ctx context.Context, binding *v1alpha1.SessionBinding, pod *corev1.Pod, replicas []*corev1.Pod) (string, error) {
+	name := sessionServiceName(binding)
+	port := podPort(pod)
+	labels := map[string]string{
+		podSessionLabelKey:             binding.Spec.SessionID,
+		"app.kubernetes.io/managed-by": "cloudflare-session-operator",
+	}
+
+	svc := &corev1.Service{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: binding.Namespace, Name: name, Labels: labels},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{{
+				Name:       sessionServicePortName,
+				Protocol:   corev1.ProtocolTCP,
+				Port:       port,
+				TargetPort: intstr.FromInt32(port),
+			}},
+		},
+	}
+	if r.SessionServiceType == SessionServiceHeadless {
+		svc.Spec.ClusterIP = corev1.ClusterIPNone
+	}
+	if err := controllerutil.SetControllerReference(binding, svc, r.Scheme); err != nil {
+		return "", err
+	}
+	if err := r.Patch(ctx, svc, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership); err != nil {
+		return "", fmt.Errorf("applying Service %s: %w", name, err)
+	}
+
+	addressType := discoveryv1.AddressTypeIPv4
+	if strings.Contains(pod.Status.PodIP, ":") {
+		addressType = discoveryv1.AddressTypeIPv6
+	}
+	ready := true
+	endpoint := func(p *corev1.Pod) discoveryv1.Endpoint {
+		return discoveryv1.Endpoint{
+			Addresses:  []string{p.Status.PodIP},
+			Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+			TargetRef:  &corev1.ObjectReference{Kind: "Pod", Namespace: p.Namespace, Name: p.Name, UID: p.UID},
+		}
+	}
+	endpoints := []discoveryv1.Endpoint{endpoint(pod)}
+	for _, replica := range replicas {
+		// A slice holds a single address family.
+		ipv6 := strings.Contains(replica.Status.PodIP, ":")
+		if isPodReady(replica) && replica.Status.PodIP != "" && ipv6 == (addressType == discoveryv1.AddressTypeIPv6) {
+			endpoints = append(endpoints, endpoint(replica))
+		}
+	}
+	portName, protocol := sessionServicePortName, corev1.ProtocolTCP
+	sliceLabels := map[string]string{
+		discoveryv1.LabelServiceName: name,
+		discoveryv1.LabelManagedBy:   fieldManager,
+	}
+	for k, v := range labels {
+		sliceLabels[k] = v
+	}
+	slice := &discoveryv1.EndpointSlice{
+		TypeMeta:    metav1.TypeMeta{APIVersion: "discovery.k8s.io/v1", Kind: "EndpointSlice"},
+		ObjectMeta:  metav1.ObjectMeta{Namespace: binding.Namespace, Name: name, Labels: sliceLabels},
+		AddressType: addressType,
+		Endpoints:   endpoints,
+		Ports:       []discoveryv1.EndpointPort{{Name: &portName, Protocol: &protocol, Port: &port}},
+	}
+	if err := controllerutil.SetControllerReference(binding, slice, r.Scheme); err != nil {
+		return "", err
+	}
+	if err := r.Patch(ctx, slice, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership); err != nil {
+		return "", fmt.Errorf("applying EndpointSlice %s: %w", name, err)
+	}
+
+	return fmt.Sprintf("%s.%s.svc:%d", name, binding.Namespace, port), nil
+}
+
+// deleteSessionService removes the binding's Service and EndpointSlice, if
+// any, when its session ends before the binding is deleted.
+func (r *SessionBindingReconciler) deleteSessionService(ctx context.Context, binding *v1alpha1.SessionBinding) error {
+	if !r.usesSessionService(binding) {
+		return nil
+	}
+	meta := metav1.ObjectMeta{Namespace: binding.Namespace, Name: sessionServiceName(binding)}
+	for _, obj := range []client.Object{&discoveryv1.EndpointSlice{ObjectMeta: meta}, &corev1.Service{ObjectMeta: meta}} {
+		if err := r.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,11 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
 	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/diagnostics"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/eventsink"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/index"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/operatorconfig"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/policy"
 	"github.com/go-logr/logr"
+	"golang.org/x/time/rate"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
@@ -17,18 +24,37 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
-	"sigs.k8s.io/controller-runtime"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 const (
 	sessionBindingFinalizer = "sessionbinding.cloudflare.example.com/finalizer"
 	podSessionLabelKey      = "cloudflare.example.com/session-id"
+	sessionIDEnvVar         = "SESSION_ID"
+	sessionBindingEnvVar    = "SESSION_BINDING_NAME"
 )
 
+// DefaultCleanupRetryBudget is the default for
+// SessionBindingReconciler.CleanupRetryBudget.
+const DefaultCleanupRetryBudget = 5
+
+// DefaultStuckThreshold is the default for
+// SessionBindingReconciler.StuckThreshold.
+const DefaultStuckThreshold = 15 * time.Minute
+
 // SessionBindingReconciler reconciles a SessionBinding object
 type SessionBindingReconciler struct {
 	client.Client
@@ -36,6 +62,81 @@ type SessionBindingReconciler struct {
 	CFClient cloudflare.Client
 	Recorder recordEventRecorder
 	Clock    Clock
+	// TTLExpiringFraction is the share of the TTL below which the
+	// TTLExpiring condition turns True. Defaults to DefaultTTLExpiringFraction.
+	TTLExpiringFraction float64
+	// ResourceProfiles are the sizes selectable through spec.profile.
+	// Defaults to DefaultResourceProfiles.
+	ResourceProfiles ResourceProfiles
+	// DefaultProfile applies to bindings without spec.profile; empty keeps
+	// the target deployment's resources.
+	DefaultProfile string
+	// NewCloudflareClient builds clients for bindings with
+	// spec.credentialsSecretRef. Defaults to
+	// cloudflare.NewClientWithCredentials.
+	NewCloudflareClient func(creds cloudflare.Credentials) cloudflare.Client
+	// AllowCrossNamespaceTargets lets targetRef.namespace name another
+	// namespace; the target must still grant the binding's namespace via
+	// the cloudflare.example.com/allowed-namespaces annotation.
+	AllowCrossNamespaceTargets bool
+	// DefaultPriorityClassName applies to session pods of bindings without
+	// spec.priorityClassName; empty keeps the target's priority class.
+	DefaultPriorityClassName string
+	// Settings holds the runtime settings from the OperatorConfig; nil uses
+	// operatorconfig.DefaultSettings.
+	Settings *operatorconfig.Store
+	// RoutingMode is RoutingModeCloudflare (the default when empty),
+	// RoutingModeIngress, RoutingModeGatewayAPI or RoutingModeTunnel.
+	// Ingress and GatewayAPI route sessions through an Ingress or HTTPRoute
+	// per session and imply a session Service.
+	RoutingMode string
+	// IngressClassName is the ingress class of session Ingresses; empty
+	// uses the cluster default.
+	IngressClassName string
+	// Gateway is the parent of session HTTPRoutes in RoutingModeGatewayAPI.
+	Gateway GatewayParentRef
+	// SessionServiceType, when set to SessionServiceClusterIP or
+	// SessionServiceHeadless, fronts each session pod with a Service and
+	// routes the session to the Service's DNS name instead of the pod IP.
+	SessionServiceType string
+	// CleanupRetryBudget is how many failed route cleanups of a deleted
+	// binding are retried before v1alpha1.ForceDeleteAnnotation is honoured.
+	// Defaults to DefaultCleanupRetryBudget.
+	CleanupRetryBudget int
+	// StuckThreshold is how long a binding stays Pending or in Error before
+	// the cloudflare_session_bindings_stuck gauge counts it. Defaults to
+	// DefaultStuckThreshold.
+	StuckThreshold time.Duration
+	// DryRun sends all writes except status updates of the operator's own
+	// resources as dry runs and only logs Cloudflare route changes; the
+	// DryRun condition lists what a reconcile would have done.
+	DryRun bool
+	// ResyncJitterFraction is the largest share by which the periodic
+	// requeues of a binding are stretched, per binding. Defaults to
+	// DefaultResyncJitterFraction.
+	ResyncJitterFraction float64
+	// CloudflaredImage is the image of the cloudflared sidecar injected in
+	// RoutingModeTunnel. Defaults to DefaultCloudflaredImage.
+	CloudflaredImage string
+	// RouteJanitorInterval is how often Cloudflare routes are checked
+	// against the bindings and those of no binding deleted; zero disables
+	// the janitor. It must only run when the operator sees every binding
+	// that has routes in its KV namespace.
+	RouteJanitorInterval time.Duration
+	// RouteJanitorDryRun only logs and counts the orphaned routes the
+	// janitor finds, as does DryRun.
+	RouteJanitorDryRun bool
+	// RateLimiter paces the retries of failed reconciles; nil uses
+	// controller-runtime's default. See NewRateLimiter.
+	RateLimiter ratelimiter.RateLimiter
+	// EventSink, when set, is sent the phase transitions of bindings; the
+	// events they record reach it through Recorder.
+	EventSink *eventsink.Sink
+
+	credentials credentialClients
+	gate        *reconcileGate
+	requeue     chan event.GenericEvent
+	notifier    *notifier
 }
 
 type recordEventRecorder interface {
@@ -55,17 +156,48 @@ func (RealClock) Now() time.Time { return time.Now() }
 //+kubebuilder:rbac:groups=cloudflare.example.com,resources=sessionbindings,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=cloudflare.example.com,resources=sessionbindings/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=cloudflare.example.com,resources=sessionbindings/finalizers,verbs=update
+//+kubebuilder:rbac:groups=cloudflare.example.com,resources=sessionpools,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cloudflare.example.com,resources=sessionpolicies,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=pods/status,verbs=patch
+//+kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;replicasets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=services,verbs=get;create;patch;delete
+//+kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;create;patch;delete
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;patch;delete
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;create;patch;delete
+//+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;patch;delete
 //+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 func (r *SessionBindingReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
+	if r.gate != nil {
+		r.gate.acquire()
+		defer r.gate.release()
+	}
 
 	binding := &v1alpha1.SessionBinding{}
 	if err := r.Get(ctx, req.NamespacedName, binding); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	// Every log line of this reconcile, including those of helpers that
+	// take ctx, identifies the binding and its session.
+	logger = logger.WithValues("binding", req.Name, "namespace", req.Namespace)
+	ctx = log.IntoContext(ctx, logger)
+	var dryRun *dryRunActions
+	if r.DryRun {
+		ctx, dryRun = withDryRunActions(ctx)
+	}
+
+	// Unlike a paused binding, an unmanaged one is not even finalized: its
+	// deletion waits until it is handed back.
+	if isUnmanaged(binding) {
+		logger.V(1).Info("SessionBinding is unmanaged; skipping reconcile")
+		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionUnmanaged, metav1.ConditionTrue, "Unmanaged", "The binding is annotated "+v1alpha1.ManagedAnnotation+"=false; the operator does not change it, its pods or its route")
+		return ctrl.Result{}, r.patchStatus(ctx, binding)
+	}
+	meta.RemoveStatusCondition(&binding.Status.Conditions, v1alpha1.ConditionUnmanaged)
 
 	if !binding.ObjectMeta.DeletionTimestamp.IsZero() {
 		return r.handleDeletion(ctx, logger, binding)
@@ -73,7 +205,7 @@ func (r *SessionBindingReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 
 	if !controllerutil.ContainsFinalizer(binding, sessionBindingFinalizer) {
 		controllerutil.AddFinalizer(binding, sessionBindingFinalizer)
-		if err := r.Update(ctx, binding); err != nil {
+		if err := r.Update(ctx, binding, client.FieldOwner(fieldManager)); err != nil {
 			return ctrl.Result{}, err
 		}
 	}
@@ -82,8 +214,31 @@ func (r *SessionBindingReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	now := metav1.Time{Time: r.Clock.Now()}
 	binding.Status.LastReconcileTime = &now
 
+	if isPaused(binding) {
+		logger.V(1).Info("SessionBinding is paused; skipping reconcile")
+		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionPaused, metav1.ConditionTrue, "Paused", "Reconciliation is paused; the session pod and route are left as they are")
+		return ctrl.Result{}, r.patchStatus(ctx, binding)
+	}
+	meta.RemoveStatusCondition(&binding.Status.Conditions, v1alpha1.ConditionPaused)
+
+	previous := binding.Status.DeepCopy()
 	result, reconcileErr := r.reconcileActive(ctx, logger, binding)
+	recordFinished(binding, r.Clock.Now())
+	if reconcileErr == nil {
+		var deleted bool
+		if deleted, result, reconcileErr = r.deleteAfterRetention(ctx, logger, binding, result); deleted {
+			return result, nil
+		}
+	}
+	if dryRun != nil {
+		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionDryRun, metav1.ConditionTrue, "DryRun", dryRun.String())
+	} else {
+		meta.RemoveStatusCondition(&binding.Status.Conditions, v1alpha1.ConditionDryRun)
+	}
 	statusErr := r.patchStatus(ctx, binding)
+	if statusErr == nil {
+		r.notifyTransitions(ctx, previous, binding)
+	}
 	if reconcileErr != nil {
 		return result, reconcileErr
 	}
@@ -99,25 +254,232 @@ func (r *SessionBindingReconciler) reconcileActive(ctx context.Context, logger l
 		return ctrl.Result{}, nil
 	}
 
-	sessionExists, sessionErr := r.CFClient.EnsureSession(ctx, binding.Spec.SessionID)
+	if ns := binding.Spec.Target().Namespace; ns != "" && ns != binding.Namespace && !r.AllowCrossNamespaceTargets {
+		err := fmt.Errorf("targetRef.namespace %q differs from the binding's namespace and cross-namespace targets are disabled", ns)
+		logger.Error(err, "invalid SessionBinding spec")
+		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionSessionDiscovered, metav1.ConditionFalse, "InvalidSpec", err.Error())
+		binding.Status.Phase = v1alpha1.SessionBindingPhaseError
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.validateTunnel(binding); err != nil {
+		logger.Error(err, "invalid SessionBinding spec")
+		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionSessionDiscovered, metav1.ConditionFalse, "InvalidSpec", err.Error())
+		binding.Status.Phase = v1alpha1.SessionBindingPhaseError
+		return ctrl.Result{}, nil
+	}
+
+	// Safety net for clusters without the validating webhook: only the
+	// oldest active binding for a session may program its route.
+	owner, err := r.sessionOwner(ctx, binding)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if owner != nil {
+		msg := fmt.Sprintf("sessionID is already bound by SessionBinding %s/%s", owner.Namespace, owner.Name)
+		logger.Info("duplicate SessionBinding for session; not reconciling", "owner", client.ObjectKeyFromObject(owner))
+		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionSessionDiscovered, metav1.ConditionFalse, "DuplicateSessionID", msg)
+		binding.Status.Phase = v1alpha1.SessionBindingPhaseError
+		return ctrl.Result{RequeueAfter: r.resyncAfter(binding, r.Settings.Get().ErrorRequeueInterval)}, nil
+	}
+
+	if binding.Annotations[v1alpha1.ExpireAnnotation] == "true" {
+		return r.expireBinding(ctx, logger, binding, "ForceExpired", "expired through the "+v1alpha1.ExpireAnnotation+" annotation")
+	}
+
+	// nextCheck is how long until the next TTL or idle transition; zero
+	// when neither applies.
+	var nextCheck time.Duration
+	if expiresAt, ok := bindingExpiry(binding); ok {
+		remaining := expiresAt.Sub(r.Clock.Now())
+		nextCheck = r.updateTTLStatus(binding, expiresAt, remaining)
+		if remaining <= 0 {
+			return r.expireBinding(ctx, logger, binding, "Expired", fmt.Sprintf("TTL of %ds elapsed", *binding.Spec.TTLSeconds))
+		}
+	} else {
+		binding.Status.ExpiresAt = nil
+		meta.RemoveStatusCondition(&binding.Status.Conditions, v1alpha1.ConditionTTLExpiring)
+	}
+
+	if timeout, ok := idleTimeout(binding); ok {
+		lastActivity, err := r.observeActivity(ctx, binding)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		remaining := lastActivity.Add(timeout).Sub(r.Clock.Now())
+		// Activity reported while draining does not bring the route back.
+		if remaining <= 0 || binding.Status.DrainStartedAt != nil {
+			return r.expireBinding(ctx, logger, binding, "IdleTimeout", fmt.Sprintf("no activity for %ds", *binding.Spec.IdleTimeoutSeconds))
+		}
+		if nextCheck == 0 || remaining < nextCheck {
+			nextCheck = remaining
+		}
+	} else {
+		binding.Status.LastActivityTime = nil
+	}
+	admitted, err := r.admit(ctx, logger, binding)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// Denied bindings wait for quota to free up or the policy to change.
+	result := ctrl.Result{RequeueAfter: r.resyncAfter(binding, r.Settings.Get().ErrorRequeueInterval)}
+	if !admitted {
+		// Neither applies any more, e.g. after the TTL was raised mid-drain.
+		binding.Status.DrainStartedAt = nil
+	} else {
+		result, err = r.reconcileSession(ctx, logger, binding)
+		// Look the session up again once the store says it ends.
+		if at := binding.Status.SessionExpiresAt; at != nil {
+			if remaining := at.Sub(r.Clock.Now()); remaining > 0 && (nextCheck == 0 || remaining < nextCheck) {
+				nextCheck = remaining
+			}
+		}
+	}
+	if nextCheck > 0 {
+		result = requeueBefore(result, nextCheck)
+	}
+	return result, err
+}
+
+// admit checks the binding against the SessionPolicies selecting its
+// namespace and records the outcome in the Admitted condition. Policies gate
+// provisioning only: a binding that is already bound keeps running when a
+// policy is tightened later.
+func (r *SessionBindingReconciler) admit(ctx context.Context, logger logr.Logger, binding *v1alpha1.SessionBinding) (bool, error) {
+	if binding.Status.BoundPod != "" && meta.IsStatusConditionTrue(binding.Status.Conditions, v1alpha1.ConditionAdmitted) {
+		return true, nil
+	}
+	violation, err := policy.Evaluate(ctx, r.Client, binding)
+	if err != nil {
+		return false, err
+	}
+	if violation == nil {
+		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionAdmitted, metav1.ConditionTrue, "Admitted", "No SessionPolicy denies the binding")
+		return true, nil
+	}
+
+	if cond := meta.FindStatusCondition(binding.Status.Conditions, v1alpha1.ConditionAdmitted); cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != violation.Reason {
+		logger.Info("SessionBinding denied by policy", "policy", violation.Policy, "reason", violation.Reason)
+		reason := "PolicyDenied"
+		if violation.Reason == policy.ReasonNamespaceQuotaExceeded || violation.Reason == policy.ReasonUserQuotaExceeded {
+			reason = reasonQuotaExceeded
+		}
+		r.Recorder.Event(binding, corev1.EventTypeWarning, reason, violation.Error())
+	}
+	r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionAdmitted, metav1.ConditionFalse, violation.Reason, violation.Error())
+	binding.Status.Phase = v1alpha1.SessionBindingPhasePending
+	return false, nil
+}
+
+func (r *SessionBindingReconciler) reconcileSession(ctx context.Context, logger logr.Logger, binding *v1alpha1.SessionBinding) (ctrl.Result, error) {
+	cf, err := r.cloudflareClientFor(ctx, binding)
+	if err != nil {
+		logger.Error(err, "failed to load Cloudflare credentials")
+		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionSessionDiscovered, metav1.ConditionUnknown, "CredentialsError", err.Error())
+		r.Recorder.Event(binding, corev1.EventTypeWarning, "CredentialsError", err.Error())
+		binding.Status.Phase = v1alpha1.SessionBindingPhaseError
+		return ctrl.Result{RequeueAfter: r.resyncAfter(binding, r.Settings.Get().ErrorRequeueInterval)}, nil
+	}
+
+	session, sessionErr := cf.EnsureSession(ctx, binding.Spec.SessionID)
 	if sessionErr != nil {
 		logger.Error(sessionErr, "failed to verify Cloudflare session")
-		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionSessionDiscovered, metav1.ConditionUnknown, "CloudflareError", sessionErr.Error())
+		reason, after := r.cloudflareRetry(binding, sessionErr)
+		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionSessionDiscovered, metav1.ConditionUnknown, reason, sessionErr.Error())
+		r.Recorder.Event(binding, corev1.EventTypeWarning, reason, "Failed to verify Cloudflare session: "+sessionErr.Error())
 		binding.Status.Phase = v1alpha1.SessionBindingPhaseError
-		return ctrl.Result{RequeueAfter: time.Minute}, nil
+		return ctrl.Result{RequeueAfter: after}, nil
 	}
 
-	if !sessionExists {
-		logger.Info("Cloudflare session missing; marking binding expired", "sessionID", binding.Spec.SessionID)
+	if !session.Exists {
 		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionSessionDiscovered, metav1.ConditionFalse, "NotFound", "Cloudflare session not found")
-		binding.Status.Phase = v1alpha1.SessionBindingPhaseExpired
-		return ctrl.Result{}, nil
+		binding.Status.SessionExpiresAt = nil
+		return r.expireBinding(ctx, logger, binding, "SessionRevoked", "Cloudflare session not found")
 	}
 
-	r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionSessionDiscovered, metav1.ConditionTrue, "SessionActive", "Cloudflare session is active")
+	message := "Cloudflare session is active"
+	binding.Status.SessionExpiresAt = nil
+	if !session.ExpiresAt.IsZero() {
+		binding.Status.SessionExpiresAt = &metav1.Time{Time: session.ExpiresAt}
+		if !session.ExpiresAt.After(r.Clock.Now()) {
+			message := fmt.Sprintf("Cloudflare session ended at %s", session.ExpiresAt.UTC().Format(time.RFC3339))
+			r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionSessionDiscovered, metav1.ConditionFalse, "SessionExpired", message)
+			return r.expireBinding(ctx, logger, binding, "SessionExpired", message)
+		}
+		message = fmt.Sprintf("Cloudflare session is active until %s", session.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionSessionDiscovered, metav1.ConditionTrue, "SessionActive", message)
+	// Nothing ends the binding any more, e.g. after the TTL was raised
+	// mid-drain.
+	binding.Status.DrainStartedAt = nil
 
-	pod, err := r.ensureSessionPod(ctx, logger, binding)
-	if err != nil {
+	var pod *corev1.Pod
+	var replicas []*corev1.Pod
+	switch {
+	case binding.Spec.PodSelector != nil:
+		binding.Status.Profile = ""
+		pod, err = r.selectSessionPod(ctx, binding)
+		if err != nil {
+			binding.Status.Phase = v1alpha1.SessionBindingPhaseError
+			return ctrl.Result{}, err
+		}
+		if pod == nil {
+			r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionPodReady, metav1.ConditionFalse, "NoMatchingPod", "No ready pod matches spec.podSelector")
+			binding.Status.Phase = v1alpha1.SessionBindingPhasePending
+			binding.Status.BoundPod, binding.Status.BoundPodUID, binding.Status.BoundNode = "", "", ""
+			binding.Status.RouteEndpoint = ""
+			setReplicaStatus(binding, nil, nil)
+			return ctrl.Result{RequeueAfter: r.Settings.Get().PendingRequeueInterval}, nil
+		}
+	case binding.Spec.PoolRef != nil:
+		pod, err = r.claimPoolPod(ctx, logger, binding)
+		if err != nil {
+			binding.Status.Phase = v1alpha1.SessionBindingPhaseError
+			return ctrl.Result{}, err
+		}
+		if pod != nil && pod.Labels[v1alpha1.PoolLabelKey] != "" {
+			binding.Status.Profile = ""
+		}
+	}
+
+	// Clone a pod from the target; for pool bindings this is the cold start
+	// when no standby pod was ready.
+	if pod == nil {
+		profile, resources, err := r.resolveProfile(binding)
+		binding.Status.Profile = profile
+		if err != nil {
+			logger.Error(err, "invalid resource profile", "profile", profile)
+			r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionPodReady, metav1.ConditionFalse, "UnknownProfile", err.Error())
+			binding.Status.Phase = v1alpha1.SessionBindingPhaseError
+			return ctrl.Result{}, nil
+		}
+
+		pod, err = r.ensureSessionPod(ctx, logger, binding, resources)
+		if apierrors.IsNotFound(err) {
+			r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionPodReady, metav1.ConditionFalse, reasonTargetMissing, err.Error())
+			r.Recorder.Event(binding, corev1.EventTypeWarning, reasonTargetMissing, err.Error())
+			binding.Status.Phase = v1alpha1.SessionBindingPhaseError
+			return ctrl.Result{RequeueAfter: r.resyncAfter(binding, r.Settings.Get().ErrorRequeueInterval)}, nil
+		}
+		if errors.Is(err, errTargetNotGranted) {
+			r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionPodReady, metav1.ConditionFalse, "TargetNotGranted", err.Error())
+			binding.Status.Phase = v1alpha1.SessionBindingPhaseError
+			return ctrl.Result{RequeueAfter: r.resyncAfter(binding, r.Settings.Get().ErrorRequeueInterval)}, nil
+		}
+		if err != nil {
+			binding.Status.Phase = v1alpha1.SessionBindingPhaseError
+			return ctrl.Result{}, err
+		}
+		if replicas, err = r.syncReplicas(ctx, logger, binding, resources); err != nil {
+			binding.Status.Phase = v1alpha1.SessionBindingPhaseError
+			return ctrl.Result{}, err
+		}
+	}
+	setReplicaStatus(binding, pod, replicas)
+	r.recordBoundPod(logger, binding, pod)
+
+	// Isolate the pod before it can serve the session.
+	if err := r.syncSessionNetworkPolicy(ctx, binding); err != nil {
 		binding.Status.Phase = v1alpha1.SessionBindingPhaseError
 		return ctrl.Result{}, err
 	}
@@ -125,9 +487,9 @@ func (r *SessionBindingReconciler) reconcileActive(ctx context.Context, logger l
 	if !isPodReady(pod) {
 		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionPodReady, metav1.ConditionFalse, "WaitingForReadiness", "Session pod not ready yet")
 		binding.Status.Phase = v1alpha1.SessionBindingPhasePending
-		binding.Status.BoundPod = pod.Name
+		binding.Status.TemplateHash = pod.Annotations[templateHashAnnotation]
 		binding.Status.RouteEndpoint = ""
-		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+		return ctrl.Result{RequeueAfter: r.Settings.Get().PendingRequeueInterval}, nil
 	}
 
 	r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionPodReady, metav1.ConditionTrue, "PodReady", "Session pod ready")
@@ -136,48 +498,189 @@ func (r *SessionBindingReconciler) reconcileActive(ctx context.Context, logger l
 	if endpoint == "" {
 		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionRouteConfigured, metav1.ConditionFalse, "PodEndpointMissing", "Pod ready but lacks PodIP/port")
 		binding.Status.Phase = v1alpha1.SessionBindingPhaseError
-		return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+		return ctrl.Result{RequeueAfter: r.Settings.Get().PendingRequeueInterval}, nil
+	}
+	switch {
+	case r.RoutingMode == RoutingModeTunnel:
+		if endpoint, err = r.tunnelEndpoint(ctx, binding); err != nil {
+			r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionRouteConfigured, metav1.ConditionFalse, "TunnelError", err.Error())
+			binding.Status.Phase = v1alpha1.SessionBindingPhaseError
+			return ctrl.Result{RequeueAfter: r.resyncAfter(binding, r.Settings.Get().ErrorRequeueInterval)}, nil
+		}
+	case r.usesSessionService(binding):
+		if endpoint, err = r.ensureSessionService(ctx, binding, pod, replicas); err != nil {
+			r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionRouteConfigured, metav1.ConditionFalse, "ServiceError", err.Error())
+			binding.Status.Phase = v1alpha1.SessionBindingPhaseError
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Writing the route below repairs any drift found here.
+	verified, drift, err := r.verifyRoute(ctx, cf, binding, pod, endpoint)
+	if err != nil {
+		logger.Error(err, "failed to verify session route", "routeID", binding.Status.RouteID)
+	}
+	if drift != "" {
+		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionRouteDrift, metav1.ConditionTrue, "Drifted", drift)
 	}
 
-	if err := r.CFClient.EnsureRoute(ctx, binding.Spec.SessionID, endpoint); err != nil {
-		logger.Error(err, "failed to configure Cloudflare route", "sessionID", binding.Spec.SessionID, "endpoint", endpoint)
-		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionRouteConfigured, metav1.ConditionFalse, "CloudflareError", err.Error())
+	record, reason, err := r.ensureRoute(ctx, cf, binding, pod, endpoint)
+	if err != nil {
+		logger.Error(err, "failed to configure session route", "endpoint", endpoint)
+		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionRouteConfigured, metav1.ConditionFalse, reason, err.Error())
+		r.Recorder.Event(binding, corev1.EventTypeWarning, reason, "Failed to configure session route: "+err.Error())
 		binding.Status.Phase = v1alpha1.SessionBindingPhaseError
-		return ctrl.Result{RequeueAfter: time.Minute}, nil
+		routeSyncErrors.Inc()
+		if errors.Is(err, cloudflare.ErrConflict) {
+			if err := r.refreshRouteVersion(ctx, cf, binding); err != nil {
+				logger.Error(err, "failed to re-read conflicting session route", "routeID", binding.Status.RouteID)
+			}
+		}
+		_, after := r.cloudflareRetry(binding, err)
+		return ctrl.Result{RequeueAfter: after}, nil
 	}
 
+	// A bound binding whose pod did not change should find its route as it
+	// left it.
+	switch {
+	case drift != "":
+		logger.Info("Cloudflare route drifted; repaired", "routeID", record.ID, "drift", drift)
+		r.Recorder.Event(binding, corev1.EventTypeWarning, reasonRouteDrift, fmt.Sprintf("Repaired drifted route: %s", drift))
+		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionRouteDrift, metav1.ConditionFalse, "Repaired", fmt.Sprintf("Repaired at %s: %s", r.Clock.Now().UTC().Format(time.RFC3339), drift))
+		routeDriftRepairs.Inc()
+	case binding.Status.Phase == v1alpha1.SessionBindingPhaseBound && binding.Status.BoundPod == pod.Name &&
+		(binding.Status.RouteEndpoint != endpoint || binding.Status.RouteID != record.ID):
+		logger.Info("Cloudflare route drifted; re-synced", "routeID", record.ID, "endpoint", endpoint)
+		r.Recorder.Event(binding, corev1.EventTypeWarning, reasonRouteDrift, fmt.Sprintf("Route %s drifted from %s; re-synced it to %s", record.ID, binding.Status.RouteEndpoint, endpoint))
+		routeDriftRepairs.Inc()
+	case verified:
+		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionRouteDrift, metav1.ConditionFalse, "InSync", "Route matches the session endpoint")
+	}
+	// Provider is only ever set here, so a binding without it is bound for
+	// the first time.
+	if binding.Status.Provider == nil {
+		sessionAttachDuration.Observe(r.Clock.Now().Sub(binding.CreationTimestamp.Time).Seconds())
+	}
 	binding.Status.Phase = v1alpha1.SessionBindingPhaseBound
-	binding.Status.BoundPod = pod.Name
+	binding.Status.TemplateHash = pod.Annotations[templateHashAnnotation]
 	binding.Status.RouteEndpoint = endpoint
+	binding.Status.RouteID = record.ID
+	binding.Status.RouteVersion = record.Version
+	syncedAt := metav1.Time{Time: r.Clock.Now()}
+	provider := &v1alpha1.ProviderStatus{Type: record.Provider, LastRouteSyncTime: &syncedAt}
+	if verified {
+		provider.LastVerifiedTime = &syncedAt
+	} else if binding.Status.Provider != nil {
+		provider.LastVerifiedTime = binding.Status.Provider.LastVerifiedTime
+	}
+	binding.Status.Provider = provider
 	r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionRouteConfigured, metav1.ConditionTrue, "RouteConfigured", "Cloudflare route configured")
-	return ctrl.Result{}, nil
+	for _, p := range append([]*corev1.Pod{pod}, replicas...) {
+		if err := r.markRouteReady(ctx, p); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if err := r.deleteReplacedPods(ctx, binding, pod); err != nil {
+		return ctrl.Result{}, err
+	}
+	// Come back to re-verify the session and route; reconcileActive moves
+	// this earlier when a TTL or idle deadline is due first.
+	return ctrl.Result{RequeueAfter: r.resyncAfter(binding, r.Settings.Get().RouteResyncInterval)}, nil
 }
 
-func (r *SessionBindingReconciler) ensureSessionPod(ctx context.Context, logger logr.Logger, binding *v1alpha1.SessionBinding) (*corev1.Pod, error) {
-	podName := fmt.Sprintf("session-%s", binding.Spec.SessionID)
-	pod := &corev1.Pod{}
-	if err := r.Get(ctx, types.NamespacedName{Namespace: binding.Namespace, Name: podName}, pod); err == nil {
+// ensureSessionPod returns the pod to route the session to, cloning one from
+// the target if the binding has none. When the resolved template no longer
+// matches the current pod's, it starts a replacement pod and keeps returning
+// the current one until the replacement is ready; once the route points at
+// the replacement, deleteReplacedPods removes the old pod.
+func (r *SessionBindingReconciler) ensureSessionPod(ctx context.Context, logger logr.Logger, binding *v1alpha1.SessionBinding, resources *corev1.ResourceRequirements) (*corev1.Pod, error) {
+	current, nameTaken, err := r.currentSessionPod(ctx, binding)
+	if err != nil {
+		return nil, err
+	}
+
+	pod, err := r.newSessionPod(ctx, binding, resources)
+	if err != nil {
+		target := binding.Spec.Target()
+		if current != nil {
+			// Keep serving from the running pod while the target is unavailable.
+			logger.Error(err, "failed to resolve pod template; keeping current pod", "kind", target.Kind, "name", target.Name, "pod", current.Name)
+			return current, nil
+		}
+		logger.Error(err, "failed to read target workload", "kind", target.Kind, "name", target.Name)
+		return nil, err
+	}
+
+	if current == nil {
+		// The bound pod may still be terminating under the session pod's
+		// name; recreate it under a generated one.
+		if nameTaken {
+			pod.GenerateName = sessionPodName(binding) + "-"
+		} else {
+			pod.Name = sessionPodName(binding)
+		}
+		if err := r.Create(ctx, pod, client.FieldOwner(fieldManager)); err != nil {
+			return nil, err
+		}
+		if binding.Status.BoundPod != "" {
+			// Not a recreation for recordBoundPod to report.
+			binding.Status.BoundPodUID = pod.UID
+			logger.Info("session pod deleted; recreated it", "pod", binding.Status.BoundPod, "replacement", pod.Name)
+			r.Recorder.Event(binding, corev1.EventTypeWarning, "PodRecreated", fmt.Sprintf("Pod %s was deleted; recreated it as %s", binding.Status.BoundPod, pod.Name))
+			sessionPodsRecreated.Inc()
+			return pod, nil
+		}
+		r.Recorder.Event(binding, corev1.EventTypeNormal, "PodCreated", fmt.Sprintf("Created pod %s for session %s", pod.Name, binding.Spec.SessionID))
 		return pod, nil
-	} else if !apierrors.IsNotFound(err) {
+	}
+
+	// Pods created before template hashing carry no hash and are kept, as
+	// are unmanaged pods.
+	hash := pod.Annotations[templateHashAnnotation]
+	if h := current.Annotations[templateHashAnnotation]; h == "" || h == hash || isUnmanaged(current) {
+		return current, nil
+	}
+
+	pod.Name = replacementPodName(binding, hash)
+	replacement := &corev1.Pod{}
+	err = r.Get(ctx, types.NamespacedName{Namespace: binding.Namespace, Name: pod.Name}, replacement)
+	switch {
+	case apierrors.IsNotFound(err):
+		if err := r.Create(ctx, pod, client.FieldOwner(fieldManager)); err != nil && !apierrors.IsAlreadyExists(err) {
+			return nil, err
+		}
+		logger.Info("pod template changed; starting replacement pod", "pod", current.Name, "replacement", pod.Name)
+		r.Recorder.Event(binding, corev1.EventTypeNormal, "RolloutStarted", fmt.Sprintf("Pod template changed; replacing pod %s with %s", current.Name, pod.Name))
+		return current, nil
+	case err != nil:
 		return nil, err
 	}
+	if isPodReady(replacement) || !isPodReady(current) {
+		return replacement, nil
+	}
+	return current, nil
+}
 
-	deployment := &appsv1.Deployment{}
-	if err := r.Get(ctx, types.NamespacedName{Namespace: binding.Namespace, Name: binding.Spec.TargetDeployment}, deployment); err != nil {
-		logger.Error(err, "target deployment not found", "deployment", binding.Spec.TargetDeployment)
+// newSessionPod builds, without creating it, the session pod for the
+// binding's current template, annotated with the template's hash.
+func (r *SessionBindingReconciler) newSessionPod(ctx context.Context, binding *v1alpha1.SessionBinding, resources *corev1.ResourceRequirements) (*corev1.Pod, error) {
+	template, err := r.targetTemplate(ctx, binding)
+	if err != nil {
 		return nil, err
 	}
 
-	template := deployment.Spec.Template.DeepCopy()
+	applyProfileResources(template, resources)
+	applyPodOverrides(template, binding.Spec.PodOverrides)
+	applyScheduling(template, &binding.Spec)
+	applyPriorityClass(template, binding.Spec.PriorityClassName, r.DefaultPriorityClassName)
 	if template.Labels == nil {
 		template.Labels = map[string]string{}
 	}
 	template.Labels[podSessionLabelKey] = binding.Spec.SessionID
 	template.Labels["app.kubernetes.io/managed-by"] = "cloudflare-session-operator"
 
-	pod = &corev1.Pod{
+	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:        podName,
 			Namespace:   binding.Namespace,
 			Labels:      template.Labels,
 			Annotations: template.Annotations,
@@ -189,25 +692,171 @@ func (r *SessionBindingReconciler) ensureSessionPod(ctx context.Context, logger
 		pod.Annotations = map[string]string{}
 	}
 	pod.Annotations[podSessionLabelKey] = binding.Spec.SessionID
+	injectSessionEnv(&pod.Spec, binding)
+	r.injectCloudflared(pod, binding)
+
+	hash, err := podTemplateHash(pod)
+	if err != nil {
+		return nil, err
+	}
+	pod.Annotations[templateHashAnnotation] = hash
+	// Added after hashing: the gate is not part of the template, and pods
+	// created before it existed are not rolled for it.
+	pod.Spec.ReadinessGates = append(pod.Spec.ReadinessGates, corev1.PodReadinessGate{ConditionType: v1alpha1.RouteReadinessGate})
 
 	if err := controllerutil.SetControllerReference(binding, pod, r.Scheme); err != nil {
 		return nil, err
 	}
+	return pod, nil
+}
+
+// injectSessionEnv tells every container which session it serves, so
+// workloads can reject traffic routed to them for another session, and which
+// binding owns the pod.
+func injectSessionEnv(spec *corev1.PodSpec, binding *v1alpha1.SessionBinding) {
+	vars := []corev1.EnvVar{
+		{Name: sessionIDEnvVar, Value: binding.Spec.SessionID},
+		{Name: sessionBindingEnvVar, Value: binding.Name},
+	}
+	for i := range spec.Containers {
+		c := &spec.Containers[i]
+		for _, v := range vars {
+			c.Env = setEnvVar(c.Env, v)
+		}
+	}
+}
+
+func setEnvVar(env []corev1.EnvVar, v corev1.EnvVar) []corev1.EnvVar {
+	for i := range env {
+		if env[i].Name == v.Name {
+			env[i] = v
+			return env
+		}
+	}
+	return append(env, v)
+}
 
-	if err := r.Create(ctx, pod); err != nil {
+// sessionOwner returns the oldest other active binding claiming the same
+// sessionID, or nil if binding is (or would be) the rightful owner.
+func (r *SessionBindingReconciler) sessionOwner(ctx context.Context, binding *v1alpha1.SessionBinding) (*v1alpha1.SessionBinding, error) {
+	if binding.Spec.SessionID == "" {
+		return nil, nil
+	}
+	active, err := index.ActiveBindingsForSession(ctx, r.Client, binding.Spec.SessionID)
+	if err != nil {
 		return nil, err
 	}
+	var owner *v1alpha1.SessionBinding
+	for i := range active {
+		candidate := &active[i]
+		if owner == nil || olderThan(candidate, owner) {
+			owner = candidate
+		}
+	}
+	if owner == nil || (owner.Namespace == binding.Namespace && owner.Name == binding.Name) {
+		return nil, nil
+	}
+	if index.IsActive(binding) && olderThan(binding, owner) {
+		return nil, nil
+	}
+	return owner, nil
+}
 
-	r.Recorder.Event(binding, corev1.EventTypeNormal, "PodCreated", fmt.Sprintf("Created pod %s for session %s", pod.Name, binding.Spec.SessionID))
-	return pod, nil
+func olderThan(a, b *v1alpha1.SessionBinding) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	return a.Namespace+"/"+a.Name < b.Namespace+"/"+b.Name
 }
 
+// isPaused reports whether reconciliation is suspended through spec.paused or
+// the PausedAnnotation.
+func isPaused(binding *v1alpha1.SessionBinding) bool {
+	return binding.Spec.Paused || binding.Annotations[v1alpha1.PausedAnnotation] == "true"
+}
+
+// isUnmanaged reports whether obj, a binding or pod, opted out of
+// management through v1alpha1.ManagedAnnotation.
+func isUnmanaged(obj metav1.Object) bool {
+	return obj.GetAnnotations()[v1alpha1.ManagedAnnotation] == "false"
+}
+
+// ensureRoute programs the session route according to the routing mode. On
+// failure it also returns the reason to report.
+func (r *SessionBindingReconciler) ensureRoute(ctx context.Context, cf cloudflare.Client, binding *v1alpha1.SessionBinding, pod *corev1.Pod, endpoint string) (cloudflare.RouteRecord, string, error) {
+	opts := routeOptions(binding, r.Settings.Get())
+	switch r.RoutingMode {
+	case RoutingModeIngress:
+		record, err := r.ensureIngressRoute(ctx, binding, opts)
+		if errors.Is(err, errNoHostname) {
+			return record, "HostnameMissing", err
+		}
+		return record, "IngressError", err
+	case RoutingModeGatewayAPI:
+		record, err := r.ensureHTTPRoute(ctx, binding, podPort(pod), opts)
+		if errors.Is(err, errNoHostname) {
+			return record, "HostnameMissing", err
+		}
+		return record, "HTTPRouteError", err
+	default:
+		// Conditional on the version last seen, so a replica or retry acting
+		// on a stale binding does not overwrite a newer route.
+		opts.IfVersion = binding.Status.RouteVersion
+		route := cloudflare.Route{Endpoint: endpoint, ExpiresAt: routeExpiresAt(binding)}
+		record, err := cf.EnsureRoute(ctx, binding.Spec.SessionID, route, opts)
+		reason, _ := r.cloudflareRetry(binding, err)
+		return record, reason, err
+	}
+}
+
+// routeOptions translates spec.route for the Cloudflare client. Bindings
+// without spec.route.hostname fall back to the configured hostname
+// template; the {sessionID} placeholder is expanded in either.
+func routeOptions(binding *v1alpha1.SessionBinding, settings operatorconfig.Settings) cloudflare.RouteOptions {
+	opts := cloudflare.RouteOptions{KVNamespaceID: settings.KVNamespaceID}
+	hostname := settings.RouteHostnameTemplate
+	if route := binding.Spec.Route; route != nil {
+		if route.Hostname != "" {
+			hostname = route.Hostname
+		}
+		opts.PathPrefix = route.PathPrefix
+		opts.TLSMode = string(route.TLSMode)
+	}
+	opts.Hostname = strings.ReplaceAll(hostname, "{sessionID}", binding.Spec.SessionID)
+	return opts
+}
+
+// routeExpiresAt is when the binding's route is to expire: at the end of
+// its TTL or of the Cloudflare session, whichever comes first; zero for
+// neither.
+func routeExpiresAt(binding *v1alpha1.SessionBinding) time.Time {
+	var expiresAt time.Time
+	if binding.Status.ExpiresAt != nil {
+		expiresAt = binding.Status.ExpiresAt.Time
+	}
+	if at := binding.Status.SessionExpiresAt; at != nil && (expiresAt.IsZero() || at.Time.Before(expiresAt)) {
+		expiresAt = at.Time
+	}
+	return expiresAt
+}
+
+func sessionPodName(binding *v1alpha1.SessionBinding) string {
+	return fmt.Sprintf("session-%s", binding.Spec.SessionID)
+}
+
+// isPodReady reports whether pod can serve its session. For pods with the
+// route readiness gate, which cannot turn Ready before they are routed to,
+// that is when all of their containers are ready.
 func isPodReady(pod *corev1.Pod) bool {
 	if pod.Status.Phase != corev1.PodRunning {
 		return false
 	}
+	condType := corev1.PodReady
+	if hasRouteReadinessGate(pod) {
+		condType = corev1.ContainersReady
+	}
 	for _, cond := range pod.Status.Conditions {
-		if cond.Type == corev1.PodReady && cond.Status == corev1.ConditionTrue {
+		if cond.Type == condType && cond.Status == corev1.ConditionTrue {
 			return true
 		}
 	}
@@ -218,14 +867,18 @@ func podEndpoint(pod *corev1.Pod) string {
 	if pod.Status.PodIP == "" {
 		return ""
 	}
-	port := int32(80)
+	return fmt.Sprintf("%s:%d", pod.Status.PodIP, podPort(pod))
+}
+
+// podPort is the session port of pod: the first declared container port,
+// or 80.
+func podPort(pod *corev1.Pod) int32 {
 	for _, container := range pod.Spec.Containers {
 		if len(container.Ports) > 0 {
-			port = container.Ports[0].ContainerPort
-			break
+			return container.Ports[0].ContainerPort
 		}
 	}
-	return fmt.Sprintf("%s:%d", pod.Status.PodIP, port)
+	return 80
 }
 
 func (r *SessionBindingReconciler) handleDeletion(ctx context.Context, logger logr.Logger, binding *v1alpha1.SessionBinding) (ctrl.Result, error) {
@@ -233,58 +886,314 @@ func (r *SessionBindingReconciler) handleDeletion(ctx context.Context, logger lo
 		return ctrl.Result{}, nil
 	}
 
-	if err := r.cleanupResources(ctx, logger, binding); err != nil {
-		return ctrl.Result{}, err
+	// Status is only written when a step fails or the drain starts; on
+	// success the finalizer is removed and the binding goes away. The route
+	// goes first so no new requests reach the pod while it drains; once the
+	// drain has started the route is known to be gone.
+	binding.Status.Phase = v1alpha1.SessionBindingPhaseTerminating
+	routeRemoved := binding.Status.DrainStartedAt != nil
+	if !routeRemoved {
+		budget := r.cleanupRetryBudget()
+		if binding.Status.CleanupAttempts >= budget && binding.Annotations[v1alpha1.ForceDeleteAnnotation] == "true" {
+			message := fmt.Sprintf("Route cleanup skipped after %d failed attempts (%s)", binding.Status.CleanupAttempts, v1alpha1.ForceDeleteAnnotation)
+			logger.Info("force-deleting SessionBinding; its route may be left behind", "routeID", binding.Status.RouteID)
+			r.Recorder.Event(binding, corev1.EventTypeWarning, "ForceDeleted", message)
+			r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionRouteDeleted, metav1.ConditionTrue, "ForceDeleted", message)
+		} else {
+			reason, message, err := r.deleteSessionRoute(ctx, logger, binding)
+			if err != nil {
+				// Retry with our own backoff so the attempts are visible in
+				// status and the budget can run out.
+				binding.Status.CleanupAttempts++
+				r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionRouteDeleted, metav1.ConditionFalse, reason, err.Error())
+				if binding.Status.CleanupAttempts == budget {
+					cleanupRetriesExhausted.Inc()
+				}
+				if binding.Status.CleanupAttempts >= budget {
+					r.Recorder.Event(binding, corev1.EventTypeWarning, "CleanupStuck", fmt.Sprintf("Route cleanup failed %d times; annotate the binding with %s=true to delete it without removing the route", binding.Status.CleanupAttempts, v1alpha1.ForceDeleteAnnotation))
+				}
+				logger.Error(err, "route cleanup failed", "attempts", binding.Status.CleanupAttempts)
+				return ctrl.Result{RequeueAfter: cleanupBackoff(binding.Status.CleanupAttempts)}, r.failDeletion(ctx, logger, binding, nil)
+			}
+			r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionRouteDeleted, metav1.ConditionTrue, reason, message)
+			routeRemoved = true
+		}
+	}
+	if grace := r.drainGracePeriod(binding); routeRemoved && grace > 0 {
+		if wait := r.drain(binding, grace); wait > 0 {
+			return ctrl.Result{RequeueAfter: wait}, r.patchStatus(ctx, binding)
+		}
+		binding.Status.Phase = v1alpha1.SessionBindingPhaseTerminating
+	}
+
+	if err := r.deleteSessionPods(ctx, binding); err != nil {
+		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionPodDeleted, metav1.ConditionFalse, "DeleteFailed", err.Error())
+		return ctrl.Result{}, r.failDeletion(ctx, logger, binding, err)
 	}
+	r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionPodDeleted, metav1.ConditionTrue, "Deleted", "Session pod deleted")
+	r.Recorder.Event(binding, corev1.EventTypeNormal, "CleanedUp", "Removed Cloudflare route and session pod")
 
 	controllerutil.RemoveFinalizer(binding, sessionBindingFinalizer)
-	if err := r.Update(ctx, binding); err != nil {
+	if err := r.Update(ctx, binding, client.FieldOwner(fieldManager)); err != nil {
 		return ctrl.Result{}, err
 	}
 	return ctrl.Result{}, nil
 }
 
+// stuckThreshold returns how long a Pending or Error binding takes to count
+// as stuck.
+func (r *SessionBindingReconciler) stuckThreshold() time.Duration {
+	if r.StuckThreshold > 0 {
+		return r.StuckThreshold
+	}
+	return DefaultStuckThreshold
+}
+
+// cleanupRetryBudget returns how many failed route cleanups are retried
+// before ForceDeleteAnnotation is honoured.
+func (r *SessionBindingReconciler) cleanupRetryBudget() int32 {
+	if r.CleanupRetryBudget > 0 {
+		return int32(r.CleanupRetryBudget)
+	}
+	return DefaultCleanupRetryBudget
+}
+
+// cleanupBackoff is the delay before retrying a route cleanup that failed
+// attempts times: 5s, doubling up to 5m.
+func cleanupBackoff(attempts int32) time.Duration {
+	d := 5 * time.Second
+	for i := int32(1); i < attempts && d < 5*time.Minute; i++ {
+		d *= 2
+	}
+	if d > 5*time.Minute {
+		d = 5 * time.Minute
+	}
+	return d
+}
+
+// failDeletion records the failed cleanup step on the binding's status and
+// returns err so the deletion is retried with backoff.
+func (r *SessionBindingReconciler) failDeletion(ctx context.Context, logger logr.Logger, binding *v1alpha1.SessionBinding, err error) error {
+	if statusErr := r.patchStatus(ctx, binding); statusErr != nil {
+		logger.Error(statusErr, "failed to record deletion progress")
+	}
+	return err
+}
+
+// cleanupResources removes the binding's Cloudflare route and session pod,
+// in that order so the pod never receives traffic it cannot serve.
 func (r *SessionBindingReconciler) cleanupResources(ctx context.Context, logger logr.Logger, binding *v1alpha1.SessionBinding) error {
-	if binding.Status.BoundPod != "" {
+	if _, _, err := r.deleteSessionRoute(ctx, logger, binding); err != nil {
+		return err
+	}
+	if err := r.deleteSessionPods(ctx, binding); err != nil {
+		return err
+	}
+	if err := r.deleteSessionService(ctx, binding); err != nil {
+		return err
+	}
+	if err := r.deleteSessionNetworkPolicy(ctx, binding); err != nil {
+		return err
+	}
+	r.Recorder.Event(binding, corev1.EventTypeNormal, "CleanedUp", "Removed Cloudflare route and session pod")
+	return nil
+}
+
+// deleteSessionPods deletes the pods the binding controls, except unmanaged
+// ones, which go with the binding. Their termination is left to the kubelet.
+func (r *SessionBindingReconciler) deleteSessionPods(ctx context.Context, binding *v1alpha1.SessionBinding) error {
+	podName := binding.Status.BoundPod
+	if podName == "" && binding.Spec.SessionID != "" {
+		// The pod may exist even if its name never made it into status.
+		podName = sessionPodName(binding)
+	}
+	if podName != "" {
 		pod := &corev1.Pod{}
-		if err := r.Get(ctx, types.NamespacedName{Namespace: binding.Namespace, Name: binding.Status.BoundPod}, pod); err == nil {
+		if err := r.Get(ctx, types.NamespacedName{Namespace: binding.Namespace, Name: podName}, pod); err == nil && metav1.IsControlledBy(pod, binding) && !isUnmanaged(pod) {
 			if err := r.Delete(ctx, pod); err != nil && !apierrors.IsNotFound(err) {
 				return err
 			}
 		}
 	}
-
-	if binding.Spec.SessionID != "" {
-		if err := r.CFClient.DeleteRoute(ctx, binding.Spec.SessionID); err != nil {
-			logger.Error(err, "failed to delete Cloudflare route during cleanup", "sessionID", binding.Spec.SessionID)
+	if binding.Spec.SessionID == "" {
+		return nil
+	}
+	// Replacement and claimed pool pods may not have made it into status
+	// either.
+	pods, err := r.controlledSessionPods(ctx, binding)
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods {
+		if isUnmanaged(pod) {
+			continue
+		}
+		if err := r.Delete(ctx, pod); err != nil && !apierrors.IsNotFound(err) {
 			return err
 		}
 	}
-
-	r.Recorder.Event(binding, corev1.EventTypeNormal, "CleanedUp", "Removed Cloudflare route and session pod")
 	return nil
 }
 
+// deleteSessionRoute removes the binding's Cloudflare route. It returns the
+// reason for the RouteDeleted condition, plus a message on success.
+func (r *SessionBindingReconciler) deleteSessionRoute(ctx context.Context, logger logr.Logger, binding *v1alpha1.SessionBinding) (reason, message string, err error) {
+	if binding.Spec.SessionID == "" {
+		return "NoRoute", "Binding has no session, so no route was programmed", nil
+	}
+	// Leave the route alone if another binding has taken over the session.
+	owner, err := r.sessionOwner(ctx, binding)
+	if err != nil {
+		return "LookupFailed", "", err
+	}
+	if owner != nil {
+		return "SessionTakenOver", fmt.Sprintf("Route left in place for SessionBinding %s/%s", owner.Namespace, owner.Name), nil
+	}
+
+	// Remove the route from wherever it was programmed, even if the routing
+	// mode changed since.
+	provider := ""
+	if binding.Status.Provider != nil {
+		provider = binding.Status.Provider.Type
+	}
+	if provider == ProviderIngress || (provider == "" && r.RoutingMode == RoutingModeIngress) {
+		if err := r.deleteIngressRoute(ctx, binding); err != nil {
+			return "DeleteFailed", "", err
+		}
+		return "Deleted", "Ingress deleted", nil
+	}
+	if provider == ProviderHTTPRoute || (provider == "" && r.RoutingMode == RoutingModeGatewayAPI) {
+		if err := r.deleteHTTPRoute(ctx, binding); err != nil {
+			return "DeleteFailed", "", err
+		}
+		return "Deleted", "HTTPRoute deleted", nil
+	}
+
+	cf, err := r.cloudflareClientFor(ctx, binding)
+	switch {
+	case apierrors.IsNotFound(err):
+		// Without its credentials the route cannot be removed; don't
+		// block deletion on a Secret that is gone for good.
+		logger.Error(err, "skipping Cloudflare route cleanup")
+		r.Recorder.Event(binding, corev1.EventTypeWarning, "CredentialsMissing", err.Error())
+		return "CredentialsMissing", "Route cleanup skipped: " + err.Error(), nil
+	case err != nil:
+		return "CredentialsError", "", err
+	}
+	// A route that is already gone is as good as deleted.
+	if err := cf.DeleteRoute(ctx, binding.Spec.SessionID, binding.Status.RouteID); err != nil && !errors.Is(err, cloudflare.ErrNotFound) {
+		logger.Error(err, "failed to delete Cloudflare route during cleanup")
+		reason, _ := r.cloudflareRetry(binding, err)
+		return reason, "", err
+	}
+	return "Deleted", "Cloudflare route deleted", nil
+}
+
 func (r *SessionBindingReconciler) patchStatus(ctx context.Context, binding *v1alpha1.SessionBinding) error {
 	current := &v1alpha1.SessionBinding{}
 	if err := r.Get(ctx, types.NamespacedName{Namespace: binding.Namespace, Name: binding.Name}, current); err != nil {
 		return err
 	}
 
+	previous := current.Status.Phase
+	if previous != binding.Status.Phase {
+		binding.Status.PhaseTransitionTime = &metav1.Time{Time: r.Clock.Now()}
+	}
 	if equality.Semantic.DeepEqual(current.Status, binding.Status) {
 		return nil
 	}
 
-	current.Status = binding.Status
-	return r.Status().Update(ctx, current)
+	if err := applyStatus(ctx, r.Client, current, &v1alpha1.SessionBinding{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v1alpha1.GroupVersion.String(), Kind: "SessionBinding"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: binding.Namespace, Name: binding.Name},
+		Status:     binding.Status,
+	}); err != nil {
+		return err
+	}
+	if previous != binding.Status.Phase {
+		r.exportTransition(binding, previous)
+	}
+	return nil
 }
 
 func (r *SessionBindingReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&v1alpha1.SessionBinding{}).
-		Owns(&corev1.Pod{}).
-		WithOptions(controller.Options{MaxConcurrentReconciles: 1}).
-		Complete(r)
+	// With runtime settings, start enough workers for the largest limit and
+	// let the gate enforce the configured one.
+	workers := 1
+	r.Recorder = newEventThrottle(r.Recorder, r.Clock)
+	if r.DryRun {
+		r.Client = NewDryRunClient(r.Client)
+	}
+	if r.Settings != nil {
+		workers = operatorconfig.MaxConcurrentReconcilesLimit
+		r.gate = newReconcileGate(r.Settings.Get().MaxConcurrentReconciles)
+		r.Settings.OnChange(func(s operatorconfig.Settings) { r.gate.resize(s.MaxConcurrentReconciles) })
+	}
+	// Targets matter for their pod template (generation) and grant
+	// annotation, not for their status churn.
+	targetChanged := builder.WithPredicates(predicate.Or(
+		predicate.GenerationChangedPredicate{},
+		predicate.AnnotationChangedPredicate{},
+	))
+	// A cache resync replays every object as an update; left through, it
+	// would reconcile all bindings at once.
+	changed := builder.WithPredicates(predicate.ResourceVersionChangedPredicate{})
+	b := ctrl.NewControllerManagedBy(mgr).
+		// Status updates, including our own, and cache resyncs are not
+		// reconcile triggers: time-based transitions are scheduled through
+		// RequeueAfter, jittered per binding. Deletion bumps the generation.
+		For(&v1alpha1.SessionBinding{}, builder.WithPredicates(predicate.Or(
+			predicate.GenerationChangedPredicate{},
+			predicate.AnnotationChangedPredicate{},
+			predicate.LabelChangedPredicate{},
+		))).
+		Owns(&corev1.Pod{}, changed).
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(r.bindingsForPod), changed).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.bindingsForSecret), changed).
+		Watches(&appsv1.Deployment{}, handler.EnqueueRequestsFromMapFunc(r.bindingsForTarget(v1alpha1.TargetKindDeployment)), targetChanged).
+		Watches(&appsv1.StatefulSet{}, handler.EnqueueRequestsFromMapFunc(r.bindingsForTarget(v1alpha1.TargetKindStatefulSet)), targetChanged).
+		Watches(&appsv1.ReplicaSet{}, handler.EnqueueRequestsFromMapFunc(r.bindingsForTarget(v1alpha1.TargetKindReplicaSet)), targetChanged).
+		WithOptions(controller.Options{MaxConcurrentReconciles: workers, RateLimiter: r.RateLimiter})
+	// Requeues from outside the watches: the pod sweeper's, for bindings
+	// whose status lost track of their pod, and NotifySession's.
+	r.requeue = make(chan event.GenericEvent)
+	b = b.WatchesRawSource(&source.Channel{Source: r.requeue}, &handler.EnqueueRequestForObject{})
+	if r.RoutingMode == RoutingModeGatewayAPI {
+		// The Gateway reports acceptance in the HTTPRoute's status. The
+		// HTTPRoute CRD is only required in this mode.
+		b = b.Owns(newHTTPRoute(), changed)
+	}
+	if err := b.Complete(diagnostics.Track("sessionbinding", r)); err != nil {
+		return err
+	}
+	if err := mgr.Add(manager.RunnableFunc(r.runPodSweeper)); err != nil {
+		return err
+	}
+	r.notifier = newNotifier(r.Recorder)
+	if err := mgr.Add(r.notifier); err != nil {
+		return err
+	}
+	if r.RouteJanitorInterval > 0 && !r.routesThroughCluster() {
+		if err := mgr.Add(manager.RunnableFunc(r.runRouteJanitor)); err != nil {
+			return err
+		}
+	}
+	return metrics.Registry.Register(&phaseCollector{
+		reader:        mgr.GetClient(),
+		clock:         r.Clock,
+		stuckAfter:    r.stuckThreshold(),
+		cleanupBudget: r.cleanupRetryBudget(),
+	})
+}
+
+// NewRateLimiter returns controller-runtime's default rate limiter with the
+// per-binding exponential backoff running from baseDelay to maxDelay.
+func NewRateLimiter(baseDelay, maxDelay time.Duration) ratelimiter.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay),
+		// Overall retry budget, as in workqueue.DefaultControllerRateLimiter.
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+	)
 }
 
 func (r *SessionBindingReconciler) setCondition(conditions *[]metav1.Condition, condType string, status metav1.ConditionStatus, reason, message string) {
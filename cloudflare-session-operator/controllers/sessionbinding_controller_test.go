@@ -0,0 +1,416 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare"
+	cffake "github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare/fake"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/index"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+const testNamespace = "sessions"
+
+type fixedClock struct{ now time.Time }
+
+func (c *fixedClock) Now() time.Time { return c.now }
+
+// fieldIndexer registers indexes on a fake.ClientBuilder, so the fake
+// client serves the same field selectors as the manager's cache.
+type fieldIndexer struct{ builder *fake.ClientBuilder }
+
+func (i fieldIndexer) IndexField(_ context.Context, obj client.Object, field string, extract client.IndexerFunc) error {
+	i.builder.WithIndex(obj, field, extract)
+	return nil
+}
+
+// applyStatusAsUpdate stands in for server-side apply of a binding's status,
+// which the fake client handles as a merge patch: as with the operator's
+// apply, fields left out of the applied status are cleared.
+func applyStatusAsUpdate(ctx context.Context, c client.Client, subResource string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	applied, ok := obj.(*v1alpha1.SessionBinding)
+	if !ok || patch.Type() != types.ApplyPatchType {
+		return c.SubResource(subResource).Patch(ctx, obj, patch, opts...)
+	}
+	current := &v1alpha1.SessionBinding{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(applied), current); err != nil {
+		return err
+	}
+	current.Status = applied.Status
+	return c.Status().Update(ctx, current)
+}
+
+type reconcilerTest struct {
+	t        *testing.T
+	client   client.Client
+	cf       *cffake.Client
+	clock    *fixedClock
+	recorder *record.FakeRecorder
+	r        *SessionBindingReconciler
+}
+
+// newReconcilerTest returns a reconciler for objs, talking to an in-memory
+// API server and Cloudflare, with the clock at now.
+func newReconcilerTest(t *testing.T, now time.Time, objs ...client.Object) *reconcilerTest {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	builder := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objs...).
+		WithStatusSubresource(&v1alpha1.SessionBinding{}).
+		WithInterceptorFuncs(interceptor.Funcs{SubResourcePatch: applyStatusAsUpdate})
+	if err := index.Register(context.Background(), fieldIndexer{builder}); err != nil {
+		t.Fatal(err)
+	}
+	c := builder.Build()
+	rt := &reconcilerTest{
+		t:        t,
+		client:   c,
+		cf:       &cffake.Client{},
+		clock:    &fixedClock{now: now},
+		recorder: record.NewFakeRecorder(100),
+	}
+	rt.r = &SessionBindingReconciler{
+		Client:   c,
+		Scheme:   scheme,
+		CFClient: rt.cf,
+		Recorder: rt.recorder,
+		Clock:    rt.clock,
+	}
+	return rt
+}
+
+func (rt *reconcilerTest) reconcile(name string) ctrl.Result {
+	rt.t.Helper()
+	result, err := rt.r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: testNamespace, Name: name}})
+	if err != nil {
+		rt.t.Fatalf("reconcile %s: %v", name, err)
+	}
+	return result
+}
+
+func (rt *reconcilerTest) binding(name string) *v1alpha1.SessionBinding {
+	rt.t.Helper()
+	binding := &v1alpha1.SessionBinding{}
+	if err := rt.client.Get(context.Background(), types.NamespacedName{Namespace: testNamespace, Name: name}, binding); err != nil {
+		rt.t.Fatalf("get binding %s: %v", name, err)
+	}
+	return binding
+}
+
+// events returns the reasons of the events recorded so far.
+func (rt *reconcilerTest) events() []string {
+	var reasons []string
+	for {
+		select {
+		case e := <-rt.recorder.Events:
+			// FakeRecorder formats events as "<type> <reason> <message>".
+			reasons = append(reasons, strings.Fields(e)[1])
+		default:
+			return reasons
+		}
+	}
+}
+
+func newBinding(name, sessionID string, created time.Time) *v1alpha1.SessionBinding {
+	return &v1alpha1.SessionBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         testNamespace,
+			Name:              name,
+			UID:               types.UID(name + "-uid"),
+			CreationTimestamp: metav1.Time{Time: created},
+			Finalizers:        []string{sessionBindingFinalizer},
+		},
+		Spec: v1alpha1.SessionBindingSpec{SessionID: sessionID, TargetDeployment: "app"},
+	}
+}
+
+// boundBinding returns binding bound to a ready session pod, routed at
+// version routeVersion and verified at verifiedAt, along with the pod.
+func boundBinding(binding *v1alpha1.SessionBinding, routeVersion string, verifiedAt time.Time) (*v1alpha1.SessionBinding, *corev1.Pod) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNamespace,
+			Name:      sessionPodName(binding),
+			UID:       types.UID(sessionPodName(binding) + "-uid"),
+			Labels:    map[string]string{podSessionLabelKey: binding.Spec.SessionID},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(binding, v1alpha1.GroupVersion.WithKind("SessionBinding")),
+			},
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "app"}}},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			PodIP:      "10.0.0.5",
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+	verified := metav1.Time{Time: verifiedAt}
+	binding.Status = v1alpha1.SessionBindingStatus{
+		Phase:         v1alpha1.SessionBindingPhaseBound,
+		BoundPod:      pod.Name,
+		BoundPodUID:   pod.UID,
+		RouteEndpoint: podEndpoint(pod),
+		RouteID:       binding.Spec.SessionID,
+		RouteVersion:  routeVersion,
+		Provider:      &v1alpha1.ProviderStatus{Type: cloudflare.ProviderWorkersKV, LastRouteSyncTime: &verified, LastVerifiedTime: &verified},
+		Conditions: []metav1.Condition{{
+			Type:               v1alpha1.ConditionAdmitted,
+			Status:             metav1.ConditionTrue,
+			Reason:             "Admitted",
+			LastTransitionTime: verified,
+		}},
+	}
+	return binding, pod
+}
+
+func TestReconcileRejectsDuplicateSessionID(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	owner := newBinding("first", "s1", now.Add(-time.Hour))
+	owner.Status.Phase = v1alpha1.SessionBindingPhaseBound
+	duplicate := newBinding("second", "s1", now.Add(-time.Minute))
+	rt := newReconcilerTest(t, now, owner, duplicate)
+
+	result := rt.reconcile("second")
+
+	got := rt.binding("second")
+	if got.Status.Phase != v1alpha1.SessionBindingPhaseError {
+		t.Fatalf("phase = %q want %q", got.Status.Phase, v1alpha1.SessionBindingPhaseError)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, v1alpha1.ConditionSessionDiscovered)
+	if cond == nil || cond.Reason != "DuplicateSessionID" || !strings.Contains(cond.Message, "sessions/first") {
+		t.Fatalf("SessionDiscovered condition = %+v, want DuplicateSessionID naming sessions/first", cond)
+	}
+	if result.RequeueAfter < rt.r.Settings.Get().ErrorRequeueInterval {
+		t.Fatalf("requeue after %s, want at least the error requeue interval", result.RequeueAfter)
+	}
+	if calls := rt.cf.Calls(); len(calls) != 0 {
+		t.Fatalf("duplicate binding called Cloudflare: %+v", calls)
+	}
+}
+
+func TestReconcileExpiresBindingAfterTTL(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	binding := newBinding("ttl", "s1", now.Add(-2*time.Minute))
+	ttl := int64(60)
+	binding.Spec.TTLSeconds = &ttl
+	binding.Status.RouteID = "s1"
+	rt := newReconcilerTest(t, now, binding)
+
+	if result := rt.reconcile("ttl"); result.RequeueAfter != 0 {
+		t.Fatalf("expired binding requeued after %s", result.RequeueAfter)
+	}
+
+	got := rt.binding("ttl")
+	if got.Status.Phase != v1alpha1.SessionBindingPhaseExpired {
+		t.Fatalf("phase = %q want %q", got.Status.Phase, v1alpha1.SessionBindingPhaseExpired)
+	}
+	if got.Status.RouteID != "" {
+		t.Fatalf("routeID = %q after expiry, want it cleared", got.Status.RouteID)
+	}
+	if cond := meta.FindStatusCondition(got.Status.Conditions, v1alpha1.ConditionRouteConfigured); cond == nil || cond.Reason != "Expired" {
+		t.Fatalf("RouteConfigured condition = %+v, want reason Expired", cond)
+	}
+	if calls := rt.cf.Calls(cffake.MethodDeleteRoute); len(calls) != 1 || calls[0].RouteID != "s1" {
+		t.Fatalf("DeleteRoute calls = %+v, want one for route s1", calls)
+	}
+}
+
+func TestReconcileExpiresIdleBindingAfterDrain(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	binding, pod := boundBinding(newBinding("idle", "s1", now.Add(-time.Hour)), "1", now)
+	timeout := int64(300)
+	binding.Spec.IdleTimeoutSeconds = &timeout
+	pod.Annotations = map[string]string{LastActivityAnnotation: now.Add(-10 * time.Minute).Format(time.RFC3339)}
+	rt := newReconcilerTest(t, now, binding, pod)
+	grace := rt.r.Settings.Get().DrainGracePeriod
+
+	// The route goes first; the pod is kept for the drain grace period.
+	if result := rt.reconcile("idle"); result.RequeueAfter != grace {
+		t.Fatalf("requeue after %s, want the drain grace period %s", result.RequeueAfter, grace)
+	}
+	got := rt.binding("idle")
+	if got.Status.Phase != v1alpha1.SessionBindingPhaseDraining || got.Status.DrainStartedAt == nil {
+		t.Fatalf("phase = %q drainStartedAt = %v, want a started drain", got.Status.Phase, got.Status.DrainStartedAt)
+	}
+	if calls := rt.cf.Calls(cffake.MethodDeleteRoute); len(calls) != 1 {
+		t.Fatalf("DeleteRoute calls = %d want 1", len(calls))
+	}
+	if err := rt.client.Get(context.Background(), client.ObjectKeyFromObject(pod), &corev1.Pod{}); err != nil {
+		t.Fatalf("session pod deleted while draining: %v", err)
+	}
+
+	rt.clock.now = now.Add(grace)
+	rt.reconcile("idle")
+	got = rt.binding("idle")
+	if got.Status.Phase != v1alpha1.SessionBindingPhaseExpired {
+		t.Fatalf("phase = %q want %q", got.Status.Phase, v1alpha1.SessionBindingPhaseExpired)
+	}
+	if cond := meta.FindStatusCondition(got.Status.Conditions, v1alpha1.ConditionPodReady); cond == nil || cond.Reason != "IdleTimeout" {
+		t.Fatalf("PodReady condition = %+v, want reason IdleTimeout", cond)
+	}
+	if err := rt.client.Get(context.Background(), client.ObjectKeyFromObject(pod), &corev1.Pod{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("get session pod after expiry: %v, want not found", err)
+	}
+}
+
+func TestReconcileDeletionHonoursForceDeleteAfterRetryBudget(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	binding := newBinding("stuck", "s1", now.Add(-time.Hour))
+	binding.Status.RouteID = "s1"
+	rt := newReconcilerTest(t, now, binding)
+	rt.r.CleanupRetryBudget = 2
+	rt.cf.SetError(cffake.MethodDeleteRoute, errors.New("cloudflare unavailable"))
+	ctx := context.Background()
+	if err := rt.client.Delete(ctx, rt.binding("stuck")); err != nil {
+		t.Fatal(err)
+	}
+
+	for attempt := int32(1); attempt <= 3; attempt++ {
+		if result := rt.reconcile("stuck"); result.RequeueAfter != cleanupBackoff(attempt) {
+			t.Fatalf("attempt %d: requeue after %s want %s", attempt, result.RequeueAfter, cleanupBackoff(attempt))
+		}
+		got := rt.binding("stuck")
+		if got.Status.CleanupAttempts != attempt {
+			t.Fatalf("cleanupAttempts = %d want %d", got.Status.CleanupAttempts, attempt)
+		}
+		if cond := meta.FindStatusCondition(got.Status.Conditions, v1alpha1.ConditionRouteDeleted); cond == nil || cond.Status != metav1.ConditionFalse {
+			t.Fatalf("attempt %d: RouteDeleted condition = %+v, want False", attempt, cond)
+		}
+	}
+	if events := strings.Join(rt.events(), ","); strings.Count(events, "CleanupStuck") != 2 {
+		t.Fatalf("events = %s, want CleanupStuck once the budget of 2 ran out", events)
+	}
+
+	// Without the annotation the binding waits; with it the route is left
+	// behind and the binding goes.
+	got := rt.binding("stuck")
+	got.Annotations = map[string]string{v1alpha1.ForceDeleteAnnotation: "true"}
+	if err := rt.client.Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	rt.reconcile("stuck")
+	if err := rt.client.Get(ctx, client.ObjectKeyFromObject(got), &v1alpha1.SessionBinding{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("get binding after force delete: %v, want not found", err)
+	}
+	if calls := rt.cf.Calls(cffake.MethodDeleteRoute); len(calls) != 3 {
+		t.Fatalf("DeleteRoute calls = %d, want none after the force delete", len(calls))
+	}
+	if events := rt.events(); len(events) == 0 || events[0] != "ForceDeleted" {
+		t.Fatalf("events = %v, want ForceDeleted first", events)
+	}
+}
+
+func TestReconcileRefreshesRouteVersionOnConflict(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	binding, pod := boundBinding(newBinding("conflict", "s1", now.Add(-time.Hour)), "1", now)
+	rt := newReconcilerTest(t, now, binding, pod)
+	ctx := context.Background()
+	// Another writer moved the route on to version 2 at another endpoint.
+	for _, endpoint := range []string{binding.Status.RouteEndpoint, "10.0.0.9:80"} {
+		if _, err := rt.cf.EnsureRoute(ctx, "s1", cloudflare.Route{Endpoint: endpoint}, cloudflare.RouteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result := rt.reconcile("conflict")
+	if want := rt.r.Settings.Get().PendingRequeueInterval; result.RequeueAfter != want {
+		t.Fatalf("requeue after %s want the pending requeue interval %s", result.RequeueAfter, want)
+	}
+	got := rt.binding("conflict")
+	if got.Status.RouteVersion != "2" {
+		t.Fatalf("routeVersion = %q after the conflict, want the current version 2", got.Status.RouteVersion)
+	}
+	if cond := meta.FindStatusCondition(got.Status.Conditions, v1alpha1.ConditionRouteConfigured); cond == nil || cond.Reason != reasonCloudflareConflict {
+		t.Fatalf("RouteConfigured condition = %+v, want reason %s", cond, reasonCloudflareConflict)
+	}
+
+	// The retry is conditional on the version read back and succeeds.
+	rt.reconcile("conflict")
+	got = rt.binding("conflict")
+	if got.Status.Phase != v1alpha1.SessionBindingPhaseBound || got.Status.RouteVersion != "3" {
+		t.Fatalf("phase = %q routeVersion = %q, want Bound at version 3", got.Status.Phase, got.Status.RouteVersion)
+	}
+	calls := rt.cf.Calls(cffake.MethodEnsureRoute)
+	if last := calls[len(calls)-1]; last.RouteOptions.IfVersion != "2" {
+		t.Fatalf("retry conditional on version %q want 2", last.RouteOptions.IfVersion)
+	}
+	if route := rt.cf.Routes()["s1"]; route.Route.Endpoint != binding.Status.RouteEndpoint {
+		t.Fatalf("route endpoint = %q want %q", route.Route.Endpoint, binding.Status.RouteEndpoint)
+	}
+}
+
+func TestReconcileExpiresBindingWhenSessionEnds(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name    string
+		session cloudflare.Session
+		reason  string
+	}{
+		{name: "revoked", session: cloudflare.Session{Exists: false}, reason: "SessionRevoked"},
+		{name: "ended", session: cloudflare.Session{Exists: true, ExpiresAt: now.Add(-time.Minute)}, reason: "SessionExpired"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			binding, pod := boundBinding(newBinding("ended", "s1", now.Add(-time.Hour)), "1", now)
+			rt := newReconcilerTest(t, now, binding, pod)
+			if _, err := rt.cf.EnsureRoute(context.Background(), "s1", cloudflare.Route{Endpoint: binding.Status.RouteEndpoint}, cloudflare.RouteOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			rt.cf.SetSession("s1", tc.session)
+			grace := rt.r.Settings.Get().DrainGracePeriod
+
+			if result := rt.reconcile("ended"); result.RequeueAfter != grace {
+				t.Fatalf("requeue after %s, want the drain grace period %s", result.RequeueAfter, grace)
+			}
+			if got := rt.binding("ended"); got.Status.Phase != v1alpha1.SessionBindingPhaseDraining {
+				t.Fatalf("phase = %q want %q", got.Status.Phase, v1alpha1.SessionBindingPhaseDraining)
+			}
+			if _, ok := rt.cf.Routes()["s1"]; ok {
+				t.Fatal("route s1 still exists while draining")
+			}
+
+			// The drain survives the next lookup and ends with the pod.
+			rt.clock.now = now.Add(grace / 2)
+			if result := rt.reconcile("ended"); result.RequeueAfter != grace-grace/2 {
+				t.Fatalf("requeue after %s mid-drain, want %s", result.RequeueAfter, grace-grace/2)
+			}
+			rt.clock.now = now.Add(grace)
+			rt.reconcile("ended")
+			got := rt.binding("ended")
+			if got.Status.Phase != v1alpha1.SessionBindingPhaseExpired || got.Status.BoundPod != "" {
+				t.Fatalf("phase = %q boundPod = %q, want Expired and unbound", got.Status.Phase, got.Status.BoundPod)
+			}
+			if cond := meta.FindStatusCondition(got.Status.Conditions, v1alpha1.ConditionRouteConfigured); cond == nil || cond.Reason != tc.reason {
+				t.Fatalf("RouteConfigured condition = %+v, want reason %s", cond, tc.reason)
+			}
+			if err := rt.client.Get(context.Background(), client.ObjectKeyFromObject(pod), &corev1.Pod{}); !apierrors.IsNotFound(err) {
+				t.Fatalf("get session pod after expiry: %v, want not found", err)
+			}
+			if _, ok := rt.cf.Routes()["s1"]; ok {
+				t.Fatal("route s1 still exists after expiry")
+			}
+		})
+	}
+}
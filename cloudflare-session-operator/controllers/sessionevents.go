@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/index"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/sessionevents"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// NotifySession requeues every binding of the event's session, in any
+// namespace, and returns how many there are. The reconcile decides what the
+// event means for each binding, so a forged or stale event can at most
+// cause an extra reconcile. Requeues are only taken by the leader, so on
+// other replicas it fails once ctx is done.
+func (r *SessionBindingReconciler) NotifySession(ctx context.Context, ev sessionevents.Event) (int, error) {
+	bindings := &v1alpha1.SessionBindingList{}
+	if err := r.List(ctx, bindings, client.MatchingFields{index.SessionIDField: ev.SessionID}); err != nil {
+		return 0, err
+	}
+	for i := range bindings.Items {
+		select {
+		case r.requeue <- event.GenericEvent{Object: &bindings.Items[i]}:
+		case <-ctx.Done():
+			return i, ctx.Err()
+		}
+	}
+	return len(bindings.Items), nil
+}
@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/diagnostics"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// SessionPoolReconciler keeps each SessionPool's standby pods at the desired
+// count. Claimed pods are handed over to their SessionBinding and no longer
+// count towards the pool.
+type SessionPoolReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder recordEventRecorder
+	// AllowCrossNamespaceTargets mirrors the SessionBinding setting for
+	// pool targets in other namespaces.
+	AllowCrossNamespaceTargets bool
+	// DryRun mirrors the SessionBinding setting: pool pods are only
+	// created and deleted as dry runs.
+	DryRun bool
+}
+
+//+kubebuilder:rbac:groups=cloudflare.example.com,resources=sessionpools,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups=cloudflare.example.com,resources=sessionpools/status,verbs=get;update;patch
+
+func (r *SessionPoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	pool := &v1alpha1.SessionPool{}
+	if err := r.Get(ctx, req.NamespacedName, pool); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	logger = logger.WithValues("pool", req.Name, "namespace", req.Namespace)
+	ctx = log.IntoContext(ctx, logger)
+	if !pool.DeletionTimestamp.IsZero() {
+		// Standby pods are garbage collected through their owner reference.
+		return ctrl.Result{}, nil
+	}
+
+	result, reconcileErr := r.reconcileStandby(ctx, logger, pool)
+	pool.Status.ObservedGeneration = pool.Generation
+	statusErr := r.patchStatus(ctx, pool)
+	if reconcileErr != nil {
+		return result, reconcileErr
+	}
+	return result, statusErr
+}
+
+func (r *SessionPoolReconciler) reconcileStandby(ctx context.Context, logger logr.Logger, pool *v1alpha1.SessionPool) (ctrl.Result, error) {
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(pool.Namespace), client.MatchingLabels{
+		v1alpha1.PoolLabelKey:      pool.Name,
+		v1alpha1.PoolStateLabelKey: v1alpha1.PoolStateWarm,
+	}); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	var standby []*corev1.Pod
+	var ready int32
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		// Unmanaged standby pods are neither counted nor deleted.
+		if !metav1.IsControlledBy(pod, pool) || !pod.DeletionTimestamp.IsZero() || isUnmanaged(pod) {
+			continue
+		}
+		if pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded {
+			if err := r.Delete(ctx, pod); err != nil && !apierrors.IsNotFound(err) {
+				return ctrl.Result{}, err
+			}
+			continue
+		}
+		if isPodReady(pod) {
+			ready++
+		}
+		standby = append(standby, pod)
+	}
+	pool.Status.Replicas = int32(len(standby))
+	pool.Status.ReadyReplicas = ready
+
+	desired := int(pool.Spec.Replicas)
+	switch {
+	case len(standby) < desired:
+		if ns := pool.Spec.TargetRef.Namespace; ns != "" && ns != pool.Namespace && !r.AllowCrossNamespaceTargets {
+			msg := fmt.Sprintf("targetRef.namespace %q differs from the pool's namespace and cross-namespace targets are disabled", ns)
+			r.setCondition(pool, metav1.ConditionFalse, "InvalidSpec", msg)
+			return ctrl.Result{}, nil
+		}
+		template, err := poolTemplate(ctx, r.Client, pool)
+		if err != nil {
+			logger.Error(err, "failed to read pool target workload")
+			r.setCondition(pool, metav1.ConditionFalse, "TemplateUnavailable", err.Error())
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+		for i := len(standby); i < desired; i++ {
+			pod := newStandbyPod(pool, template)
+			if err := controllerutil.SetControllerReference(pool, pod, r.Scheme); err != nil {
+				return ctrl.Result{}, err
+			}
+			if err := r.Create(ctx, pod, client.FieldOwner(fieldManager)); err != nil {
+				return ctrl.Result{}, err
+			}
+			pool.Status.Replicas++
+		}
+		r.Recorder.Event(pool, corev1.EventTypeNormal, "ScaledUp", fmt.Sprintf("Created %d standby pod(s)", desired-len(standby)))
+	case len(standby) > desired:
+		// Drop pods that are not ready yet first, then the newest.
+		sort.Slice(standby, func(i, j int) bool {
+			if ri, rj := isPodReady(standby[i]), isPodReady(standby[j]); ri != rj {
+				return !ri
+			}
+			return standby[j].CreationTimestamp.Before(&standby[i].CreationTimestamp)
+		})
+		for _, pod := range standby[:len(standby)-desired] {
+			if err := r.Delete(ctx, pod); err != nil && !apierrors.IsNotFound(err) {
+				return ctrl.Result{}, err
+			}
+			pool.Status.Replicas--
+			if isPodReady(pod) {
+				pool.Status.ReadyReplicas--
+			}
+		}
+	}
+
+	if pool.Status.ReadyReplicas >= pool.Spec.Replicas {
+		r.setCondition(pool, metav1.ConditionTrue, "StandbyReady", "All standby pods are ready")
+	} else {
+		r.setCondition(pool, metav1.ConditionFalse, "WaitingForPods", fmt.Sprintf("%d of %d standby pods ready", pool.Status.ReadyReplicas, pool.Spec.Replicas))
+	}
+	return ctrl.Result{}, nil
+}
+
+// poolTemplate returns the pod template standby pods of pool are created from.
+func poolTemplate(ctx context.Context, c client.Reader, pool *v1alpha1.SessionPool) (*corev1.PodTemplateSpec, error) {
+	template, err := workloadTemplate(ctx, c, pool.Spec.TargetRef, pool.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	applyPodOverrides(template, pool.Spec.PodOverrides)
+	return template, nil
+}
+
+func newStandbyPod(pool *v1alpha1.SessionPool, template *corev1.PodTemplateSpec) *corev1.Pod {
+	labels := map[string]string{}
+	for k, v := range template.Labels {
+		labels[k] = v
+	}
+	labels[v1alpha1.PoolLabelKey] = pool.Name
+	labels[v1alpha1.PoolStateLabelKey] = v1alpha1.PoolStateWarm
+	labels["app.kubernetes.io/managed-by"] = "cloudflare-session-operator"
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: pool.Name + "-",
+			Namespace:    pool.Namespace,
+			Labels:       labels,
+			Annotations:  template.Annotations,
+		},
+		Spec: *template.Spec.DeepCopy(),
+	}
+}
+
+func (r *SessionPoolReconciler) setCondition(pool *v1alpha1.SessionPool, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&pool.Status.Conditions, metav1.Condition{
+		Type:    v1alpha1.ConditionPoolReady,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
+func (r *SessionPoolReconciler) patchStatus(ctx context.Context, pool *v1alpha1.SessionPool) error {
+	current := &v1alpha1.SessionPool{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: pool.Namespace, Name: pool.Name}, current); err != nil {
+		return err
+	}
+
+	if equality.Semantic.DeepEqual(current.Status, pool.Status) {
+		return nil
+	}
+
+	return applyStatus(ctx, r.Client, current, &v1alpha1.SessionPool{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v1alpha1.GroupVersion.String(), Kind: "SessionPool"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: pool.Namespace, Name: pool.Name},
+		Status:     pool.Status,
+	})
+}
+
+func (r *SessionPoolReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.DryRun {
+		r.Client = NewDryRunClient(r.Client)
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.SessionPool{}).
+		Owns(&corev1.Pod{}).
+		Complete(diagnostics.Track("sessionpool", r))
+}
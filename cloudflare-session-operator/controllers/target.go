@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/index"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// targetNamespacesAnnotation is set on a target workload in another
+// namespace to grant bindings from the listed namespaces ("*" for all) use of
+// its pod template, in the spirit of Gateway API ReferenceGrants.
+const targetNamespacesAnnotation = "cloudflare.example.com/allowed-namespaces"
+
+var errTargetNotGranted = errors.New("target workload does not grant access to the binding's namespace")
+
+// targetTemplate returns a copy of the pod template the binding's session
+// pod is cloned from: its target workload's, or for pool bindings the pool's.
+func (r *SessionBindingReconciler) targetTemplate(ctx context.Context, binding *v1alpha1.SessionBinding) (*corev1.PodTemplateSpec, error) {
+	if binding.Spec.PoolRef != nil {
+		pool := &v1alpha1.SessionPool{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: binding.Namespace, Name: binding.Spec.PoolRef.Name}, pool); err != nil {
+			return nil, err
+		}
+		return poolTemplate(ctx, r.Client, pool)
+	}
+	return workloadTemplate(ctx, r.Client, binding.Spec.Target(), binding.Namespace)
+}
+
+// workloadTemplate returns a copy of the pod template of the workload ref
+// points at, on behalf of an object in namespace. Workloads in other
+// namespaces must grant namespace through targetNamespacesAnnotation.
+func workloadTemplate(ctx context.Context, c client.Reader, ref v1alpha1.TargetReference, namespace string) (*corev1.PodTemplateSpec, error) {
+	key := types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}
+	if key.Namespace == "" {
+		key.Namespace = namespace
+	}
+	if ref.Kind == "" {
+		ref.Kind = v1alpha1.TargetKindDeployment
+	}
+
+	var obj client.Object
+	switch ref.Kind {
+	case v1alpha1.TargetKindDeployment:
+		obj = &appsv1.Deployment{}
+	case v1alpha1.TargetKindStatefulSet:
+		obj = &appsv1.StatefulSet{}
+	case v1alpha1.TargetKindReplicaSet:
+		obj = &appsv1.ReplicaSet{}
+	default:
+		return nil, fmt.Errorf("unsupported target kind %q", ref.Kind)
+	}
+	if err := c.Get(ctx, key, obj); err != nil {
+		return nil, err
+	}
+	if key.Namespace != namespace && !grantsNamespace(obj, namespace) {
+		return nil, fmt.Errorf("%s %s: %w", ref.Kind, key, errTargetNotGranted)
+	}
+
+	switch target := obj.(type) {
+	case *appsv1.Deployment:
+		return target.Spec.Template.DeepCopy(), nil
+	case *appsv1.StatefulSet:
+		template := target.Spec.Template.DeepCopy()
+		addClaimTemplateVolumes(&template.Spec, target.Spec.VolumeClaimTemplates)
+		return template, nil
+	default:
+		return obj.(*appsv1.ReplicaSet).Spec.Template.DeepCopy(), nil
+	}
+}
+
+func grantsNamespace(target client.Object, namespace string) bool {
+	for _, ns := range strings.Split(target.GetAnnotations()[targetNamespacesAnnotation], ",") {
+		if ns = strings.TrimSpace(ns); ns == "*" || ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// addClaimTemplateVolumes gives a pod cloned from a StatefulSet the volumes
+// its claim templates would have provided. They become generic ephemeral
+// volumes, so each session gets its own scratch claim that is deleted along
+// with the pod.
+func addClaimTemplateVolumes(spec *corev1.PodSpec, claims []corev1.PersistentVolumeClaim) {
+	for _, claim := range claims {
+		if hasVolume(spec, claim.Name) {
+			continue
+		}
+		spec.Volumes = append(spec.Volumes, corev1.Volume{
+			Name: claim.Name,
+			VolumeSource: corev1.VolumeSource{
+				Ephemeral: &corev1.EphemeralVolumeSource{
+					VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels:      claim.Labels,
+							Annotations: claim.Annotations,
+						},
+						Spec: *claim.Spec.DeepCopy(),
+					},
+				},
+			},
+		})
+	}
+}
+
+func hasVolume(spec *corev1.PodSpec, name string) bool {
+	for _, v := range spec.Volumes {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// bindingsForTarget returns a map function that maps events of workloads of
+// kind to the bindings cloning them, in any namespace, so template and grant
+// changes are picked up without waiting for a resync.
+func (r *SessionBindingReconciler) bindingsForTarget(kind string) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		list := &v1alpha1.SessionBindingList{}
+		key := index.TargetKey(kind, obj.GetNamespace(), obj.GetName())
+		if err := r.List(ctx, list, client.MatchingFields{index.TargetField: key}); err != nil {
+			return nil
+		}
+		requests := make([]reconcile.Request, 0, len(list.Items))
+		for i := range list.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+		}
+		return requests
+	}
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// DefaultTTLExpiringFraction is used when the reconciler is not configured
+// with a TTLExpiringFraction.
+const DefaultTTLExpiringFraction = 0.1
+
+// bindingExpiry returns creationTimestamp + spec.ttlSeconds; ok is false when
+// the binding has no TTL.
+func bindingExpiry(binding *v1alpha1.SessionBinding) (time.Time, bool) {
+	if binding.Spec.TTLSeconds == nil || *binding.Spec.TTLSeconds <= 0 {
+		return time.Time{}, false
+	}
+	return binding.CreationTimestamp.Add(time.Duration(*binding.Spec.TTLSeconds) * time.Second), true
+}
+
+// updateTTLStatus records expiresAt and the TTLExpiring condition, and returns
+// how long until the next TTL transition (warning threshold or expiry).
+func (r *SessionBindingReconciler) updateTTLStatus(binding *v1alpha1.SessionBinding, expiresAt time.Time, remaining time.Duration) time.Duration {
+	binding.Status.ExpiresAt = &metav1.Time{Time: expiresAt}
+
+	fraction := r.TTLExpiringFraction
+	if fraction <= 0 || fraction >= 1 {
+		fraction = DefaultTTLExpiringFraction
+	}
+	ttl := time.Duration(*binding.Spec.TTLSeconds) * time.Second
+	threshold := time.Duration(float64(ttl) * fraction)
+
+	switch {
+	case remaining <= 0:
+		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionTTLExpiring, metav1.ConditionTrue, "Expired", fmt.Sprintf("TTL elapsed at %s", expiresAt.UTC().Format(time.RFC3339)))
+		return 0
+	case remaining <= threshold:
+		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionTTLExpiring, metav1.ConditionTrue, "TTLExpiring", fmt.Sprintf("Session expires at %s", expiresAt.UTC().Format(time.RFC3339)))
+		return remaining
+	default:
+		r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionTTLExpiring, metav1.ConditionFalse, "TTLRemaining", fmt.Sprintf("Session expires at %s", expiresAt.UTC().Format(time.RFC3339)))
+		return remaining - threshold
+	}
+}
+
+// requeueBefore makes sure the binding is reconciled again no later than
+// after d, so expiry is acted on as soon as it is due.
+func requeueBefore(result ctrl.Result, d time.Duration) ctrl.Result {
+	if result.RequeueAfter == 0 || d < result.RequeueAfter {
+		result.RequeueAfter = d
+	}
+	return result
+}
+
+// expireBinding tears down the session pod and Cloudflare route once the TTL
+// or idle timeout has elapsed, or the session has ended in the session store. The route goes first, and the pod is kept
+// Draining for the drain grace period so in-flight requests can finish. The
+// binding itself is kept in phase Expired so its history stays inspectable;
+// deleting it is up to the owner.
+func (r *SessionBindingReconciler) expireBinding(ctx context.Context, logger logr.Logger, binding *v1alpha1.SessionBinding, reason, message string) (ctrl.Result, error) {
+	if binding.Status.Phase == v1alpha1.SessionBindingPhaseExpired && binding.Status.BoundPod == "" {
+		return ctrl.Result{}, nil
+	}
+
+	if grace := r.drainGracePeriod(binding); grace > 0 {
+		if binding.Status.DrainStartedAt == nil {
+			logger.Info("SessionBinding expired; removing route and draining session pod", "reason", message, "gracePeriod", grace)
+			if _, _, err := r.deleteSessionRoute(ctx, logger, binding); err != nil {
+				return ctrl.Result{}, err
+			}
+			r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionRouteConfigured, metav1.ConditionFalse, reason, "Cloudflare route removed: "+message)
+		}
+		if wait := r.drain(binding, grace); wait > 0 {
+			return ctrl.Result{RequeueAfter: wait}, nil
+		}
+	}
+
+	logger.Info("SessionBinding expired; removing session pod and route", "reason", message)
+	if err := r.cleanupResources(ctx, logger, binding); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	sessionExpirations.WithLabelValues(reason).Inc()
+	binding.Status.Phase = v1alpha1.SessionBindingPhaseExpired
+	binding.Status.BoundPod, binding.Status.BoundPodUID, binding.Status.BoundNode = "", "", ""
+	binding.Status.TemplateHash = ""
+	binding.Status.RouteEndpoint = ""
+	binding.Status.RouteID, binding.Status.RouteVersion = "", ""
+	binding.Status.Provider = nil
+	binding.Status.DrainStartedAt = nil
+	binding.Status.Replicas, binding.Status.ReadyReplicas = 0, 0
+	r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionPodReady, metav1.ConditionFalse, reason, "Session pod removed: "+message)
+	r.setCondition(&binding.Status.Conditions, v1alpha1.ConditionRouteConfigured, metav1.ConditionFalse, reason, "Cloudflare route removed: "+message)
+	r.Recorder.Event(binding, corev1.EventTypeNormal, reason, message)
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// RoutingModeTunnel runs a cloudflared sidecar in each session pod,
+// connecting the session's own Cloudflare Tunnel, and routes the session to
+// the tunnel. Cloudflare's edge never needs to reach pod IPs. Replicas of a
+// session run the same tunnel, which Cloudflare balances across.
+const RoutingModeTunnel = "Tunnel"
+
+// DefaultCloudflaredImage is the default for
+// SessionBindingReconciler.CloudflaredImage.
+const DefaultCloudflaredImage = "cloudflare/cloudflared:2024.6.1"
+
+const (
+	cloudflaredContainerName = "cloudflared"
+	// cloudflaredMetricsPort serves cloudflared's /ready, which succeeds
+	// once the tunnel has a connection to the edge.
+	cloudflaredMetricsPort = 2000
+	// tunnelTokenKey is read from the Secret named by
+	// spec.route.tunnelTokenSecretRef.
+	tunnelTokenKey = "token"
+)
+
+var errNoTunnelToken = errors.New("spec.route.tunnelTokenSecretRef is required in Tunnel routing mode")
+
+// validateTunnel checks that the binding can be served in Tunnel routing
+// mode: only cloned pods get the sidecar, and the session needs a tunnel.
+func (r *SessionBindingReconciler) validateTunnel(binding *v1alpha1.SessionBinding) error {
+	if r.RoutingMode != RoutingModeTunnel {
+		return nil
+	}
+	if binding.Spec.PodSelector != nil || binding.Spec.PoolRef != nil {
+		return errors.New("podSelector and poolRef bindings are not supported in Tunnel routing mode")
+	}
+	if binding.Spec.Route == nil || binding.Spec.Route.TunnelTokenSecretRef == nil {
+		return errNoTunnelToken
+	}
+	return nil
+}
+
+// injectCloudflared adds the cloudflared sidecar running the binding's
+// tunnel to pod, pointed at the session container's port.
+func (r *SessionBindingReconciler) injectCloudflared(pod *corev1.Pod, binding *v1alpha1.SessionBinding) {
+	if r.RoutingMode != RoutingModeTunnel || binding.Spec.Route == nil || binding.Spec.Route.TunnelTokenSecretRef == nil {
+		return
+	}
+	image := r.CloudflaredImage
+	if image == "" {
+		image = DefaultCloudflaredImage
+	}
+	pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{
+		Name:  cloudflaredContainerName,
+		Image: image,
+		Args: []string{
+			"tunnel", "--no-autoupdate",
+			"--metrics", fmt.Sprintf("0.0.0.0:%d", cloudflaredMetricsPort),
+			"--url", fmt.Sprintf("http://localhost:%d", podPort(pod)),
+			"run",
+		},
+		Env: []corev1.EnvVar{{
+			Name: "TUNNEL_TOKEN",
+			ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: *binding.Spec.Route.TunnelTokenSecretRef,
+				Key:                  tunnelTokenKey,
+			}},
+		}},
+		ReadinessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{
+				Path: "/ready",
+				Port: intstr.FromInt32(cloudflaredMetricsPort),
+			}},
+		},
+	})
+}
+
+// tunnelEndpoint returns the hostname of the binding's tunnel,
+// <tunnel ID>.cfargotunnel.com, which is what the session is routed to. The
+// tunnel ID is read from the token, base64-encoded JSON whose "t" is the ID.
+func (r *SessionBindingReconciler) tunnelEndpoint(ctx context.Context, binding *v1alpha1.SessionBinding) (string, error) {
+	if err := r.validateTunnel(binding); err != nil {
+		return "", err
+	}
+	key := types.NamespacedName{Namespace: binding.Namespace, Name: binding.Spec.Route.TunnelTokenSecretRef.Name}
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, key, secret); err != nil {
+		return "", fmt.Errorf("get tunnel token secret %s: %w", key, err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(string(secret.Data[tunnelTokenKey]))
+	if err != nil {
+		return "", fmt.Errorf("tunnel token in secret %s is not base64: %w", key, err)
+	}
+	var token struct {
+		TunnelID string `json:"t"`
+	}
+	if err := json.Unmarshal(raw, &token); err != nil || token.TunnelID == "" {
+		return "", fmt.Errorf("tunnel token in secret %s does not name a tunnel", key)
+	}
+	return token.TunnelID + ".cfargotunnel.com", nil
+}
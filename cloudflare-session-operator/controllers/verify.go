@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// recordBoundPod records pod as the binding's bound pod. A pod under the
+// bound pod's name but with another UID was recreated by something else,
+// typically with a new IP, so the route is due for verification right away
+// instead of at the next resync.
+func (r *SessionBindingReconciler) recordBoundPod(logger logr.Logger, binding *v1alpha1.SessionBinding, pod *corev1.Pod) {
+	if binding.Status.BoundPod == pod.Name && binding.Status.BoundPodUID != "" && binding.Status.BoundPodUID != pod.UID {
+		logger.Info("bound pod was recreated outside the operator; re-verifying its route", "pod", pod.Name, "previousUID", binding.Status.BoundPodUID, "uid", pod.UID)
+		r.Recorder.Event(binding, corev1.EventTypeWarning, "BoundPodRecreated", fmt.Sprintf("Pod %s was recreated outside the operator (UID %s, previously %s); re-verifying its route", pod.Name, pod.UID, binding.Status.BoundPodUID))
+		boundPodsRecreatedExternally.Inc()
+		if binding.Status.Provider != nil {
+			provider := *binding.Status.Provider
+			provider.LastVerifiedTime = nil
+			binding.Status.Provider = &provider
+		}
+	}
+	binding.Status.BoundPod = pod.Name
+	binding.Status.BoundPodUID = pod.UID
+	binding.Status.BoundNode = pod.Spec.NodeName
+}
+
+// verifyRoute reads the route of a bound binding back from Cloudflare, once
+// per route resync interval, and compares it with endpoint. verified is
+// false when no check was due or the client cannot read routes back; drift
+// describes the difference found, if any.
+func (r *SessionBindingReconciler) verifyRoute(ctx context.Context, cf cloudflare.Client, binding *v1alpha1.SessionBinding, pod *corev1.Pod, endpoint string) (verified bool, drift string, err error) {
+	if r.routesThroughCluster() || binding.Status.Phase != v1alpha1.SessionBindingPhaseBound || binding.Status.BoundPod != pod.Name || binding.Status.Provider == nil {
+		return false, "", nil
+	}
+	if last := binding.Status.Provider.LastVerifiedTime; last != nil && r.Clock.Now().Sub(last.Time) < r.Settings.Get().RouteResyncInterval {
+		return false, "", nil
+	}
+
+	route, err := cf.GetRoute(ctx, binding.Spec.SessionID, binding.Status.RouteID)
+	switch {
+	case errors.Is(err, cloudflare.ErrUnsupported):
+		return false, "", nil
+	case errors.Is(err, cloudflare.ErrRouteNotFound):
+		return true, fmt.Sprintf("route %s is missing", binding.Status.RouteID), nil
+	case err != nil:
+		return false, "", err
+	case route.Route.Endpoint != endpoint:
+		return true, fmt.Sprintf("route %s points at %s instead of %s", binding.Status.RouteID, route.Route.Endpoint, endpoint), nil
+	}
+	return true, "", nil
+}
+
+// refreshRouteVersion re-reads the route after a write lost to a newer one,
+// so the next attempt, made from a fresh look at the binding, is
+// conditional on what is there now.
+func (r *SessionBindingReconciler) refreshRouteVersion(ctx context.Context, cf cloudflare.Client, binding *v1alpha1.SessionBinding) error {
+	route, err := cf.GetRoute(ctx, binding.Spec.SessionID, binding.Status.RouteID)
+	switch {
+	case errors.Is(err, cloudflare.ErrRouteNotFound):
+		binding.Status.RouteVersion = ""
+	case err != nil:
+		return err
+	case route.Version == binding.Status.RouteVersion:
+		// The write conflicted on another route than status.routeID, e.g.
+		// one in a newly configured KV namespace, which the binding never
+		// saw a version of.
+		binding.Status.RouteVersion = ""
+	default:
+		binding.Status.RouteVersion = route.Version
+	}
+	return nil
+}
@@ -1,21 +1,42 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1beta1"
 	"github.com/Creme-ala-creme/cloudflare-session-operator/controllers"
 	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare"
-	"github.com/go-logr/stdr"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/diagnostics"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/eventsink"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/index"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/metricsauth"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/operatorconfig"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/provisioning"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/readiness"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/sessionevents"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/webhooks"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
-	"sigs.k8s.io/controller-runtime"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
-	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 )
 
 var (
@@ -26,60 +47,612 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(v1alpha1.AddToScheme(scheme))
+	utilruntime.Must(v1beta1.AddToScheme(scheme))
 }
 
 func main() {
 	var metricsAddr string
+	var metricsAuth bool
+	var metricsSecure bool
+	var metricsCertDir string
 	var probeAddr string
+	var pprofAddr string
+	var debugReconciles bool
 	var enableLeaderElection bool
+	var leaderElectionID string
+	var leaderElectionNamespace string
+	var leaseDuration time.Duration
+	var renewDeadline time.Duration
+	var retryPeriod time.Duration
+	var releaseLeaderOnShutdown bool
+	var ttlExpiringFraction float64
+	var enableWebhooks bool
+	var defaultTTLSeconds int64
+	var defaultTTLSecondsAfterFinished int64
+	var resourceProfilesFile string
+	var defaultProfile string
+	var allowCrossNamespaceTargets bool
+	var defaultPriorityClassName string
+	var maxConcurrentReconciles int
+	var rateLimiterBaseDelay time.Duration
+	var rateLimiterMaxDelay time.Duration
+	var watchNamespaces string
+	var watchLabelSelector string
+	var sessionServiceType string
+	var routingMode string
+	var routeBackend string
+	var loadBalancerPoolID string
+	var loadBalancerMonitorID string
+	var loadBalancerOriginWeight float64
+	var tunnelID string
+	var dnsZoneID string
+	var dnsRecordTarget string
+	var dnsOwnerID string
+	var sessionValidationURL string
+	var sessionKVNamespaceID string
+	var sessionCacheTTL time.Duration
+	var sessionCacheNegativeTTL time.Duration
+	var cloudflareRateLimit int
+	var cloudflareRateBurst int
+	var breakerThreshold int
+	var breakerOpenDuration time.Duration
+	var tokenVerifyInterval time.Duration
+	var tokenReloadInterval time.Duration
+	var cloudflareAPIURL string
+	var cloudflareCABundle string
+	var cloudflareTimeout time.Duration
+	var cloudflareTimeouts string
+	var cloudflaredImage string
+	var ingressClassName string
+	var gateway string
+	var cleanupRetryBudget int
+	var stuckThreshold time.Duration
+	var drainGracePeriod time.Duration
+	var dryRun bool
+	var resyncJitterFraction float64
+	var routeJanitorInterval time.Duration
+	var routeJanitorDryRun bool
+	var sessionEventsAddr string
+	var eventSinkURL string
+	var eventSinkFormat string
+	var sessionEventsCertFile string
+	var sessionEventsKeyFile string
+	var provisioningAddr string
+	var provisioningNamespaces string
+	var provisioningCertFile string
+	var provisioningKeyFile string
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
+	flag.BoolVar(&metricsAuth, "metrics-auth", true, "Only serve metrics to clients whose bearer token the API server authenticates and authorizes to get /metrics; without --metrics-secure the tokens travel in the clear.")
+	flag.BoolVar(&metricsSecure, "metrics-secure", false, "Serve metrics over HTTPS.")
+	flag.StringVar(&metricsCertDir, "metrics-cert-dir", "", "Directory holding the tls.crt and tls.key metrics are served with over HTTPS, reloaded when they change; a self-signed certificate is used when empty or missing.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.StringVar(&pprofAddr, "pprof-bind-address", "0", "The address /debug/pprof/ serves goroutine, heap and other runtime profiles on, unauthenticated; 0 disables it.")
+	flag.BoolVar(&debugReconciles, "debug-reconciles", false, "Serve a text dump of every controller's workqueue and reconciles in flight at "+diagnostics.ReconcilesPath+" on the metrics endpoint, behind the same --metrics-auth; clients need the get verb on that URL.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false, "Enable leader election for controller manager.")
+	flag.StringVar(&leaderElectionID, "leader-election-id", "sessionbinding.cloudflare.example", "Name of the Lease used for leader election.")
+	flag.StringVar(&leaderElectionNamespace, "leader-election-namespace", "", "Namespace of the leader election Lease; defaults to the operator's namespace.")
+	flag.DurationVar(&leaseDuration, "leader-election-lease-duration", 15*time.Second, "How long non-leaders wait after the last renewal before taking over leadership.")
+	flag.DurationVar(&renewDeadline, "leader-election-renew-deadline", 10*time.Second, "How long the leader keeps retrying to renew its lease before giving up leadership.")
+	flag.DurationVar(&retryPeriod, "leader-election-retry-period", 2*time.Second, "How often candidates try to acquire or renew leadership.")
+	flag.BoolVar(&releaseLeaderOnShutdown, "leader-election-release-on-shutdown", true, "Release the lease when the manager stops, so the next replica takes over right away instead of after the lease duration.")
+	flag.Float64Var(&ttlExpiringFraction, "ttl-expiring-fraction", controllers.DefaultTTLExpiringFraction, "Share of a SessionBinding's TTL below which its TTLExpiring condition turns True.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false, "Serve the SessionBinding admission webhooks (requires serving certificates in the webhook cert dir).")
+	flag.Int64Var(&defaultTTLSeconds, "default-ttl-seconds", 0, "TTL applied by the defaulting webhook to SessionBindings without spec.ttlSeconds (0 means no TTL, otherwise at least 60). The OperatorConfig can override it.")
+	flag.Int64Var(&defaultTTLSecondsAfterFinished, "default-ttl-seconds-after-finished", 0, "How long Expired and Error SessionBindings without spec.ttlSecondsAfterFinished are kept before they are deleted (0 keeps them). The OperatorConfig can override it.")
+	flag.StringVar(&resourceProfilesFile, "resource-profiles", "", "YAML file mapping profile names (small, medium, large) to resource requirements; built-in sizes are used when empty.")
+	flag.StringVar(&defaultProfile, "default-profile", "", "Resource profile applied to SessionBindings without spec.profile (empty keeps the target deployment's resources).")
+	flag.BoolVar(&allowCrossNamespaceTargets, "allow-cross-namespace-targets", false, "Allow SessionBindings to clone workloads from other namespaces that grant them via the cloudflare.example.com/allowed-namespaces annotation.")
+	flag.StringVar(&defaultPriorityClassName, "default-priority-class", "", "PriorityClass for session pods of SessionBindings without spec.priorityClassName (empty keeps the target's).")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1, fmt.Sprintf("SessionBindings reconciled at once (1-%d). The OperatorConfig can override it.", operatorconfig.MaxConcurrentReconcilesLimit))
+	flag.DurationVar(&rateLimiterBaseDelay, "rate-limiter-base-delay", 5*time.Millisecond, "Initial backoff before retrying a SessionBinding whose reconcile failed; it doubles on every further failure.")
+	flag.DurationVar(&rateLimiterMaxDelay, "rate-limiter-max-delay", 1000*time.Second, "Upper bound of the backoff between retries of a failing SessionBinding.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "", "Comma-separated namespaces whose objects the operator watches and manages; empty watches all namespaces.")
+	flag.StringVar(&watchLabelSelector, "watch-label-selector", "", "Label selector restricting the pods the operator caches. Session pods carry their target's pod template labels; pool pods and pods matched by spec.podSelector must match it as well.")
+	// --zap-devel, --zap-encoder, --zap-log-level, --zap-stacktrace-level
+	// and --zap-time-encoding configure logging.
+	zapOpts := zap.Options{}
+	zapOpts.BindFlags(flag.CommandLine)
+	flag.StringVar(&sessionServiceType, "session-service-type", "", "Front each session pod with a Service of this type (ClusterIP or Headless) and route sessions to its DNS name; empty routes to pod IPs.")
+	flag.StringVar(&routingMode, "routing-mode", controllers.RoutingModeCloudflare, "How session routes are programmed: Cloudflare (through the Cloudflare API), Ingress (an Ingress per session, for tunnels ending at a shared ingress controller), GatewayAPI (an HTTPRoute per session attached to --gateway) or Tunnel (through the Cloudflare API to the session's own tunnel, run by a cloudflared sidecar from spec.route.tunnelTokenSecretRef; egress NetworkPolicies must allow Cloudflare's edge).")
+	flag.StringVar(&routeBackend, "route-backend", cloudflare.ProviderWorkersKV, "Where routes programmed through the Cloudflare API live: WorkersKV (a KV entry per session, looked up by a Worker), LoadBalancer (an origin per session in --load-balancer-pool-id), Tunnel (a public hostname per session on --tunnel-id) or DNS (a proxied DNS record per session hostname in --dns-zone-id).")
+	flag.StringVar(&loadBalancerPoolID, "load-balancer-pool-id", "", "Cloudflare Load Balancer pool session origins are added to with --route-backend=LoadBalancer.")
+	flag.StringVar(&loadBalancerMonitorID, "load-balancer-monitor-id", "", "Health check monitor attached to --load-balancer-pool-id; empty keeps the pool's.")
+	flag.Float64Var(&loadBalancerOriginWeight, "load-balancer-origin-weight", 1, "Weight of session origins in --load-balancer-pool-id, from 0 to 1.")
+	flag.StringVar(&tunnelID, "tunnel-id", "", "Named Cloudflare Tunnel, dedicated to sessions, whose ingress rules route them with --route-backend=Tunnel; its cloudflared replicas must reach session pods.")
+	flag.StringVar(&dnsZoneID, "dns-zone-id", "", "Cloudflare zone session DNS records are created in with --route-backend=DNS.")
+	flag.StringVar(&dnsRecordTarget, "dns-record-target", "", "Hostname session DNS records are CNAMEs of, e.g. the tunnel or load balancer serving sessions; empty points them at the session endpoint.")
+	flag.StringVar(&dnsOwnerID, "dns-owner-id", cloudflare.DefaultDNSOwnerID, "Owner recorded in the ownership TXT records of session DNS records; operators sharing a zone need different ones.")
+	flag.StringVar(&sessionValidationURL, "session-validation-url", "", "Auth service endpoint sessions are validated at; \"{sessionID}\" is replaced with the session ID, otherwise passed as the sessionID query parameter. It answers 404 for unknown sessions and may return {\"active\": bool, \"expiresAt\": RFC 3339 time}.")
+	flag.StringVar(&sessionKVNamespaceID, "session-kv-namespace-id", "", "Workers KV namespace with a key per live session, expiring with it, that sessions are validated against when --session-validation-url is empty. Without either, every session is taken to exist.")
+	flag.DurationVar(&sessionCacheTTL, "session-cache-ttl", cloudflare.DefaultSessionCacheTTL, "How long a session found in the session store is taken to exist without looking it up again; session events end it early. 0 disables the session cache.")
+	flag.DurationVar(&sessionCacheNegativeTTL, "session-cache-negative-ttl", cloudflare.DefaultSessionCacheNegativeTTL, "How long a session missing from the session store is taken not to exist without looking it up again; session events end it early.")
+	flag.IntVar(&cloudflareRateLimit, "cloudflare-rate-limit", cloudflare.DefaultRateLimitRequests, "Cloudflare API requests the operator makes at most every 5 minutes, across all workers and credentials; 0 disables the limit.")
+	flag.IntVar(&cloudflareRateBurst, "cloudflare-rate-burst", cloudflare.DefaultRateLimitBurst, "Cloudflare API requests the operator may make at once within --cloudflare-rate-limit.")
+	flag.IntVar(&breakerThreshold, "cloudflare-breaker-threshold", cloudflare.DefaultBreakerThreshold, "Consecutive failed Cloudflare calls (5xx, 429 or network errors) after which calls fail fast for --cloudflare-breaker-open-duration; 0 disables the circuit breaker.")
+	flag.DurationVar(&breakerOpenDuration, "cloudflare-breaker-open-duration", cloudflare.DefaultBreakerOpenDuration, "How long Cloudflare calls fail fast once the circuit breaker opened, before a probe call is let through.")
+	flag.StringVar(&cloudflareAPIURL, "cloudflare-api-url", "", "Root of the Cloudflare API, e.g. a fake Cloudflare server for local development and end-to-end tests; empty uses CLOUDFLARE_API_BASE_URL or else Cloudflare's.")
+	flag.StringVar(&cloudflareCABundle, "cloudflare-ca-bundle", "", "PEM file of CA certificates trusted for Cloudflare API calls on top of the system's, e.g. those of an egress proxy intercepting TLS. The proxy itself is taken from HTTPS_PROXY and NO_PROXY.")
+	flag.DurationVar(&cloudflareTimeout, "cloudflare-timeout", cloudflare.DefaultTimeout, "How long an attempt at a Cloudflare API call may take.")
+	flag.StringVar(&cloudflareTimeouts, "cloudflare-timeouts", "", "Per-operation overrides of --cloudflare-timeout as comma-separated operation=duration pairs, e.g. kv.list=30s,dns.list=20s.")
+	flag.DurationVar(&tokenReloadInterval, "cloudflare-token-reload-interval", cloudflare.DefaultTokenReloadInterval, "How often the Cloudflare API token file given by CLOUDFLARE_API_TOKEN_FILE is read again, so rotated tokens are picked up without a restart.")
+	flag.DurationVar(&tokenVerifyInterval, "cloudflare-token-verify-interval", cloudflare.DefaultTokenVerifyInterval, "How often the Cloudflare API token is verified, starting at startup; the readiness check fails until it is verified, while Cloudflare rejects it and once Cloudflare is unreachable for 3 intervals. 0 disables verification.")
+	flag.StringVar(&cloudflaredImage, "cloudflared-image", controllers.DefaultCloudflaredImage, "Image of the cloudflared sidecar injected into session pods in Tunnel routing mode.")
+	flag.StringVar(&ingressClassName, "ingress-class", "", "IngressClass of the session Ingresses in Ingress routing mode; empty uses the cluster default.")
+	flag.StringVar(&gateway, "gateway", "", "Gateway session HTTPRoutes attach to in GatewayAPI routing mode, as namespace/name or namespace/name/sectionName.")
+	flag.IntVar(&cleanupRetryBudget, "cleanup-retry-budget", controllers.DefaultCleanupRetryBudget, "Failed route cleanups of a deleted SessionBinding after which its cloudflare.example.com/force-delete annotation is honoured.")
+	flag.DurationVar(&stuckThreshold, "stuck-binding-threshold", controllers.DefaultStuckThreshold, "How long a SessionBinding stays Pending or in Error before the cloudflare_session_bindings_stuck gauge counts it.")
+	flag.DurationVar(&drainGracePeriod, "drain-grace-period", 30*time.Second, "How long the pod of an expired or deleted SessionBinding keeps running after its route is removed, so in-flight requests can finish (0 deletes it right away). The OperatorConfig can override it.")
+	flag.BoolVar(&dryRun, "dry-run", false, "Log the pod, Service and route changes the operator would make, and list them in each SessionBinding's DryRun condition, without making them. Only the status of the operator's own resources is written.")
+	flag.Float64Var(&resyncJitterFraction, "resync-jitter-fraction", controllers.DefaultResyncJitterFraction, "Largest share by which the periodic route resync and error retry of a SessionBinding are stretched, fixed per binding, so bindings do not hit Cloudflare all at once.")
+	flag.DurationVar(&routeJanitorInterval, "route-janitor-interval", 0, "How often Cloudflare routes in the KV namespace are checked against the SessionBindings and those without one deleted (0 disables the janitor). Cannot be combined with --watch-namespaces.")
+	flag.BoolVar(&routeJanitorDryRun, "route-janitor-dry-run", false, "Only log and count the orphaned routes the janitor finds.")
+	flag.StringVar(&sessionEventsAddr, "session-events-bind-address", "", "Address to receive signed session lifecycle events from Cloudflare-side automation on, at /events; empty disables the receiver. The HMAC secret is read from SESSION_EVENTS_SECRET.")
+	flag.StringVar(&sessionEventsCertFile, "session-events-tls-cert", "", "Certificate file for serving session events over HTTPS.")
+	flag.StringVar(&sessionEventsKeyFile, "session-events-tls-key", "", "Key file for serving session events over HTTPS.")
+	flag.StringVar(&eventSinkURL, "event-sink-url", "", "URL to export the events the operator records and the phase transitions of SessionBindings to, so they outlive the cluster's event TTL; empty disables the export. Headers for every request, e.g. credentials, are read from EVENT_SINK_HEADERS as comma-separated key=value pairs.")
+	flag.StringVar(&eventSinkFormat, "event-sink-format", eventsink.FormatOTLP, "Format of the --event-sink-url requests: OTLP posts OTLP/HTTP JSON logs, e.g. to http://otel-collector:4318/v1/logs; Webhook posts a JSON array of records.")
+	flag.StringVar(&provisioningAddr, "provisioning-api-bind-address", "", "Address to serve the session provisioning API on, for services outside the cluster to create and delete sessions; empty disables it. Callers authenticate with the bearer token read from PROVISIONING_API_TOKEN.")
+	flag.StringVar(&provisioningNamespaces, "provisioning-api-namespaces", "", "Comma-separated namespaces the provisioning API may create sessions in; the first is the default.")
+	flag.StringVar(&provisioningCertFile, "provisioning-api-tls-cert", "", "Certificate file for serving the provisioning API over HTTPS.")
+	flag.StringVar(&provisioningKeyFile, "provisioning-api-tls-key", "", "Key file for serving the provisioning API over HTTPS.")
 	flag.Parse()
 
-	logger := stdr.New(os.Stdout)
-	log.SetLogger(logger)
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&zapOpts)))
 
+	if defaultTTLSeconds != 0 && defaultTTLSeconds < 60 {
+		setupLog.Error(fmt.Errorf("got %d", defaultTTLSeconds), "--default-ttl-seconds must be 0 or at least 60")
+		os.Exit(1)
+	}
+	if defaultTTLSecondsAfterFinished < 0 {
+		setupLog.Error(fmt.Errorf("got %d", defaultTTLSecondsAfterFinished), "--default-ttl-seconds-after-finished must not be negative")
+		os.Exit(1)
+	}
+	if drainGracePeriod < 0 {
+		setupLog.Error(fmt.Errorf("got %s", drainGracePeriod), "--drain-grace-period must not be negative")
+		os.Exit(1)
+	}
+	if stuckThreshold <= 0 {
+		setupLog.Error(fmt.Errorf("got %s", stuckThreshold), "--stuck-binding-threshold must be positive")
+		os.Exit(1)
+	}
+	if maxConcurrentReconciles < 1 || maxConcurrentReconciles > operatorconfig.MaxConcurrentReconcilesLimit {
+		setupLog.Error(fmt.Errorf("got %d", maxConcurrentReconciles), fmt.Sprintf("--max-concurrent-reconciles must be between 1 and %d", operatorconfig.MaxConcurrentReconcilesLimit))
+		os.Exit(1)
+	}
+	switch sessionServiceType {
+	case "", controllers.SessionServiceClusterIP, controllers.SessionServiceHeadless:
+	default:
+		setupLog.Error(fmt.Errorf("got %q", sessionServiceType), "--session-service-type must be ClusterIP, Headless or empty")
+		os.Exit(1)
+	}
+	var gatewayRef controllers.GatewayParentRef
+	if routeJanitorInterval < 0 || (routeJanitorInterval > 0 && watchNamespaces != "") {
+		// Bindings outside the watched namespaces are invisible, so their
+		// routes would look orphaned.
+		setupLog.Error(fmt.Errorf("got %s with --watch-namespaces=%q", routeJanitorInterval, watchNamespaces), "--route-janitor-interval must not be negative and requires the operator to watch all namespaces")
+		os.Exit(1)
+	}
+	// client-go requires the lease to outlast the renew deadline, and the
+	// deadline to leave room for a jittered retry.
+	if leaseDuration <= renewDeadline || float64(renewDeadline) <= leaderelection.JitterFactor*float64(retryPeriod) || retryPeriod <= 0 {
+		setupLog.Error(fmt.Errorf("got %s, %s and %s", leaseDuration, renewDeadline, retryPeriod), "--leader-election-lease-duration must exceed --leader-election-renew-deadline, which must exceed 1.2 times --leader-election-retry-period")
+		os.Exit(1)
+	}
+	switch routingMode {
+	case controllers.RoutingModeCloudflare, controllers.RoutingModeIngress, controllers.RoutingModeTunnel:
+	case controllers.RoutingModeGatewayAPI:
+		ref, err := controllers.ParseGatewayParentRef(gateway)
+		if err != nil {
+			setupLog.Error(err, "invalid --gateway")
+			os.Exit(1)
+		}
+		gatewayRef = ref
+	default:
+		setupLog.Error(fmt.Errorf("got %q", routingMode), "--routing-mode must be Cloudflare, Ingress, GatewayAPI or Tunnel")
+		os.Exit(1)
+	}
+	switch routeBackend {
+	case cloudflare.ProviderWorkersKV:
+	case cloudflare.ProviderLoadBalancer:
+		if loadBalancerPoolID == "" {
+			setupLog.Error(errors.New("--load-balancer-pool-id is empty"), "--route-backend=LoadBalancer requires a pool")
+			os.Exit(1)
+		}
+		if loadBalancerOriginWeight <= 0 || loadBalancerOriginWeight > 1 {
+			setupLog.Error(fmt.Errorf("got %v", loadBalancerOriginWeight), "--load-balancer-origin-weight must be above 0 and at most 1")
+			os.Exit(1)
+		}
+	case cloudflare.ProviderTunnel:
+		if tunnelID == "" {
+			setupLog.Error(errors.New("--tunnel-id is empty"), "--route-backend=Tunnel requires a tunnel")
+			os.Exit(1)
+		}
+		if routingMode != controllers.RoutingModeCloudflare {
+			setupLog.Error(fmt.Errorf("got %q", routingMode), "--route-backend=Tunnel requires --routing-mode=Cloudflare")
+			os.Exit(1)
+		}
+	case cloudflare.ProviderDNS:
+		if dnsZoneID == "" {
+			setupLog.Error(errors.New("--dns-zone-id is empty"), "--route-backend=DNS requires a zone")
+			os.Exit(1)
+		}
+	default:
+		setupLog.Error(fmt.Errorf("got %q", routeBackend), "--route-backend must be WorkersKV, LoadBalancer, Tunnel or DNS")
+		os.Exit(1)
+	}
+	if metricsCertDir != "" && !metricsSecure {
+		setupLog.Error(fmt.Errorf("got %q", metricsCertDir), "--metrics-cert-dir requires --metrics-secure")
+		os.Exit(1)
+	}
+	if debugReconciles && metricsAddr == "0" {
+		setupLog.Error(fmt.Errorf("got %q", metricsAddr), "--debug-reconciles requires --metrics-bind-address")
+		os.Exit(1)
+	}
+	sessionEventsSecret := os.Getenv("SESSION_EVENTS_SECRET")
+	if sessionEventsAddr != "" && sessionEventsSecret == "" {
+		setupLog.Error(errors.New("SESSION_EVENTS_SECRET is empty"), "--session-events-bind-address requires an HMAC secret")
+		os.Exit(1)
+	}
+	if (sessionEventsCertFile == "") != (sessionEventsKeyFile == "") {
+		setupLog.Error(fmt.Errorf("got %q and %q", sessionEventsCertFile, sessionEventsKeyFile), "--session-events-tls-cert and --session-events-tls-key must be set together")
+		os.Exit(1)
+	}
+	var sink *eventsink.Sink
+	if eventSinkURL != "" {
+		headers, err := eventsink.ParseHeaders(os.Getenv("EVENT_SINK_HEADERS"))
+		if err != nil {
+			setupLog.Error(err, "EVENT_SINK_HEADERS must list comma-separated key=value pairs")
+			os.Exit(1)
+		}
+		if sink, err = eventsink.New(eventSinkURL, eventSinkFormat, headers); err != nil {
+			setupLog.Error(err, "invalid --event-sink-url or --event-sink-format")
+			os.Exit(1)
+		}
+	}
+	provisioningToken := os.Getenv("PROVISIONING_API_TOKEN")
+	var provisioningNamespaceList []string
+	for _, ns := range strings.Split(provisioningNamespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			provisioningNamespaceList = append(provisioningNamespaceList, ns)
+		}
+	}
+	if provisioningAddr != "" {
+		if provisioningToken == "" {
+			setupLog.Error(errors.New("PROVISIONING_API_TOKEN is empty"), "--provisioning-api-bind-address requires a bearer token")
+			os.Exit(1)
+		}
+		if len(provisioningNamespaceList) == 0 {
+			setupLog.Error(fmt.Errorf("got %q", provisioningNamespaces), "--provisioning-api-bind-address requires --provisioning-api-namespaces")
+			os.Exit(1)
+		}
+	}
+	if (provisioningCertFile == "") != (provisioningKeyFile == "") {
+		setupLog.Error(fmt.Errorf("got %q and %q", provisioningCertFile, provisioningKeyFile), "--provisioning-api-tls-cert and --provisioning-api-tls-key must be set together")
+		os.Exit(1)
+	}
+	if rateLimiterBaseDelay <= 0 || rateLimiterMaxDelay < rateLimiterBaseDelay {
+		setupLog.Error(fmt.Errorf("got %s and %s", rateLimiterBaseDelay, rateLimiterMaxDelay), "--rate-limiter-base-delay must be positive and at most --rate-limiter-max-delay")
+		os.Exit(1)
+	}
+	if cloudflareRateLimit < 0 || cloudflareRateLimit > 0 && (cloudflareRateBurst < 1 || cloudflareRateBurst >= cloudflareRateLimit) {
+		setupLog.Error(fmt.Errorf("got %d and %d", cloudflareRateLimit, cloudflareRateBurst), "--cloudflare-rate-burst must be positive and below a non-negative --cloudflare-rate-limit")
+		os.Exit(1)
+	}
+	if sessionCacheTTL < 0 || sessionCacheNegativeTTL < 0 {
+		setupLog.Error(fmt.Errorf("got %s and %s", sessionCacheTTL, sessionCacheNegativeTTL), "--session-cache-ttl and --session-cache-negative-ttl must not be negative")
+		os.Exit(1)
+	}
+	if cloudflareAPIURL != "" {
+		if u, err := url.Parse(cloudflareAPIURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			setupLog.Error(fmt.Errorf("got %q", cloudflareAPIURL), "--cloudflare-api-url must be an http or https URL")
+			os.Exit(1)
+		}
+	}
+	if cloudflareTimeout <= 0 {
+		setupLog.Error(fmt.Errorf("got %s", cloudflareTimeout), "--cloudflare-timeout must be positive")
+		os.Exit(1)
+	}
+	timeouts, err := cloudflare.ParseTimeouts(cloudflareTimeouts)
+	if err != nil {
+		setupLog.Error(err, "invalid --cloudflare-timeouts")
+		os.Exit(1)
+	}
+	transport, err := cloudflare.NewTransport(cloudflareCABundle)
+	if err != nil {
+		setupLog.Error(err, "invalid --cloudflare-ca-bundle")
+		os.Exit(1)
+	}
+	if tokenReloadInterval <= 0 {
+		setupLog.Error(fmt.Errorf("got %s", tokenReloadInterval), "--cloudflare-token-reload-interval must be positive")
+		os.Exit(1)
+	}
+	if tokenVerifyInterval < 0 {
+		setupLog.Error(fmt.Errorf("got %s", tokenVerifyInterval), "--cloudflare-token-verify-interval must not be negative")
+		os.Exit(1)
+	}
+	if breakerThreshold > 0 && breakerOpenDuration <= 0 {
+		setupLog.Error(fmt.Errorf("got %s", breakerOpenDuration), "--cloudflare-breaker-open-duration must be positive")
+		os.Exit(1)
+	}
+
+	cacheOptions, err := newCacheOptions(watchNamespaces, watchLabelSelector)
+	if err != nil {
+		setupLog.Error(err, "invalid cache scope")
+		os.Exit(1)
+	}
+	for _, ns := range provisioningNamespaceList {
+		// The API reads sessions back from the cache.
+		if _, ok := cacheOptions.DefaultNamespaces[ns]; cacheOptions.DefaultNamespaces != nil && !ok {
+			setupLog.Error(fmt.Errorf("got %q", ns), "--provisioning-api-namespaces must be among --watch-namespaces")
+			os.Exit(1)
+		}
+	}
+
+	metricsOptions := metricsserver.Options{BindAddress: metricsAddr, SecureServing: metricsSecure, CertDir: metricsCertDir}
+	if metricsAuth {
+		metricsOptions.FilterProvider = metricsauth.WithAuthenticationAndAuthorization
+	}
+	if debugReconciles {
+		metricsOptions.ExtraHandlers = map[string]http.Handler{diagnostics.ReconcilesPath: diagnostics.ReconcilesHandler()}
+	}
+
+	// Releasing the lease on cancel is safe because main exits as soon as
+	// the manager stops, and every runnable stops with it.
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
-		MetricsBindAddress:     metricsAddr,
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "sessionbinding.cloudflare.example",
-		Cache: cache.Options{
-			SyncPeriod: func() *time.Duration {
-				d := 5 * time.Minute
-				return &d
-			}(),
-		},
+		Scheme:                        scheme,
+		Metrics:                       metricsOptions,
+		HealthProbeBindAddress:        probeAddr,
+		PprofBindAddress:              pprofAddr,
+		LeaderElection:                enableLeaderElection,
+		LeaderElectionID:              leaderElectionID,
+		LeaderElectionNamespace:       leaderElectionNamespace,
+		LeaderElectionReleaseOnCancel: releaseLeaderOnShutdown,
+		LeaseDuration:                 &leaseDuration,
+		RenewDeadline:                 &renewDeadline,
+		RetryPeriod:                   &retryPeriod,
+		Cache:                         cacheOptions,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-	cfClient := cloudflare.NewClientFromEnv()
+	if err := index.Register(context.Background(), mgr.GetFieldIndexer()); err != nil {
+		setupLog.Error(err, "unable to register field indexes")
+		os.Exit(1)
+	}
+
+	profiles := controllers.DefaultResourceProfiles()
+	if resourceProfilesFile != "" {
+		if profiles, err = controllers.LoadResourceProfiles(resourceProfilesFile); err != nil {
+			setupLog.Error(err, "unable to load resource profiles")
+			os.Exit(1)
+		}
+	}
+	if _, ok := profiles[defaultProfile]; defaultProfile != "" && !ok {
+		setupLog.Error(fmt.Errorf("profile %q not configured", defaultProfile), "invalid --default-profile")
+		os.Exit(1)
+	}
+
+	// Flags provide the base settings; the OperatorConfig overrides them at runtime.
+	baseSettings := operatorconfig.DefaultSettings()
+	baseSettings.DefaultTTLSeconds = defaultTTLSeconds
+	baseSettings.DefaultTTLSecondsAfterFinished = defaultTTLSecondsAfterFinished
+	baseSettings.DrainGracePeriod = drainGracePeriod
+	baseSettings.MaxConcurrentReconciles = maxConcurrentReconciles
+	settings := operatorconfig.NewStore(baseSettings)
+
+	// One limiter for every client keeps the operator under the limit even
+	// when bindings share an account through their own credentials.
+	var limiter *cloudflare.RateLimiter
+	if cloudflareRateLimit > 0 {
+		limiter = cloudflare.NewRateLimiter(cloudflareRateLimit, cloudflare.DefaultRateLimitWindow, cloudflareRateBurst)
+	}
+	var breaker *cloudflare.CircuitBreaker
+	if breakerThreshold > 0 {
+		breaker = cloudflare.NewCircuitBreaker(breakerThreshold, breakerOpenDuration)
+	}
+	var sessionCache *cloudflare.SessionCache
+	if sessionCacheTTL > 0 {
+		sessionCache = cloudflare.NewSessionCache(sessionCacheTTL, sessionCacheNegativeTTL)
+	}
+	// Bindings with their own credentials get a client of the same backend
+	// and session store.
+	withRouteBackend := func(api *cloudflare.APIClient) cloudflare.Client {
+		api.BaseURL = cloudflareAPIURL
+		api.HTTPClient.Transport = transport
+		api.Timeout = cloudflareTimeout
+		api.Timeouts = timeouts
+		api.SessionValidationURL = sessionValidationURL
+		api.SessionKVNamespaceID = sessionKVNamespaceID
+		api.Sessions = sessionCache
+		api.Limiter = limiter
+		api.Breaker = breaker
+		switch routeBackend {
+		case cloudflare.ProviderLoadBalancer:
+			lb := cloudflare.NewLoadBalancerClient(api, loadBalancerPoolID)
+			lb.MonitorID = loadBalancerMonitorID
+			lb.OriginWeight = loadBalancerOriginWeight
+			return lb
+		case cloudflare.ProviderTunnel:
+			tunnel := cloudflare.NewTunnelClient(api, tunnelID)
+			tunnel.HostnameTemplate = func() string { return settings.Get().RouteHostnameTemplate }
+			return tunnel
+		case cloudflare.ProviderDNS:
+			dns := cloudflare.NewDNSClient(api, dnsZoneID)
+			dns.Target = dnsRecordTarget
+			dns.OwnerID = dnsOwnerID
+			return dns
+		}
+		return api
+	}
+	api, err := cloudflare.NewClientFromEnv()
+	if err != nil {
+		setupLog.Error(err, "unable to configure the Cloudflare client")
+		os.Exit(1)
+	}
+	if cloudflareAPIURL == "" {
+		cloudflareAPIURL = api.BaseURL
+	}
+	cfClient := withRouteBackend(api)
+	newCloudflareClient := func(creds cloudflare.Credentials) cloudflare.Client {
+		return withRouteBackend(cloudflare.NewClientWithCredentials(creds))
+	}
+
+	if err = (&controllers.OperatorConfigReconciler{
+		Client:   mgr.GetClient(),
+		Settings: settings,
+		Breaker:  breaker,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "OperatorConfig")
+		os.Exit(1)
+	}
+
+	// With an event sink, the events of the controllers are exported too.
+	eventRecorderFor := mgr.GetEventRecorderFor
+	if sink != nil {
+		if err := mgr.Add(sink); err != nil {
+			setupLog.Error(err, "unable to set up event sink")
+			os.Exit(1)
+		}
+		eventRecorderFor = func(name string) record.EventRecorder {
+			return eventsink.Recorder(mgr.GetEventRecorderFor(name), sink, mgr.GetScheme())
+		}
+	}
 
-	if err = (&controllers.SessionBindingReconciler{
+	bindingReconciler := &controllers.SessionBindingReconciler{
 		Client:   mgr.GetClient(),
 		Scheme:   mgr.GetScheme(),
 		CFClient: cfClient,
-		Recorder: mgr.GetEventRecorderFor("sessionbinding-controller"),
+		Recorder: eventRecorderFor("sessionbinding-controller"),
 		Clock:    controllers.RealClock{},
-	}).SetupWithManager(mgr); err != nil {
+
+		TTLExpiringFraction:  ttlExpiringFraction,
+		ResyncJitterFraction: resyncJitterFraction,
+		ResourceProfiles:     profiles,
+		DefaultProfile:       defaultProfile,
+
+		NewCloudflareClient:        newCloudflareClient,
+		AllowCrossNamespaceTargets: allowCrossNamespaceTargets,
+		DefaultPriorityClassName:   defaultPriorityClassName,
+		SessionServiceType:         sessionServiceType,
+		RoutingMode:                routingMode,
+		CloudflaredImage:           cloudflaredImage,
+		IngressClassName:           ingressClassName,
+		Gateway:                    gatewayRef,
+		CleanupRetryBudget:         cleanupRetryBudget,
+		StuckThreshold:             stuckThreshold,
+		EventSink:                  sink,
+		DryRun:                     dryRun,
+		RouteJanitorInterval:       routeJanitorInterval,
+		RouteJanitorDryRun:         routeJanitorDryRun,
+		Settings:                   settings,
+		RateLimiter:                controllers.NewRateLimiter(rateLimiterBaseDelay, rateLimiterMaxDelay),
+	}
+	if err = bindingReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SessionBinding")
 		os.Exit(1)
 	}
 
+	if sessionEventsAddr != "" {
+		if err := mgr.Add(&sessionevents.Server{
+			Addr:     sessionEventsAddr,
+			CertFile: sessionEventsCertFile,
+			KeyFile:  sessionEventsKeyFile,
+			Handler: &sessionevents.Handler{
+				Secret: []byte(sessionEventsSecret),
+				Notify: func(ctx context.Context, ev sessionevents.Event) (int, error) {
+					if sessionCache != nil {
+						sessionCache.Invalidate(ev.SessionID)
+					}
+					return bindingReconciler.NotifySession(ctx, ev)
+				},
+			},
+		}); err != nil {
+			setupLog.Error(err, "unable to set up session event receiver")
+			os.Exit(1)
+		}
+	}
+
+	if provisioningAddr != "" {
+		if err := mgr.Add(&provisioning.Server{
+			Addr:     provisioningAddr,
+			CertFile: provisioningCertFile,
+			KeyFile:  provisioningKeyFile,
+			Handler: &provisioning.Handler{
+				Client:     mgr.GetClient(),
+				Token:      []byte(provisioningToken),
+				Namespaces: provisioningNamespaceList,
+			},
+		}); err != nil {
+			setupLog.Error(err, "unable to set up provisioning API")
+			os.Exit(1)
+		}
+	}
+
+	if err = (&controllers.SessionPoolReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: eventRecorderFor("sessionpool-controller"),
+
+		AllowCrossNamespaceTargets: allowCrossNamespaceTargets,
+		DryRun:                     dryRun,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SessionPool")
+		os.Exit(1)
+	}
+
+	if enableWebhooks {
+		if err := (&webhooks.SessionBindingDefaulter{
+			Settings: settings,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "SessionBinding")
+			os.Exit(1)
+		}
+		if err := (&webhooks.SessionBindingValidator{
+			Reader: mgr.GetClient(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "SessionBinding")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
 	}
-	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+	if err := mgr.AddReadyzCheck("informer-caches", readiness.CacheSynced(mgr.GetCache())); err != nil {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	// Leadership is deliberately not a readiness condition: standby replicas
+	// serve the SessionBinding webhooks, whose failurePolicy is Fail, and
+	// must stay in the Service while the lease changes hands.
+	if enableWebhooks {
+		if err := mgr.AddReadyzCheck("webhook-server", mgr.GetWebhookServer().StartedChecker()); err != nil {
+			setupLog.Error(err, "unable to set up ready check")
+			os.Exit(1)
+		}
+	}
+	if api.TokenFile != nil {
+		api.TokenFile.Interval = tokenReloadInterval
+		if err := mgr.Add(api.TokenFile); err != nil {
+			setupLog.Error(err, "unable to set up Cloudflare token reloading")
+			os.Exit(1)
+		}
+	}
+	if tokenVerifyInterval > 0 {
+		verifier := &cloudflare.TokenVerifier{Client: api, Interval: tokenVerifyInterval}
+		if err := mgr.Add(verifier); err != nil {
+			setupLog.Error(err, "unable to set up Cloudflare token verification")
+			os.Exit(1)
+		}
+		if err := mgr.AddReadyzCheck("cloudflare-token", verifier.Check); err != nil {
+			setupLog.Error(err, "unable to set up ready check")
+			os.Exit(1)
+		}
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
@@ -87,3 +660,32 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// newCacheOptions scopes the manager cache to the comma-separated
+// namespaces, and its pods to podSelector; empty values leave the cache
+// cluster-wide.
+func newCacheOptions(namespaces, podSelector string) (cache.Options, error) {
+	syncPeriod := 5 * time.Minute
+	opts := cache.Options{SyncPeriod: &syncPeriod}
+
+	for _, ns := range strings.Split(namespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns == "" {
+			continue
+		}
+		if opts.DefaultNamespaces == nil {
+			opts.DefaultNamespaces = map[string]cache.Config{}
+		}
+		opts.DefaultNamespaces[ns] = cache.Config{}
+	}
+
+	if podSelector != "" {
+		selector, err := labels.Parse(podSelector)
+		if err != nil {
+			return cache.Options{}, fmt.Errorf("--watch-label-selector: %w", err)
+		}
+		opts.ByObject = map[client.Object]cache.ByObject{
+			&corev1.Pod{}: {Label: selector},
+		}
+	}
+	return opts, nil
+}
@@ -0,0 +1,179 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the root of the Cloudflare v4 API.
+const DefaultBaseURL = "https://api.cloudflare.com/client/v4"
+
+// maxResponseBytes caps the responses read from the API.
+const maxResponseBytes = 10 << 20
+
+// apiResponse is the envelope of Cloudflare API responses.
+type apiResponse struct {
+	Success    bool            `json:"success"`
+	Errors     []apiMessage    `json:"errors"`
+	Result     json.RawMessage `json:"result"`
+	ResultInfo *resultInfo     `json:"result_info,omitempty"`
+}
+
+type apiMessage struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// resultInfo describes a page of a list response, paged by cursor or by
+// page number depending on the endpoint.
+type resultInfo struct {
+	Count      int    `json:"count"`
+	Cursor     string `json:"cursor"`
+	Page       int    `json:"page"`
+	TotalPages int    `json:"total_pages"`
+}
+
+// apiError is a failed API call.
+type apiError struct {
+	StatusCode int
+	Errors     []apiMessage
+	// retryAfter is the delay the response's Retry-After header asks for.
+	retryAfter time.Duration
+}
+
+func (e *apiError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("cloudflare: HTTP %d", e.StatusCode)
+	}
+	messages := make([]string, len(e.Errors))
+	for i, m := range e.Errors {
+		messages[i] = fmt.Sprintf("%s (code %d)", m.Message, m.Code)
+	}
+	return fmt.Sprintf("cloudflare: HTTP %d: %s", e.StatusCode, strings.Join(messages, "; "))
+}
+
+// newRequest builds an authenticated request to path under the API root;
+// operation names it in metrics and traces.
+func (c *APIClient) newRequest(ctx context.Context, operation, method, path string, body io.Reader) (*http.Request, error) {
+	base := c.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	req, err := http.NewRequestWithContext(withOperation(ctx, operation), method, strings.TrimSuffix(base, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	c.authenticate(req, path)
+	return req, nil
+}
+
+// do sends req and returns the raw body of a successful response. Failed
+// responses are returned as *apiError, decoded from the envelope when the
+// body has one. Idempotent requests are retried as c.Retry allows; every
+// attempt waits for c.Limiter, if any. c.Breaker, if any, sees the outcome
+// of the call, retries included. Every call is traced and every attempt
+// measured.
+func (c *APIClient) do(req *http.Request) (body []byte, err error) {
+	req, span := startSpan(req)
+	defer func() { endSpan(span, err) }()
+	if c.Breaker == nil {
+		return c.doRetry(req)
+	}
+	if err := c.Breaker.allow(); err != nil {
+		return nil, err
+	}
+	body, err = c.doRetry(req)
+	c.Breaker.done(err)
+	return body, err
+}
+
+func (c *APIClient) doRetry(req *http.Request) ([]byte, error) {
+	for attempt := 1; ; attempt++ {
+		if c.Limiter != nil {
+			if err := c.Limiter.Wait(req.Context()); err != nil {
+				return nil, fmt.Errorf("cloudflare: waiting for rate limiter: %w", err)
+			}
+		}
+		body, err := c.send(req)
+		delay, retry := c.retryDelay(req, attempt, err)
+		if err == nil || !retry {
+			return body, err
+		}
+		traceRetry(req, attempt, delay)
+		if sleep(req.Context(), delay) != nil || rewind(req) != nil {
+			return nil, err
+		}
+	}
+}
+
+// send makes one attempt at req, within the timeout of its operation.
+func (c *APIClient) send(req *http.Request) ([]byte, error) {
+	timeout := c.timeout(req.Context(), operationOf(req.Context()))
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+	start := time.Now()
+	resp, err := c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		observeAttempt(req, 0, start)
+		return nil, attemptError(ctx, req, timeout, err)
+	}
+	defer resp.Body.Close()
+	observeRateLimitHeaders(resp.Header)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	observeAttempt(req, resp.StatusCode, start)
+	if err != nil {
+		return nil, attemptError(ctx, req, timeout, err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return body, nil
+	}
+	apiErr := &apiError{StatusCode: resp.StatusCode}
+	apiErr.retryAfter, _ = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	var envelope apiResponse
+	if json.Unmarshal(body, &envelope) == nil {
+		apiErr.Errors = envelope.Errors
+	}
+	return nil, apiErr
+}
+
+// errAttemptTimeout is an attempt that outlasted its timeout. Unlike the
+// caller giving up, it is worth retrying and counts against Cloudflare.
+var errAttemptTimeout = errors.New("cloudflare: attempt timed out")
+
+// attemptError is the error of the attempt at req made with ctx, which
+// failed with err: an errAttemptTimeout when ctx timed out before the
+// request's own context was done.
+func attemptError(ctx context.Context, req *http.Request, timeout time.Duration, err error) error {
+	if ctx.Err() != nil && req.Context().Err() == nil {
+		return fmt.Errorf("%w after %s: %v", errAttemptTimeout, timeout, err)
+	}
+	return err
+}
+
+// doJSON sends req and decodes the envelope of its response, returning it
+// once the result, if any, is decoded into result.
+func (c *APIClient) doJSON(req *http.Request, result any) (*apiResponse, error) {
+	body, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	var envelope apiResponse
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("cloudflare: decoding response: %w", err)
+	}
+	if !envelope.Success {
+		return nil, &apiError{StatusCode: http.StatusOK, Errors: envelope.Errors}
+	}
+	if result != nil && len(envelope.Result) > 0 {
+		if err := json.Unmarshal(envelope.Result, result); err != nil {
+			return nil, fmt.Errorf("cloudflare: decoding result: %w", err)
+		}
+	}
+	return &envelope, nil
+}
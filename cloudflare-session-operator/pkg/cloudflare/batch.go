@@ -0,0 +1,260 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// RouteWrite is a route of a batch: the arguments of EnsureRoute.
+type RouteWrite struct {
+	SessionID string
+	Route     Route
+	Options   RouteOptions
+}
+
+// BatchClient is implemented by clients writing and deleting many routes
+// in a few API calls instead of one or more per route, so mass operations
+// such as a cluster failover or the collection of expired routes do not
+// issue thousands of them. EnsureRoutes and DeleteRoutes use it when the
+// client has it.
+//
+// A RouteErrors returned by either method tells which routes failed, the
+// others succeeded; any other error failed them all.
+type BatchClient interface {
+	// BatchEnsureRoutes does what EnsureRoute does for every route and
+	// returns their records in the same order.
+	BatchEnsureRoutes(ctx context.Context, routes []RouteWrite) ([]RouteRecord, error)
+	// BatchDeleteRoutes does what DeleteRoute does with the SessionID and
+	// ID of every route.
+	BatchDeleteRoutes(ctx context.Context, routes []RouteRecord) error
+}
+
+// RouteErrors are the errors of the routes of a batch that failed, by the
+// index of the route in the batch.
+type RouteErrors map[int]error
+
+func (e RouteErrors) Error() string {
+	first := -1
+	for i := range e {
+		if first < 0 || i < first {
+			first = i
+		}
+	}
+	if len(e) == 1 {
+		return fmt.Sprintf("route %d: %v", first, e[first])
+	}
+	return fmt.Sprintf("%d routes failed, route %d: %v", len(e), first, e[first])
+}
+
+// Unwrap returns the errors in route order, for errors.Is and errors.As.
+func (e RouteErrors) Unwrap() []error {
+	indices := make([]int, 0, len(e))
+	for i := range e {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+	errs := make([]error, len(indices))
+	for n, i := range indices {
+		errs[n] = e[i]
+	}
+	return errs
+}
+
+// orNil returns e, or nil when no route failed.
+func (e RouteErrors) orNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// failAll records err for the routes at indices.
+func (e RouteErrors) failAll(indices []int, err error) {
+	for _, i := range indices {
+		e[i] = err
+	}
+}
+
+// EnsureRoutes ensures every route with c, in a batch when c is a
+// BatchClient and one route at a time otherwise.
+func EnsureRoutes(ctx context.Context, c Client, routes []RouteWrite) ([]RouteRecord, error) {
+	if len(routes) == 0 {
+		return nil, nil
+	}
+	if b, ok := c.(BatchClient); ok {
+		return b.BatchEnsureRoutes(ctx, routes)
+	}
+	return ensureEach(ctx, c, routes)
+}
+
+// DeleteRoutes deletes every route with c, in a batch when c is a
+// BatchClient and one route at a time otherwise.
+func DeleteRoutes(ctx context.Context, c Client, routes []RouteRecord) error {
+	if len(routes) == 0 {
+		return nil
+	}
+	if b, ok := c.(BatchClient); ok {
+		return b.BatchDeleteRoutes(ctx, routes)
+	}
+	return deleteEach(ctx, c, routes)
+}
+
+func ensureEach(ctx context.Context, c Client, routes []RouteWrite) ([]RouteRecord, error) {
+	records := make([]RouteRecord, len(routes))
+	errs := RouteErrors{}
+	for i, w := range routes {
+		record, err := c.EnsureRoute(ctx, w.SessionID, w.Route, w.Options)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		records[i] = record
+	}
+	return records, errs.orNil()
+}
+
+func deleteEach(ctx context.Context, c Client, routes []RouteRecord) error {
+	errs := RouteErrors{}
+	for i, route := range routes {
+		if err := c.DeleteRoute(ctx, route.SessionID, route.ID); err != nil {
+			errs[i] = err
+		}
+	}
+	return errs.orNil()
+}
+
+// BatchEnsureRoutes writes the routes with the Workers KV bulk endpoint, in
+// as few calls as kvBulkLimit and their namespaces allow. Unlike
+// EnsureRoute it does not read every entry back; the versions of routes
+// with IfVersion are still checked one by one.
+func (c *APIClient) BatchEnsureRoutes(ctx context.Context, routes []RouteWrite) ([]RouteRecord, error) {
+	records := make([]RouteRecord, len(routes))
+	errs := RouteErrors{}
+	batches := map[string]*kvBatch{}
+	var namespaces []string
+	for i, w := range routes {
+		if err := validateRoute(w.SessionID, w.Route, w.Options.PathPrefix); err != nil {
+			errs[i] = err
+			continue
+		}
+		namespaceID := w.Options.KVNamespaceID
+		if namespaceID == "" {
+			namespaceID = c.KVNamespaceID
+		}
+		key := routeKey(w.SessionID)
+		records[i] = RouteRecord{ID: kvRouteID(namespaceID, key), Provider: ProviderWorkersKV}
+		if !c.hasCredentials() {
+			continue
+		}
+		if namespaceID == "" {
+			errs[i] = errNoKVNamespace
+			continue
+		}
+		if version := w.Options.IfVersion; version != "" {
+			if err := c.checkRouteVersion(ctx, namespaceID, key, w.Route.Endpoint, version); err != nil {
+				errs[i] = err
+				continue
+			}
+		}
+		b, ok := batches[namespaceID]
+		if !ok {
+			b = &kvBatch{}
+			batches[namespaceID] = b
+			namespaces = append(namespaces, namespaceID)
+		}
+		metadata := newRouteMetadata(w.SessionID, w.Route, w.Options)
+		records[i].Version = metadata.Version
+		b.indices = append(b.indices, i)
+		b.entries = append(b.entries, kvBulkEntry{
+			Key:        key,
+			Value:      w.Route.Endpoint,
+			Metadata:   metadata,
+			Expiration: kvExpiration(w.Route.ExpiresAt),
+		})
+	}
+	for _, namespaceID := range namespaces {
+		b := batches[namespaceID]
+		for start := 0; start < len(b.entries); start += kvBulkLimit {
+			end := min(start+kvBulkLimit, len(b.entries))
+			kvBulk(errs, b.indices[start:end], b.keys(start, end), func() ([]string, error) {
+				return c.kvBulkPut(ctx, namespaceID, b.entries[start:end])
+			})
+		}
+	}
+	return records, errs.orNil()
+}
+
+// BatchDeleteRoutes deletes the routes with the Workers KV bulk endpoint,
+// in as few calls as kvBulkLimit and their namespaces allow.
+func (c *APIClient) BatchDeleteRoutes(ctx context.Context, routes []RouteRecord) error {
+	if !c.hasCredentials() {
+		return nil
+	}
+	errs := RouteErrors{}
+	batches := map[string]*kvBatch{}
+	var namespaces []string
+	for i, route := range routes {
+		if route.ID == "" && route.SessionID == "" {
+			continue
+		}
+		namespaceID, key, err := c.parseRouteID(route.SessionID, route.ID)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		b, ok := batches[namespaceID]
+		if !ok {
+			b = &kvBatch{}
+			batches[namespaceID] = b
+			namespaces = append(namespaces, namespaceID)
+		}
+		b.indices = append(b.indices, i)
+		b.entries = append(b.entries, kvBulkEntry{Key: key})
+	}
+	for _, namespaceID := range namespaces {
+		b := batches[namespaceID]
+		for start := 0; start < len(b.entries); start += kvBulkLimit {
+			end := min(start+kvBulkLimit, len(b.entries))
+			keys := b.keys(start, end)
+			kvBulk(errs, b.indices[start:end], keys, func() ([]string, error) {
+				return c.kvBulkDelete(ctx, namespaceID, keys)
+			})
+		}
+	}
+	return errs.orNil()
+}
+
+// kvBatch is the part of a batch in one namespace, with the index in the
+// batch of every entry; the entries of a delete only have their Key.
+type kvBatch struct {
+	indices []int
+	entries []kvBulkEntry
+}
+
+func (b *kvBatch) keys(start, end int) []string {
+	keys := make([]string, 0, end-start)
+	for _, e := range b.entries[start:end] {
+		keys = append(keys, e.Key)
+	}
+	return keys
+}
+
+// kvBulk makes a bulk call on keys, the routes at indices, and records in
+// errs the routes it failed.
+func kvBulk(errs RouteErrors, indices []int, keys []string, call func() ([]string, error)) {
+	unsuccessful, err := call()
+	if err != nil {
+		errs.failAll(indices, err)
+		return
+	}
+	failed := map[string]bool{}
+	for _, key := range unsuccessful {
+		failed[key] = true
+	}
+	for n, key := range keys {
+		if failed[key] {
+			errs[indices[n]] = fmt.Errorf("cloudflare: Workers KV did not apply the bulk change of %s", key)
+		}
+	}
+}
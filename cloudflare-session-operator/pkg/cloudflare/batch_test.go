@@ -0,0 +1,205 @@
+package cloudflare_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare/fake"
+)
+
+// failingBulk makes Workers KV bulk calls skip the keys in failing and
+// report them as unsuccessful_keys, as KV does the keys it did not apply.
+func failingBulk(t *testing.T, srv *fake.Server, failing ...string) *recorder {
+	skip := map[string]bool{}
+	for _, key := range failing {
+		skip[key] = true
+	}
+	return &recorder{next: srv, intercept: func(w http.ResponseWriter, req *http.Request) bool {
+		if !strings.HasSuffix(req.URL.Path, "/bulk") {
+			return false
+		}
+		var unsuccessful []string
+		var applied any
+		if req.Method == http.MethodPut {
+			var pairs []map[string]any
+			bulkBody(t, req, &pairs)
+			kept := []map[string]any{}
+			for _, pair := range pairs {
+				if key, _ := pair["key"].(string); skip[key] {
+					unsuccessful = append(unsuccessful, key)
+					continue
+				}
+				kept = append(kept, pair)
+			}
+			applied = kept
+		} else {
+			var keys []string
+			bulkBody(t, req, &keys)
+			kept := []string{}
+			for _, key := range keys {
+				if skip[key] {
+					unsuccessful = append(unsuccessful, key)
+					continue
+				}
+				kept = append(kept, key)
+			}
+			applied = kept
+		}
+		body, err := json.Marshal(applied)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			w.WriteHeader(rec.Code)
+			_, _ = w.Write(rec.Body.Bytes())
+			return true
+		}
+		writeSuccess(w, map[string]any{"successful_key_count": 0, "unsuccessful_keys": unsuccessful})
+		return true
+	}}
+}
+
+func TestBatchEnsureRoutes(t *testing.T) {
+	ctx := context.Background()
+	srv := fake.NewServer()
+	rec := failingBulk(t, srv, "session:s3")
+	c := newTestClient(t, rec)
+	stale, err := c.EnsureRoute(ctx, "s4", cloudflare.Route{Endpoint: "10.0.0.4:80"}, cloudflare.RouteOptions{})
+	if err != nil {
+		t.Fatalf("EnsureRoute: %v", err)
+	}
+	if _, err := c.EnsureRoute(ctx, "s4", cloudflare.Route{Endpoint: "10.0.0.5:80"}, cloudflare.RouteOptions{}); err != nil {
+		t.Fatalf("EnsureRoute: %v", err)
+	}
+
+	records, err := cloudflare.EnsureRoutes(ctx, c, []cloudflare.RouteWrite{
+		{SessionID: "s1", Route: cloudflare.Route{Endpoint: "10.0.0.1:80"}},
+		{SessionID: "s2", Route: cloudflare.Route{Endpoint: "10.0.0.2:80"}, Options: cloudflare.RouteOptions{KVNamespaceID: "other"}},
+		{SessionID: "s3", Route: cloudflare.Route{Endpoint: "10.0.0.3:80"}},
+		{SessionID: "s4", Route: cloudflare.Route{Endpoint: "10.0.0.6:80"}, Options: cloudflare.RouteOptions{IfVersion: stale.Version}},
+		{SessionID: "", Route: cloudflare.Route{Endpoint: "10.0.0.7:80"}},
+	})
+	var errs cloudflare.RouteErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("EnsureRoutes: %v, want RouteErrors", err)
+	}
+	if len(errs) != 3 || errs[2] == nil || !errors.Is(errs[3], cloudflare.ErrConflict) || errs[4] == nil {
+		t.Fatalf("EnsureRoutes failed %v, want routes 2 to 4 failed, 3 in conflict", errs)
+	}
+	if !errors.Is(err, cloudflare.ErrConflict) {
+		t.Fatalf("errors.Is(%v, ErrConflict) = false", err)
+	}
+	if records[0].ID != testNamespace+"/session:s1" || records[0].Version == "" || records[1].ID != "other/session:s2" {
+		t.Fatalf("records = %+v", records)
+	}
+	// One bulk write per namespace.
+	if n := rec.count(http.MethodPut, "/bulk"); n != 2 {
+		t.Fatalf("made %d bulk writes, want 2", n)
+	}
+
+	for ns, want := range map[string]map[string]string{
+		testNamespace: {"session:s1": "10.0.0.1:80", "session:s4": "10.0.0.5:80"},
+		"other":       {"session:s2": "10.0.0.2:80"},
+	} {
+		for key, endpoint := range want {
+			if got, _ := srv.Value(ns, key); got != endpoint {
+				t.Errorf("%s/%s = %q want %q", ns, key, got, endpoint)
+			}
+		}
+	}
+	if _, ok := srv.Value(testNamespace, "session:s3"); ok {
+		t.Errorf("the route KV did not apply was written")
+	}
+	got, err := c.GetRoute(ctx, "s1", "")
+	if err != nil || got.Version != records[0].Version {
+		t.Fatalf("GetRoute = %+v, %v, want version %s", got, err, records[0].Version)
+	}
+}
+
+func TestBatchDeleteRoutes(t *testing.T) {
+	ctx := context.Background()
+	srv := fake.NewServer()
+	for _, key := range []string{"session:s1", "session:s2", "session:s3"} {
+		srv.PutValue(testNamespace, key, "10.0.0.1:80", time.Time{})
+	}
+	srv.PutValue("other", "session:s4", "10.0.0.1:80", time.Time{})
+	rec := failingBulk(t, srv, "session:s2")
+	c := newTestClient(t, rec)
+
+	err := cloudflare.DeleteRoutes(ctx, c, []cloudflare.RouteRecord{
+		{SessionID: "s1"},
+		{ID: testNamespace + "/session:s2"},
+		{ID: testNamespace + "/session:s3"},
+		{ID: "other/session:s4"},
+		{},
+	})
+	var errs cloudflare.RouteErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[1] == nil {
+		t.Fatalf("DeleteRoutes: %v, want route 1 failed", err)
+	}
+	if n := rec.count(http.MethodDelete, "/bulk"); n != 2 {
+		t.Fatalf("made %d bulk deletes, want 2", n)
+	}
+	for ns, keys := range map[string][]string{testNamespace: {"session:s1", "session:s3"}, "other": {"session:s4"}} {
+		for _, key := range keys {
+			if _, ok := srv.Value(ns, key); ok {
+				t.Errorf("%s/%s was not deleted", ns, key)
+			}
+		}
+	}
+	if _, ok := srv.Value(testNamespace, "session:s2"); !ok {
+		t.Errorf("the route KV did not delete is gone")
+	}
+}
+
+func TestEnsureRoutesOneAtATimeWithoutBatches(t *testing.T) {
+	ctx := context.Background()
+	f := &fake.Client{}
+	f.FailNext(fake.MethodEnsureRoute, nil, cloudflare.ErrConflict)
+	// Hides the fake's BatchEnsureRoutes.
+	c := struct{ cloudflare.Client }{f}
+
+	records, err := cloudflare.EnsureRoutes(ctx, c, []cloudflare.RouteWrite{
+		{SessionID: "s1", Route: cloudflare.Route{Endpoint: "10.0.0.1:80"}},
+		{SessionID: "s2", Route: cloudflare.Route{Endpoint: "10.0.0.2:80"}},
+		{SessionID: "s3", Route: cloudflare.Route{Endpoint: "10.0.0.3:80"}},
+	})
+	var errs cloudflare.RouteErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || !errors.Is(errs[1], cloudflare.ErrConflict) {
+		t.Fatalf("EnsureRoutes: %v, want route 1 in conflict", err)
+	}
+	if records[0].ID == "" || records[1].ID != "" || records[2].ID == "" {
+		t.Fatalf("records = %+v", records)
+	}
+	if n := len(f.Calls(fake.MethodEnsureRoute)); n != 3 {
+		t.Fatalf("made %d EnsureRoute calls, want 3", n)
+	}
+	if len(f.Calls(fake.MethodBatchEnsureRoutes)) != 0 {
+		t.Fatalf("used BatchEnsureRoutes of a client not offering it")
+	}
+}
+
+func TestRouteErrors(t *testing.T) {
+	errs := cloudflare.RouteErrors{3: cloudflare.ErrConflict, 1: errors.New("boom")}
+	if got := errs.Error(); got != "2 routes failed, route 1: boom" {
+		t.Fatalf("Error() = %q", got)
+	}
+	if !errors.Is(errs, cloudflare.ErrConflict) {
+		t.Fatalf("errors.Is(%v, ErrConflict) = false", errs)
+	}
+	if got := (cloudflare.RouteErrors{2: cloudflare.ErrConflict}).Error(); !strings.HasPrefix(got, "route 2: ") {
+		t.Fatalf("Error() = %q", got)
+	}
+}
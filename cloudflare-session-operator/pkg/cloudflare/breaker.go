@@ -0,0 +1,157 @@
+package cloudflare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Defaults of NewCircuitBreaker's arguments.
+const (
+	DefaultBreakerThreshold    = 5
+	DefaultBreakerOpenDuration = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without calling Cloudflare while the circuit
+// breaker is open; RetryAfter tells when it lets calls through again.
+var ErrCircuitOpen = errors.New("cloudflare: circuit breaker open")
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets every call through.
+	BreakerClosed BreakerState = iota
+	// BreakerHalfOpen lets a single probe call through, whose outcome
+	// closes or reopens the breaker.
+	BreakerHalfOpen
+	// BreakerOpen fails every call right away.
+	BreakerOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "Closed"
+	case BreakerHalfOpen:
+		return "HalfOpen"
+	}
+	return "Open"
+}
+
+// CircuitBreaker stops the clients sharing it from calling Cloudflare
+// during an outage: after threshold consecutive calls failed with a 5xx, a
+// 429 or a network error, it opens and fails calls with ErrCircuitOpen for
+// the open duration, then lets a probe call through to find out whether
+// Cloudflare recovered. Calls failing for other reasons, e.g. a missing
+// route, show Cloudflare is up.
+type CircuitBreaker struct {
+	threshold    int
+	openDuration time.Duration
+	// now is time.Now, replaced in tests.
+	now func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	changed  chan struct{}
+}
+
+// NewCircuitBreaker returns a closed CircuitBreaker opening after threshold
+// consecutive failures for openDuration.
+func NewCircuitBreaker(threshold int, openDuration time.Duration) *CircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	b := &CircuitBreaker{threshold: threshold, openDuration: openDuration, changed: make(chan struct{}, 1), now: time.Now}
+	breakerState.Set(float64(BreakerClosed))
+	return b
+}
+
+// State returns the breaker's state and, when open, until when.
+func (b *CircuitBreaker) State() (BreakerState, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen {
+		return b.state, b.openedAt.Add(b.openDuration)
+	}
+	return b.state, time.Time{}
+}
+
+// Changed is signalled when the breaker changes state. Changes made while
+// the previous signal is pending are coalesced into it.
+func (b *CircuitBreaker) Changed() <-chan struct{} {
+	return b.changed
+}
+
+// allow returns nil when a call may be made, which must then be reported
+// with done.
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		until := b.openedAt.Add(b.openDuration)
+		if b.now().Before(until) {
+			breakerRejections.Inc()
+			return &circuitOpenError{until: until}
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+	case BreakerHalfOpen:
+		if b.probing {
+			breakerRejections.Inc()
+			return &circuitOpenError{until: b.now().Add(time.Second)}
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// done records the outcome of a call allowed by allow.
+func (b *CircuitBreaker) done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// Given up on by the caller; says nothing about Cloudflare.
+		return
+	}
+	if err == nil || !retryable(err) {
+		b.failures = 0
+		b.setState(BreakerClosed)
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.openedAt = b.now()
+		b.setState(BreakerOpen)
+	}
+}
+
+func (b *CircuitBreaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	breakerState.Set(float64(state))
+	select {
+	case b.changed <- struct{}{}:
+	default:
+	}
+}
+
+// circuitOpenError is the ErrCircuitOpen of a call rejected until until.
+type circuitOpenError struct {
+	until time.Time
+}
+
+func (e *circuitOpenError) Error() string {
+	return fmt.Sprintf("%v until %s", ErrCircuitOpen, e.until.UTC().Format(time.RFC3339))
+}
+
+func (e *circuitOpenError) Unwrap() error { return ErrCircuitOpen }
@@ -0,0 +1,104 @@
+package cloudflare
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var (
+	errUnavailable = &apiError{StatusCode: http.StatusServiceUnavailable}
+	errMissing     = &apiError{StatusCode: http.StatusNotFound}
+)
+
+type testClock struct{ now time.Time }
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func newTestBreaker(threshold int, openDuration time.Duration) (*CircuitBreaker, *testClock) {
+	clock := &testClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	b := NewCircuitBreaker(threshold, openDuration)
+	b.now = clock.Now
+	return b, clock
+}
+
+func TestCircuitBreakerCountsConsecutiveFailures(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		outcomes []error
+		want     BreakerState
+	}{
+		{"below threshold", []error{errUnavailable, errUnavailable}, BreakerClosed},
+		{"threshold reached", []error{errUnavailable, errUnavailable, errUnavailable}, BreakerOpen},
+		{"rate limited counts", []error{errUnavailable, &apiError{StatusCode: http.StatusTooManyRequests}, errUnavailable}, BreakerOpen},
+		{"success resets", []error{errUnavailable, errUnavailable, nil, errUnavailable, errUnavailable}, BreakerClosed},
+		{"permanent error resets", []error{errUnavailable, errUnavailable, errMissing, errUnavailable, errUnavailable}, BreakerClosed},
+		{"cancel does not reset", []error{errUnavailable, errUnavailable, context.Canceled, errUnavailable}, BreakerOpen},
+		{"deadline does not count", []error{errUnavailable, context.DeadlineExceeded, context.DeadlineExceeded}, BreakerClosed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, _ := newTestBreaker(3, time.Minute)
+			for i, err := range tc.outcomes {
+				if allowErr := b.allow(); allowErr != nil {
+					t.Fatalf("call %d rejected: %v", i, allowErr)
+				}
+				b.done(err)
+			}
+			if state, _ := b.State(); state != tc.want {
+				t.Fatalf("state = %s want %s", state, tc.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbe(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		probe error
+		want  BreakerState
+	}{
+		{"probe succeeds", nil, BreakerClosed},
+		{"probe fails", errUnavailable, BreakerOpen},
+		{"probe canceled", context.Canceled, BreakerHalfOpen},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, clock := newTestBreaker(1, 30*time.Second)
+			if err := b.allow(); err != nil {
+				t.Fatal(err)
+			}
+			b.done(errUnavailable)
+
+			clock.now = clock.now.Add(29 * time.Second)
+			if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+				t.Fatalf("allow before the open duration = %v want ErrCircuitOpen", err)
+			}
+
+			clock.now = clock.now.Add(time.Second)
+			if err := b.allow(); err != nil {
+				t.Fatalf("probe rejected: %v", err)
+			}
+			if state, _ := b.State(); state != BreakerHalfOpen {
+				t.Fatalf("state while probing = %s want HalfOpen", state)
+			}
+			if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+				t.Fatalf("second call while probing = %v want ErrCircuitOpen", err)
+			}
+
+			b.done(tc.probe)
+			state, until := b.State()
+			if state != tc.want {
+				t.Fatalf("state after probe = %s want %s", state, tc.want)
+			}
+			if state == BreakerOpen && !until.Equal(clock.now.Add(30*time.Second)) {
+				t.Fatalf("reopened until %s want %s", until, clock.now.Add(30*time.Second))
+			}
+			// A closed breaker, and one whose probe was canceled, let the
+			// next call through.
+			if err := b.allow(); (err == nil) != (tc.want != BreakerOpen) {
+				t.Fatalf("allow after probe = %v", err)
+			}
+		})
+	}
+}
@@ -2,74 +2,416 @@ package cloudflare
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
 // Client defines the minimal surface used by the operator to interact with Cloudflare.
 type Client interface {
-	EnsureSession(ctx context.Context, sessionID string) (bool, error)
-	EnsureRoute(ctx context.Context, sessionID, endpoint string) error
-	DeleteRoute(ctx context.Context, sessionID string) error
+	// EnsureSession looks the session up in the session store.
+	EnsureSession(ctx context.Context, sessionID string) (Session, error)
+	// EnsureRoute points the session's route at route.Endpoint. With
+	// opts.IfVersion it fails with an ErrConflict when the route changed
+	// since, so a stale writer does not overwrite a newer route.
+	EnsureRoute(ctx context.Context, sessionID string, route Route, opts RouteOptions) (RouteRecord, error)
+	// DeleteRoute removes the session's route. routeID is the ID returned by
+	// EnsureRoute; when empty it is derived from sessionID.
+	DeleteRoute(ctx context.Context, sessionID, routeID string) error
+	// GetRoute reads back the route routeID of the session, with its
+	// Route. It returns ErrRouteNotFound when the route does not exist.
+	GetRoute(ctx context.Context, sessionID, routeID string) (RouteRecord, error)
+	// ListRoutes returns a page of the session routes in the Workers KV
+	// namespace kvNamespaceID, or the client's when empty, with their
+	// SessionID.
+	ListRoutes(ctx context.Context, kvNamespaceID string, opts ListOptions) (RoutePage, error)
+	// ListSessions returns a page of the live sessions of the session
+	// store, with their ID. Stores that cannot be listed return
+	// ErrUnsupported.
+	ListSessions(ctx context.Context, opts ListOptions) (SessionPage, error)
+}
+
+var (
+	// ErrRouteNotFound is returned by GetRoute for routes that do not exist;
+	// it is an ErrNotFound.
+	ErrRouteNotFound error = &kindError{kind: ErrNotFound, msg: "cloudflare: route not found"}
+	// ErrUnsupported is returned by clients that cannot perform an
+	// operation, e.g. read routes back without credentials.
+	ErrUnsupported = errors.New("cloudflare: operation not supported")
+)
+
+// ProviderWorkersKV identifies routes stored as Workers KV entries.
+const ProviderWorkersKV = "WorkersKV"
+
+// Session is what the session store knows about a session.
+type Session struct {
+	// ID is the session's ID; only set by ListSessions.
+	ID string
+	// Exists is false for sessions the store does not know or that ended.
+	Exists bool
+	// ExpiresAt is when the session ends; zero when the store does not
+	// say.
+	ExpiresAt time.Time
+}
+
+// Route is where a session's traffic goes and how. Backends keep what they
+// can express of it: Workers KV routes store every field as metadata for
+// the Worker serving sessions, Load Balancer origins take the Weight and
+// tunnel ingress rules the Protocol; the other fields are ignored.
+type Route struct {
+	// Endpoint is the host:port the session's traffic is sent to.
+	Endpoint string
+	// Weight is the share of the traffic the route takes next to the other
+	// routes of its pool, from 0 to 1; 0 is the backend's default.
+	Weight float64
+	// Priority orders the routes of a session the Worker fails over
+	// between, lowest first.
+	Priority int
+	// Protocol is how the endpoint is reached, e.g. http, https or tcp;
+	// empty leaves it to the backend, e.g. from RouteOptions' TLSMode.
+	Protocol string
+	// Labels are stored with the route, for the Worker and whoever
+	// inspects the routes.
+	Labels map[string]string
+	// ExpiresAt, when set, is when the session ends; the route is dropped
+	// by then even if it is never deleted.
+	ExpiresAt time.Time
+}
+
+// RouteRecord identifies a route programmed by EnsureRoute.
+type RouteRecord struct {
+	// ID is the provider's identifier for the route (KV key qualified with
+	// its namespace, record ID, ...).
+	ID string
+	// Provider is the backend holding the route, e.g. ProviderWorkersKV.
+	Provider string
+	// Route is the route as the backend keeps it, with at least its
+	// Endpoint; only set by GetRoute.
+	Route Route
+	// SessionID is the session the route belongs to; only set by
+	// ListRoutes.
+	SessionID string
+	// Version identifies the route's current value, for RouteOptions'
+	// IfVersion; only set by EnsureRoute and GetRoute, and empty when the
+	// provider does not version routes.
+	Version string
+}
+
+// ListOptions select a page of a listing. Every page is a call of its own,
+// paced by the client's rate limiter like any other.
+type ListOptions struct {
+	// Cursor is the NextCursor of the previous page; empty lists the first
+	// page.
+	Cursor string
+	// Limit is the most entries per page, within what the backend allows;
+	// 0 is the most it allows. Pages may hold fewer entries even when more
+	// follow.
+	Limit int
+}
+
+// RoutePage is a page of ListRoutes.
+type RoutePage struct {
+	Routes []RouteRecord
+	// NextCursor lists the next page; empty on the last one.
+	NextCursor string
+}
+
+// SessionPage is a page of ListSessions.
+type SessionPage struct {
+	Sessions []Session
+	// NextCursor lists the next page; empty on the last one.
+	NextCursor string
+}
+
+// AllRoutes lists every route of c in kvNamespaceID, page by page.
+func AllRoutes(ctx context.Context, c Client, kvNamespaceID string) ([]RouteRecord, error) {
+	var routes []RouteRecord
+	opts := ListOptions{}
+	for {
+		page, err := c.ListRoutes(ctx, kvNamespaceID, opts)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, page.Routes...)
+		if page.NextCursor == "" {
+			return routes, nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+// AllSessions lists every live session of c's session store, page by page.
+func AllSessions(ctx context.Context, c Client) ([]Session, error) {
+	var sessions []Session
+	opts := ListOptions{}
+	for {
+		page, err := c.ListSessions(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, page.Sessions...)
+		if page.NextCursor == "" {
+			return sessions, nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+// RouteOptions customise how a session route is exposed. The zero value keys
+// the route by the session ID alone.
+type RouteOptions struct {
+	// Hostname is the fully resolved hostname for the session.
+	Hostname string
+	// PathPrefix restricts the route to requests under this path.
+	PathPrefix string
+	// TLSMode is one of Flexible, Full or Strict; empty keeps the zone default.
+	TLSMode string
+	// KVNamespaceID is the Workers KV namespace to write the route to; empty
+	// uses the client's KVNamespaceID.
+	KVNamespaceID string
+	// IfVersion, when set, is the Version the route is expected to still
+	// have: the write fails with an ErrConflict when it changed or was
+	// deleted since, unless it already points at the endpoint, which keeps
+	// retries of a write that did go through idempotent. Only Workers KV
+	// routes are versioned; other providers write unconditionally.
+	IfVersion string
 }
 
 // APIClient is a lightweight implementation of Client built on top of the Cloudflare REST API.
+// Routes are Workers KV entries mapping routeKey(sessionID) to the session's
+// endpoint, with the route options as metadata. Without credentials it
+// performs no calls and reports every write as successful.
 type APIClient struct {
+	// HTTPClient sends the calls. Its Transport, http.DefaultTransport when
+	// nil, takes its proxy from HTTPS_PROXY and NO_PROXY; replace it e.g.
+	// for a custom CA bundle, see NewTransport.
 	HTTPClient *http.Client
-	AccountID  string
-	APIToken   string
+	// Timeout bounds every attempt at a call; 0 is DefaultTimeout. Calls
+	// override it and Retry with WithCallOptions.
+	Timeout time.Duration
+	// Timeouts override Timeout for the operations they name, e.g. for
+	// the listings of large namespaces.
+	Timeouts map[string]time.Duration
+	// BaseURL is the root of the API; empty is DefaultBaseURL. Pointing it
+	// at a fake.Server runs the client without a Cloudflare account.
+	BaseURL string
+	Credentials
+	// KVNamespaceID is the Workers KV namespace routes are written to by
+	// default.
+	KVNamespaceID string
+	// SessionValidationURL, when set, is the auth service endpoint sessions
+	// are looked up at; "{sessionID}" in it is replaced with the session
+	// ID, which is otherwise passed as the sessionID query parameter.
+	SessionValidationURL string
+	// SessionKVNamespaceID, when set and SessionValidationURL is not, is the
+	// Workers KV namespace holding a key per live session, named after the
+	// session and expiring with it. Without either, every session is taken
+	// to exist.
+	SessionKVNamespaceID string
+	// Sessions, when set, caches session lookups; clients of the same
+	// session store share one.
+	Sessions *SessionCache
+	// Retry is how failed idempotent calls are retried.
+	Retry RetryPolicy
+	// Limiter, when set, paces the client's API requests; clients of the
+	// same account share one.
+	Limiter *RateLimiter
+	// Breaker, when set, stops the client's API calls during a Cloudflare
+	// outage; clients share one.
+	Breaker *CircuitBreaker
 }
 
 // NewClientFromEnv creates a Client using environment variables for configuration.
 // Expected environment variables:
 //   - CLOUDFLARE_ACCOUNT_ID
-//   - CLOUDFLARE_API_TOKEN
-func NewClientFromEnv() Client {
-	return &APIClient{
-		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+//   - CLOUDFLARE_API_TOKEN, or CLOUDFLARE_API_KEY and CLOUDFLARE_EMAIL
+//   - CLOUDFLARE_API_TOKEN_FILE (optional), a file holding the API token
+//     instead, read as a TokenFile
+//   - CLOUDFLARE_ZONE_TOKENS (optional), as parsed by ParseZoneTokens
+//   - CLOUDFLARE_KV_NAMESPACE_ID (optional)
+//   - CLOUDFLARE_API_BASE_URL (optional)
+func NewClientFromEnv() (*APIClient, error) {
+	zoneTokens, err := ParseZoneTokens(os.Getenv("CLOUDFLARE_ZONE_TOKENS"))
+	if err != nil {
+		return nil, fmt.Errorf("CLOUDFLARE_ZONE_TOKENS: %w", err)
+	}
+	var tokenFile *TokenFile
+	if path := os.Getenv("CLOUDFLARE_API_TOKEN_FILE"); path != "" {
+		if tokenFile, err = NewTokenFile(path); err != nil {
+			return nil, fmt.Errorf("CLOUDFLARE_API_TOKEN_FILE: %w", err)
+		}
+	}
+	c := NewClientWithCredentials(Credentials{
 		AccountID:  os.Getenv("CLOUDFLARE_ACCOUNT_ID"),
 		APIToken:   os.Getenv("CLOUDFLARE_API_TOKEN"),
+		TokenFile:  tokenFile,
+		APIKey:     os.Getenv("CLOUDFLARE_API_KEY"),
+		Email:      os.Getenv("CLOUDFLARE_EMAIL"),
+		ZoneTokens: zoneTokens,
+	})
+	c.KVNamespaceID = os.Getenv("CLOUDFLARE_KV_NAMESPACE_ID")
+	c.BaseURL = os.Getenv("CLOUDFLARE_API_BASE_URL")
+	return c, nil
+}
+
+// NewClient creates an APIClient for the given account credentials.
+func NewClient(accountID, apiToken string) *APIClient {
+	return NewClientWithCredentials(Credentials{AccountID: accountID, APIToken: apiToken})
+}
+
+// NewClientWithCredentials creates an APIClient authenticating with creds.
+func NewClientWithCredentials(creds Credentials) *APIClient {
+	return &APIClient{
+		HTTPClient:  &http.Client{},
+		Credentials: creds,
+		Retry:       DefaultRetryPolicy,
 	}
 }
 
-func (c *APIClient) EnsureSession(ctx context.Context, sessionID string) (bool, error) {
-	if sessionID == "" {
-		return false, fmt.Errorf("sessionID is empty")
+func (c *APIClient) EnsureRoute(ctx context.Context, sessionID string, route Route, opts RouteOptions) (RouteRecord, error) {
+	if err := validateRoute(sessionID, route, opts.PathPrefix); err != nil {
+		return RouteRecord{}, err
 	}
-	if c.APIToken == "" || c.AccountID == "" {
-		// Without credentials we assume session exists but log that Cloudflare integration is disabled.
-		return true, nil
+	namespaceID := opts.KVNamespaceID
+	if namespaceID == "" {
+		namespaceID = c.KVNamespaceID
 	}
+	key := routeKey(sessionID)
+	record := RouteRecord{ID: kvRouteID(namespaceID, key), Provider: ProviderWorkersKV}
+	if !c.hasCredentials() {
+		return record, nil
+	}
+	if namespaceID == "" {
+		return RouteRecord{}, errNoKVNamespace
+	}
+	if opts.IfVersion != "" {
+		if err := c.checkRouteVersion(ctx, namespaceID, key, route.Endpoint, opts.IfVersion); err != nil {
+			return RouteRecord{}, err
+		}
+	}
+
+	metadata := newRouteMetadata(sessionID, route, opts)
+	if err := c.kvPut(ctx, namespaceID, key, route.Endpoint, metadata, route.ExpiresAt); err != nil {
+		return RouteRecord{}, err
+	}
+	// Read the entry back, so a write that was accepted but not applied
+	// fails here instead of surfacing as drift at the next verification.
+	got, err := c.kvGet(ctx, namespaceID, key)
+	if err != nil {
+		return RouteRecord{}, fmt.Errorf("cloudflare: verifying route %s: %w", record.ID, err)
+	}
+	if got != route.Endpoint {
+		return RouteRecord{}, fmt.Errorf("cloudflare: route %s reads back %q after writing %q", record.ID, got, route.Endpoint)
+	}
+	record.Version = metadata.Version
+	return record, nil
+}
 
-	// TODO: integrate with actual Cloudflare session validation endpoint.
-	return true, nil
+// checkRouteVersion fails with an ErrConflict when the route under key is
+// no longer at version, unless it already points at endpoint. Workers KV
+// has no conditional writes, so a writer racing between the check and the
+// write still wins; the check narrows that window to a few calls.
+func (c *APIClient) checkRouteVersion(ctx context.Context, namespaceID, key, endpoint, version string) error {
+	var metadata routeMetadata
+	err := c.kvGetMetadata(ctx, namespaceID, key, &metadata)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return fmt.Errorf("%w: route %s was deleted since version %s", ErrConflict, kvRouteID(namespaceID, key), version)
+	case err != nil:
+		return err
+	case metadata.Version == version:
+		return nil
+	}
+	current, err := c.kvGet(ctx, namespaceID, key)
+	switch {
+	case errors.Is(err, ErrRouteNotFound):
+		return fmt.Errorf("%w: route %s was deleted since version %s", ErrConflict, kvRouteID(namespaceID, key), version)
+	case err != nil:
+		return err
+	case current != endpoint:
+		return fmt.Errorf("%w: route %s changed since version %s and points at %s", ErrConflict, kvRouteID(namespaceID, key), version, current)
+	}
+	return nil
 }
 
-func (c *APIClient) EnsureRoute(ctx context.Context, sessionID, endpoint string) error {
+// validateRoute checks the arguments of a Workers KV route.
+func validateRoute(sessionID string, route Route, pathPrefix string) error {
 	if sessionID == "" {
 		return fmt.Errorf("sessionID is empty")
 	}
-	if endpoint == "" {
+	if route.Endpoint == "" {
 		return fmt.Errorf("endpoint is empty")
 	}
-	if c.APIToken == "" || c.AccountID == "" {
-		return nil
+	if route.Weight < 0 || route.Weight > 1 {
+		return fmt.Errorf("route weight %v must be between 0 and 1", route.Weight)
+	}
+	if pathPrefix != "" && !strings.HasPrefix(pathPrefix, "/") {
+		return fmt.Errorf("path prefix %q must start with /", pathPrefix)
 	}
-
-	// TODO: integrate with Cloudflare Workers KV or Load Balancer API.
 	return nil
 }
 
-func (c *APIClient) DeleteRoute(ctx context.Context, sessionID string) error {
-	if sessionID == "" {
+func (c *APIClient) DeleteRoute(ctx context.Context, sessionID, routeID string) error {
+	if routeID == "" && sessionID == "" {
 		return nil
 	}
-	if c.APIToken == "" || c.AccountID == "" {
+	if !c.hasCredentials() {
 		return nil
 	}
+	namespaceID, key, err := c.parseRouteID(sessionID, routeID)
+	if err != nil {
+		return err
+	}
+	return c.kvDelete(ctx, namespaceID, key)
+}
 
-	// TODO: delete Cloudflare route once API integration is implemented.
-	return nil
+func (c *APIClient) GetRoute(ctx context.Context, sessionID, routeID string) (RouteRecord, error) {
+	if routeID == "" && sessionID == "" {
+		return RouteRecord{}, ErrRouteNotFound
+	}
+	if !c.hasCredentials() {
+		return RouteRecord{}, ErrUnsupported
+	}
+	namespaceID, key, err := c.parseRouteID(sessionID, routeID)
+	if err != nil {
+		return RouteRecord{}, err
+	}
+	endpoint, err := c.kvGet(ctx, namespaceID, key)
+	if err != nil {
+		return RouteRecord{}, err
+	}
+	// Entries written before routes were versioned have none.
+	var metadata routeMetadata
+	if err := c.kvGetMetadata(ctx, namespaceID, key, &metadata); err != nil && !errors.Is(err, ErrNotFound) {
+		return RouteRecord{}, err
+	}
+	return RouteRecord{ID: kvRouteID(namespaceID, key), Provider: ProviderWorkersKV, Route: metadata.route(endpoint), Version: metadata.Version}, nil
+}
+
+func (c *APIClient) ListRoutes(ctx context.Context, kvNamespaceID string, opts ListOptions) (RoutePage, error) {
+	if !c.hasCredentials() {
+		return RoutePage{}, ErrUnsupported
+	}
+	if kvNamespaceID == "" {
+		kvNamespaceID = c.KVNamespaceID
+	}
+	if kvNamespaceID == "" {
+		return RoutePage{}, errNoKVNamespace
+	}
+	keys, next, err := c.kvListPage(ctx, kvNamespaceID, routeKeyPrefix, opts)
+	if err != nil {
+		return RoutePage{}, err
+	}
+	page := RoutePage{Routes: make([]RouteRecord, 0, len(keys)), NextCursor: next}
+	for _, k := range keys {
+		page.Routes = append(page.Routes, RouteRecord{
+			ID:        kvRouteID(kvNamespaceID, k.Name),
+			Provider:  ProviderWorkersKV,
+			SessionID: strings.TrimPrefix(k.Name, routeKeyPrefix),
+		})
+	}
+	return page, nil
 }
@@ -0,0 +1,314 @@
+package cloudflare_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare/fake"
+)
+
+const (
+	testAccount   = "account"
+	testNamespace = "routes"
+	testZone      = "zone"
+)
+
+// newTestClient returns a client of h, e.g. a fake.Server, writing routes
+// to testNamespace and making every call once.
+func newTestClient(t *testing.T, h http.Handler) *cloudflare.APIClient {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	c := cloudflare.NewClient(testAccount, "token")
+	c.BaseURL = srv.URL
+	c.KVNamespaceID = testNamespace
+	c.Retry = cloudflare.RetryPolicy{MaxAttempts: 1}
+	return c
+}
+
+// recorder passes requests on to a handler and counts them by method and
+// path suffix; intercept, when set, answers the requests it returns true
+// for instead.
+type recorder struct {
+	next      http.Handler
+	intercept func(w http.ResponseWriter, req *http.Request) bool
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	r.calls = append(r.calls, req.Method+" "+req.URL.Path)
+	r.mu.Unlock()
+	if r.intercept != nil && r.intercept(w, req) {
+		return
+	}
+	r.next.ServeHTTP(w, req)
+}
+
+// count returns how many calls were made with method to a path ending in
+// suffix.
+func (r *recorder) count(method, suffix string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, call := range r.calls {
+		m, path, _ := strings.Cut(call, " ")
+		if m == method && strings.HasSuffix(path, suffix) {
+			n++
+		}
+	}
+	return n
+}
+
+// writeSuccess answers a call as Cloudflare does one that succeeded.
+func writeSuccess(w http.ResponseWriter, result any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "errors": []any{}, "messages": []any{}, "result": result})
+}
+
+func TestEnsureRouteIfVersion(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name string
+		// since changes the route after the first version was written.
+		since    func(t *testing.T, c *cloudflare.APIClient)
+		endpoint string
+		wantErr  error
+		// want is the endpoint of the route afterwards, empty when there
+		// is none.
+		want string
+	}{
+		{
+			name:     "version matches",
+			since:    func(*testing.T, *cloudflare.APIClient) {},
+			endpoint: "10.0.0.2:80",
+			want:     "10.0.0.2:80",
+		},
+		{
+			name: "changed to the same endpoint",
+			since: func(t *testing.T, c *cloudflare.APIClient) {
+				if _, err := c.EnsureRoute(ctx, "s1", cloudflare.Route{Endpoint: "10.0.0.2:80"}, cloudflare.RouteOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			endpoint: "10.0.0.2:80",
+			want:     "10.0.0.2:80",
+		},
+		{
+			name: "changed to another endpoint",
+			since: func(t *testing.T, c *cloudflare.APIClient) {
+				if _, err := c.EnsureRoute(ctx, "s1", cloudflare.Route{Endpoint: "10.0.0.3:80"}, cloudflare.RouteOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			endpoint: "10.0.0.2:80",
+			wantErr:  cloudflare.ErrConflict,
+			want:     "10.0.0.3:80",
+		},
+		{
+			name: "deleted",
+			since: func(t *testing.T, c *cloudflare.APIClient) {
+				if err := c.DeleteRoute(ctx, "s1", ""); err != nil {
+					t.Fatal(err)
+				}
+			},
+			endpoint: "10.0.0.2:80",
+			wantErr:  cloudflare.ErrConflict,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestClient(t, fake.NewServer())
+			first, err := c.EnsureRoute(ctx, "s1", cloudflare.Route{Endpoint: "10.0.0.1:80"}, cloudflare.RouteOptions{})
+			if err != nil {
+				t.Fatalf("EnsureRoute: %v", err)
+			}
+			if first.ID != testNamespace+"/session:s1" || first.Version == "" {
+				t.Fatalf("EnsureRoute = %+v, want route %s/session:s1 with a version", first, testNamespace)
+			}
+			tc.since(t, c)
+
+			got, err := c.EnsureRoute(ctx, "s1", cloudflare.Route{Endpoint: tc.endpoint}, cloudflare.RouteOptions{IfVersion: first.Version})
+			if !errors.Is(err, tc.wantErr) || (tc.wantErr == nil && err != nil) {
+				t.Fatalf("EnsureRoute with IfVersion: %v, want %v", err, tc.wantErr)
+			}
+			if err == nil && (got.Version == "" || got.Version == first.Version) {
+				t.Fatalf("version = %q after the write, want a new one", got.Version)
+			}
+
+			route, err := c.GetRoute(ctx, "s1", "")
+			switch {
+			case tc.want == "" && !errors.Is(err, cloudflare.ErrRouteNotFound):
+				t.Fatalf("GetRoute: %v, want ErrRouteNotFound", err)
+			case tc.want != "" && err != nil:
+				t.Fatalf("GetRoute: %v", err)
+			case route.Route.Endpoint != tc.want:
+				t.Fatalf("route endpoint = %q want %q", route.Route.Endpoint, tc.want)
+			}
+		})
+	}
+}
+
+func TestEnsureRouteFailsWhenWriteIsNotApplied(t *testing.T) {
+	srv := fake.NewServer()
+	// The write is acknowledged, but the value stays what it was.
+	rec := &recorder{next: srv, intercept: func(w http.ResponseWriter, req *http.Request) bool {
+		if req.Method != http.MethodPut || !strings.Contains(req.URL.Path, "/values/") {
+			return false
+		}
+		writeSuccess(w, nil)
+		return true
+	}}
+	srv.PutValue(testNamespace, "session:s1", "10.0.0.1:80", time.Time{})
+	c := newTestClient(t, rec)
+
+	_, err := c.EnsureRoute(context.Background(), "s1", cloudflare.Route{Endpoint: "10.0.0.2:80"}, cloudflare.RouteOptions{})
+	if err == nil || !strings.Contains(err.Error(), "reads back") {
+		t.Fatalf("EnsureRoute: %v, want a read-back mismatch", err)
+	}
+}
+
+func TestGetRouteReadsMetadataBack(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, fake.NewServer())
+	route := cloudflare.Route{
+		Endpoint:  "10.0.0.1:8443",
+		Weight:    0.5,
+		Priority:  2,
+		Protocol:  "https",
+		Labels:    map[string]string{"tier": "gold"},
+		ExpiresAt: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	written, err := c.EnsureRoute(ctx, "s1", route, cloudflare.RouteOptions{Hostname: "s1.example.com", PathPrefix: "/app"})
+	if err != nil {
+		t.Fatalf("EnsureRoute: %v", err)
+	}
+
+	got, err := c.GetRoute(ctx, "", written.ID)
+	if err != nil {
+		t.Fatalf("GetRoute: %v", err)
+	}
+	if !reflect.DeepEqual(got.Route, route) || got.Version != written.Version || got.Provider != cloudflare.ProviderWorkersKV {
+		t.Fatalf("GetRoute = %+v, want route %+v at version %s", got, route, written.Version)
+	}
+	if _, err := c.GetRoute(ctx, "s2", ""); !errors.Is(err, cloudflare.ErrNotFound) {
+		t.Fatalf("GetRoute of a missing route: %v, want an ErrNotFound", err)
+	}
+}
+
+func TestGetRouteOfUnversionedEntry(t *testing.T) {
+	srv := fake.NewServer()
+	// Written before routes had metadata.
+	srv.PutValue(testNamespace, "session:s1", "10.0.0.1:80", time.Time{})
+	c := newTestClient(t, srv)
+
+	got, err := c.GetRoute(context.Background(), "s1", "")
+	if err != nil {
+		t.Fatalf("GetRoute: %v", err)
+	}
+	if got.Route.Endpoint != "10.0.0.1:80" || got.Version != "" {
+		t.Fatalf("GetRoute = %+v, want endpoint 10.0.0.1:80 without a version", got)
+	}
+}
+
+func TestListRoutesPages(t *testing.T) {
+	ctx := context.Background()
+	srv := fake.NewServer()
+	for _, id := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"} {
+		srv.PutValue(testNamespace, "session:"+id, "10.0.0.1:80", time.Time{})
+	}
+	// Not a route.
+	srv.PutValue(testNamespace, "config", "{}", time.Time{})
+	c := newTestClient(t, srv)
+
+	first, err := c.ListRoutes(ctx, "", cloudflare.ListOptions{Limit: 10})
+	if err != nil {
+		t.Fatalf("ListRoutes: %v", err)
+	}
+	if len(first.Routes) != 10 || first.NextCursor == "" {
+		t.Fatalf("first page has %d routes and cursor %q, want 10 and a cursor", len(first.Routes), first.NextCursor)
+	}
+	routes, err := cloudflare.AllRoutes(ctx, c, "")
+	if err != nil {
+		t.Fatalf("AllRoutes: %v", err)
+	}
+	if len(routes) != 12 || routes[0].SessionID != "a" || routes[0].ID != testNamespace+"/session:a" {
+		t.Fatalf("AllRoutes = %+v, want the 12 session routes", routes)
+	}
+}
+
+func TestClientWithoutCredentialsMakesNoCalls(t *testing.T) {
+	rec := &recorder{next: fake.NewServer()}
+	c := newTestClient(t, rec)
+	c.Credentials = cloudflare.Credentials{}
+	ctx := context.Background()
+
+	if _, err := c.EnsureRoute(ctx, "s1", cloudflare.Route{Endpoint: "10.0.0.1:80"}, cloudflare.RouteOptions{}); err != nil {
+		t.Fatalf("EnsureRoute: %v", err)
+	}
+	if err := c.DeleteRoute(ctx, "s1", ""); err != nil {
+		t.Fatalf("DeleteRoute: %v", err)
+	}
+	if _, err := c.GetRoute(ctx, "s1", ""); !errors.Is(err, cloudflare.ErrUnsupported) {
+		t.Fatalf("GetRoute: %v, want ErrUnsupported", err)
+	}
+	if len(rec.calls) != 0 {
+		t.Fatalf("made calls %v without credentials", rec.calls)
+	}
+}
+
+// bulkBody reads the body of a bulk call and puts it back.
+func bulkBody(t *testing.T, req *http.Request, v any) {
+	t.Helper()
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	if err := json.Unmarshal(body, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// apiCall makes a call to the fake h directly, e.g. to seed it with what
+// the operator did not write or to see what it wrote, and decodes the
+// result into result unless it is nil.
+func apiCall(t *testing.T, h http.Handler, method, path string, body, result any) {
+	t.Helper()
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, "/client/v4"+path, r)
+	req.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	var resp struct {
+		Success bool            `json:"success"`
+		Result  json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || !resp.Success {
+		t.Fatalf("%s %s: %d %s", method, path, w.Code, w.Body)
+	}
+	if result != nil {
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			t.Fatalf("%s %s: decoding result: %v", method, path, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package cloudflare
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Credentials authenticate API calls with an account-level API token, with
+// a Global API Key and the email of its user, or with API tokens scoped to
+// single zones, for accounts whose policy does not allow account-level
+// tokens. A call on a zone of ZoneTokens uses the zone's token; any other
+// call uses the API token or, without one, APIKey and Email.
+type Credentials struct {
+	AccountID string
+	APIToken  string
+	// TokenFile, when set, holds the API token instead of APIToken and
+	// follows its rotations.
+	TokenFile *TokenFile
+	APIKey    string
+	Email     string
+	// ZoneTokens are API tokens by the ID of the zone they are scoped to.
+	ZoneTokens map[string]string
+}
+
+// hasCredentials reports whether the client has credentials to call the
+// API with; without, it makes no calls.
+func (c Credentials) hasCredentials() bool {
+	return c.AccountID != "" && (c.apiToken() != "" || c.APIKey != "" && c.Email != "" || len(c.ZoneTokens) > 0)
+}
+
+// apiToken is the current API token.
+func (c Credentials) apiToken() string {
+	if c.TokenFile != nil {
+		return c.TokenFile.Token()
+	}
+	return c.APIToken
+}
+
+// authenticate sets the credentials of a call on path, relative to the API
+// root.
+func (c Credentials) authenticate(req *http.Request, path string) {
+	if rest, ok := strings.CutPrefix(path, "/zones/"); ok {
+		zoneID := rest
+		if i := strings.IndexAny(rest, "/?"); i >= 0 {
+			zoneID = rest[:i]
+		}
+		if token := c.ZoneTokens[zoneID]; token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+			return
+		}
+	}
+	switch token := c.apiToken(); {
+	case token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	case c.APIKey != "":
+		req.Header.Set("X-Auth-Key", c.APIKey)
+		req.Header.Set("X-Auth-Email", c.Email)
+	}
+}
+
+// ParseZoneTokens parses zone-scoped API tokens listed as comma-separated
+// zoneID=token pairs.
+func ParseZoneTokens(s string) (map[string]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	tokens := map[string]string{}
+	for i, pair := range strings.Split(s, ",") {
+		zoneID, token, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || zoneID == "" || token == "" {
+			return nil, fmt.Errorf("zone token %d is not zoneID=token", i+1)
+		}
+		tokens[zoneID] = token
+	}
+	return tokens, nil
+}
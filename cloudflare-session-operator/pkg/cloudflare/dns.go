@@ -0,0 +1,423 @@
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ProviderDNS identifies routes stored as proxied DNS records.
+const ProviderDNS = "DNS"
+
+const (
+	// ownerRecordPrefix starts the name of the TXT record claiming a
+	// session's DNS record for the operator. The claim cannot share the
+	// record's name, which a CNAME owns alone.
+	ownerRecordPrefix = "_session-owner."
+	// ownerHeritage marks the TXT records written by the operator.
+	ownerHeritage = "cloudflare-session-operator"
+	// DefaultDNSOwnerID is the owner of DNS records when DNSClient.OwnerID
+	// is empty.
+	DefaultDNSOwnerID = "default"
+	// dnsListLimit is the page size of DNS record listings.
+	dnsListLimit = 1000
+)
+
+// DNSClient is a Client routing each session through a proxied DNS record
+// of its hostname in a Cloudflare zone, pointing at Target, e.g. the
+// hostname of the tunnel or load balancer serving sessions, or else at the
+// session endpoint's host. Every record comes with an ownership TXT record
+// naming the operator instance and the session, so only records the
+// operator created are ever updated, listed or deleted. Sessions are
+// validated as by the embedded APIClient.
+type DNSClient struct {
+	*APIClient
+	// ZoneID is the zone session records are created in.
+	ZoneID string
+	// Target, when set, is the hostname every session record is a CNAME
+	// of.
+	Target string
+	// OwnerID tells apart the operator instances sharing a zone; empty uses
+	// DefaultDNSOwnerID.
+	OwnerID string
+}
+
+// NewDNSClient returns a DNSClient managing session records in zoneID with
+// the credentials of api.
+func NewDNSClient(api *APIClient, zoneID string) *DNSClient {
+	return &DNSClient{APIClient: api, ZoneID: zoneID}
+}
+
+// dnsRecord is a DNS record as the API reads and writes it.
+type dnsRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	Proxied bool   `json:"proxied"`
+	// TTL 1 is "automatic", the only TTL of proxied records.
+	TTL     int    `json:"ttl"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// dnsOwner is the content of an ownership TXT record.
+type dnsOwner struct {
+	Owner     string
+	SessionID string
+	// Endpoint is the session endpoint the record was written for, which
+	// GetRoute reports while the record still points where it was made to.
+	Endpoint string
+}
+
+func (o dnsOwner) String() string {
+	return fmt.Sprintf("%q", "heritage="+ownerHeritage+",owner="+o.Owner+",session="+o.SessionID+",endpoint="+o.Endpoint)
+}
+
+// parseDNSOwner reads an ownership TXT record; ok is false for TXT records
+// the operator did not write.
+func parseDNSOwner(content string) (owner dnsOwner, ok bool) {
+	fields := map[string]string{}
+	for _, field := range strings.Split(strings.Trim(content, `"`), ",") {
+		if k, v, found := strings.Cut(field, "="); found {
+			fields[k] = v
+		}
+	}
+	if fields["heritage"] != ownerHeritage || fields["session"] == "" {
+		return dnsOwner{}, false
+	}
+	return dnsOwner{Owner: fields["owner"], SessionID: fields["session"], Endpoint: fields["endpoint"]}, true
+}
+
+func (c *DNSClient) ownerID() string {
+	if c.OwnerID == "" {
+		return DefaultDNSOwnerID
+	}
+	return c.OwnerID
+}
+
+func (c *DNSClient) routeID(hostname string) string {
+	return c.ZoneID + "/" + hostname
+}
+
+func (c *DNSClient) recordsPath(suffix string) string {
+	return "/zones/" + url.PathEscape(c.ZoneID) + "/dns_records" + suffix
+}
+
+// recordContent returns the type and content of the record routing to
+// endpoint.
+func (c *DNSClient) recordContent(endpoint string) (recordType, content string) {
+	if c.Target != "" {
+		return "CNAME", c.Target
+	}
+	host := endpoint
+	if h, _, err := net.SplitHostPort(endpoint); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return "CNAME", host
+	case ip.To4() != nil:
+		return "A", host
+	}
+	return "AAAA", host
+}
+
+// listRecords lists the zone's records matching query across pages.
+func (c *DNSClient) listRecords(ctx context.Context, query url.Values) ([]dnsRecord, error) {
+	var records []dnsRecord
+	for page := 1; ; page++ {
+		result, more, err := c.listRecordsPage(ctx, query, page, dnsListLimit)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, result...)
+		if !more {
+			return records, nil
+		}
+	}
+}
+
+// listRecordsPage lists the page-th page of perPage records matching query
+// and reports whether more follow.
+func (c *DNSClient) listRecordsPage(ctx context.Context, query url.Values, page, perPage int) ([]dnsRecord, bool, error) {
+	if perPage <= 0 || perPage > dnsListLimit {
+		perPage = dnsListLimit
+	}
+	query.Set("per_page", strconv.Itoa(perPage))
+	query.Set("page", strconv.Itoa(page))
+	req, err := c.newRequest(ctx, "dns.list", http.MethodGet, c.recordsPath("?"+query.Encode()), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	var result []dnsRecord
+	resp, err := c.doJSON(req, &result)
+	if err != nil {
+		return nil, false, err
+	}
+	return result, resp.ResultInfo != nil && page < resp.ResultInfo.TotalPages && len(result) > 0, nil
+}
+
+// sessionRecords returns the ownership record of hostname, if the operator
+// owns it, and the records hostname resolves with.
+func (c *DNSClient) sessionRecords(ctx context.Context, hostname string) (owner *dnsRecord, records []dnsRecord, err error) {
+	txt, err := c.listRecords(ctx, url.Values{"type": {"TXT"}, "name": {ownerRecordPrefix + hostname}})
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range txt {
+		if o, ok := parseDNSOwner(txt[i].Content); ok && o.Owner == c.ownerID() {
+			owner = &txt[i]
+			break
+		}
+	}
+	all, err := c.listRecords(ctx, url.Values{"name": {hostname}})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, r := range all {
+		switch r.Type {
+		case "A", "AAAA", "CNAME":
+			records = append(records, r)
+		}
+	}
+	return owner, records, nil
+}
+
+// writeRecord creates record, or updates the existing one with id.
+func (c *DNSClient) writeRecord(ctx context.Context, id string, record dnsRecord) error {
+	operation, method, path := "dns.create", http.MethodPost, c.recordsPath("")
+	if id != "" {
+		operation, method, path = "dns.update", http.MethodPut, c.recordsPath("/"+url.PathEscape(id))
+	}
+	body, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequest(ctx, operation, method, path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	_, err = c.doJSON(req, nil)
+	return err
+}
+
+func (c *DNSClient) deleteRecord(ctx context.Context, id string) error {
+	req, err := c.newRequest(ctx, "dns.delete", http.MethodDelete, c.recordsPath("/"+url.PathEscape(id)), nil)
+	if err != nil {
+		return err
+	}
+	if _, err := c.doJSON(req, nil); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// hostnameOf returns the hostname of routeID, or finds the session's among
+// the owned records when routeID is empty. Routes of another zone are not
+// this client's.
+func (c *DNSClient) hostnameOf(ctx context.Context, sessionID, routeID string) (string, error) {
+	if routeID != "" {
+		zone, hostname, ok := strings.Cut(routeID, "/")
+		if !ok || zone != c.ZoneID || hostname == "" {
+			return "", fmt.Errorf("cloudflare: route %s is not in zone %s", routeID, c.ZoneID)
+		}
+		return hostname, nil
+	}
+	routes, err := AllRoutes(ctx, c, "")
+	if err != nil {
+		return "", err
+	}
+	for _, route := range routes {
+		if route.SessionID == sessionID {
+			return strings.TrimPrefix(route.ID, c.ZoneID+"/"), nil
+		}
+	}
+	return "", ErrRouteNotFound
+}
+
+// EnsureRoute claims the session's hostname with an ownership record and
+// points a proxied record of it at Target or the route's endpoint. Records
+// of the hostname the operator does not own are left alone and fail the
+// route.
+func (c *DNSClient) EnsureRoute(ctx context.Context, sessionID string, route Route, opts RouteOptions) (RouteRecord, error) {
+	if err := validateRoute(sessionID, route, ""); err != nil {
+		return RouteRecord{}, err
+	}
+	endpoint := route.Endpoint
+	if opts.Hostname == "" {
+		return RouteRecord{}, fmt.Errorf("cloudflare: DNS routes need a hostname")
+	}
+	record := RouteRecord{ID: c.routeID(opts.Hostname), Provider: ProviderDNS}
+	if !c.hasCredentials() {
+		return record, nil
+	}
+
+	owner, records, err := c.sessionRecords(ctx, opts.Hostname)
+	if err != nil {
+		return RouteRecord{}, err
+	}
+	if owner == nil && len(records) > 0 {
+		return RouteRecord{}, fmt.Errorf("%w: DNS record %s exists and is not owned by this operator", ErrConflict, opts.Hostname)
+	}
+	if owner != nil {
+		if o, _ := parseDNSOwner(owner.Content); o.SessionID != sessionID {
+			return RouteRecord{}, fmt.Errorf("%w: DNS record %s is owned by session %s", ErrConflict, opts.Hostname, o.SessionID)
+		}
+	}
+
+	// The claim is written first, so a record is never left unclaimed.
+	claim := dnsRecord{
+		Type:    "TXT",
+		Name:    ownerRecordPrefix + opts.Hostname,
+		Content: dnsOwner{Owner: c.ownerID(), SessionID: sessionID, Endpoint: endpoint}.String(),
+		TTL:     1,
+	}
+	switch {
+	case owner == nil:
+		err = c.writeRecord(ctx, "", claim)
+	case owner.Content != claim.Content:
+		err = c.writeRecord(ctx, owner.ID, claim)
+	}
+	if err != nil {
+		return RouteRecord{}, err
+	}
+
+	recordType, content := c.recordContent(endpoint)
+	want := dnsRecord{Type: recordType, Name: opts.Hostname, Content: content, Proxied: true, TTL: 1, Comment: "Session " + sessionID}
+	id, upToDate := "", false
+	for _, r := range records {
+		if r.Type == recordType && id == "" {
+			id, upToDate = r.ID, r.Content == want.Content && r.Proxied
+			continue
+		}
+		// An A record cannot stay next to a CNAME, nor an address of the
+		// previous endpoint next to the new one.
+		if err := c.deleteRecord(ctx, r.ID); err != nil {
+			return RouteRecord{}, err
+		}
+	}
+	if upToDate {
+		return record, nil
+	}
+	if err := c.writeRecord(ctx, id, want); err != nil {
+		return RouteRecord{}, err
+	}
+	return record, nil
+}
+
+// DeleteRoute removes the session's record and its ownership record. A
+// hostname the operator does not own is not touched.
+func (c *DNSClient) DeleteRoute(ctx context.Context, sessionID, routeID string) error {
+	if routeID == "" && sessionID == "" {
+		return nil
+	}
+	if !c.hasCredentials() {
+		return nil
+	}
+	hostname, err := c.hostnameOf(ctx, sessionID, routeID)
+	if errors.Is(err, ErrRouteNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	owner, records, err := c.sessionRecords(ctx, hostname)
+	if err != nil || owner == nil {
+		return err
+	}
+	for _, r := range records {
+		if err := c.deleteRecord(ctx, r.ID); err != nil {
+			return err
+		}
+	}
+	return c.deleteRecord(ctx, owner.ID)
+}
+
+// BatchEnsureRoutes ensures the routes one at a time, each claiming its
+// hostname on its own; it keeps the embedded APIClient from writing them to
+// Workers KV.
+func (c *DNSClient) BatchEnsureRoutes(ctx context.Context, routes []RouteWrite) ([]RouteRecord, error) {
+	return ensureEach(ctx, c, routes)
+}
+
+// BatchDeleteRoutes deletes the routes one at a time.
+func (c *DNSClient) BatchDeleteRoutes(ctx context.Context, routes []RouteRecord) error {
+	return deleteEach(ctx, c, routes)
+}
+
+// GetRoute reads the session's record back. The endpoint it was written for
+// is its Endpoint while it still points where it was made to, and its
+// content once it does not.
+func (c *DNSClient) GetRoute(ctx context.Context, sessionID, routeID string) (RouteRecord, error) {
+	if routeID == "" && sessionID == "" {
+		return RouteRecord{}, ErrRouteNotFound
+	}
+	if !c.hasCredentials() {
+		return RouteRecord{}, ErrUnsupported
+	}
+	hostname, err := c.hostnameOf(ctx, sessionID, routeID)
+	if err != nil {
+		return RouteRecord{}, err
+	}
+	owner, records, err := c.sessionRecords(ctx, hostname)
+	if err != nil {
+		return RouteRecord{}, err
+	}
+	if owner == nil || len(records) == 0 {
+		return RouteRecord{}, ErrRouteNotFound
+	}
+	o, _ := parseDNSOwner(owner.Content)
+	route := RouteRecord{ID: c.routeID(hostname), Provider: ProviderDNS, Route: Route{Endpoint: o.Endpoint}}
+	if recordType, content := c.recordContent(o.Endpoint); records[0].Type != recordType || records[0].Content != content {
+		route.Route.Endpoint = records[0].Content
+	}
+	return route, nil
+}
+
+// ListRoutes returns the hostnames this operator instance owns in the zone,
+// with their session; kvNamespaceID does not apply. Pages are pages of the
+// zone's TXT records, of which only the ownership records are listed, and
+// their cursor is the number of the next.
+func (c *DNSClient) ListRoutes(ctx context.Context, kvNamespaceID string, opts ListOptions) (RoutePage, error) {
+	if !c.hasCredentials() {
+		return RoutePage{}, ErrUnsupported
+	}
+	page := 1
+	if opts.Cursor != "" {
+		n, err := strconv.Atoi(opts.Cursor)
+		if err != nil || n < 1 {
+			return RoutePage{}, fmt.Errorf("cloudflare: invalid DNS listing cursor %q", opts.Cursor)
+		}
+		page = n
+	}
+	txt, more, err := c.listRecordsPage(ctx, url.Values{"type": {"TXT"}}, page, opts.Limit)
+	if err != nil {
+		return RoutePage{}, err
+	}
+	var routes []RouteRecord
+	for _, r := range txt {
+		o, ok := parseDNSOwner(r.Content)
+		if !ok || o.Owner != c.ownerID() || !strings.HasPrefix(r.Name, ownerRecordPrefix) {
+			continue
+		}
+		routes = append(routes, RouteRecord{
+			ID:        c.routeID(strings.TrimPrefix(r.Name, ownerRecordPrefix)),
+			Provider:  ProviderDNS,
+			SessionID: o.SessionID,
+		})
+	}
+	result := RoutePage{Routes: routes}
+	if more {
+		result.NextCursor = strconv.Itoa(page + 1)
+	}
+	return result, nil
+}
@@ -0,0 +1,156 @@
+package cloudflare_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare/fake"
+)
+
+type testRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	Proxied bool   `json:"proxied"`
+}
+
+// zoneRecords returns the records of testZone as "TYPE name content",
+// sorted.
+func zoneRecords(t *testing.T, srv *fake.Server) []string {
+	t.Helper()
+	var records []testRecord
+	apiCall(t, srv, http.MethodGet, "/zones/"+testZone+"/dns_records?per_page=1000", nil, &records)
+	lines := make([]string, 0, len(records))
+	for _, r := range records {
+		lines = append(lines, r.Type+" "+r.Name+" "+r.Content)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func newTestDNSClient(t *testing.T, srv *fake.Server) *cloudflare.DNSClient {
+	return cloudflare.NewDNSClient(newTestClient(t, srv), testZone)
+}
+
+func TestDNSEnsureRouteClaimsRecord(t *testing.T) {
+	ctx := context.Background()
+	srv := fake.NewServer()
+	c := newTestDNSClient(t, srv)
+
+	record, err := c.EnsureRoute(ctx, "s1", cloudflare.Route{Endpoint: "10.0.0.1:8080"}, cloudflare.RouteOptions{Hostname: "s1.example.com"})
+	if err != nil {
+		t.Fatalf("EnsureRoute: %v", err)
+	}
+	if record.ID != testZone+"/s1.example.com" || record.Provider != cloudflare.ProviderDNS {
+		t.Fatalf("EnsureRoute = %+v", record)
+	}
+	want := []string{
+		"A s1.example.com 10.0.0.1",
+		`TXT _session-owner.s1.example.com "heritage=cloudflare-session-operator,owner=default,session=s1,endpoint=10.0.0.1:8080"`,
+	}
+	if got := zoneRecords(t, srv); !equalStrings(got, want) {
+		t.Fatalf("records = %q want %q", got, want)
+	}
+
+	// Moving to a Target replaces the A record with a CNAME.
+	c.Target = "sessions.example.com"
+	if _, err := c.EnsureRoute(ctx, "s1", cloudflare.Route{Endpoint: "10.0.0.2:8080"}, cloudflare.RouteOptions{Hostname: "s1.example.com"}); err != nil {
+		t.Fatalf("EnsureRoute with a target: %v", err)
+	}
+	want = []string{
+		"CNAME s1.example.com sessions.example.com",
+		`TXT _session-owner.s1.example.com "heritage=cloudflare-session-operator,owner=default,session=s1,endpoint=10.0.0.2:8080"`,
+	}
+	if got := zoneRecords(t, srv); !equalStrings(got, want) {
+		t.Fatalf("records = %q want %q", got, want)
+	}
+
+	got, err := c.GetRoute(ctx, "s1", "")
+	if err != nil || got.Route.Endpoint != "10.0.0.2:8080" || got.ID != record.ID {
+		t.Fatalf("GetRoute = %+v, %v, want endpoint 10.0.0.2:8080", got, err)
+	}
+	page, err := c.ListRoutes(ctx, "", cloudflare.ListOptions{})
+	if err != nil || len(page.Routes) != 1 || page.Routes[0].SessionID != "s1" || page.Routes[0].ID != record.ID {
+		t.Fatalf("ListRoutes = %+v, %v", page, err)
+	}
+}
+
+func TestDNSEnsureRouteRefusesRecordsItDoesNotOwn(t *testing.T) {
+	ctx := context.Background()
+	srv := fake.NewServer()
+	apiCall(t, srv, http.MethodPost, "/zones/"+testZone+"/dns_records", testRecord{Type: "A", Name: "app.example.com", Content: "192.0.2.1"}, nil)
+	c := newTestDNSClient(t, srv)
+
+	_, err := c.EnsureRoute(ctx, "s1", cloudflare.Route{Endpoint: "10.0.0.1:80"}, cloudflare.RouteOptions{Hostname: "app.example.com"})
+	if !errors.Is(err, cloudflare.ErrConflict) {
+		t.Fatalf("EnsureRoute over an unowned record: %v, want ErrConflict", err)
+	}
+
+	if _, err := c.EnsureRoute(ctx, "s1", cloudflare.Route{Endpoint: "10.0.0.1:80"}, cloudflare.RouteOptions{Hostname: "s1.example.com"}); err != nil {
+		t.Fatalf("EnsureRoute: %v", err)
+	}
+	_, err = c.EnsureRoute(ctx, "s2", cloudflare.Route{Endpoint: "10.0.0.2:80"}, cloudflare.RouteOptions{Hostname: "s1.example.com"})
+	if !errors.Is(err, cloudflare.ErrConflict) {
+		t.Fatalf("EnsureRoute over another session's record: %v, want ErrConflict", err)
+	}
+
+	// Another operator instance does not own the records of this one.
+	other := newTestDNSClient(t, srv)
+	other.OwnerID = "other"
+	if page, err := other.ListRoutes(ctx, "", cloudflare.ListOptions{}); err != nil || len(page.Routes) != 0 {
+		t.Fatalf("ListRoutes of another owner = %+v, %v, want none", page, err)
+	}
+	if _, err := other.EnsureRoute(ctx, "s1", cloudflare.Route{Endpoint: "10.0.0.1:80"}, cloudflare.RouteOptions{Hostname: "s1.example.com"}); !errors.Is(err, cloudflare.ErrConflict) {
+		t.Fatalf("EnsureRoute by another owner: %v, want ErrConflict", err)
+	}
+}
+
+func TestDNSDeleteRoute(t *testing.T) {
+	ctx := context.Background()
+	srv := fake.NewServer()
+	apiCall(t, srv, http.MethodPost, "/zones/"+testZone+"/dns_records", testRecord{Type: "A", Name: "app.example.com", Content: "192.0.2.1"}, nil)
+	c := newTestDNSClient(t, srv)
+	for _, id := range []string{"s1", "s2"} {
+		if _, err := c.EnsureRoute(ctx, id, cloudflare.Route{Endpoint: "10.0.0.1:80"}, cloudflare.RouteOptions{Hostname: id + ".example.com"}); err != nil {
+			t.Fatalf("EnsureRoute: %v", err)
+		}
+	}
+
+	// By session, found among the owned records, and by route ID.
+	if err := c.DeleteRoute(ctx, "s1", ""); err != nil {
+		t.Fatalf("DeleteRoute by session: %v", err)
+	}
+	if err := c.DeleteRoute(ctx, "", testZone+"/s2.example.com"); err != nil {
+		t.Fatalf("DeleteRoute by ID: %v", err)
+	}
+	if err := c.DeleteRoute(ctx, "", testZone+"/app.example.com"); err != nil {
+		t.Fatalf("DeleteRoute of an unowned record: %v", err)
+	}
+	if got, want := zoneRecords(t, srv), []string{"A app.example.com 192.0.2.1"}; !equalStrings(got, want) {
+		t.Fatalf("records = %q want %q", got, want)
+	}
+	if _, err := c.GetRoute(ctx, "s1", ""); !errors.Is(err, cloudflare.ErrRouteNotFound) {
+		t.Fatalf("GetRoute of a deleted route: %v, want ErrRouteNotFound", err)
+	}
+	if err := c.DeleteRoute(ctx, "", "elsewhere/s1.example.com"); err == nil || !strings.Contains(err.Error(), "not in zone") {
+		t.Fatalf("DeleteRoute of another zone: %v", err)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
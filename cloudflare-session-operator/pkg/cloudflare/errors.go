@@ -0,0 +1,90 @@
+package cloudflare
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Kinds of failed API calls, matched with errors.Is. The Client's errors are
+// of one of them when the API says so, whatever the operation.
+var (
+	// ErrNotFound is a call on something that does not exist.
+	ErrNotFound = errors.New("cloudflare: not found")
+	// ErrRateLimited is a call refused for exceeding the API rate limit;
+	// RetryAfter tells when to try again, if Cloudflare said.
+	ErrRateLimited = errors.New("cloudflare: rate limited")
+	// ErrUnauthorized is a call with missing, invalid or insufficient
+	// credentials, which retrying will not fix.
+	ErrUnauthorized = errors.New("cloudflare: unauthorized")
+	// ErrConflict is a write clashing with the current state, e.g. a record
+	// that already exists.
+	ErrConflict = errors.New("cloudflare: conflict")
+)
+
+// API error codes of each kind, for the failures reported with a status
+// that does not tell.
+var errorKindCodes = map[error][]int{
+	// Workers KV key not found; DNS record not found.
+	ErrNotFound: {10009, 81044},
+	// Too many requests.
+	ErrRateLimited: {971},
+	// Authentication error; missing or invalid authentication headers;
+	// invalid API token.
+	ErrUnauthorized: {10000, 9106, 9107, 9109},
+	// DNS record already exists.
+	ErrConflict: {81053, 81057, 81058},
+}
+
+// errorKindStatus is the HTTP status of each kind.
+var errorKindStatus = map[error][]int{
+	ErrNotFound:     {http.StatusNotFound, http.StatusGone},
+	ErrRateLimited:  {http.StatusTooManyRequests},
+	ErrUnauthorized: {http.StatusUnauthorized, http.StatusForbidden},
+	ErrConflict:     {http.StatusConflict, http.StatusPreconditionFailed},
+}
+
+// Is reports whether e is of the kind target.
+func (e *apiError) Is(target error) bool {
+	for _, status := range errorKindStatus[target] {
+		if e.StatusCode == status {
+			return true
+		}
+	}
+	for _, code := range errorKindCodes[target] {
+		for _, m := range e.Errors {
+			if m.Code == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// kindError is an error of one of the kinds above with a message of its
+// own.
+type kindError struct {
+	kind error
+	msg  string
+}
+
+func (e *kindError) Error() string { return e.msg }
+
+func (e *kindError) Unwrap() error { return e.kind }
+
+// RetryAfter returns the delay Cloudflare asked for before the call failing
+// with err is retried, or until the circuit breaker that rejected it lets
+// calls through again; ok is false when neither says.
+func RetryAfter(err error) (d time.Duration, ok bool) {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.retryAfter > 0 {
+		return apiErr.retryAfter, true
+	}
+	var openErr *circuitOpenError
+	if errors.As(err, &openErr) {
+		if d := time.Until(openErr.until); d > 0 {
+			return d, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,397 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare"
+)
+
+// Names of the cloudflare.Client methods, as recorded in Call.Method and
+// programmed with SetError, FailNext and SetLatency.
+const (
+	MethodEnsureSession = "EnsureSession"
+	MethodEnsureRoute   = "EnsureRoute"
+	MethodDeleteRoute   = "DeleteRoute"
+	MethodGetRoute      = "GetRoute"
+	MethodListRoutes    = "ListRoutes"
+	MethodListSessions  = "ListSessions"
+	// Batches are recorded as one call, not as a call per route.
+	MethodBatchEnsureRoutes = "BatchEnsureRoutes"
+	MethodBatchDeleteRoutes = "BatchDeleteRoutes"
+)
+
+// Call is a call made on a Client, with the arguments its method takes.
+type Call struct {
+	Method        string
+	SessionID     string
+	RouteID       string
+	Route         cloudflare.Route
+	KVNamespaceID string
+	RouteOptions  cloudflare.RouteOptions
+	ListOptions   cloudflare.ListOptions
+	// Writes and Deletes are the routes of a batch.
+	Writes  []cloudflare.RouteWrite
+	Deletes []cloudflare.RouteRecord
+}
+
+// Client is an in-memory cloudflare.Client for tests. It records every
+// call, keeps the routes written by EnsureRoute for GetRoute, ListRoutes
+// and DeleteRoute, versioned as Workers KV routes are, and takes sessions
+// to exist unless SetSession says otherwise. Errors and latencies can be
+// programmed per method. It is safe for concurrent use; the zero value is
+// ready to use.
+type Client struct {
+	// Provider is the Provider of the routes; empty is
+	// cloudflare.ProviderWorkersKV. Set it before the first call.
+	Provider string
+
+	mu       sync.Mutex
+	calls    []Call
+	routes   map[string]fakeRoute
+	versions int
+	sessions map[string]cloudflare.Session
+	errs     map[string]error
+	next     map[string][]error
+	latency  map[string]time.Duration
+}
+
+type fakeRoute struct {
+	record        cloudflare.RouteRecord
+	kvNamespaceID string
+}
+
+var (
+	_ cloudflare.Client      = &Client{}
+	_ cloudflare.BatchClient = &Client{}
+)
+
+// SetSession sets what EnsureSession and ListSessions return for sessionID.
+func (c *Client) SetSession(sessionID string, session cloudflare.Session) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sessions == nil {
+		c.sessions = map[string]cloudflare.Session{}
+	}
+	session.ID = sessionID
+	c.sessions[sessionID] = session
+}
+
+// SetError makes every call of method fail with err, until set back to nil.
+func (c *Client) SetError(method string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.errs == nil {
+		c.errs = map[string]error{}
+	}
+	c.errs[method] = err
+}
+
+// FailNext makes the next calls of method fail with errs, one each, before
+// any error set with SetError.
+func (c *Client) FailNext(method string, errs ...error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.next == nil {
+		c.next = map[string][]error{}
+	}
+	c.next[method] = append(c.next[method], errs...)
+}
+
+// SetLatency delays every call of method by d, or until its context is
+// done.
+func (c *Client) SetLatency(method string, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.latency == nil {
+		c.latency = map[string]time.Duration{}
+	}
+	c.latency[method] = d
+}
+
+// Calls returns the calls made so far, in order, of every method or of
+// those given.
+func (c *Client) Calls(methods ...string) []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var calls []Call
+	for _, call := range c.calls {
+		if len(methods) == 0 || contains(methods, call.Method) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Routes returns the routes currently held, by ID, with their Route and
+// SessionID.
+func (c *Client) Routes() map[string]cloudflare.RouteRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	routes := make(map[string]cloudflare.RouteRecord, len(c.routes))
+	for id, r := range c.routes {
+		routes[id] = r.record
+	}
+	return routes
+}
+
+// begin records call and returns the error it is programmed to fail with,
+// after its latency, or the error of ctx once it is done, as the API
+// client would.
+func (c *Client) begin(ctx context.Context, call Call) error {
+	c.mu.Lock()
+	c.calls = append(c.calls, call)
+	delay := c.latency[call.Method]
+	var err error
+	if queued := c.next[call.Method]; len(queued) > 0 {
+		err, c.next[call.Method] = queued[0], queued[1:]
+	} else {
+		err = c.errs[call.Method]
+	}
+	c.mu.Unlock()
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+func (c *Client) EnsureSession(ctx context.Context, sessionID string) (cloudflare.Session, error) {
+	if err := c.begin(ctx, Call{Method: MethodEnsureSession, SessionID: sessionID}); err != nil {
+		return cloudflare.Session{}, err
+	}
+	if sessionID == "" {
+		return cloudflare.Session{}, errors.New("sessionID is empty")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	session, ok := c.sessions[sessionID]
+	if !ok {
+		return cloudflare.Session{Exists: true}, nil
+	}
+	session.ID = ""
+	return session, nil
+}
+
+func (c *Client) EnsureRoute(ctx context.Context, sessionID string, route cloudflare.Route, opts cloudflare.RouteOptions) (cloudflare.RouteRecord, error) {
+	if err := c.begin(ctx, Call{Method: MethodEnsureRoute, SessionID: sessionID, Route: route, KVNamespaceID: opts.KVNamespaceID, RouteOptions: opts}); err != nil {
+		return cloudflare.RouteRecord{}, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ensureRoute(sessionID, route, opts)
+}
+
+// BatchEnsureRoutes ensures the routes as EnsureRoute does; routes that
+// EnsureRoute would reject fail alone, as a cloudflare.RouteErrors.
+func (c *Client) BatchEnsureRoutes(ctx context.Context, routes []cloudflare.RouteWrite) ([]cloudflare.RouteRecord, error) {
+	if err := c.begin(ctx, Call{Method: MethodBatchEnsureRoutes, Writes: routes}); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	records := make([]cloudflare.RouteRecord, len(routes))
+	errs := cloudflare.RouteErrors{}
+	for i, w := range routes {
+		record, err := c.ensureRoute(w.SessionID, w.Route, w.Options)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		records[i] = record
+	}
+	if len(errs) > 0 {
+		return records, errs
+	}
+	return records, nil
+}
+
+func (c *Client) ensureRoute(sessionID string, route cloudflare.Route, opts cloudflare.RouteOptions) (cloudflare.RouteRecord, error) {
+	switch {
+	case sessionID == "":
+		return cloudflare.RouteRecord{}, errors.New("sessionID is empty")
+	case route.Endpoint == "":
+		return cloudflare.RouteRecord{}, errors.New("endpoint is empty")
+	}
+	if c.routes == nil {
+		c.routes = map[string]fakeRoute{}
+	}
+	id := routeID(opts.KVNamespaceID, sessionID)
+	if opts.IfVersion != "" {
+		current, ok := c.routes[id]
+		switch {
+		case !ok:
+			return cloudflare.RouteRecord{}, fmt.Errorf("%w: route %s was deleted since version %s", cloudflare.ErrConflict, id, opts.IfVersion)
+		case current.record.Version != opts.IfVersion && current.record.Route.Endpoint != route.Endpoint:
+			return cloudflare.RouteRecord{}, fmt.Errorf("%w: route %s changed since version %s", cloudflare.ErrConflict, id, opts.IfVersion)
+		}
+	}
+	c.versions++
+	record := cloudflare.RouteRecord{ID: id, Provider: c.provider(), Version: strconv.Itoa(c.versions)}
+	stored := record
+	stored.Route, stored.SessionID = route, sessionID
+	c.routes[record.ID] = fakeRoute{record: stored, kvNamespaceID: opts.KVNamespaceID}
+	return record, nil
+}
+
+func (c *Client) DeleteRoute(ctx context.Context, sessionID, id string) error {
+	if err := c.begin(ctx, Call{Method: MethodDeleteRoute, SessionID: sessionID, RouteID: id}); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.routes, c.resolve(sessionID, id))
+	return nil
+}
+
+// BatchDeleteRoutes deletes the routes as DeleteRoute does.
+func (c *Client) BatchDeleteRoutes(ctx context.Context, routes []cloudflare.RouteRecord) error {
+	if err := c.begin(ctx, Call{Method: MethodBatchDeleteRoutes, Deletes: routes}); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, route := range routes {
+		delete(c.routes, c.resolve(route.SessionID, route.ID))
+	}
+	return nil
+}
+
+func (c *Client) GetRoute(ctx context.Context, sessionID, id string) (cloudflare.RouteRecord, error) {
+	if err := c.begin(ctx, Call{Method: MethodGetRoute, SessionID: sessionID, RouteID: id}); err != nil {
+		return cloudflare.RouteRecord{}, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.routes[c.resolve(sessionID, id)]
+	if !ok {
+		return cloudflare.RouteRecord{}, cloudflare.ErrRouteNotFound
+	}
+	record := r.record
+	record.SessionID = ""
+	return record, nil
+}
+
+// ListRoutes lists the routes written to kvNamespaceID, all of them when
+// empty, in ID order; cursors are offsets in that order.
+func (c *Client) ListRoutes(ctx context.Context, kvNamespaceID string, opts cloudflare.ListOptions) (cloudflare.RoutePage, error) {
+	if err := c.begin(ctx, Call{Method: MethodListRoutes, KVNamespaceID: kvNamespaceID, ListOptions: opts}); err != nil {
+		return cloudflare.RoutePage{}, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var routes []cloudflare.RouteRecord
+	for _, r := range c.routes {
+		if kvNamespaceID == "" || r.kvNamespaceID == kvNamespaceID {
+			record := r.record
+			record.Route, record.Version = cloudflare.Route{}, ""
+			routes = append(routes, record)
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].ID < routes[j].ID })
+	page, next, err := paginate(len(routes), opts)
+	if err != nil {
+		return cloudflare.RoutePage{}, err
+	}
+	return cloudflare.RoutePage{Routes: routes[page.start:page.end], NextCursor: next}, nil
+}
+
+// ListSessions lists the sessions set to exist with SetSession, in ID
+// order; cursors are offsets in that order.
+func (c *Client) ListSessions(ctx context.Context, opts cloudflare.ListOptions) (cloudflare.SessionPage, error) {
+	if err := c.begin(ctx, Call{Method: MethodListSessions, ListOptions: opts}); err != nil {
+		return cloudflare.SessionPage{}, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var sessions []cloudflare.Session
+	for _, s := range c.sessions {
+		if s.Exists {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	page, next, err := paginate(len(sessions), opts)
+	if err != nil {
+		return cloudflare.SessionPage{}, err
+	}
+	return cloudflare.SessionPage{Sessions: sessions[page.start:page.end], NextCursor: next}, nil
+}
+
+func (c *Client) provider() string {
+	if c.Provider == "" {
+		return cloudflare.ProviderWorkersKV
+	}
+	return c.Provider
+}
+
+// resolve returns the ID of the route id, or of the session's route in
+// any namespace when id is empty.
+func (c *Client) resolve(sessionID, id string) string {
+	if id != "" {
+		return id
+	}
+	for routeID, r := range c.routes {
+		if r.record.SessionID == sessionID {
+			return routeID
+		}
+	}
+	return routeID("", sessionID)
+}
+
+func routeID(kvNamespaceID, sessionID string) string {
+	if kvNamespaceID == "" {
+		return sessionID
+	}
+	return kvNamespaceID + "/" + sessionID
+}
+
+type bounds struct{ start, end int }
+
+// paginate returns the bounds of the page of n entries opts selects and
+// the cursor of the next page.
+func paginate(n int, opts cloudflare.ListOptions) (bounds, string, error) {
+	start := 0
+	if opts.Cursor != "" {
+		offset, err := strconv.Atoi(opts.Cursor)
+		if err != nil || offset < 0 {
+			return bounds{}, "", errors.New("fake: invalid cursor " + strconv.Quote(opts.Cursor))
+		}
+		start = offset
+	}
+	if start > n {
+		start = n
+	}
+	end := n
+	if opts.Limit > 0 && start+opts.Limit < n {
+		end = start + opts.Limit
+	}
+	next := ""
+	if end < n {
+		next = strconv.Itoa(end)
+	}
+	return bounds{start, end}, next, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
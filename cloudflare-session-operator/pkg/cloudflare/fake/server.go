@@ -0,0 +1,631 @@
+// Package fake serves, from memory, the subset of the Cloudflare v4 API the
+// operator's client uses, so the operator and its end-to-end tests run
+// without a Cloudflare account:
+//
+//	srv := httptest.NewServer(fake.NewServer())
+//	api := cloudflare.NewClient("account", "token")
+//	api.BaseURL = srv.URL
+//
+// It serves Workers KV values and their metadata, bulk writes and deletes
+// and key listings, Load Balancer pools, Tunnel configurations, DNS records
+// and credential verification, for any account ID. Pools and tunnels spring
+// into existence, empty, when first read.
+//
+// Tests that do not need HTTP use Client instead, an in-memory
+// cloudflare.Client recording its calls.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token statuses reported by token verification.
+const (
+	TokenActive   = "active"
+	TokenDisabled = "disabled"
+	TokenExpired  = "expired"
+)
+
+// API error codes, as Cloudflare's.
+const (
+	codeInvalidToken    = 1000
+	codeInvalidRequest  = 1004
+	codeNoRoute         = 7003
+	codeAuthentication  = 10000
+	codeNotAllowed      = 10405
+	codeKeyNotFound     = 10009
+	codeRecordNotFound  = 81044
+	codeRecordConflict  = 81053
+	codeIdenticalRecord = 81058
+)
+
+const (
+	kvListLimit     = 1000
+	kvListMinLimit  = 10
+	kvBulkLimit     = 10000
+	dnsDefaultLimit = 100
+	// autoTTL is the TTL of records written without one.
+	autoTTL      = 1
+	maxBodyBytes = 10 << 20
+)
+
+// Server is an in-memory Cloudflare API. The zero value is not usable; make
+// one with NewServer.
+type Server struct {
+	// Tokens, when set, are the only API tokens accepted, with their
+	// status; tokens that are not TokenActive are refused like unknown
+	// ones, except by token verification. Any API key is accepted.
+	Tokens map[string]string
+	// Now defaults to time.Now; it expires Workers KV entries.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	kv      map[string]map[string]kvEntry
+	pools   map[string]map[string]json.RawMessage
+	tunnels map[string]map[string]json.RawMessage
+	records map[string][]dnsRecord
+	nextID  int
+}
+
+type kvEntry struct {
+	value      string
+	metadata   json.RawMessage
+	expiration int64
+}
+
+type dnsRecord struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	Proxied bool   `json:"proxied"`
+	TTL     int    `json:"ttl"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// NewServer returns an empty Server accepting any credentials.
+func NewServer() *Server {
+	return &Server{
+		kv:      map[string]map[string]kvEntry{},
+		pools:   map[string]map[string]json.RawMessage{},
+		tunnels: map[string]map[string]json.RawMessage{},
+		records: map[string][]dnsRecord{},
+	}
+}
+
+// PutValue writes value under key in the Workers KV namespace, e.g. to seed
+// the session store; a zero expiration never expires.
+func (s *Server) PutValue(namespaceID, key, value string, expiration time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := kvEntry{value: value}
+	if !expiration.IsZero() {
+		entry.expiration = expiration.Unix()
+	}
+	s.namespace(namespaceID)[key] = entry
+}
+
+// Value returns the value under key in the Workers KV namespace.
+func (s *Server) Value(namespaceID, key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.liveEntry(namespaceID, key)
+	return entry.value, ok
+}
+
+// DeleteValue removes key from the Workers KV namespace, e.g. to end a
+// session of the session store.
+func (s *Server) DeleteValue(namespaceID, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.namespace(namespaceID), key)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := strings.TrimPrefix(req.URL.EscapedPath(), "/client/v4")
+	var segments []string
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidRequest, "invalid path")
+			return
+		}
+		segments = append(segments, unescaped)
+	}
+	if len(segments) == 3 && segments[0] == "user" && segments[1] == "tokens" && segments[2] == "verify" {
+		s.verifyToken(w, req)
+		return
+	}
+	if !s.authenticated(req) {
+		writeError(w, http.StatusUnauthorized, codeAuthentication, "Authentication error")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case len(segments) == 1 && segments[0] == "user":
+		s.getUser(w, req)
+	case len(segments) == 8 && segments[0] == "accounts" && segments[2] == "storage" && segments[3] == "kv" && segments[4] == "namespaces" && segments[6] == "values":
+		s.serveValue(w, req, segments[5], segments[7])
+	case len(segments) == 8 && segments[0] == "accounts" && segments[2] == "storage" && segments[3] == "kv" && segments[4] == "namespaces" && segments[6] == "metadata":
+		s.serveMetadata(w, req, segments[5], segments[7])
+	case len(segments) == 7 && segments[0] == "accounts" && segments[2] == "storage" && segments[3] == "kv" && segments[4] == "namespaces" && segments[6] == "keys":
+		s.listKeys(w, req, segments[5])
+	case len(segments) == 7 && segments[0] == "accounts" && segments[2] == "storage" && segments[3] == "kv" && segments[4] == "namespaces" && segments[6] == "bulk":
+		s.serveBulk(w, req, segments[5])
+	case len(segments) == 5 && segments[0] == "accounts" && segments[2] == "load_balancers" && segments[3] == "pools":
+		s.servePool(w, req, segments[4])
+	case len(segments) == 5 && segments[0] == "accounts" && segments[2] == "cfd_tunnel" && segments[4] == "configurations":
+		s.serveTunnel(w, req, segments[3])
+	case len(segments) == 3 && segments[0] == "zones" && segments[2] == "dns_records":
+		s.serveRecords(w, req, segments[1])
+	case len(segments) == 4 && segments[0] == "zones" && segments[2] == "dns_records":
+		s.serveRecord(w, req, segments[1], segments[3])
+	default:
+		writeError(w, http.StatusNotFound, codeNoRoute, "Could not route to "+path)
+	}
+}
+
+// authenticated reports whether req carries credentials the server takes.
+func (s *Server) authenticated(req *http.Request) bool {
+	if token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+		return s.Tokens == nil || s.Tokens[token] == TokenActive
+	}
+	return req.Header.Get("X-Auth-Key") != "" && req.Header.Get("X-Auth-Email") != ""
+}
+
+func (s *Server) verifyToken(w http.ResponseWriter, req *http.Request) {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		writeError(w, http.StatusUnauthorized, codeAuthentication, "Authentication error")
+		return
+	}
+	status := TokenActive
+	if s.Tokens != nil {
+		if status, ok = s.Tokens[token]; !ok {
+			writeError(w, http.StatusUnauthorized, codeInvalidToken, "Invalid API Token")
+			return
+		}
+	}
+	writeResult(w, http.StatusOK, map[string]string{"id": "fake-token", "status": status}, nil)
+}
+
+func (s *Server) getUser(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	writeResult(w, http.StatusOK, map[string]string{"id": "fake-user", "email": req.Header.Get("X-Auth-Email")}, nil)
+}
+
+func (s *Server) namespace(namespaceID string) map[string]kvEntry {
+	ns, ok := s.kv[namespaceID]
+	if !ok {
+		ns = map[string]kvEntry{}
+		s.kv[namespaceID] = ns
+	}
+	return ns
+}
+
+// liveEntry returns the entry of key unless it is missing or expired.
+func (s *Server) liveEntry(namespaceID, key string) (kvEntry, bool) {
+	entry, ok := s.kv[namespaceID][key]
+	if !ok || entry.expiration > 0 && entry.expiration <= s.now().Unix() {
+		return kvEntry{}, false
+	}
+	return entry, true
+}
+
+func (s *Server) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+func (s *Server) serveValue(w http.ResponseWriter, req *http.Request, namespaceID, key string) {
+	switch req.Method {
+	case http.MethodGet:
+		entry, ok := s.liveEntry(namespaceID, key)
+		if !ok {
+			writeError(w, http.StatusNotFound, codeKeyNotFound, "get: 'key not found'")
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = io.WriteString(w, entry.value)
+	case http.MethodPut:
+		entry := kvEntry{}
+		if strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/form-data") {
+			if err := req.ParseMultipartForm(maxBodyBytes); err != nil {
+				writeError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+				return
+			}
+			entry.value = req.FormValue("value")
+			if metadata := req.FormValue("metadata"); metadata != "" {
+				if !json.Valid([]byte(metadata)) {
+					writeError(w, http.StatusBadRequest, codeInvalidRequest, "metadata is not valid JSON")
+					return
+				}
+				entry.metadata = json.RawMessage(metadata)
+			}
+		} else {
+			body, err := io.ReadAll(io.LimitReader(req.Body, maxBodyBytes))
+			if err != nil {
+				writeError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+				return
+			}
+			entry.value = string(body)
+		}
+		if expiration := req.URL.Query().Get("expiration"); expiration != "" {
+			seconds, err := strconv.ParseInt(expiration, 10, 64)
+			if err != nil || seconds <= s.now().Unix() {
+				writeError(w, http.StatusBadRequest, codeInvalidRequest, "Invalid expiration: must be in the future")
+				return
+			}
+			entry.expiration = seconds
+		}
+		s.namespace(namespaceID)[key] = entry
+		writeResult(w, http.StatusOK, nil, nil)
+	case http.MethodDelete:
+		delete(s.namespace(namespaceID), key)
+		writeResult(w, http.StatusOK, nil, nil)
+	default:
+		writeMethodNotAllowed(w)
+	}
+}
+
+// serveMetadata reads the metadata of a key, null when it was written
+// without any.
+func (s *Server) serveMetadata(w http.ResponseWriter, req *http.Request, namespaceID, key string) {
+	if req.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	entry, ok := s.liveEntry(namespaceID, key)
+	if !ok {
+		writeError(w, http.StatusNotFound, codeKeyNotFound, "get: 'key not found'")
+		return
+	}
+	writeResult(w, http.StatusOK, entry.metadata, nil)
+}
+
+// serveBulk writes or deletes many keys of the namespace at once. Every
+// entry is checked before any is applied, so a rejected request changes
+// nothing.
+func (s *Server) serveBulk(w http.ResponseWriter, req *http.Request, namespaceID string) {
+	switch req.Method {
+	case http.MethodPut:
+		var pairs []struct {
+			Key        string          `json:"key"`
+			Value      string          `json:"value"`
+			Metadata   json.RawMessage `json:"metadata"`
+			Expiration int64           `json:"expiration"`
+		}
+		if err := decodeBody(req, &pairs); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+		if len(pairs) > kvBulkLimit {
+			writeError(w, http.StatusBadRequest, codeInvalidRequest, "too many keys in a bulk write")
+			return
+		}
+		for _, pair := range pairs {
+			if pair.Key == "" {
+				writeError(w, http.StatusBadRequest, codeInvalidRequest, "key is empty")
+				return
+			}
+			if pair.Expiration != 0 && pair.Expiration <= s.now().Unix() {
+				writeError(w, http.StatusBadRequest, codeInvalidRequest, "Invalid expiration: must be in the future")
+				return
+			}
+		}
+		ns := s.namespace(namespaceID)
+		for _, pair := range pairs {
+			entry := kvEntry{value: pair.Value, expiration: pair.Expiration}
+			if len(pair.Metadata) > 0 && string(pair.Metadata) != "null" {
+				entry.metadata = pair.Metadata
+			}
+			ns[pair.Key] = entry
+		}
+		writeResult(w, http.StatusOK, map[string]any{"successful_key_count": len(pairs), "unsuccessful_keys": []string{}}, nil)
+	case http.MethodDelete:
+		var keys []string
+		if err := decodeBody(req, &keys); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+		if len(keys) > kvBulkLimit {
+			writeError(w, http.StatusBadRequest, codeInvalidRequest, "too many keys in a bulk delete")
+			return
+		}
+		ns := s.namespace(namespaceID)
+		for _, key := range keys {
+			delete(ns, key)
+		}
+		writeResult(w, http.StatusOK, map[string]any{"successful_key_count": len(keys), "unsuccessful_keys": []string{}}, nil)
+	default:
+		writeMethodNotAllowed(w)
+	}
+}
+
+// listKeys lists the live keys of the namespace in name order; the cursor
+// is the offset of the page in that order.
+func (s *Server) listKeys(w http.ResponseWriter, req *http.Request, namespaceID string) {
+	if req.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	query := req.URL.Query()
+	limit := kvListLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < kvListMinLimit || n > kvListLimit {
+			writeError(w, http.StatusBadRequest, codeInvalidRequest, "limit must be between 10 and 1000")
+			return
+		}
+		limit = n
+	}
+	offset := 0
+	if cursor := query.Get("cursor"); cursor != "" {
+		n, err := strconv.Atoi(cursor)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, codeInvalidRequest, "invalid cursor")
+			return
+		}
+		offset = n
+	}
+
+	var names []string
+	for name := range s.kv[namespaceID] {
+		if _, ok := s.liveEntry(namespaceID, name); ok && strings.HasPrefix(name, query.Get("prefix")) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if offset > len(names) {
+		offset = len(names)
+	}
+	end := offset + limit
+	if end > len(names) {
+		end = len(names)
+	}
+	type key struct {
+		Name       string          `json:"name"`
+		Expiration int64           `json:"expiration,omitempty"`
+		Metadata   json.RawMessage `json:"metadata,omitempty"`
+	}
+	keys := make([]key, 0, end-offset)
+	for _, name := range names[offset:end] {
+		entry := s.kv[namespaceID][name]
+		keys = append(keys, key{Name: name, Expiration: entry.expiration, Metadata: entry.metadata})
+	}
+	cursor := ""
+	if end < len(names) {
+		cursor = strconv.Itoa(end)
+	}
+	writeResult(w, http.StatusOK, keys, map[string]any{"count": len(keys), "cursor": cursor})
+}
+
+func (s *Server) servePool(w http.ResponseWriter, req *http.Request, poolID string) {
+	pool, ok := s.pools[poolID]
+	if !ok {
+		pool = map[string]json.RawMessage{
+			"id":      mustJSON(poolID),
+			"name":    mustJSON(poolID),
+			"origins": mustJSON([]any{}),
+		}
+		s.pools[poolID] = pool
+	}
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPatch:
+		var fields map[string]json.RawMessage
+		if err := decodeBody(req, &fields); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+		for k, v := range fields {
+			if k != "id" {
+				pool[k] = v
+			}
+		}
+	default:
+		writeMethodNotAllowed(w)
+		return
+	}
+	writeResult(w, http.StatusOK, pool, nil)
+}
+
+func (s *Server) serveTunnel(w http.ResponseWriter, req *http.Request, tunnelID string) {
+	config, ok := s.tunnels[tunnelID]
+	if !ok {
+		config = map[string]json.RawMessage{
+			"ingress": mustJSON([]map[string]string{{"service": "http_status:404"}}),
+		}
+		s.tunnels[tunnelID] = config
+	}
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var body struct {
+			Config map[string]json.RawMessage `json:"config"`
+		}
+		if err := decodeBody(req, &body); err != nil || body.Config == nil {
+			writeError(w, http.StatusBadRequest, codeInvalidRequest, "body must hold a config")
+			return
+		}
+		config = body.Config
+		s.tunnels[tunnelID] = config
+	default:
+		writeMethodNotAllowed(w)
+		return
+	}
+	writeResult(w, http.StatusOK, map[string]any{"tunnel_id": tunnelID, "config": config}, nil)
+}
+
+// serveRecords lists, by page number, or creates records of the zone.
+func (s *Server) serveRecords(w http.ResponseWriter, req *http.Request, zoneID string) {
+	switch req.Method {
+	case http.MethodGet:
+		query := req.URL.Query()
+		var matching []dnsRecord
+		for _, r := range s.records[zoneID] {
+			if (query.Get("type") == "" || r.Type == query.Get("type")) && (query.Get("name") == "" || r.Name == query.Get("name")) {
+				matching = append(matching, r)
+			}
+		}
+		page, perPage := atoiOr(query.Get("page"), 1), atoiOr(query.Get("per_page"), dnsDefaultLimit)
+		if page < 1 || perPage < 1 {
+			writeError(w, http.StatusBadRequest, codeInvalidRequest, "invalid page or per_page")
+			return
+		}
+		totalPages := (len(matching) + perPage - 1) / perPage
+		start, end := (page-1)*perPage, page*perPage
+		if start > len(matching) {
+			start = len(matching)
+		}
+		if end > len(matching) {
+			end = len(matching)
+		}
+		result := append([]dnsRecord{}, matching[start:end]...)
+		writeResult(w, http.StatusOK, result, map[string]any{
+			"page": page, "per_page": perPage, "count": len(result),
+			"total_count": len(matching), "total_pages": totalPages,
+		})
+	case http.MethodPost:
+		var record dnsRecord
+		if err := decodeBody(req, &record); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+		if status, code, msg := s.checkRecord(zoneID, "", record); code != 0 {
+			writeError(w, status, code, msg)
+			return
+		}
+		s.nextID++
+		record.ID = fmt.Sprintf("%032x", s.nextID)
+		if record.TTL == 0 {
+			record.TTL = autoTTL
+		}
+		s.records[zoneID] = append(s.records[zoneID], record)
+		writeResult(w, http.StatusOK, record, nil)
+	default:
+		writeMethodNotAllowed(w)
+	}
+}
+
+func (s *Server) serveRecord(w http.ResponseWriter, req *http.Request, zoneID, id string) {
+	records := s.records[zoneID]
+	i := 0
+	for i < len(records) && records[i].ID != id {
+		i++
+	}
+	if i == len(records) {
+		writeError(w, http.StatusNotFound, codeRecordNotFound, "Record does not exist.")
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+		writeResult(w, http.StatusOK, records[i], nil)
+	case http.MethodPut:
+		var record dnsRecord
+		if err := decodeBody(req, &record); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+		if status, code, msg := s.checkRecord(zoneID, id, record); code != 0 {
+			writeError(w, status, code, msg)
+			return
+		}
+		record.ID = id
+		if record.TTL == 0 {
+			record.TTL = autoTTL
+		}
+		records[i] = record
+		writeResult(w, http.StatusOK, record, nil)
+	case http.MethodDelete:
+		s.records[zoneID] = append(records[:i:i], records[i+1:]...)
+		writeResult(w, http.StatusOK, map[string]string{"id": id}, nil)
+	default:
+		writeMethodNotAllowed(w)
+	}
+}
+
+// checkRecord applies the rules Cloudflare enforces on a record written to
+// the zone, other than the one with id: a CNAME is the only record of its
+// name, and no two records are identical.
+func (s *Server) checkRecord(zoneID, id string, record dnsRecord) (status, code int, msg string) {
+	if record.Type == "" || record.Name == "" || record.Content == "" {
+		return http.StatusBadRequest, codeInvalidRequest, "type, name and content are required"
+	}
+	for _, r := range s.records[zoneID] {
+		switch {
+		case r.ID == id || r.Name != record.Name:
+		case r.Type == record.Type && r.Content == record.Content:
+			return http.StatusBadRequest, codeIdenticalRecord, "An identical record already exists."
+		case r.Type == "CNAME" || record.Type == "CNAME":
+			return http.StatusBadRequest, codeRecordConflict, "A CNAME record with that host already exists."
+		}
+	}
+	return 0, 0, ""
+}
+
+func decodeBody(req *http.Request, v any) error {
+	return json.NewDecoder(io.LimitReader(req.Body, maxBodyBytes)).Decode(v)
+}
+
+func writeResult(w http.ResponseWriter, status int, result any, info map[string]any) {
+	body := map[string]any{"success": true, "errors": []any{}, "messages": []any{}, "result": result}
+	if info != nil {
+		body["result_info"] = info
+	}
+	writeJSON(w, status, body)
+}
+
+func writeError(w http.ResponseWriter, status, code int, msg string) {
+	writeJSON(w, status, map[string]any{
+		"success":  false,
+		"errors":   []map[string]any{{"code": code, "message": msg}},
+		"messages": []any{},
+		"result":   nil,
+	})
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter) {
+	writeError(w, http.StatusMethodNotAllowed, codeNotAllowed, "Method not allowed")
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func mustJSON(v any) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func atoiOr(s string, fallback int) int {
+	if s == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return -1
+	}
+	return n
+}
@@ -0,0 +1,71 @@
+package cloudflare
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer makes the spans of API calls from the global TracerProvider, so
+// they are dropped unless the binary installs one.
+var tracer = otel.Tracer("github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare")
+
+type operationKey struct{}
+
+// withOperation names the API calls made with ctx in metrics and traces.
+func withOperation(ctx context.Context, operation string) context.Context {
+	return context.WithValue(ctx, operationKey{}, operation)
+}
+
+func operationOf(ctx context.Context) string {
+	if operation, ok := ctx.Value(operationKey{}).(string); ok {
+		return operation
+	}
+	return "unknown"
+}
+
+// startSpan starts the span of the call of req, returning req with the
+// span in its context.
+func startSpan(req *http.Request) (*http.Request, trace.Span) {
+	operation := operationOf(req.Context())
+	ctx, span := tracer.Start(req.Context(), "cloudflare."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("cloudflare.operation", operation),
+			attribute.String("http.method", req.Method),
+		))
+	return req.WithContext(ctx), span
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// observeAttempt records an attempt at req started at start, which got a
+// response with code or, when code is 0, none.
+func observeAttempt(req *http.Request, code int, start time.Time) {
+	label := "error"
+	if code != 0 {
+		label = strconv.Itoa(code)
+		trace.SpanFromContext(req.Context()).SetAttributes(attribute.Int("http.status_code", code))
+	}
+	requestDuration.WithLabelValues(operationOf(req.Context()), label).Observe(time.Since(start).Seconds())
+}
+
+// traceRetry notes on the call's span that attempt is retried after delay.
+func traceRetry(req *http.Request, attempt int, delay time.Duration) {
+	trace.SpanFromContext(req.Context()).AddEvent("retry", trace.WithAttributes(
+		attribute.Int("attempt", attempt),
+		attribute.String("delay", delay.String()),
+	))
+}
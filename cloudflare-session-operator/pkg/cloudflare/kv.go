@@ -0,0 +1,300 @@
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// routeKeyPrefix starts the KV key of every session route.
+	routeKeyPrefix = "session:"
+	// kvMinExpiration is the shortest expiration Workers KV accepts.
+	kvMinExpiration = 60 * time.Second
+	// kvListLimit and kvListMinLimit bound the pages of keys Workers KV
+	// returns.
+	kvListLimit    = 1000
+	kvListMinLimit = 10
+	// kvBulkLimit is the most entries a Workers KV bulk write or delete
+	// takes.
+	kvBulkLimit = 10000
+)
+
+// routeMetadata is the KV metadata of a route entry, for the Worker
+// serving sessions and for whoever inspects the namespace. The entry's
+// value is the route's endpoint.
+type routeMetadata struct {
+	SessionID  string            `json:"sessionID"`
+	Hostname   string            `json:"hostname,omitempty"`
+	PathPrefix string            `json:"pathPrefix,omitempty"`
+	TLSMode    string            `json:"tlsMode,omitempty"`
+	Weight     float64           `json:"weight,omitempty"`
+	Priority   int               `json:"priority,omitempty"`
+	Protocol   string            `json:"protocol,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	ExpiresAt  *time.Time        `json:"expiresAt,omitempty"`
+	UpdatedAt  time.Time         `json:"updatedAt"`
+	// Version changes with every write of the entry.
+	Version string `json:"version,omitempty"`
+}
+
+// newRouteMetadata is the metadata of the session's route entry.
+func newRouteMetadata(sessionID string, route Route, opts RouteOptions) routeMetadata {
+	metadata := routeMetadata{
+		SessionID:  sessionID,
+		Hostname:   opts.Hostname,
+		PathPrefix: opts.PathPrefix,
+		TLSMode:    opts.TLSMode,
+		Weight:     route.Weight,
+		Priority:   route.Priority,
+		Protocol:   route.Protocol,
+		Labels:     route.Labels,
+		UpdatedAt:  time.Now().UTC(),
+		Version:    newRouteVersion(),
+	}
+	if !route.ExpiresAt.IsZero() {
+		expiresAt := route.ExpiresAt.UTC()
+		metadata.ExpiresAt = &expiresAt
+	}
+	return metadata
+}
+
+// route is the route of the entry holding endpoint and m.
+func (m routeMetadata) route(endpoint string) Route {
+	route := Route{Endpoint: endpoint, Weight: m.Weight, Priority: m.Priority, Protocol: m.Protocol, Labels: m.Labels}
+	if m.ExpiresAt != nil {
+		route.ExpiresAt = *m.ExpiresAt
+	}
+	return route
+}
+
+// newRouteVersion returns a version for a route entry, random so that two
+// writers never pick the same.
+func newRouteVersion() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// kvBulkEntry is an entry of a Workers KV bulk write.
+type kvBulkEntry struct {
+	Key        string `json:"key"`
+	Value      string `json:"value"`
+	Metadata   any    `json:"metadata,omitempty"`
+	Expiration int64  `json:"expiration,omitempty"`
+}
+
+// kvKey is an entry of a KV key listing.
+type kvKey struct {
+	Name       string `json:"name"`
+	Expiration int64  `json:"expiration,omitempty"`
+}
+
+// routeKey is the KV key a session's route is stored under.
+func routeKey(sessionID string) string {
+	return routeKeyPrefix + sessionID
+}
+
+// kvRouteID qualifies a route's KV key with the namespace it was written to,
+// so DeleteRoute finds it even after the configured namespace changes.
+func kvRouteID(namespaceID, key string) string {
+	if namespaceID == "" {
+		return key
+	}
+	return namespaceID + "/" + key
+}
+
+// parseRouteID returns the namespace and key of routeID, falling back to
+// the client's namespace and the session's key for the parts it lacks.
+func (c *APIClient) parseRouteID(sessionID, routeID string) (namespaceID, key string, err error) {
+	namespaceID, key = c.KVNamespaceID, routeID
+	if ns, k, ok := strings.Cut(routeID, "/"); ok {
+		namespaceID, key = ns, k
+	}
+	if key == "" {
+		key = routeKey(sessionID)
+	}
+	if namespaceID == "" {
+		return "", "", errNoKVNamespace
+	}
+	return namespaceID, key, nil
+}
+
+var errNoKVNamespace = errors.New("cloudflare: no Workers KV namespace configured")
+
+func (c *APIClient) kvPath(namespaceID, suffix string) string {
+	return "/accounts/" + url.PathEscape(c.AccountID) + "/storage/kv/namespaces/" + url.PathEscape(namespaceID) + suffix
+}
+
+// kvPut writes value and its metadata under key. A non-zero expiration
+// has KV drop the entry then, no sooner than kvMinExpiration from now.
+func (c *APIClient) kvPut(ctx context.Context, namespaceID, key, value string, metadata any, expiration time.Time) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("value", value); err != nil {
+		return err
+	}
+	meta, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	if err := form.WriteField("metadata", string(meta)); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	path := c.kvPath(namespaceID, "/values/"+url.PathEscape(key))
+	if seconds := kvExpiration(expiration); seconds != 0 {
+		path += "?expiration=" + strconv.FormatInt(seconds, 10)
+	}
+	req, err := c.newRequest(ctx, "kv.put", http.MethodPut, path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	_, err = c.doJSON(req, nil)
+	return err
+}
+
+// kvExpiration is the expiration KV is given for an entry expiring at t, in
+// seconds since the epoch and no sooner than kvMinExpiration from now; 0,
+// never, when t is zero.
+func kvExpiration(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	if earliest := time.Now().Add(kvMinExpiration); t.Before(earliest) {
+		t = earliest
+	}
+	return t.Unix()
+}
+
+// kvBulkPut writes entries, at most kvBulkLimit, and returns the keys KV
+// did not write.
+func (c *APIClient) kvBulkPut(ctx context.Context, namespaceID string, entries []kvBulkEntry) ([]string, error) {
+	return c.kvBulkCall(ctx, "kv.bulk_put", http.MethodPut, namespaceID, entries)
+}
+
+// kvBulkDelete removes keys, at most kvBulkLimit, and returns those KV did
+// not remove; missing keys are not an error.
+func (c *APIClient) kvBulkDelete(ctx context.Context, namespaceID string, keys []string) ([]string, error) {
+	return c.kvBulkCall(ctx, "kv.bulk_delete", http.MethodDelete, namespaceID, keys)
+}
+
+func (c *APIClient) kvBulkCall(ctx context.Context, operation, method, namespaceID string, payload any) ([]string, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, operation, method, c.kvPath(namespaceID, "/bulk"), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var result struct {
+		UnsuccessfulKeys []string `json:"unsuccessful_keys"`
+	}
+	if _, err := c.doJSON(req, &result); err != nil {
+		return nil, err
+	}
+	return result.UnsuccessfulKeys, nil
+}
+
+// kvGet reads the value under key; ErrRouteNotFound when there is none.
+func (c *APIClient) kvGet(ctx context.Context, namespaceID, key string) (string, error) {
+	req, err := c.newRequest(ctx, "kv.get", http.MethodGet, c.kvPath(namespaceID, "/values/"+url.PathEscape(key)), nil)
+	if err != nil {
+		return "", err
+	}
+	value, err := c.do(req)
+	if errors.Is(err, ErrNotFound) {
+		return "", ErrRouteNotFound
+	}
+	return string(value), err
+}
+
+// kvGetMetadata decodes the metadata of key into metadata; an ErrNotFound
+// when there is no key.
+func (c *APIClient) kvGetMetadata(ctx context.Context, namespaceID, key string, metadata any) error {
+	req, err := c.newRequest(ctx, "kv.metadata", http.MethodGet, c.kvPath(namespaceID, "/metadata/"+url.PathEscape(key)), nil)
+	if err != nil {
+		return err
+	}
+	_, err = c.doJSON(req, metadata)
+	return err
+}
+
+// kvDelete removes key; a missing key is not an error.
+func (c *APIClient) kvDelete(ctx context.Context, namespaceID, key string) error {
+	req, err := c.newRequest(ctx, "kv.delete", http.MethodDelete, c.kvPath(namespaceID, "/values/"+url.PathEscape(key)), nil)
+	if err != nil {
+		return err
+	}
+	if _, err := c.doJSON(req, nil); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// kvList lists every key starting with prefix, following the cursor across
+// pages.
+func (c *APIClient) kvList(ctx context.Context, namespaceID, prefix string) ([]kvKey, error) {
+	var keys []kvKey
+	opts := ListOptions{}
+	for {
+		page, next, err := c.kvListPage(ctx, namespaceID, prefix, opts)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, page...)
+		if next == "" {
+			return keys, nil
+		}
+		opts.Cursor = next
+	}
+}
+
+// kvListPage lists a page of the keys starting with prefix and returns the
+// cursor of the next one, empty on the last.
+func (c *APIClient) kvListPage(ctx context.Context, namespaceID, prefix string, opts ListOptions) ([]kvKey, string, error) {
+	limit := opts.Limit
+	switch {
+	case limit <= 0 || limit > kvListLimit:
+		limit = kvListLimit
+	case limit < kvListMinLimit:
+		limit = kvListMinLimit
+	}
+	query := url.Values{"limit": {strconv.Itoa(limit)}}
+	if prefix != "" {
+		query.Set("prefix", prefix)
+	}
+	if opts.Cursor != "" {
+		query.Set("cursor", opts.Cursor)
+	}
+	req, err := c.newRequest(ctx, "kv.list", http.MethodGet, c.kvPath(namespaceID, "/keys?"+query.Encode()), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	var keys []kvKey
+	resp, err := c.doJSON(req, &keys)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.ResultInfo == nil || len(keys) == 0 {
+		return keys, "", nil
+	}
+	return keys, resp.ResultInfo.Cursor, nil
+}
@@ -0,0 +1,370 @@
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ProviderLoadBalancer identifies routes stored as origins of a Cloudflare
+// Load Balancer pool.
+const ProviderLoadBalancer = "LoadBalancer"
+
+// originNamePrefix starts the name of every session origin.
+const originNamePrefix = "session-"
+
+// LoadBalancerClient is a Client routing each session through an origin of
+// its own in a Cloudflare Load Balancer pool, named after the session. The
+// load balancer in front of the pool steers a session's requests to its
+// origin, e.g. by the Host header the origin is given. Sessions are
+// validated as by the embedded APIClient.
+type LoadBalancerClient struct {
+	*APIClient
+	// PoolID is the pool session origins are added to.
+	PoolID string
+	// MonitorID, when set, is the health check monitor attached to the
+	// pool, so unhealthy session origins are taken out of rotation.
+	MonitorID string
+	// OriginWeight is the weight of session origins whose Route has none,
+	// from 0 to 1; zero uses 1.
+	OriginWeight float64
+
+	// mu serializes the read-modify-write cycles on the pool's origins.
+	mu sync.Mutex
+}
+
+// NewLoadBalancerClient returns a LoadBalancerClient managing the origins of
+// poolID with the credentials of api.
+func NewLoadBalancerClient(api *APIClient, poolID string) *LoadBalancerClient {
+	return &LoadBalancerClient{APIClient: api, PoolID: poolID}
+}
+
+// originName is the name of a session's origin in the pool.
+func originName(sessionID string) string {
+	return originNamePrefix + sessionID
+}
+
+func (c *LoadBalancerClient) poolPath() string {
+	return "/accounts/" + url.PathEscape(c.AccountID) + "/load_balancers/pools/" + url.PathEscape(c.PoolID)
+}
+
+func (c *LoadBalancerClient) routeID(name string) string {
+	return c.PoolID + "/" + name
+}
+
+// originOf returns the origin name of routeID, or of the session when
+// routeID is empty. Routes of another pool are not this client's.
+func (c *LoadBalancerClient) originOf(sessionID, routeID string) (string, error) {
+	if routeID == "" {
+		return originName(sessionID), nil
+	}
+	pool, name, ok := strings.Cut(routeID, "/")
+	if !ok || pool != c.PoolID {
+		return "", fmt.Errorf("cloudflare: route %s is not in load balancer pool %s", routeID, c.PoolID)
+	}
+	return name, nil
+}
+
+// pool is the part of a Load Balancer pool the client reads and writes.
+// Origins are kept as decoded, so fields the client does not know survive
+// its updates.
+type pool struct {
+	Origins []map[string]any `json:"origins"`
+	Monitor string           `json:"monitor,omitempty"`
+}
+
+func (c *LoadBalancerClient) getPool(ctx context.Context) (*pool, error) {
+	req, err := c.newRequest(ctx, "pool.get", http.MethodGet, c.poolPath(), nil)
+	if err != nil {
+		return nil, err
+	}
+	p := &pool{}
+	if _, err := c.doJSON(req, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (c *LoadBalancerClient) patchPool(ctx context.Context, fields map[string]any) error {
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequest(ctx, "pool.update", http.MethodPatch, c.poolPath(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	_, err = c.doJSON(req, nil)
+	return err
+}
+
+func findOrigin(origins []map[string]any, name string) int {
+	for i, o := range origins {
+		if o["name"] == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// EnsureRoute adds or updates the session's origin, pointing it at the
+// route's endpoint with its weight and the session's hostname as Host
+// header.
+func (c *LoadBalancerClient) EnsureRoute(ctx context.Context, sessionID string, route Route, opts RouteOptions) (RouteRecord, error) {
+	if err := validateRoute(sessionID, route, ""); err != nil {
+		return RouteRecord{}, err
+	}
+	name := originName(sessionID)
+	record := RouteRecord{ID: c.routeID(name), Provider: ProviderLoadBalancer}
+	if !c.hasCredentials() {
+		return record, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, err := c.getPool(ctx)
+	if err != nil {
+		return RouteRecord{}, err
+	}
+	setOrigin(p, c.newOrigin(name, route, opts))
+	if err := c.patchPool(ctx, c.originFields(p)); err != nil {
+		return RouteRecord{}, err
+	}
+	return record, nil
+}
+
+// BatchEnsureRoutes adds or updates the origins of every route in a single
+// update of the pool.
+func (c *LoadBalancerClient) BatchEnsureRoutes(ctx context.Context, routes []RouteWrite) ([]RouteRecord, error) {
+	records := make([]RouteRecord, len(routes))
+	errs := RouteErrors{}
+	var indices []int
+	for i, w := range routes {
+		if err := validateRoute(w.SessionID, w.Route, ""); err != nil {
+			errs[i] = err
+			continue
+		}
+		records[i] = RouteRecord{ID: c.routeID(originName(w.SessionID)), Provider: ProviderLoadBalancer}
+		indices = append(indices, i)
+	}
+	if len(indices) == 0 || !c.hasCredentials() {
+		return records, errs.orNil()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, err := c.getPool(ctx)
+	if err == nil {
+		for _, i := range indices {
+			setOrigin(p, c.newOrigin(originName(routes[i].SessionID), routes[i].Route, routes[i].Options))
+		}
+		err = c.patchPool(ctx, c.originFields(p))
+	}
+	if err != nil {
+		errs.failAll(indices, err)
+	}
+	return records, errs.orNil()
+}
+
+// newOrigin is the origin name pointing at the route's endpoint, with the
+// session's hostname as Host header.
+func (c *LoadBalancerClient) newOrigin(name string, route Route, opts RouteOptions) map[string]any {
+	weight := route.Weight
+	if weight == 0 {
+		weight = c.weight()
+	}
+	origin := map[string]any{"name": name, "enabled": true, "weight": weight}
+	if host, port, err := net.SplitHostPort(route.Endpoint); err == nil {
+		origin["address"] = host
+		if n, err := strconv.Atoi(port); err == nil {
+			origin["port"] = n
+		}
+	} else {
+		origin["address"] = route.Endpoint
+	}
+	if opts.Hostname != "" {
+		origin["header"] = map[string][]string{"Host": {opts.Hostname}}
+	}
+	return origin
+}
+
+// setOrigin adds origin to p, or updates the origin of the same name.
+func setOrigin(p *pool, origin map[string]any) {
+	if i := findOrigin(p.Origins, origin["name"].(string)); i >= 0 {
+		for k, v := range origin {
+			p.Origins[i][k] = v
+		}
+		return
+	}
+	p.Origins = append(p.Origins, origin)
+}
+
+// originFields are the fields of p to patch after its origins changed,
+// attaching the monitor when it is not yet.
+func (c *LoadBalancerClient) originFields(p *pool) map[string]any {
+	fields := map[string]any{"origins": p.Origins}
+	if c.MonitorID != "" && p.Monitor != c.MonitorID {
+		fields["monitor"] = c.MonitorID
+	}
+	return fields
+}
+
+func (c *LoadBalancerClient) weight() float64 {
+	if c.OriginWeight <= 0 || c.OriginWeight > 1 {
+		return 1
+	}
+	return c.OriginWeight
+}
+
+// DeleteRoute removes the session's origin. Pools must keep an origin, so
+// the last one is disabled instead.
+func (c *LoadBalancerClient) DeleteRoute(ctx context.Context, sessionID, routeID string) error {
+	if routeID == "" && sessionID == "" {
+		return nil
+	}
+	if !c.hasCredentials() {
+		return nil
+	}
+	name, err := c.originOf(sessionID, routeID)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, err := c.getPool(ctx)
+	if err != nil {
+		return err
+	}
+	if !removeOrigin(p, name) {
+		return nil
+	}
+	return c.patchPool(ctx, map[string]any{"origins": p.Origins})
+}
+
+// BatchDeleteRoutes removes the origins of every route in a single update
+// of the pool.
+func (c *LoadBalancerClient) BatchDeleteRoutes(ctx context.Context, routes []RouteRecord) error {
+	if !c.hasCredentials() {
+		return nil
+	}
+	errs := RouteErrors{}
+	var indices []int
+	names := make([]string, len(routes))
+	for i, route := range routes {
+		if route.ID == "" && route.SessionID == "" {
+			continue
+		}
+		name, err := c.originOf(route.SessionID, route.ID)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		names[i] = name
+		indices = append(indices, i)
+	}
+	if len(indices) == 0 {
+		return errs.orNil()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, err := c.getPool(ctx)
+	if err == nil {
+		changed := false
+		for _, i := range indices {
+			if removeOrigin(p, names[i]) {
+				changed = true
+			}
+		}
+		if changed {
+			err = c.patchPool(ctx, map[string]any{"origins": p.Origins})
+		}
+	}
+	if err != nil {
+		errs.failAll(indices, err)
+	}
+	return errs.orNil()
+}
+
+// removeOrigin removes the origin name from p and reports whether p
+// changed. Pools must keep an origin, so the last one is disabled instead.
+func removeOrigin(p *pool, name string) bool {
+	i := findOrigin(p.Origins, name)
+	switch {
+	case i < 0:
+		return false
+	case len(p.Origins) == 1:
+		p.Origins[0]["enabled"] = false
+	default:
+		p.Origins = append(p.Origins[:i], p.Origins[i+1:]...)
+	}
+	return true
+}
+
+// GetRoute reads the session's origin back, with its address and port as
+// Endpoint and its weight. A disabled origin routes nothing and is reported
+// missing.
+func (c *LoadBalancerClient) GetRoute(ctx context.Context, sessionID, routeID string) (RouteRecord, error) {
+	if routeID == "" && sessionID == "" {
+		return RouteRecord{}, ErrRouteNotFound
+	}
+	if !c.hasCredentials() {
+		return RouteRecord{}, ErrUnsupported
+	}
+	name, err := c.originOf(sessionID, routeID)
+	if err != nil {
+		return RouteRecord{}, err
+	}
+	p, err := c.getPool(ctx)
+	if err != nil {
+		return RouteRecord{}, err
+	}
+	i := findOrigin(p.Origins, name)
+	if i < 0 || p.Origins[i]["enabled"] == false {
+		return RouteRecord{}, ErrRouteNotFound
+	}
+	endpoint, _ := p.Origins[i]["address"].(string)
+	if port, ok := p.Origins[i]["port"].(float64); ok && port > 0 {
+		endpoint = net.JoinHostPort(endpoint, strconv.Itoa(int(port)))
+	}
+	weight, _ := p.Origins[i]["weight"].(float64)
+	return RouteRecord{ID: c.routeID(name), Provider: ProviderLoadBalancer, Route: Route{Endpoint: endpoint, Weight: weight}}, nil
+}
+
+// ListRoutes returns the session origins of the pool in a single page;
+// kvNamespaceID does not apply.
+func (c *LoadBalancerClient) ListRoutes(ctx context.Context, kvNamespaceID string, opts ListOptions) (RoutePage, error) {
+	if !c.hasCredentials() {
+		return RoutePage{}, ErrUnsupported
+	}
+	if c.PoolID == "" {
+		return RoutePage{}, errors.New("cloudflare: no load balancer pool configured")
+	}
+	p, err := c.getPool(ctx)
+	if err != nil {
+		return RoutePage{}, err
+	}
+	var routes []RouteRecord
+	for _, o := range p.Origins {
+		name, _ := o["name"].(string)
+		if !strings.HasPrefix(name, originNamePrefix) || o["enabled"] == false {
+			continue
+		}
+		routes = append(routes, RouteRecord{
+			ID:        c.routeID(name),
+			Provider:  ProviderLoadBalancer,
+			SessionID: strings.TrimPrefix(name, originNamePrefix),
+		})
+	}
+	return RoutePage{Routes: routes}, nil
+}
@@ -0,0 +1,108 @@
+package cloudflare_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare/fake"
+)
+
+const testPool = "pool"
+
+const poolPath = "/accounts/" + testAccount + "/load_balancers/pools/" + testPool
+
+type testPoolState struct {
+	Origins []map[string]any `json:"origins"`
+	Monitor string           `json:"monitor"`
+}
+
+func poolState(t *testing.T, srv *fake.Server) testPoolState {
+	t.Helper()
+	var p testPoolState
+	apiCall(t, srv, http.MethodGet, poolPath, nil, &p)
+	return p
+}
+
+func TestLoadBalancerEnsureRoute(t *testing.T) {
+	ctx := context.Background()
+	srv := fake.NewServer()
+	apiCall(t, srv, http.MethodPatch, poolPath, map[string]any{"origins": []map[string]any{
+		{"name": "static", "address": "192.0.2.1", "enabled": true, "weight": 1, "virtual_network_id": "vnet"},
+	}}, nil)
+	c := cloudflare.NewLoadBalancerClient(newTestClient(t, srv), testPool)
+	c.MonitorID = "monitor"
+	c.OriginWeight = 0.5
+
+	record, err := c.EnsureRoute(ctx, "s1", cloudflare.Route{Endpoint: "10.0.0.1:8080"}, cloudflare.RouteOptions{Hostname: "s1.example.com"})
+	if err != nil {
+		t.Fatalf("EnsureRoute: %v", err)
+	}
+	if record.ID != testPool+"/session-s1" || record.Provider != cloudflare.ProviderLoadBalancer {
+		t.Fatalf("EnsureRoute = %+v", record)
+	}
+	if _, err := c.EnsureRoute(ctx, "s2", cloudflare.Route{Endpoint: "10.0.0.2", Weight: 0.2}, cloudflare.RouteOptions{}); err != nil {
+		t.Fatalf("EnsureRoute: %v", err)
+	}
+
+	p := poolState(t, srv)
+	want := []map[string]any{
+		{"name": "static", "address": "192.0.2.1", "enabled": true, "weight": 1.0, "virtual_network_id": "vnet"},
+		{"name": "session-s1", "address": "10.0.0.1", "port": 8080.0, "enabled": true, "weight": 0.5, "header": map[string]any{"Host": []any{"s1.example.com"}}},
+		{"name": "session-s2", "address": "10.0.0.2", "enabled": true, "weight": 0.2},
+	}
+	if !reflect.DeepEqual(p.Origins, want) {
+		t.Fatalf("origins = %v\nwant %v", p.Origins, want)
+	}
+	if p.Monitor != "monitor" {
+		t.Fatalf("monitor = %q, want it attached", p.Monitor)
+	}
+
+	got, err := c.GetRoute(ctx, "s1", "")
+	if err != nil || got.Route.Endpoint != "10.0.0.1:8080" || got.Route.Weight != 0.5 {
+		t.Fatalf("GetRoute = %+v, %v", got, err)
+	}
+	page, err := c.ListRoutes(ctx, "", cloudflare.ListOptions{})
+	if err != nil || len(page.Routes) != 2 || page.Routes[0].SessionID != "s1" || page.Routes[1].SessionID != "s2" {
+		t.Fatalf("ListRoutes = %+v, %v, want the two session origins", page, err)
+	}
+}
+
+func TestLoadBalancerDisablesLastOrigin(t *testing.T) {
+	ctx := context.Background()
+	srv := fake.NewServer()
+	c := cloudflare.NewLoadBalancerClient(newTestClient(t, srv), testPool)
+	for _, id := range []string{"s1", "s2"} {
+		if _, err := c.EnsureRoute(ctx, id, cloudflare.Route{Endpoint: "10.0.0.1:80"}, cloudflare.RouteOptions{}); err != nil {
+			t.Fatalf("EnsureRoute: %v", err)
+		}
+	}
+
+	if err := c.DeleteRoute(ctx, "", testPool+"/session-s1"); err != nil {
+		t.Fatalf("DeleteRoute: %v", err)
+	}
+	if err := c.DeleteRoute(ctx, "s2", ""); err != nil {
+		t.Fatalf("DeleteRoute: %v", err)
+	}
+	origins := poolState(t, srv).Origins
+	if len(origins) != 1 || origins[0]["name"] != "session-s2" || origins[0]["enabled"] != false {
+		t.Fatalf("origins = %v, want session-s2 kept disabled", origins)
+	}
+	if _, err := c.GetRoute(ctx, "s2", ""); !errors.Is(err, cloudflare.ErrRouteNotFound) {
+		t.Fatalf("GetRoute of a disabled origin: %v, want ErrRouteNotFound", err)
+	}
+	if page, err := c.ListRoutes(ctx, "", cloudflare.ListOptions{}); err != nil || len(page.Routes) != 0 {
+		t.Fatalf("ListRoutes = %+v, %v, want none", page, err)
+	}
+
+	// Routing the session again enables its origin.
+	if _, err := c.EnsureRoute(ctx, "s2", cloudflare.Route{Endpoint: "10.0.0.2:80"}, cloudflare.RouteOptions{}); err != nil {
+		t.Fatalf("EnsureRoute: %v", err)
+	}
+	if got, err := c.GetRoute(ctx, "s2", ""); err != nil || got.Route.Endpoint != "10.0.0.2:80" {
+		t.Fatalf("GetRoute = %+v, %v", got, err)
+	}
+}
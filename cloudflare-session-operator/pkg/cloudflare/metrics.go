@@ -0,0 +1,73 @@
+package cloudflare
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// requestDuration observes every attempt at an API call, by operation
+	// and response status code, "error" when there was no response.
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cloudflare_api_request_duration_seconds",
+		Help:    "Duration of Cloudflare API requests by operation and status code.",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"operation", "code"})
+
+	// rateLimitRemaining and rateLimitReset are the account's rate limit
+	// as last reported by Cloudflare's response headers.
+	rateLimitRemaining = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cloudflare_api_rate_limit_remaining",
+		Help: "Cloudflare API requests left in the current rate limit window, as last reported by Cloudflare.",
+	})
+	rateLimitReset = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cloudflare_api_rate_limit_reset_seconds",
+		Help: "Seconds until the Cloudflare API rate limit window resets, as last reported by Cloudflare.",
+	})
+
+	// sessionCacheLookups counts EnsureSession calls answered by the
+	// session cache (hit, negative_hit) or not (miss).
+	sessionCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloudflare_session_cache_lookups_total",
+		Help: "Number of session lookups by session cache result (hit, negative_hit, miss).",
+	}, []string{"result"})
+
+	// rateLimitWait observes how long Cloudflare API requests wait for the
+	// client-side rate limiter.
+	rateLimitWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "cloudflare_api_rate_limit_wait_seconds",
+		Help:    "Time Cloudflare API requests waited for the client-side rate limiter.",
+		Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60},
+	})
+
+	// tokenValid is whether Cloudflare accepted the credentials at their
+	// last verification.
+	tokenValid = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cloudflare_api_token_valid",
+		Help: "Whether Cloudflare accepted the operator's API credentials when they were last verified (1) or rejected them (0).",
+	})
+
+	// tokenReloads counts the reloads of a TokenFile that found a new
+	// token, or failed.
+	tokenReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloudflare_api_token_reloads_total",
+		Help: "Number of reloads of the Cloudflare API token file by result: success when a rotated token was loaded, error when the file could not be read.",
+	}, []string{"result"})
+
+	// breakerState is the BreakerState of the circuit breaker.
+	breakerState = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cloudflare_api_circuit_breaker_state",
+		Help: "State of the Cloudflare API circuit breaker: 0 closed, 1 half-open, 2 open.",
+	})
+
+	// breakerRejections counts the calls failed by the open circuit
+	// breaker without reaching Cloudflare.
+	breakerRejections = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cloudflare_api_circuit_breaker_rejections_total",
+		Help: "Number of Cloudflare API calls rejected by the open circuit breaker.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(requestDuration, rateLimitRemaining, rateLimitReset, sessionCacheLookups, rateLimitWait, tokenValid, tokenReloads, breakerState, breakerRejections)
+}
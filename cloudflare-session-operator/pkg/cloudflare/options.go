@@ -0,0 +1,56 @@
+package cloudflare
+
+import (
+	"context"
+	"time"
+)
+
+// CallOption adjusts the API calls made with a context; see
+// WithCallOptions.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	timeout time.Duration
+	retry   *RetryPolicy
+}
+
+type callOptionsKey struct{}
+
+// WithCallOptions returns ctx with opts applied to the calls of APIClient
+// and the clients embedding it made with it, on top of the options ctx
+// already has:
+//
+//	ctx := cloudflare.WithCallOptions(ctx, cloudflare.WithTimeout(2*time.Second))
+//	route, err := cf.GetRoute(ctx, sessionID, routeID)
+//
+// Calls stop as soon as ctx is done, retries and rate limiter waits
+// included.
+func WithCallOptions(ctx context.Context, opts ...CallOption) context.Context {
+	o := callOptionsOf(ctx)
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return context.WithValue(ctx, callOptionsKey{}, o)
+}
+
+// WithTimeout bounds every attempt at a call to d instead of the client's
+// timeout of its operation. A deadline on the whole call, retries
+// included, is one of its context.
+func WithTimeout(d time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.timeout = d
+	}
+}
+
+// WithRetryPolicy retries calls as p says instead of as the client's
+// Retry does; a zero RetryPolicy disables retries.
+func WithRetryPolicy(p RetryPolicy) CallOption {
+	return func(o *callOptions) {
+		o.retry = &p
+	}
+}
+
+func callOptionsOf(ctx context.Context) callOptions {
+	o, _ := ctx.Value(callOptionsKey{}).(callOptions)
+	return o
+}
@@ -0,0 +1,94 @@
+package cloudflare
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Cloudflare's global API rate limit: DefaultRateLimitRequests requests per
+// user every DefaultRateLimitWindow.
+const (
+	DefaultRateLimitRequests = 1200
+	DefaultRateLimitWindow   = 5 * time.Minute
+	// DefaultRateLimitBurst is the burst of limiters made with
+	// DefaultRateLimitRequests.
+	DefaultRateLimitBurst = 20
+)
+
+// RateLimiter is a token bucket shared by the clients of an account, so
+// that all of the operator's workers together stay under the account's API
+// rate limit instead of running into 429s.
+type RateLimiter struct {
+	limiter *rate.Limiter
+}
+
+// NewRateLimiter returns a RateLimiter letting at most requests calls
+// through in any window, burst of them at once. The bucket refills at
+// (requests-burst)/window, so that a full bucket spent at the start of a
+// window still leaves the window within the limit.
+func NewRateLimiter(requests int, window time.Duration, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	refill := requests - burst
+	if refill < 1 {
+		refill = 1
+	}
+	return &RateLimiter{limiter: rate.NewLimiter(rate.Limit(float64(refill)/window.Seconds()), burst)}
+}
+
+// Wait blocks until a request may be made, or fails when ctx is done first
+// or its deadline is too close to wait for one.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	start := time.Now()
+	err := l.limiter.Wait(ctx)
+	rateLimitWait.Observe(time.Since(start).Seconds())
+	return err
+}
+
+// observeRateLimitHeaders exposes what is left of the account's rate limit,
+// as told by a response's headers: Ratelimit, e.g. "default";r=50;t=30, or
+// the older Ratelimit-Remaining and Ratelimit-Reset, possibly X- prefixed.
+func observeRateLimitHeaders(h http.Header) {
+	remaining, reset := -1, -1
+	if v := h.Get("Ratelimit"); v != "" {
+		item, _, _ := strings.Cut(v, ",")
+		for _, param := range strings.Split(item, ";")[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			switch key {
+			case "r":
+				remaining = atoiOr(value, -1)
+			case "t":
+				reset = atoiOr(value, -1)
+			}
+		}
+	} else {
+		for _, prefix := range []string{"", "X-"} {
+			if remaining < 0 {
+				remaining = atoiOr(h.Get(prefix+"Ratelimit-Remaining"), -1)
+			}
+			if reset < 0 {
+				reset = atoiOr(h.Get(prefix+"Ratelimit-Reset"), -1)
+			}
+		}
+	}
+	if remaining >= 0 {
+		rateLimitRemaining.Set(float64(remaining))
+	}
+	if reset >= 0 {
+		rateLimitReset.Set(float64(reset))
+	}
+}
+
+func atoiOr(s string, fallback int) int {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return fallback
+	}
+	return n
+}
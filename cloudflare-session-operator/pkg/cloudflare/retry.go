@@ -0,0 +1,145 @@
+package cloudflare
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how APIClient retries idempotent calls that failed
+// with 429, a 5xx status or a temporary network error.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts made per call, the first
+	// included; below 2 disables retries.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled before each
+	// further one up to MaxDelay. Delays are jittered down to half their
+	// value so clients failing together do not retry together.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy is the RetryPolicy of clients made by NewClient.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 4, BaseDelay: 500 * time.Millisecond, MaxDelay: 30 * time.Second}
+
+// backoff is the jittered delay before the retry following attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// idempotent reports whether a request with method can be sent again
+// without changing its outcome.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// retryable reports whether err, returned by send, may succeed when tried
+// again.
+func retryable(err error) bool {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return errors.Is(apiErr, ErrRateLimited) || apiErr.StatusCode >= 500
+	}
+	if errors.Is(err, errAttemptTimeout) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// parseRetryAfter reads a Retry-After header, in seconds or as an HTTP
+// date; ok is false when there is none.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := at.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// retryDelay returns how long to wait before retrying req after attempt
+// failed with err; ok is false when it is not retried: the call is not
+// idempotent, the error is permanent, the attempts are used up or the
+// retry could not be made before the request's deadline. The server's
+// Retry-After takes precedence over the backoff. The policy is c.Retry
+// unless the request's context has another.
+func (c *APIClient) retryDelay(req *http.Request, attempt int, err error) (time.Duration, bool) {
+	policy := c.Retry
+	if p := callOptionsOf(req.Context()).retry; p != nil {
+		policy = *p
+	}
+	if attempt >= policy.MaxAttempts || !idempotent(req.Method) || !retryable(err) {
+		return 0, false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return 0, false
+	}
+	delay := policy.backoff(attempt)
+	if after, ok := RetryAfter(err); ok {
+		delay = after
+	}
+	if deadline, ok := req.Context().Deadline(); ok && time.Now().Add(delay).After(deadline) {
+		return 0, false
+	}
+	return delay, true
+}
+
+// rewind prepares req to be sent again.
+func rewind(req *http.Request) error {
+	if req.GetBody == nil {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+	req.Body = body
+	return nil
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
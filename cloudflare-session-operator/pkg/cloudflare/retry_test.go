@@ -0,0 +1,85 @@
+package cloudflare
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{"0", 0, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+	} {
+		got, ok := parseRetryAfter(tc.value, now)
+		if got != tc.want || ok != tc.wantOK {
+			t.Errorf("parseRetryAfter(%q) = %s, %t want %s, %t", tc.value, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	c := &APIClient{Retry: RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 4 * time.Second}}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	soon, cancelSoon := context.WithTimeout(context.Background(), time.Second)
+	defer cancelSoon()
+
+	for _, tc := range []struct {
+		name     string
+		ctx      context.Context
+		method   string
+		body     bool
+		attempt  int
+		err      error
+		min, max time.Duration
+		wantOK   bool
+	}{
+		{name: "first retry", method: http.MethodGet, attempt: 1, err: errUnavailable, min: 500 * time.Millisecond, max: time.Second, wantOK: true},
+		{name: "doubled", method: http.MethodGet, attempt: 2, err: errUnavailable, min: time.Second, max: 2 * time.Second, wantOK: true},
+		{name: "capped", method: http.MethodDelete, attempt: 4, err: errUnavailable, min: 2 * time.Second, max: 4 * time.Second, wantOK: true},
+		{name: "retry after wins", method: http.MethodGet, attempt: 1, err: &apiError{StatusCode: http.StatusTooManyRequests, retryAfter: 7 * time.Second}, min: 7 * time.Second, max: 7 * time.Second, wantOK: true},
+		{name: "attempts used up", method: http.MethodGet, attempt: 5, err: errUnavailable},
+		{name: "not idempotent", method: http.MethodPost, attempt: 1, err: errUnavailable},
+		{name: "permanent error", method: http.MethodGet, attempt: 1, err: errMissing},
+		{name: "caller gave up", method: http.MethodGet, attempt: 1, err: context.Canceled, ctx: canceled},
+		{name: "body cannot be rewound", method: http.MethodPut, body: true, attempt: 1, err: errUnavailable},
+		{name: "past the deadline", ctx: soon, method: http.MethodGet, attempt: 1, err: &apiError{StatusCode: http.StatusTooManyRequests, retryAfter: time.Minute}},
+		{name: "call disables retries", ctx: WithCallOptions(context.Background(), WithRetryPolicy(RetryPolicy{})), method: http.MethodGet, attempt: 1, err: errUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := tc.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			req, err := http.NewRequestWithContext(ctx, tc.method, "https://api.cloudflare.com/client/v4/x", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.body {
+				// A body without GetBody cannot be sent again.
+				req.Body = io.NopCloser(strings.NewReader("{}"))
+			}
+			got, ok := c.retryDelay(req, tc.attempt, tc.err)
+			if ok != tc.wantOK {
+				t.Fatalf("retried = %t want %t", ok, tc.wantOK)
+			}
+			if ok && (got < tc.min || got > tc.max) {
+				t.Fatalf("delay = %s want within [%s, %s]", got, tc.min, tc.max)
+			}
+		})
+	}
+}
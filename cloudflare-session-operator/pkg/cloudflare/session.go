@@ -0,0 +1,145 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// sessionResponse is the body of a successful SessionValidationURL lookup.
+// Both fields are optional: a session is active unless Active is false.
+type sessionResponse struct {
+	Active    *bool      `json:"active"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// EnsureSession looks the session up at SessionValidationURL or in
+// SessionKVNamespaceID, through Sessions if set. Without either, or without
+// credentials for the latter, the session is taken to exist.
+func (c *APIClient) EnsureSession(ctx context.Context, sessionID string) (Session, error) {
+	if sessionID == "" {
+		return Session{}, fmt.Errorf("sessionID is empty")
+	}
+	var lookup func(context.Context, string) (Session, error)
+	switch {
+	case c.SessionValidationURL != "":
+		lookup = c.validateSession
+	case c.SessionKVNamespaceID != "" && c.hasCredentials():
+		lookup = c.lookupSession
+	default:
+		return Session{Exists: true}, nil
+	}
+	if c.Sessions == nil {
+		return lookup(ctx, sessionID)
+	}
+	if session, ok := c.Sessions.get(sessionID); ok {
+		return session, nil
+	}
+	session, err := lookup(ctx, sessionID)
+	if err != nil {
+		return Session{}, err
+	}
+	c.Sessions.put(sessionID, session)
+	return session, nil
+}
+
+// validateSession asks the auth service about the session: 404 and 410 mean
+// it does not exist, any other failure is an error.
+func (c *APIClient) validateSession(ctx context.Context, sessionID string) (Session, error) {
+	target := c.SessionValidationURL
+	if strings.Contains(target, sessionIDPlaceholder) {
+		target = strings.ReplaceAll(target, sessionIDPlaceholder, url.PathEscape(sessionID))
+	} else {
+		u, err := url.Parse(target)
+		if err != nil {
+			return Session{}, fmt.Errorf("session validation URL: %w", err)
+		}
+		query := u.Query()
+		query.Set("sessionID", sessionID)
+		u.RawQuery = query.Encode()
+		target = u.String()
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout(ctx, "session.validate"))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return Session{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return Session{}, fmt.Errorf("session validation: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return Session{}, nil
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return Session{}, fmt.Errorf("session validation returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return Session{}, fmt.Errorf("session validation: %w", err)
+	}
+	var result sessionResponse
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := json.Unmarshal(body, &result); err != nil {
+			return Session{}, fmt.Errorf("session validation: decoding response: %w", err)
+		}
+	}
+	if result.Active != nil && !*result.Active {
+		return Session{}, nil
+	}
+	session := Session{Exists: true}
+	if result.ExpiresAt != nil {
+		session.ExpiresAt = *result.ExpiresAt
+	}
+	return session, nil
+}
+
+// lookupSession finds the session's key in SessionKVNamespaceID, whose
+// expiration, if any, is the session's.
+func (c *APIClient) lookupSession(ctx context.Context, sessionID string) (Session, error) {
+	keys, err := c.kvList(ctx, c.SessionKVNamespaceID, sessionID)
+	if err != nil {
+		return Session{}, err
+	}
+	for _, k := range keys {
+		if k.Name != sessionID {
+			continue
+		}
+		session := Session{Exists: true}
+		if k.Expiration > 0 {
+			session.ExpiresAt = time.Unix(k.Expiration, 0)
+		}
+		return session, nil
+	}
+	return Session{}, nil
+}
+
+// ListSessions lists the keys of SessionKVNamespaceID; sessions validated
+// at SessionValidationURL cannot be listed.
+func (c *APIClient) ListSessions(ctx context.Context, opts ListOptions) (SessionPage, error) {
+	if c.SessionValidationURL != "" || c.SessionKVNamespaceID == "" || !c.hasCredentials() {
+		return SessionPage{}, ErrUnsupported
+	}
+	keys, next, err := c.kvListPage(ctx, c.SessionKVNamespaceID, "", opts)
+	if err != nil {
+		return SessionPage{}, err
+	}
+	page := SessionPage{Sessions: make([]Session, 0, len(keys)), NextCursor: next}
+	for _, k := range keys {
+		session := Session{ID: k.Name, Exists: true}
+		if k.Expiration > 0 {
+			session.ExpiresAt = time.Unix(k.Expiration, 0)
+		}
+		page.Sessions = append(page.Sessions, session)
+	}
+	return page, nil
+}
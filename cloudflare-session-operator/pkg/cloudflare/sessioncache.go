@@ -0,0 +1,105 @@
+package cloudflare
+
+import (
+	"sync"
+	"time"
+)
+
+// Defaults of NewSessionCache's arguments.
+const (
+	DefaultSessionCacheTTL         = 30 * time.Second
+	DefaultSessionCacheNegativeTTL = 10 * time.Second
+)
+
+// minSessionCacheSweep is the size below which the cache is not swept of
+// expired entries.
+const minSessionCacheSweep = 1024
+
+// SessionCache remembers EnsureSession results for a short while, so
+// bindings reconciled together, e.g. at every resync, do not look the same
+// sessions up again and again. Sessions found not to exist are remembered
+// too, for their own, usually shorter, TTL. Session events make Invalidate
+// drop an entry as soon as the session changes. Failed lookups are not
+// cached.
+type SessionCache struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	// now is time.Now, replaced in tests.
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]sessionCacheEntry
+	sweepAt int
+}
+
+type sessionCacheEntry struct {
+	session Session
+	until   time.Time
+}
+
+// NewSessionCache returns a SessionCache keeping existing sessions for ttl
+// and missing ones for negativeTTL; 0 does not cache them.
+func NewSessionCache(ttl, negativeTTL time.Duration) *SessionCache {
+	return &SessionCache{
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		entries:     map[string]sessionCacheEntry{},
+		sweepAt:     minSessionCacheSweep,
+		now:         time.Now,
+	}
+}
+
+// get returns the cached lookup of sessionID, if still fresh.
+func (c *SessionCache) get(sessionID string) (Session, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[sessionID]
+	if !ok || !c.now().Before(entry.until) {
+		sessionCacheLookups.WithLabelValues("miss").Inc()
+		return Session{}, false
+	}
+	if entry.session.Exists {
+		sessionCacheLookups.WithLabelValues("hit").Inc()
+	} else {
+		sessionCacheLookups.WithLabelValues("negative_hit").Inc()
+	}
+	return entry.session, true
+}
+
+// put caches the lookup of sessionID. An existing session is not cached
+// past its end.
+func (c *SessionCache) put(sessionID string, session Session) {
+	now := c.now()
+	until := now.Add(c.negativeTTL)
+	if session.Exists {
+		until = now.Add(c.ttl)
+		if !session.ExpiresAt.IsZero() && session.ExpiresAt.Before(until) {
+			until = session.ExpiresAt
+		}
+	}
+	if !now.Before(until) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[sessionID] = sessionCacheEntry{session: session, until: until}
+	if len(c.entries) >= c.sweepAt {
+		for id, entry := range c.entries {
+			if !now.Before(entry.until) {
+				delete(c.entries, id)
+			}
+		}
+		c.sweepAt = 2 * len(c.entries)
+		if c.sweepAt < minSessionCacheSweep {
+			c.sweepAt = minSessionCacheSweep
+		}
+	}
+}
+
+// Invalidate forgets sessionID, so its next EnsureSession asks the session
+// store again.
+func (c *SessionCache) Invalidate(sessionID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, sessionID)
+}
@@ -0,0 +1,90 @@
+package cloudflare
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newTestSessionCache(ttl, negativeTTL time.Duration) (*SessionCache, *testClock) {
+	clock := &testClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	c := NewSessionCache(ttl, negativeTTL)
+	c.now = clock.Now
+	return c, clock
+}
+
+func TestSessionCacheExpiry(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name    string
+		session Session
+		// fresh is how long the entry is served.
+		fresh time.Duration
+	}{
+		{"existing", Session{Exists: true}, 30 * time.Second},
+		{"missing", Session{}, 10 * time.Second},
+		{"ending before the TTL", Session{Exists: true, ExpiresAt: start.Add(5 * time.Second)}, 5 * time.Second},
+		{"ending after the TTL", Session{Exists: true, ExpiresAt: start.Add(time.Hour)}, 30 * time.Second},
+		{"already ended", Session{Exists: true, ExpiresAt: start.Add(-time.Second)}, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, clock := newTestSessionCache(30*time.Second, 10*time.Second)
+			c.put("s1", tc.session)
+			if tc.fresh > 0 {
+				clock.now = start.Add(tc.fresh - time.Nanosecond)
+				if got, ok := c.get("s1"); !ok || got != tc.session {
+					t.Fatalf("get just before expiry = %+v, %t want %+v", got, ok, tc.session)
+				}
+			}
+			clock.now = start.Add(tc.fresh)
+			if _, ok := c.get("s1"); ok {
+				t.Fatalf("entry served after %s", tc.fresh)
+			}
+		})
+	}
+}
+
+func TestSessionCacheDisabledTTLs(t *testing.T) {
+	c, _ := newTestSessionCache(0, 0)
+	c.put("s1", Session{Exists: true})
+	c.put("s2", Session{})
+	if len(c.entries) != 0 {
+		t.Fatalf("cached %d entries with zero TTLs", len(c.entries))
+	}
+}
+
+func TestSessionCacheInvalidate(t *testing.T) {
+	c, _ := newTestSessionCache(time.Minute, time.Minute)
+	c.put("s1", Session{Exists: true})
+	c.Invalidate("s1")
+	if _, ok := c.get("s1"); ok {
+		t.Fatal("invalidated entry still served")
+	}
+}
+
+func TestSessionCacheSweepsExpiredEntries(t *testing.T) {
+	c, clock := newTestSessionCache(time.Minute, 10*time.Second)
+	for i := 0; i < minSessionCacheSweep-1; i++ {
+		c.put(fmt.Sprintf("missing-%d", i), Session{})
+	}
+	c.put("live", Session{Exists: true})
+	// Nothing had expired, so the sweep kept every entry and waits for
+	// twice as many.
+	if len(c.entries) != minSessionCacheSweep || c.sweepAt != 2*minSessionCacheSweep {
+		t.Fatalf("entries = %d sweepAt = %d after sweeping live entries", len(c.entries), c.sweepAt)
+	}
+
+	clock.now = clock.now.Add(10 * time.Second)
+	for i := 0; i < minSessionCacheSweep; i++ {
+		c.put(fmt.Sprintf("new-%d", i), Session{Exists: true})
+	}
+	if want := minSessionCacheSweep + 1; len(c.entries) != want {
+		t.Fatalf("entries after sweep = %d want %d, the expired ones dropped", len(c.entries), want)
+	}
+	if _, ok := c.entries["live"]; !ok {
+		t.Fatal("live entry dropped by the sweep")
+	}
+	if c.sweepAt != 2*(minSessionCacheSweep+1) {
+		t.Fatalf("sweepAt = %d want %d", c.sweepAt, 2*(minSessionCacheSweep+1))
+	}
+}
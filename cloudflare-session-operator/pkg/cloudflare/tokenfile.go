@@ -0,0 +1,90 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTokenReloadInterval is how often a started TokenFile is read
+// again by default.
+const DefaultTokenReloadInterval = 30 * time.Second
+
+// TokenFile is an API token kept in a file, typically a key of a mounted
+// Secret, which the kubelet updates in place when the Secret changes. Once
+// started it reads the file again every Interval, so a rotated token is
+// used from the next call on, without restarting the operator. A file that
+// cannot be read or is empty keeps the last token.
+type TokenFile struct {
+	Path     string
+	Interval time.Duration
+
+	mu    sync.RWMutex
+	token string
+}
+
+// NewTokenFile reads the token in path.
+func NewTokenFile(path string) (*TokenFile, error) {
+	f := &TokenFile{Path: path, Interval: DefaultTokenReloadInterval}
+	if _, err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Token returns the token last read.
+func (f *TokenFile) Token() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.token
+}
+
+// Start implements manager.Runnable.
+func (f *TokenFile) Start(ctx context.Context) error {
+	ticker := time.NewTicker(f.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+		changed, err := f.reload()
+		switch {
+		case err != nil:
+			log.Error(err, "failed to reload the Cloudflare API token; keeping the current one", "path", f.Path)
+			tokenReloads.WithLabelValues("error").Inc()
+		case changed:
+			log.Info("reloaded the rotated Cloudflare API token", "path", f.Path)
+			tokenReloads.WithLabelValues("success").Inc()
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: every
+// replica calls Cloudflare.
+func (f *TokenFile) NeedLeaderElection() bool {
+	return false
+}
+
+// reload reads the file and reports whether its token changed.
+func (f *TokenFile) reload() (bool, error) {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return false, err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return false, fmt.Errorf("API token file %s is empty", f.Path)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if token == f.token {
+		return false, nil
+	}
+	f.token = token
+	return true, nil
+}
@@ -0,0 +1,99 @@
+package cloudflare
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds every attempt at an API call by default.
+const DefaultTimeout = 10 * time.Second
+
+// Operations are the names of the calls the client makes, as labelled in
+// metrics and traces and as keyed in APIClient.Timeouts.
+var Operations = []string{
+	"dns.create", "dns.delete", "dns.list", "dns.update",
+	"kv.bulk_delete", "kv.bulk_put", "kv.delete", "kv.get", "kv.list", "kv.metadata", "kv.put",
+	"pool.get", "pool.update",
+	"session.validate",
+	"token.verify",
+	"tunnel.get", "tunnel.update",
+	"user.get",
+}
+
+// timeout is how long an attempt at operation, made with ctx, may take.
+func (c *APIClient) timeout(ctx context.Context, operation string) time.Duration {
+	if d := callOptionsOf(ctx).timeout; d > 0 {
+		return d
+	}
+	if d := c.Timeouts[operation]; d > 0 {
+		return d
+	}
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return DefaultTimeout
+}
+
+// NewTransport returns a transport with the settings of
+// http.DefaultTransport, which takes its proxy from HTTPS_PROXY and
+// NO_PROXY, trusting the CAs in the PEM file caBundle, when set, on top of
+// the system's; e.g. those of a corporate egress proxy intercepting TLS.
+func NewTransport(caBundle string) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if caBundle == "" {
+		return t, nil
+	}
+	pem, err := os.ReadFile(caBundle)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA bundle %s holds no PEM certificate", caBundle)
+	}
+	t.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	return t, nil
+}
+
+// ParseTimeouts parses per-operation timeouts listed as comma-separated
+// operation=duration pairs, e.g. "kv.list=30s,dns.list=20s"; operations
+// are those of Operations.
+func ParseTimeouts(s string) (map[string]time.Duration, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	timeouts := map[string]time.Duration{}
+	for _, pair := range strings.Split(s, ",") {
+		operation, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("timeout %q is not operation=duration", pair)
+		}
+		if !knownOperation(operation) {
+			return nil, fmt.Errorf("unknown operation %q, want one of %s", operation, strings.Join(Operations, ", "))
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("timeout of %s must be a positive duration, got %q", operation, value)
+		}
+		timeouts[operation] = d
+	}
+	return timeouts, nil
+}
+
+func knownOperation(operation string) bool {
+	for _, o := range Operations {
+		if o == operation {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,481 @@
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ProviderTunnel identifies routes stored as public hostnames of a named
+// Cloudflare Tunnel.
+const ProviderTunnel = "Tunnel"
+
+// tunnelCatchAll is the last ingress rule added to configurations that lack
+// one; cloudflared refuses ingress without a rule matching every request.
+const tunnelCatchAll = "http_status:404"
+
+// sessionIDPlaceholder is replaced with the session ID in hostname
+// templates.
+const sessionIDPlaceholder = "{sessionID}"
+
+// TunnelClient is a Client routing each session through a public hostname
+// of a named Cloudflare Tunnel: an ingress rule of the tunnel's remotely
+// managed configuration sends the session's hostname, and path prefix if
+// any, to its endpoint. The tunnel's cloudflared replicas pick the
+// configuration up from Cloudflare, so they must be able to reach the
+// session endpoints. Sessions are validated as by the embedded APIClient.
+type TunnelClient struct {
+	*APIClient
+	// TunnelID is the tunnel whose ingress rules the client manages.
+	TunnelID string
+	// HostnameTemplate, when set, returns the hostname template of
+	// sessions, in which "{sessionID}" stands for the session ID. It lets
+	// DeleteRoute and GetRoute find a session's rule without its route ID
+	// and ListRoutes tell the session a rule belongs to; rules not matching
+	// it are listed without one.
+	HostnameTemplate func() string
+
+	// mu serializes the read-modify-write cycles on the configuration.
+	mu sync.Mutex
+}
+
+// NewTunnelClient returns a TunnelClient managing the ingress of tunnelID
+// with the credentials of api.
+func NewTunnelClient(api *APIClient, tunnelID string) *TunnelClient {
+	return &TunnelClient{APIClient: api, TunnelID: tunnelID}
+}
+
+// tunnelConfig is the part of a tunnel configuration the client reads and
+// writes. Everything but the ingress rules, and the fields of the rules the
+// client does not set, are kept as decoded so its updates preserve them.
+type tunnelConfig struct {
+	Ingress []map[string]any
+	Rest    map[string]json.RawMessage
+}
+
+func (c *TunnelClient) configPath() string {
+	return "/accounts/" + url.PathEscape(c.AccountID) + "/cfd_tunnel/" + url.PathEscape(c.TunnelID) + "/configurations"
+}
+
+func (c *TunnelClient) getConfig(ctx context.Context) (*tunnelConfig, error) {
+	req, err := c.newRequest(ctx, "tunnel.get", http.MethodGet, c.configPath(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Config map[string]json.RawMessage `json:"config"`
+	}
+	if _, err := c.doJSON(req, &result); err != nil {
+		return nil, err
+	}
+	cfg := &tunnelConfig{Rest: result.Config}
+	if cfg.Rest == nil {
+		cfg.Rest = map[string]json.RawMessage{}
+	}
+	if raw, ok := cfg.Rest["ingress"]; ok {
+		if err := json.Unmarshal(raw, &cfg.Ingress); err != nil {
+			return nil, fmt.Errorf("cloudflare: decoding tunnel %s ingress: %w", c.TunnelID, err)
+		}
+	}
+	return cfg, nil
+}
+
+func (c *TunnelClient) putConfig(ctx context.Context, cfg *tunnelConfig) error {
+	ingress, err := json.Marshal(cfg.Ingress)
+	if err != nil {
+		return err
+	}
+	cfg.Rest["ingress"] = ingress
+	body, err := json.Marshal(map[string]any{"config": cfg.Rest})
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequest(ctx, "tunnel.update", http.MethodPut, c.configPath(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	_, err = c.doJSON(req, nil)
+	return err
+}
+
+// tunnelRulePath is the path regular expression of a rule matching
+// pathPrefix.
+func tunnelRulePath(pathPrefix string) string {
+	if pathPrefix == "" {
+		return ""
+	}
+	return "^" + regexp.QuoteMeta(pathPrefix)
+}
+
+// findRule returns the index of the rule for hostname and path, or -1.
+func findRule(ingress []map[string]any, hostname, path string) int {
+	for i, rule := range ingress {
+		h, _ := rule["hostname"].(string)
+		p, _ := rule["path"].(string)
+		if h == hostname && p == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// isCatchAll reports whether rule matches every request.
+func isCatchAll(rule map[string]any) bool {
+	h, _ := rule["hostname"].(string)
+	p, _ := rule["path"].(string)
+	return h == "" && p == ""
+}
+
+func (c *TunnelClient) routeID(hostname, pathPrefix string) string {
+	return c.TunnelID + "/" + hostname + pathPrefix
+}
+
+// ruleOf returns the hostname and path of the rule routeID names, or of the
+// session's rule when routeID is empty. Routes of another tunnel are not
+// this client's.
+func (c *TunnelClient) ruleOf(sessionID, routeID string) (hostname, path string, err error) {
+	if routeID == "" {
+		hostname = c.hostnameOf(sessionID)
+		if hostname == "" {
+			return "", "", fmt.Errorf("cloudflare: no hostname template to find the tunnel route of session %s", sessionID)
+		}
+		return hostname, "", nil
+	}
+	tunnel, rest, ok := strings.Cut(routeID, "/")
+	if !ok || tunnel != c.TunnelID || rest == "" {
+		return "", "", fmt.Errorf("cloudflare: route %s is not in tunnel %s", routeID, c.TunnelID)
+	}
+	hostname, pathPrefix, _ := strings.Cut(rest, "/")
+	if pathPrefix != "" {
+		pathPrefix = "/" + pathPrefix
+	}
+	return hostname, tunnelRulePath(pathPrefix), nil
+}
+
+// hostnameOf is the session's hostname by HostnameTemplate; empty without
+// a template naming the session.
+func (c *TunnelClient) hostnameOf(sessionID string) string {
+	if c.HostnameTemplate == nil {
+		return ""
+	}
+	template := c.HostnameTemplate()
+	if !strings.Contains(template, sessionIDPlaceholder) {
+		return ""
+	}
+	return strings.ReplaceAll(template, sessionIDPlaceholder, sessionID)
+}
+
+// sessionOf recovers the session ID from a hostname made by
+// HostnameTemplate; empty when it does not match. Session IDs are taken to
+// be a single DNS label.
+func (c *TunnelClient) sessionOf(hostname string) string {
+	if c.HostnameTemplate == nil {
+		return ""
+	}
+	prefix, suffix, ok := strings.Cut(c.HostnameTemplate(), sessionIDPlaceholder)
+	if !ok || strings.Contains(suffix, sessionIDPlaceholder) || len(hostname) <= len(prefix)+len(suffix) ||
+		!strings.HasPrefix(hostname, prefix) || !strings.HasSuffix(hostname, suffix) {
+		return ""
+	}
+	sessionID := hostname[len(prefix) : len(hostname)-len(suffix)]
+	if strings.Contains(sessionID, ".") {
+		return ""
+	}
+	return sessionID
+}
+
+// tunnelRule builds the ingress rule sending hostname and pathPrefix to the
+// route's endpoint, over its protocol. Without one, Full and Strict TLS
+// reach the endpoint over HTTPS, Full without verifying its certificate.
+func tunnelRule(route Route, opts RouteOptions) map[string]any {
+	scheme := route.Protocol
+	switch {
+	case scheme != "":
+	case opts.TLSMode == "Full" || opts.TLSMode == "Strict":
+		scheme = "https"
+	default:
+		scheme = "http"
+	}
+	rule := map[string]any{"hostname": opts.Hostname, "service": scheme + "://" + route.Endpoint}
+	if path := tunnelRulePath(opts.PathPrefix); path != "" {
+		rule["path"] = path
+	}
+	if opts.TLSMode == "Full" {
+		rule["originRequest"] = map[string]any{"noTLSVerify": true}
+	}
+	return rule
+}
+
+// sameRule reports whether existing already is rule; the configuration is
+// not written when nothing changes.
+func sameRule(existing, rule map[string]any) bool {
+	a, errA := json.Marshal(existing)
+	b, errB := json.Marshal(rule)
+	return errA == nil && errB == nil && bytes.Equal(a, b)
+}
+
+// EnsureRoute adds or updates the ingress rule of the session's hostname,
+// ahead of the catch-all rule. Tunnel routes need a hostname.
+func (c *TunnelClient) EnsureRoute(ctx context.Context, sessionID string, route Route, opts RouteOptions) (RouteRecord, error) {
+	if err := validateTunnelRoute(sessionID, route, opts); err != nil {
+		return RouteRecord{}, err
+	}
+	record := RouteRecord{ID: c.routeID(opts.Hostname, opts.PathPrefix), Provider: ProviderTunnel}
+	if !c.hasCredentials() {
+		return record, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cfg, err := c.getConfig(ctx)
+	if err != nil {
+		return RouteRecord{}, err
+	}
+	if !setRule(cfg, route, opts) {
+		return record, nil
+	}
+	if err := c.putConfig(ctx, cfg); err != nil {
+		return RouteRecord{}, err
+	}
+	return record, nil
+}
+
+// BatchEnsureRoutes adds or updates the ingress rules of every route in a
+// single update of the configuration.
+func (c *TunnelClient) BatchEnsureRoutes(ctx context.Context, routes []RouteWrite) ([]RouteRecord, error) {
+	records := make([]RouteRecord, len(routes))
+	errs := RouteErrors{}
+	var indices []int
+	for i, w := range routes {
+		if err := validateTunnelRoute(w.SessionID, w.Route, w.Options); err != nil {
+			errs[i] = err
+			continue
+		}
+		records[i] = RouteRecord{ID: c.routeID(w.Options.Hostname, w.Options.PathPrefix), Provider: ProviderTunnel}
+		indices = append(indices, i)
+	}
+	if len(indices) == 0 || !c.hasCredentials() {
+		return records, errs.orNil()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cfg, err := c.getConfig(ctx)
+	if err == nil {
+		changed := false
+		for _, i := range indices {
+			if setRule(cfg, routes[i].Route, routes[i].Options) {
+				changed = true
+			}
+		}
+		if changed {
+			err = c.putConfig(ctx, cfg)
+		}
+	}
+	if err != nil {
+		errs.failAll(indices, err)
+	}
+	return records, errs.orNil()
+}
+
+func validateTunnelRoute(sessionID string, route Route, opts RouteOptions) error {
+	if err := validateRoute(sessionID, route, opts.PathPrefix); err != nil {
+		return err
+	}
+	if opts.Hostname == "" {
+		return fmt.Errorf("cloudflare: tunnel routes need a hostname")
+	}
+	return nil
+}
+
+// setRule adds the rule sending opts' hostname and path to the route to
+// cfg, or replaces the rule of the same hostname and path, and reports
+// whether cfg changed.
+func setRule(cfg *tunnelConfig, route Route, opts RouteOptions) bool {
+	rule := tunnelRule(route, opts)
+	if i := findRule(cfg.Ingress, opts.Hostname, tunnelRulePath(opts.PathPrefix)); i >= 0 {
+		if sameRule(cfg.Ingress[i], rule) {
+			return false
+		}
+		cfg.Ingress[i] = rule
+		return true
+	}
+	last := len(cfg.Ingress)
+	if last == 0 || !isCatchAll(cfg.Ingress[last-1]) {
+		cfg.Ingress = append(cfg.Ingress, map[string]any{"service": tunnelCatchAll})
+		last = len(cfg.Ingress)
+	}
+	// Rules match in order, so the session's goes before the catch-all.
+	cfg.Ingress = append(cfg.Ingress[:last-1], rule, cfg.Ingress[last-1])
+	return true
+}
+
+// DeleteRoute removes the session's ingress rule; a missing rule is not an
+// error.
+func (c *TunnelClient) DeleteRoute(ctx context.Context, sessionID, routeID string) error {
+	if routeID == "" && sessionID == "" {
+		return nil
+	}
+	if !c.hasCredentials() {
+		return nil
+	}
+	hostname, path, err := c.ruleOf(sessionID, routeID)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cfg, err := c.getConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if !removeRule(cfg, hostname, path) {
+		return nil
+	}
+	return c.putConfig(ctx, cfg)
+}
+
+// BatchDeleteRoutes removes the ingress rules of every route in a single
+// update of the configuration.
+func (c *TunnelClient) BatchDeleteRoutes(ctx context.Context, routes []RouteRecord) error {
+	if !c.hasCredentials() {
+		return nil
+	}
+	type target struct{ hostname, path string }
+	errs := RouteErrors{}
+	var indices []int
+	targets := make([]target, len(routes))
+	for i, route := range routes {
+		if route.ID == "" && route.SessionID == "" {
+			continue
+		}
+		hostname, path, err := c.ruleOf(route.SessionID, route.ID)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		targets[i] = target{hostname, path}
+		indices = append(indices, i)
+	}
+	if len(indices) == 0 {
+		return errs.orNil()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cfg, err := c.getConfig(ctx)
+	if err == nil {
+		changed := false
+		for _, i := range indices {
+			if removeRule(cfg, targets[i].hostname, targets[i].path) {
+				changed = true
+			}
+		}
+		if changed {
+			err = c.putConfig(ctx, cfg)
+		}
+	}
+	if err != nil {
+		errs.failAll(indices, err)
+	}
+	return errs.orNil()
+}
+
+// removeRule removes the rule of hostname and path from cfg and reports
+// whether it had one.
+func removeRule(cfg *tunnelConfig, hostname, path string) bool {
+	i := findRule(cfg.Ingress, hostname, path)
+	if i < 0 {
+		return false
+	}
+	cfg.Ingress = append(cfg.Ingress[:i], cfg.Ingress[i+1:]...)
+	return true
+}
+
+// GetRoute reads the session's ingress rule back, with the host and port
+// of its service as Endpoint and its scheme as Protocol.
+func (c *TunnelClient) GetRoute(ctx context.Context, sessionID, routeID string) (RouteRecord, error) {
+	if routeID == "" && sessionID == "" {
+		return RouteRecord{}, ErrRouteNotFound
+	}
+	if !c.hasCredentials() {
+		return RouteRecord{}, ErrUnsupported
+	}
+	hostname, path, err := c.ruleOf(sessionID, routeID)
+	if err != nil {
+		return RouteRecord{}, err
+	}
+	cfg, err := c.getConfig(ctx)
+	if err != nil {
+		return RouteRecord{}, err
+	}
+	i := findRule(cfg.Ingress, hostname, path)
+	if i < 0 {
+		return RouteRecord{}, ErrRouteNotFound
+	}
+	return c.ruleRecord(cfg.Ingress[i]), nil
+}
+
+// ruleRecord describes rule as a route.
+func (c *TunnelClient) ruleRecord(rule map[string]any) RouteRecord {
+	hostname, _ := rule["hostname"].(string)
+	path, _ := rule["path"].(string)
+	service, _ := rule["service"].(string)
+	route := Route{Endpoint: service}
+	if u, err := url.Parse(service); err == nil && u.Host != "" {
+		route = Route{Endpoint: u.Host, Protocol: u.Scheme}
+	}
+	pathPrefix := strings.TrimPrefix(path, "^")
+	if unquoted, err := unquoteMeta(pathPrefix); err == nil {
+		pathPrefix = unquoted
+	}
+	return RouteRecord{ID: c.routeID(hostname, pathPrefix), Provider: ProviderTunnel, Route: route}
+}
+
+// unquoteMeta undoes regexp.QuoteMeta.
+func unquoteMeta(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			if i++; i == len(s) {
+				return "", errors.New("trailing backslash")
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String(), nil
+}
+
+// ListRoutes returns the ingress rules of the tunnel with a hostname, with
+// the session of those matching HostnameTemplate, in a single page;
+// kvNamespaceID does not apply.
+func (c *TunnelClient) ListRoutes(ctx context.Context, kvNamespaceID string, opts ListOptions) (RoutePage, error) {
+	if !c.hasCredentials() {
+		return RoutePage{}, ErrUnsupported
+	}
+	cfg, err := c.getConfig(ctx)
+	if err != nil {
+		return RoutePage{}, err
+	}
+	var routes []RouteRecord
+	for _, rule := range cfg.Ingress {
+		hostname, _ := rule["hostname"].(string)
+		if hostname == "" {
+			continue
+		}
+		record := c.ruleRecord(rule)
+		record.Route = Route{}
+		record.SessionID = c.sessionOf(hostname)
+		routes = append(routes, record)
+	}
+	return RoutePage{Routes: routes}, nil
+}
@@ -0,0 +1,144 @@
+package cloudflare_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/cloudflare/fake"
+)
+
+const testTunnel = "tunnel"
+
+const tunnelPath = "/accounts/" + testAccount + "/cfd_tunnel/" + testTunnel + "/configurations"
+
+// tunnelConfig returns the configuration of testTunnel.
+func tunnelConfig(t *testing.T, srv *fake.Server) map[string]json.RawMessage {
+	t.Helper()
+	var result struct {
+		Config map[string]json.RawMessage `json:"config"`
+	}
+	apiCall(t, srv, http.MethodGet, tunnelPath, nil, &result)
+	return result.Config
+}
+
+func tunnelIngress(t *testing.T, srv *fake.Server) []map[string]any {
+	t.Helper()
+	var ingress []map[string]any
+	if err := json.Unmarshal(tunnelConfig(t, srv)["ingress"], &ingress); err != nil {
+		t.Fatal(err)
+	}
+	return ingress
+}
+
+func TestTunnelEnsureRoute(t *testing.T) {
+	ctx := context.Background()
+	srv := fake.NewServer()
+	apiCall(t, srv, http.MethodPut, tunnelPath, map[string]any{"config": map[string]any{
+		"ingress":      []map[string]any{{"hostname": "app.example.com", "service": "http://app:80"}, {"service": "http_status:404"}},
+		"warp-routing": map[string]any{"enabled": true},
+	}}, nil)
+	rec := &recorder{next: srv}
+	c := cloudflare.NewTunnelClient(newTestClient(t, rec), testTunnel)
+
+	for _, w := range []cloudflare.RouteWrite{
+		{SessionID: "s1", Route: cloudflare.Route{Endpoint: "10.0.0.1:80"}, Options: cloudflare.RouteOptions{Hostname: "s1.example.com"}},
+		{SessionID: "s2", Route: cloudflare.Route{Endpoint: "10.0.0.2:443"}, Options: cloudflare.RouteOptions{Hostname: "s2.example.com", PathPrefix: "/v1.0", TLSMode: "Full"}},
+		{SessionID: "s3", Route: cloudflare.Route{Endpoint: "10.0.0.3:443"}, Options: cloudflare.RouteOptions{Hostname: "s3.example.com", TLSMode: "Strict"}},
+	} {
+		record, err := c.EnsureRoute(ctx, w.SessionID, w.Route, w.Options)
+		if err != nil {
+			t.Fatalf("EnsureRoute(%s): %v", w.SessionID, err)
+		}
+		if want := testTunnel + "/" + w.Options.Hostname + w.Options.PathPrefix; record.ID != want {
+			t.Fatalf("route ID = %q want %q", record.ID, want)
+		}
+	}
+	want := []map[string]any{
+		{"hostname": "app.example.com", "service": "http://app:80"},
+		{"hostname": "s1.example.com", "service": "http://10.0.0.1:80"},
+		{"hostname": "s2.example.com", "path": `^/v1\.0`, "service": "https://10.0.0.2:443", "originRequest": map[string]any{"noTLSVerify": true}},
+		{"hostname": "s3.example.com", "service": "https://10.0.0.3:443"},
+		{"service": "http_status:404"},
+	}
+	if got := tunnelIngress(t, srv); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ingress = %v\nwant %v", got, want)
+	}
+	if got := string(tunnelConfig(t, srv)["warp-routing"]); got != `{"enabled":true}` {
+		t.Fatalf("warp-routing = %s, want it kept", got)
+	}
+
+	// Writing the same rule again does not update the configuration.
+	puts := rec.count(http.MethodPut, "/configurations")
+	if _, err := c.EnsureRoute(ctx, "s1", cloudflare.Route{Endpoint: "10.0.0.1:80"}, cloudflare.RouteOptions{Hostname: "s1.example.com"}); err != nil {
+		t.Fatalf("EnsureRoute: %v", err)
+	}
+	if n := rec.count(http.MethodPut, "/configurations"); n != puts {
+		t.Fatalf("rewrote an unchanged configuration")
+	}
+
+	got, err := c.GetRoute(ctx, "", testTunnel+"/s2.example.com/v1.0")
+	if err != nil {
+		t.Fatalf("GetRoute: %v", err)
+	}
+	if got.Route.Endpoint != "10.0.0.2:443" || got.Route.Protocol != "https" || got.ID != testTunnel+"/s2.example.com/v1.0" {
+		t.Fatalf("GetRoute = %+v", got)
+	}
+}
+
+func TestTunnelRoutesByHostnameTemplate(t *testing.T) {
+	ctx := context.Background()
+	srv := fake.NewServer()
+	rec := &recorder{next: srv}
+	c := cloudflare.NewTunnelClient(newTestClient(t, rec), testTunnel)
+	c.HostnameTemplate = func() string { return "{sessionID}.sessions.example.com" }
+
+	_, err := cloudflare.EnsureRoutes(ctx, c, []cloudflare.RouteWrite{
+		{SessionID: "s1", Route: cloudflare.Route{Endpoint: "10.0.0.1:80"}, Options: cloudflare.RouteOptions{Hostname: "s1.sessions.example.com"}},
+		{SessionID: "s2", Route: cloudflare.Route{Endpoint: "10.0.0.2:80"}, Options: cloudflare.RouteOptions{Hostname: "s2.sessions.example.com"}},
+		{SessionID: "s3", Route: cloudflare.Route{Endpoint: "10.0.0.3:80"}, Options: cloudflare.RouteOptions{Hostname: "static.example.com"}},
+		{SessionID: "s4", Route: cloudflare.Route{Endpoint: "10.0.0.4:80"}},
+	})
+	var errs cloudflare.RouteErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[3] == nil {
+		t.Fatalf("EnsureRoutes: %v, want the route without a hostname failed", err)
+	}
+	if n := rec.count(http.MethodPut, "/configurations"); n != 1 {
+		t.Fatalf("updated the configuration %d times, want once", n)
+	}
+
+	page, err := c.ListRoutes(ctx, "", cloudflare.ListOptions{})
+	if err != nil {
+		t.Fatalf("ListRoutes: %v", err)
+	}
+	sessions := map[string]string{}
+	for _, r := range page.Routes {
+		sessions[r.ID] = r.SessionID
+	}
+	want := map[string]string{
+		testTunnel + "/s1.sessions.example.com": "s1",
+		testTunnel + "/s2.sessions.example.com": "s2",
+		testTunnel + "/static.example.com":      "",
+	}
+	if !reflect.DeepEqual(sessions, want) {
+		t.Fatalf("ListRoutes sessions = %v want %v", sessions, want)
+	}
+
+	if err := c.DeleteRoute(ctx, "s1", ""); err != nil {
+		t.Fatalf("DeleteRoute: %v", err)
+	}
+	if _, err := c.GetRoute(ctx, "s1", ""); !errors.Is(err, cloudflare.ErrRouteNotFound) {
+		t.Fatalf("GetRoute of a deleted route: %v, want ErrRouteNotFound", err)
+	}
+	if got, err := c.GetRoute(ctx, "s2", ""); err != nil || got.Route.Endpoint != "10.0.0.2:80" {
+		t.Fatalf("GetRoute = %+v, %v", got, err)
+	}
+	ingress := tunnelIngress(t, srv)
+	if last := ingress[len(ingress)-1]; len(ingress) != 3 || last["service"] != "http_status:404" {
+		t.Fatalf("ingress = %v, want two rules and the catch-all", ingress)
+	}
+}
@@ -0,0 +1,177 @@
+package cloudflare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// DefaultTokenVerifyInterval is how often TokenVerifier checks the
+// credentials by default.
+const DefaultTokenVerifyInterval = 5 * time.Minute
+
+// tokenStatusActive is the status of a usable API token.
+const tokenStatusActive = "active"
+
+var log = ctrl.Log.WithName("cloudflare")
+
+// Verify checks the client's credentials with Cloudflare: the API token, or
+// APIKey and Email without one, and every zone token. It fails with an
+// ErrUnauthorized when one is invalid, disabled or expired, and with
+// ErrUnsupported without credentials.
+func (c *APIClient) Verify(ctx context.Context) error {
+	if !c.hasCredentials() {
+		return ErrUnsupported
+	}
+	switch token := c.apiToken(); {
+	case token != "":
+		if err := c.verifyToken(ctx, token); err != nil {
+			return err
+		}
+	case c.APIKey != "" && c.Email != "":
+		// Keys have no verify endpoint; reading their user tells whether
+		// they are accepted.
+		req, err := c.newRequest(ctx, "user.get", http.MethodGet, "/user", nil)
+		if err != nil {
+			return err
+		}
+		if _, err := c.doJSON(req, nil); err != nil {
+			return err
+		}
+	}
+	for zoneID, token := range c.ZoneTokens {
+		if err := c.verifyToken(ctx, token); err != nil {
+			return fmt.Errorf("zone %s: %w", zoneID, err)
+		}
+	}
+	return nil
+}
+
+func (c *APIClient) verifyToken(ctx context.Context, token string) error {
+	req, err := c.newRequest(ctx, "token.verify", http.MethodGet, "/user/tokens/verify", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Del("X-Auth-Key")
+	req.Header.Del("X-Auth-Email")
+	req.Header.Set("Authorization", "Bearer "+token)
+	var result struct {
+		Status string `json:"status"`
+	}
+	if _, err := c.doJSON(req, &result); err != nil {
+		return err
+	}
+	if result.Status != tokenStatusActive {
+		return fmt.Errorf("%w: API token is %s", ErrUnauthorized, result.Status)
+	}
+	return nil
+}
+
+// TokenVerifier verifies Client's credentials when the manager starts and
+// every Interval after, so a revoked or rotated token shows up as a failing
+// readiness check and in the cloudflare_api_token_valid metric instead of
+// as failing routes. The check also fails until the credentials were
+// verified once, and while Cloudflare has not been reached for longer than
+// UnreachableAfter, since no route can be written then either.
+type TokenVerifier struct {
+	Client   *APIClient
+	Interval time.Duration
+	// UnreachableAfter is how long verifications may fail to reach
+	// Cloudflare before the check fails; 0 is DefaultUnreachableIntervals
+	// Intervals, enough for an occasional failure not to flap it.
+	UnreachableAfter time.Duration
+
+	mu          sync.Mutex
+	err         error
+	verified    bool
+	reachedAt   time.Time
+	unreachable error
+}
+
+// DefaultUnreachableIntervals is the TokenVerifier Intervals Cloudflare may
+// go unreached for by default.
+const DefaultUnreachableIntervals = 3
+
+// Start implements manager.Runnable.
+func (v *TokenVerifier) Start(ctx context.Context) error {
+	ticker := time.NewTicker(v.Interval)
+	defer ticker.Stop()
+	for {
+		v.verify(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: every
+// replica reports its readiness.
+func (v *TokenVerifier) NeedLeaderElection() bool {
+	return false
+}
+
+func (v *TokenVerifier) verify(ctx context.Context) {
+	err := v.Client.Verify(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	switch {
+	case errors.Is(err, ErrUnsupported):
+		// Without credentials there is nothing to verify, and no call to
+		// make.
+		v.verified, v.reachedAt, v.unreachable = true, time.Now(), nil
+		return
+	case err != nil && !errors.Is(err, ErrUnauthorized):
+		log.Error(err, "failed to verify the Cloudflare credentials")
+		v.unreachable = err
+		return
+	}
+	v.verified, v.reachedAt, v.unreachable = true, time.Now(), nil
+	if err != nil {
+		if v.err == nil {
+			log.Error(err, "Cloudflare rejected the credentials")
+		}
+		tokenValid.Set(0)
+	} else {
+		if v.err != nil {
+			log.Info("Cloudflare accepts the credentials again")
+		}
+		tokenValid.Set(1)
+	}
+	v.err = err
+}
+
+// Check is a healthz.Checker failing while Cloudflare rejects the
+// credentials, until they were verified once and while Cloudflare has
+// been unreachable for longer than UnreachableAfter.
+func (v *TokenVerifier) Check(_ *http.Request) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	switch {
+	case v.err != nil:
+		return v.err
+	case !v.verified && v.unreachable != nil:
+		return fmt.Errorf("Cloudflare credentials not verified yet: %w", v.unreachable)
+	case !v.verified:
+		return errors.New("Cloudflare credentials not verified yet")
+	case v.unreachable != nil && time.Since(v.reachedAt) > v.unreachableAfter():
+		return fmt.Errorf("Cloudflare unreachable since %s: %w", v.reachedAt.UTC().Format(time.RFC3339), v.unreachable)
+	}
+	return nil
+}
+
+func (v *TokenVerifier) unreachableAfter() time.Duration {
+	if v.UnreachableAfter > 0 {
+		return v.UnreachableAfter
+	}
+	return DefaultUnreachableIntervals * v.Interval
+}
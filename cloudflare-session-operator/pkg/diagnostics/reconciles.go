@@ -0,0 +1,158 @@
+// Package diagnostics exposes the state of the manager's controllers for
+// diagnosing stuck reconciles in production: which requests are being
+// reconciled and for how long, next to the state of every workqueue, in
+// the spirit of OpenCensus zpages.
+package diagnostics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ReconcilesPath is where ReconcilesHandler is served.
+const ReconcilesPath = "/debug/reconciles"
+
+// reconciles are the reconciles in flight in the reconcilers wrapped with
+// Track.
+var reconciles = &tracker{active: map[uint64]*activeReconcile{}}
+
+type tracker struct {
+	mu          sync.Mutex
+	active      map[uint64]*activeReconcile
+	next        uint64
+	controllers []string
+}
+
+type activeReconcile struct {
+	controller string
+	request    reconcile.Request
+	started    time.Time
+}
+
+// Track returns r recording its reconciles in flight for ReconcilesHandler
+// under controllerName, the name of the controller running r, which also names
+// its workqueue.
+func Track(controllerName string, r reconcile.Reconciler) reconcile.Reconciler {
+	reconciles.mu.Lock()
+	reconciles.controllers = append(reconciles.controllers, controllerName)
+	reconciles.mu.Unlock()
+	return reconcile.Func(func(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+		reconciles.mu.Lock()
+		id := reconciles.next
+		reconciles.next++
+		reconciles.active[id] = &activeReconcile{controller: controllerName, request: req, started: time.Now()}
+		reconciles.mu.Unlock()
+		defer func() {
+			reconciles.mu.Lock()
+			delete(reconciles.active, id)
+			reconciles.mu.Unlock()
+		}()
+		return r.Reconcile(ctx, req)
+	})
+}
+
+// queueMetrics are the workqueue and worker metrics of a controller dumped
+// by ReconcilesHandler, by their name in metrics.Registry.
+var queueMetrics = []struct {
+	name, label, title string
+}{
+	{"workqueue_depth", "name", "depth"},
+	{"workqueue_adds_total", "name", "adds"},
+	{"workqueue_retries_total", "name", "retries"},
+	{"workqueue_unfinished_work_seconds", "name", "unfinished work (s)"},
+	{"workqueue_longest_running_processor_seconds", "name", "longest running (s)"},
+	{"controller_runtime_active_workers", "controller", "active workers"},
+	{"controller_runtime_max_concurrent_reconciles", "controller", "max workers"},
+}
+
+// ReconcilesHandler dumps, as text, the workqueue of every controller
+// tracked with Track and its reconciles in flight, longest running first.
+func ReconcilesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		values, err := gatherQueueMetrics()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("gathering metrics: %v", err), http.StatusInternalServerError)
+			return
+		}
+		now := time.Now()
+		reconciles.mu.Lock()
+		controllers := append([]string(nil), reconciles.controllers...)
+		active := make([]activeReconcile, 0, len(reconciles.active))
+		for _, a := range reconciles.active {
+			active = append(active, *a)
+		}
+		reconciles.mu.Unlock()
+		sort.Slice(active, func(i, j int) bool { return active[i].started.Before(active[j].started) })
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, name := range controllers {
+			fmt.Fprintf(tw, "controller %s\n", name)
+			for _, m := range queueMetrics {
+				if v, ok := values[m.name][name]; ok {
+					fmt.Fprintf(tw, "  %s\t%g\n", m.title, v)
+				}
+			}
+			fmt.Fprintln(tw, "  in flight\tstarted\trunning for")
+			for _, a := range active {
+				if a.controller == name {
+					fmt.Fprintf(tw, "  %s\t%s\t%s\n", a.request, a.started.UTC().Format(time.RFC3339), now.Sub(a.started).Round(time.Millisecond))
+				}
+			}
+			fmt.Fprintln(tw)
+		}
+		tw.Flush()
+	})
+}
+
+// gatherQueueMetrics returns the values of queueMetrics by metric and
+// controller.
+func gatherQueueMetrics() (map[string]map[string]float64, error) {
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]map[string]float64{}
+	for _, m := range queueMetrics {
+		values[m.name] = map[string]float64{}
+	}
+	for _, family := range families {
+		for _, m := range queueMetrics {
+			if family.GetName() != m.name {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				values[m.name][labelValue(metric, m.label)] = value(metric)
+			}
+		}
+	}
+	return values, nil
+}
+
+func labelValue(metric *dto.Metric, name string) string {
+	for _, label := range metric.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
+
+func value(metric *dto.Metric) float64 {
+	switch {
+	case metric.Gauge != nil:
+		return metric.GetGauge().GetValue()
+	case metric.Counter != nil:
+		return metric.GetCounter().GetValue()
+	}
+	return 0
+}
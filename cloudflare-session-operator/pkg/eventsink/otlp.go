@@ -0,0 +1,103 @@
+package eventsink
+
+import (
+	"sort"
+	"strconv"
+)
+
+// The OTLP/HTTP JSON encoding of an ExportLogsServiceRequest, reduced to
+// the fields records use; see
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding.
+type (
+	otlpRequest struct {
+		ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+	}
+	otlpResourceLogs struct {
+		Resource  otlpResource    `json:"resource"`
+		ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeLogs struct {
+		Scope      otlpScope       `json:"scope"`
+		LogRecords []otlpLogRecord `json:"logRecords"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpLogRecord struct {
+		// Nanosecond timestamps are 64-bit integers, which the JSON
+		// encoding carries as strings.
+		TimeUnixNano         string         `json:"timeUnixNano"`
+		ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+		SeverityNumber       int            `json:"severityNumber"`
+		SeverityText         string         `json:"severityText"`
+		Body                 otlpAnyValue   `json:"body"`
+		Attributes           []otlpKeyValue `json:"attributes"`
+	}
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+	otlpAnyValue struct {
+		StringValue string `json:"stringValue"`
+	}
+)
+
+const (
+	// serviceName is the service.name of the operator's log records.
+	serviceName = "cloudflare-session-operator"
+	scopeName   = "github.com/Creme-ala-creme/cloudflare-session-operator/pkg/eventsink"
+
+	// Severity numbers of Normal and Warning events.
+	severityInfo = 9
+	severityWarn = 13
+)
+
+// otlpLogs encodes batch as log records with the event message as body,
+// and the rest of the record as attributes.
+func otlpLogs(batch []Record) otlpRequest {
+	records := make([]otlpLogRecord, 0, len(batch))
+	for _, r := range batch {
+		severity, severityText := severityInfo, "INFO"
+		if r.Type == "Warning" {
+			severity, severityText = severityWarn, "WARN"
+		}
+		attributes := []otlpKeyValue{
+			attribute("k8s.event.kind", r.Kind),
+			attribute("k8s.event.type", r.Type),
+			attribute("k8s.event.reason", r.Reason),
+			attribute("k8s.object.api_version", r.Object.APIVersion),
+			attribute("k8s.object.kind", r.Object.Kind),
+			attribute("k8s.namespace.name", r.Object.Namespace),
+			attribute("k8s.object.name", r.Object.Name),
+			attribute("k8s.object.uid", string(r.Object.UID)),
+		}
+		keys := make([]string, 0, len(r.Attributes))
+		for k := range r.Attributes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			attributes = append(attributes, attribute(k, r.Attributes[k]))
+		}
+		timestamp := strconv.FormatInt(r.Time.UnixNano(), 10)
+		records = append(records, otlpLogRecord{
+			TimeUnixNano:         timestamp,
+			ObservedTimeUnixNano: timestamp,
+			SeverityNumber:       severity,
+			SeverityText:         severityText,
+			Body:                 otlpAnyValue{StringValue: r.Message},
+			Attributes:           attributes,
+		})
+	}
+	return otlpRequest{ResourceLogs: []otlpResourceLogs{{
+		Resource:  otlpResource{Attributes: []otlpKeyValue{attribute("service.name", serviceName)}},
+		ScopeLogs: []otlpScopeLogs{{Scope: otlpScope{Name: scopeName}, LogRecords: records}},
+	}}}
+}
+
+func attribute(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: value}}
+}
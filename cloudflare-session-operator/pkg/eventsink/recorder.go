@@ -0,0 +1,66 @@
+package eventsink
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// recorder records events with the wrapped recorder and emits them to a
+// Sink.
+type recorder struct {
+	record.EventRecorder
+	sink   *Sink
+	scheme *runtime.Scheme
+}
+
+// Recorder returns r also emitting the events it records to sink; scheme
+// resolves the kind of objects without one set, as those of the cache.
+func Recorder(r record.EventRecorder, sink *Sink, scheme *runtime.Scheme) record.EventRecorder {
+	return &recorder{EventRecorder: r, sink: sink, scheme: scheme}
+}
+
+func (r *recorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.EventRecorder.Event(object, eventtype, reason, message)
+	r.emit(object, eventtype, reason, message)
+}
+
+func (r *recorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.EventRecorder.Eventf(object, eventtype, reason, messageFmt, args...)
+	r.emit(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *recorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, messageFmt, args...)
+	r.emit(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *recorder) emit(object runtime.Object, eventtype, reason, message string) {
+	r.sink.Emit(Record{
+		Time:    time.Now(),
+		Kind:    KindEvent,
+		Type:    eventtype,
+		Reason:  reason,
+		Message: message,
+		Object:  Ref(object, r.scheme),
+	})
+}
+
+// Ref returns the reference to object, with its kind from scheme when
+// object does not carry one.
+func Ref(object runtime.Object, scheme *runtime.Scheme) ObjectRef {
+	var ref ObjectRef
+	gvk := object.GetObjectKind().GroupVersionKind()
+	if gvk.Empty() && scheme != nil {
+		gvk, _ = apiutil.GVKForObject(object, scheme)
+	}
+	ref.APIVersion, ref.Kind = gvk.GroupVersion().String(), gvk.Kind
+	if accessor, err := meta.Accessor(object); err == nil {
+		ref.Namespace, ref.Name, ref.UID = accessor.GetNamespace(), accessor.GetName(), accessor.GetUID()
+	}
+	return ref
+}
@@ -0,0 +1,260 @@
+// Package eventsink exports the events the operator records, and the phase
+// transitions of its bindings, to an OTLP logs endpoint or a webhook, so
+// the history of a session outlives the hour the API server keeps events
+// for.
+package eventsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Formats of the requests a Sink makes.
+const (
+	// FormatOTLP posts OTLP/HTTP JSON log records, to a URL such as
+	// http://otel-collector:4318/v1/logs.
+	FormatOTLP = "OTLP"
+	// FormatWebhook posts a JSON array of Records.
+	FormatWebhook = "Webhook"
+)
+
+// Kinds of records.
+const (
+	// KindEvent is a Kubernetes event recorded by the operator.
+	KindEvent = "Event"
+	// KindTransition is a binding entering a phase.
+	KindTransition = "PhaseTransition"
+)
+
+const (
+	// queueSize bounds the records waiting for export; more are dropped.
+	queueSize = 1000
+	// batchSize records are exported at most per request, and batches are
+	// sent at least every flushInterval.
+	batchSize     = 100
+	flushInterval = 5 * time.Second
+	// attempts are made per batch, backoff apart at first and twice as far
+	// apart after each failure.
+	attempts = 5
+	backoff  = time.Second
+	timeout  = 10 * time.Second
+	// shutdownTimeout bounds the export of the records queued when the
+	// manager stops.
+	shutdownTimeout = 5 * time.Second
+)
+
+var exported = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cloudflare_session_event_sink_records_total",
+	Help: "Number of events and phase transitions by export result (exported, failed, dropped).",
+}, []string{"result"})
+
+func init() {
+	metrics.Registry.MustRegister(exported)
+}
+
+var log = ctrl.Log.WithName("event-sink")
+
+// Record is an event or transition as exported.
+type Record struct {
+	Time time.Time `json:"time"`
+	// Kind is KindEvent or KindTransition.
+	Kind string `json:"kind"`
+	// Type is the event type, Normal or Warning.
+	Type    string    `json:"type"`
+	Reason  string    `json:"reason"`
+	Message string    `json:"message"`
+	Object  ObjectRef `json:"object"`
+	// Attributes describe transitions further, e.g. the phase left.
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// ObjectRef is the object a Record is about.
+type ObjectRef struct {
+	APIVersion string    `json:"apiVersion,omitempty"`
+	Kind       string    `json:"kind,omitempty"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Name       string    `json:"name"`
+	UID        types.UID `json:"uid,omitempty"`
+}
+
+// Sink exports records in batches in the background, so an unreachable
+// endpoint never holds up a reconcile, retrying failed batches with
+// exponential backoff. Records emitted while the queue is full are dropped.
+// It runs on every replica, since replicas that do not lead record events
+// too.
+type Sink struct {
+	url     string
+	format  string
+	headers map[string]string
+	client  *http.Client
+	queue   chan Record
+}
+
+// New returns a Sink posting to rawURL in format, FormatOTLP or FormatWebhook,
+// with headers, e.g. the credentials of the endpoint, on every request.
+func New(rawURL, format string, headers map[string]string) (*Sink, error) {
+	if format != FormatOTLP && format != FormatWebhook {
+		return nil, fmt.Errorf("unknown event sink format %q, want %s or %s", format, FormatOTLP, FormatWebhook)
+	}
+	if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("event sink URL %q is not an http or https URL", rawURL)
+	}
+	return &Sink{
+		url:     rawURL,
+		format:  format,
+		headers: headers,
+		client:  &http.Client{Timeout: timeout},
+		queue:   make(chan Record, queueSize),
+	}, nil
+}
+
+// Emit queues r for export.
+func (s *Sink) Emit(r Record) {
+	select {
+	case s.queue <- r:
+	default:
+		exported.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Start implements manager.Runnable.
+func (s *Sink) Start(ctx context.Context) error {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	batch := make([]Record, 0, batchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) > 0 {
+			s.export(ctx, batch)
+			batch = batch[:0]
+		}
+	}
+	for {
+		select {
+		case r := <-s.queue:
+			if batch = append(batch, r); len(batch) == batchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		case <-ctx.Done():
+			// Export what is queued on a fresh context, the manager's is
+			// done.
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+		drain:
+			for {
+				select {
+				case r := <-s.queue:
+					batch = append(batch, r)
+				default:
+					break drain
+				}
+			}
+			for len(batch) > batchSize {
+				s.export(ctx, batch[:batchSize])
+				batch = batch[batchSize:]
+			}
+			flush(ctx)
+			return nil
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (s *Sink) NeedLeaderElection() bool {
+	return false
+}
+
+func (s *Sink) export(ctx context.Context, batch []Record) {
+	body, err := s.encode(batch)
+	if err != nil {
+		s.failed(err, batch)
+		return
+	}
+	delay := backoff
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var retry bool
+		if retry, err = s.post(ctx, body); err == nil {
+			exported.WithLabelValues("exported").Add(float64(len(batch)))
+			return
+		}
+		if !retry || attempt == attempts {
+			break
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			s.failed(ctx.Err(), batch)
+			return
+		}
+		delay *= 2
+	}
+	s.failed(err, batch)
+}
+
+func (s *Sink) failed(err error, batch []Record) {
+	log.Error(err, "failed to export records", "records", len(batch))
+	exported.WithLabelValues("failed").Add(float64(len(batch)))
+}
+
+func (s *Sink) encode(batch []Record) ([]byte, error) {
+	if s.format == FormatOTLP {
+		return json.Marshal(otlpLogs(batch))
+	}
+	return json.Marshal(batch)
+}
+
+// post makes one export attempt; retry reports whether a failure may be
+// transient.
+func (s *Sink) post(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return !errors.Is(err, context.Canceled), err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("event sink returned %s", resp.Status)
+	}
+	return false, fmt.Errorf("event sink returned %s", resp.Status)
+}
+
+// ParseHeaders parses headers listed as comma-separated key=value pairs,
+// as OTEL_EXPORTER_OTLP_HEADERS lists them, e.g.
+// "Authorization=Bearer abc,X-Scope-OrgID=sessions".
+func ParseHeaders(s string) (map[string]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	headers := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if key = strings.TrimSpace(key); !ok || key == "" {
+			return nil, fmt.Errorf("header %q is not key=value", pair)
+		}
+		headers[key] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
@@ -0,0 +1,85 @@
+// Package index registers the cache field indexes shared by the controllers
+// and admission webhooks.
+package index
+
+import (
+	"context"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SessionIDField indexes SessionBindings by spec.sessionID.
+const SessionIDField = ".spec.sessionID"
+
+// CredentialsSecretField indexes SessionBindings by spec.credentialsSecretRef.name.
+const CredentialsSecretField = ".spec.credentialsSecretRef.name"
+
+// TargetField indexes SessionBindings by the workload they clone, as
+// returned by TargetKey.
+const TargetField = ".spec.targetRef"
+
+// TargetKey identifies a target workload in the TargetField index.
+func TargetKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// Register adds all indexes to the manager's field indexer. It must be called
+// before the manager starts.
+func Register(ctx context.Context, indexer client.FieldIndexer) error {
+	if err := indexer.IndexField(ctx, &v1alpha1.SessionBinding{}, SessionIDField, func(obj client.Object) []string {
+		binding := obj.(*v1alpha1.SessionBinding)
+		if binding.Spec.SessionID == "" {
+			return nil
+		}
+		return []string{binding.Spec.SessionID}
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(ctx, &v1alpha1.SessionBinding{}, CredentialsSecretField, func(obj client.Object) []string {
+		binding := obj.(*v1alpha1.SessionBinding)
+		if binding.Spec.CredentialsSecretRef == nil || binding.Spec.CredentialsSecretRef.Name == "" {
+			return nil
+		}
+		return []string{binding.Spec.CredentialsSecretRef.Name}
+	}); err != nil {
+		return err
+	}
+	return indexer.IndexField(ctx, &v1alpha1.SessionBinding{}, TargetField, func(obj client.Object) []string {
+		binding := obj.(*v1alpha1.SessionBinding)
+		if binding.Spec.PodSelector != nil || binding.Spec.PoolRef != nil {
+			return nil
+		}
+		target := binding.Spec.Target()
+		if target.Name == "" {
+			return nil
+		}
+		namespace := target.Namespace
+		if namespace == "" {
+			namespace = binding.Namespace
+		}
+		return []string{TargetKey(target.Kind, namespace, target.Name)}
+	})
+}
+
+// IsActive reports whether the binding still claims its session: it is not
+// being deleted and has not expired.
+func IsActive(binding *v1alpha1.SessionBinding) bool {
+	return binding.DeletionTimestamp.IsZero() && binding.Status.Phase != v1alpha1.SessionBindingPhaseExpired
+}
+
+// ActiveBindingsForSession lists active SessionBindings in any namespace that
+// claim sessionID.
+func ActiveBindingsForSession(ctx context.Context, c client.Reader, sessionID string) ([]v1alpha1.SessionBinding, error) {
+	list := &v1alpha1.SessionBindingList{}
+	if err := c.List(ctx, list, client.MatchingFields{SessionIDField: sessionID}); err != nil {
+		return nil, err
+	}
+	active := list.Items[:0]
+	for i := range list.Items {
+		if IsActive(&list.Items[i]) {
+			active = append(active, list.Items[i])
+		}
+	}
+	return active, nil
+}
@@ -0,0 +1,209 @@
+// Package metricsauth guards the manager's metrics endpoint with the
+// cluster's own authentication and authorization, as controller-runtime's
+// filters.WithAuthenticationAndAuthorization does, without the dependency
+// on k8s.io/apiserver that comes with it. Scrapers send a bearer token,
+// typically their service account's, which is checked with a TokenReview;
+// its user needs the get verb on the non-resource URL /metrics, which is
+// checked with a SubjectAccessReview.
+package metricsauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	authenticationclient "k8s.io/client-go/kubernetes/typed/authentication/v1"
+	authorizationclient "k8s.io/client-go/kubernetes/typed/authorization/v1"
+	"k8s.io/client-go/rest"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+const (
+	// authenticatedTTL is how long an authenticated token is trusted
+	// before it is reviewed again. Rejected tokens are not remembered, so
+	// random ones cannot fill the cache.
+	authenticatedTTL = time.Minute
+	// allowedTTL and deniedTTL are how long a decision of the authorizer
+	// is kept.
+	allowedTTL = 5 * time.Minute
+	deniedTTL  = 30 * time.Second
+	// reviewTimeout bounds every review.
+	reviewTimeout = 10 * time.Second
+	// maxCached is the number of entries past which expired ones are
+	// dropped from a cache.
+	maxCached = 1024
+)
+
+// WithAuthenticationAndAuthorization returns a metrics server filter
+// authenticating and authorizing every request with the API server config
+// talks to; it is a metricsserver.Options FilterProvider.
+func WithAuthenticationAndAuthorization(config *rest.Config, httpClient *http.Client) (metricsserver.Filter, error) {
+	authn, err := authenticationclient.NewForConfigAndClient(config, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	authz, err := authorizationclient.NewForConfigAndClient(config, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	g := &guard{
+		tokenReviews:   authn.TokenReviews(),
+		accessReviews:  authz.SubjectAccessReviews(),
+		authenticated:  newCache[*authenticationv1.UserInfo](),
+		authorizations: newCache[bool](),
+	}
+	return func(log logr.Logger, handler http.Handler) (http.Handler, error) {
+		return g.wrap(log, handler), nil
+	}, nil
+}
+
+type guard struct {
+	tokenReviews   authenticationclient.TokenReviewInterface
+	accessReviews  authorizationclient.SubjectAccessReviewInterface
+	authenticated  *cache[*authenticationv1.UserInfo]
+	authorizations *cache[bool]
+}
+
+func (g *guard) wrap(log logr.Logger, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		user, err := g.authenticate(req.Context(), token)
+		if err != nil {
+			log.Error(err, "failed to authenticate metrics request")
+			http.Error(w, "Authentication failed", http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		allowed, err := g.authorize(req.Context(), user, strings.ToLower(req.Method), req.URL.Path)
+		if err != nil {
+			log.Error(err, "failed to authorize metrics request", "user", user.Username)
+			http.Error(w, "Authorization failed", http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			log.V(1).Info("metrics request denied", "user", user.Username, "path", req.URL.Path)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// authenticate returns the user token belongs to, nil when it is not
+// valid.
+func (g *guard) authenticate(ctx context.Context, token string) (*authenticationv1.UserInfo, error) {
+	key := fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+	if user, ok := g.authenticated.get(key); ok {
+		return user, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, reviewTimeout)
+	defer cancel()
+	review, err := g.tokenReviews.Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("token review: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return nil, nil
+	}
+	user := review.Status.User
+	g.authenticated.put(key, &user, authenticatedTTL)
+	return &user, nil
+}
+
+// authorize reports whether user may use verb on the non-resource URL
+// path.
+func (g *guard) authorize(ctx context.Context, user *authenticationv1.UserInfo, verb, path string) (bool, error) {
+	groups := append([]string(nil), user.Groups...)
+	sort.Strings(groups)
+	key := strings.Join([]string{user.Username, user.UID, strings.Join(groups, ","), verb, path}, "\x00")
+	if allowed, ok := g.authorizations.get(key); ok {
+		return allowed, nil
+	}
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	ctx, cancel := context.WithTimeout(ctx, reviewTimeout)
+	defer cancel()
+	review, err := g.accessReviews.Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:                  user.Username,
+			UID:                   user.UID,
+			Groups:                user.Groups,
+			Extra:                 extra,
+			NonResourceAttributes: &authorizationv1.NonResourceAttributes{Path: path, Verb: verb},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, fmt.Errorf("subject access review: %w", err)
+	}
+	ttl := deniedTTL
+	if review.Status.Allowed {
+		ttl = allowedTTL
+	}
+	g.authorizations.put(key, review.Status.Allowed, ttl)
+	return review.Status.Allowed, nil
+}
+
+// cache keeps values until they expire.
+type cache[V any] struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry[V]
+}
+
+type cacheEntry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+func newCache[V any]() *cache[V] {
+	return &cache[V]{entries: map[string]cacheEntry[V]{}}
+}
+
+func (c *cache[V]) get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+func (c *cache[V]) put(key string, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.entries) >= maxCached {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = cacheEntry[V]{value: value, expires: now.Add(ttl)}
+}
@@ -0,0 +1,151 @@
+// Package operatorconfig holds the operator settings that can be changed at
+// runtime through the OperatorConfig resource. The controllers and admission
+// webhooks read them from a shared Store.
+package operatorconfig
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+)
+
+// MaxConcurrentReconcilesLimit is the upper bound for
+// Settings.MaxConcurrentReconciles, matching the OperatorConfig schema.
+const MaxConcurrentReconcilesLimit = 32
+
+// Settings are the effective runtime settings.
+type Settings struct {
+	// PendingRequeueInterval is how often bindings waiting for their pod
+	// are re-checked.
+	PendingRequeueInterval time.Duration
+	// ErrorRequeueInterval is how often failed or denied bindings are retried.
+	ErrorRequeueInterval time.Duration
+	// RouteResyncInterval is how often the route of a bound binding is
+	// re-verified with Cloudflare.
+	RouteResyncInterval time.Duration
+	// DefaultTTLSeconds is applied to bindings without spec.ttlSeconds; zero
+	// leaves them without a TTL.
+	DefaultTTLSeconds int64
+	// DefaultTTLSecondsAfterFinished is how long finished bindings without
+	// spec.ttlSecondsAfterFinished are kept; zero keeps them.
+	DefaultTTLSecondsAfterFinished int64
+	// RouteHostnameTemplate is the hostname for bindings without
+	// spec.route.hostname; "{sessionID}" is replaced with the session ID.
+	RouteHostnameTemplate string
+	// KVNamespaceID is the Workers KV namespace new routes are written to;
+	// empty leaves the choice to the Cloudflare client.
+	KVNamespaceID string
+	// DrainGracePeriod is how long a session pod keeps running after the
+	// route of its expired or deleted binding is removed.
+	DrainGracePeriod time.Duration
+	// MaxConcurrentReconciles bounds concurrent SessionBinding reconciles.
+	MaxConcurrentReconciles int
+	// NetworkPolicy, when set, is the NetworkPolicy applied to every session
+	// pod. It must not be modified.
+	NetworkPolicy *v1alpha1.SessionNetworkPolicy
+}
+
+// DefaultSettings returns the settings used when neither flags nor an
+// OperatorConfig say otherwise.
+func DefaultSettings() Settings {
+	return Settings{
+		PendingRequeueInterval:  10 * time.Second,
+		ErrorRequeueInterval:    time.Minute,
+		RouteResyncInterval:     5 * time.Minute,
+		DrainGracePeriod:        30 * time.Second,
+		MaxConcurrentReconciles: 1,
+	}
+}
+
+// Apply returns s with the fields set in spec overriding it, and
+// MaxConcurrentReconciles clamped to [1, MaxConcurrentReconcilesLimit].
+func (s Settings) Apply(spec *v1alpha1.OperatorConfigSpec) Settings {
+	if spec != nil {
+		if spec.PendingRequeueInterval != nil && spec.PendingRequeueInterval.Duration > 0 {
+			s.PendingRequeueInterval = spec.PendingRequeueInterval.Duration
+		}
+		if spec.ErrorRequeueInterval != nil && spec.ErrorRequeueInterval.Duration > 0 {
+			s.ErrorRequeueInterval = spec.ErrorRequeueInterval.Duration
+		}
+		if spec.RouteResyncInterval != nil && spec.RouteResyncInterval.Duration > 0 {
+			s.RouteResyncInterval = spec.RouteResyncInterval.Duration
+		}
+		if spec.DefaultTTLSeconds != nil {
+			s.DefaultTTLSeconds = *spec.DefaultTTLSeconds
+		}
+		if spec.DefaultTTLSecondsAfterFinished != nil {
+			s.DefaultTTLSecondsAfterFinished = *spec.DefaultTTLSecondsAfterFinished
+		}
+		if spec.RouteHostnameTemplate != "" {
+			s.RouteHostnameTemplate = spec.RouteHostnameTemplate
+		}
+		if spec.KVNamespaceID != "" {
+			s.KVNamespaceID = spec.KVNamespaceID
+		}
+		if spec.DrainGracePeriod != nil && spec.DrainGracePeriod.Duration >= 0 {
+			s.DrainGracePeriod = spec.DrainGracePeriod.Duration
+		}
+		if spec.MaxConcurrentReconciles != nil {
+			s.MaxConcurrentReconciles = int(*spec.MaxConcurrentReconciles)
+		}
+		if spec.NetworkPolicy != nil {
+			s.NetworkPolicy = spec.NetworkPolicy.DeepCopy()
+		}
+	}
+	if s.MaxConcurrentReconciles < 1 {
+		s.MaxConcurrentReconciles = 1
+	}
+	if s.MaxConcurrentReconciles > MaxConcurrentReconcilesLimit {
+		s.MaxConcurrentReconciles = MaxConcurrentReconcilesLimit
+	}
+	return s
+}
+
+// Store holds the current Settings. It is safe for concurrent use; a nil
+// Store returns DefaultSettings.
+type Store struct {
+	mu        sync.RWMutex
+	base      Settings
+	current   Settings
+	listeners []func(Settings)
+}
+
+// NewStore returns a Store whose settings are base until an OperatorConfig
+// is applied. base usually comes from command-line flags.
+func NewStore(base Settings) *Store {
+	base = base.Apply(nil)
+	return &Store{base: base, current: base}
+}
+
+// Get returns the current settings.
+func (s *Store) Get() Settings {
+	if s == nil {
+		return DefaultSettings()
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+// Update replaces the current settings with the base settings overridden by
+// spec; a nil spec restores the base settings. Listeners are notified of
+// the result.
+func (s *Store) Update(spec *v1alpha1.OperatorConfigSpec) Settings {
+	s.mu.Lock()
+	s.current = s.base.Apply(spec)
+	current, listeners := s.current, s.listeners
+	s.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(current)
+	}
+	return current
+}
+
+// OnChange registers fn to be called after every Update.
+func (s *Store) OnChange(fn func(Settings)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
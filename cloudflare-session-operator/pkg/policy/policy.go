@@ -0,0 +1,199 @@
+// Package policy evaluates SessionPolicy limits for SessionBindings. The
+// controller and the validating webhook share it so both deny bindings for
+// the same reasons.
+package policy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/index"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Reasons a binding is denied, used for its Admitted condition.
+const (
+	ReasonNamespaceQuotaExceeded = "NamespaceQuotaExceeded"
+	ReasonUserQuotaExceeded      = "UserQuotaExceeded"
+	ReasonTTLNotAllowed          = "TTLNotAllowed"
+	ReasonProfileNotAllowed      = "ProfileNotAllowed"
+)
+
+// Violation describes the first SessionPolicy limit a binding exceeds.
+type Violation struct {
+	Policy  string
+	Reason  string
+	Message string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("denied by SessionPolicy %s: %s", v.Policy, v.Message)
+}
+
+// Evaluate checks binding against every SessionPolicy selecting its
+// namespace, in name order, and returns the first violation or nil.
+//
+// Session quotas are first come, first served: only active bindings created
+// before binding count against them, and a binding that has not been created
+// yet comes after all others. Bindings denied for their TTL or profile never
+// run and do not take up quota.
+func Evaluate(ctx context.Context, c client.Reader, binding *v1alpha1.SessionBinding) (*Violation, error) {
+	policies := &v1alpha1.SessionPolicyList{}
+	if err := c.List(ctx, policies); err != nil {
+		return nil, err
+	}
+	if len(policies.Items) == 0 {
+		return nil, nil
+	}
+	sort.Slice(policies.Items, func(i, j int) bool {
+		return policies.Items[i].Name < policies.Items[j].Name
+	})
+
+	e := &evaluator{ctx: ctx, client: c}
+	for i := range policies.Items {
+		policy := &policies.Items[i]
+		selected, err := e.selects(policy, binding.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		if !selected {
+			continue
+		}
+		if v, err := e.check(policy, binding); v != nil || err != nil {
+			return v, err
+		}
+	}
+	return nil, nil
+}
+
+// evaluator caches the namespaces and bindings listed while checking one
+// binding against several policies.
+type evaluator struct {
+	ctx    context.Context
+	client client.Reader
+
+	namespaces map[string]labels.Set
+	bindings   []v1alpha1.SessionBinding
+}
+
+func (e *evaluator) check(policy *v1alpha1.SessionPolicy, binding *v1alpha1.SessionBinding) (*Violation, error) {
+	spec := policy.Spec
+	deny := func(reason, format string, args ...interface{}) (*Violation, error) {
+		return &Violation{Policy: policy.Name, Reason: reason, Message: fmt.Sprintf(format, args...)}, nil
+	}
+
+	if spec.MaxTTLSeconds != nil {
+		if binding.Spec.TTLSeconds == nil {
+			return deny(ReasonTTLNotAllowed, "spec.ttlSeconds must be set and at most %d", *spec.MaxTTLSeconds)
+		}
+		if *binding.Spec.TTLSeconds > *spec.MaxTTLSeconds {
+			return deny(ReasonTTLNotAllowed, "spec.ttlSeconds %d exceeds the maximum of %d", *binding.Spec.TTLSeconds, *spec.MaxTTLSeconds)
+		}
+	}
+	if len(spec.AllowedProfiles) > 0 && binding.Spec.Profile != "" && !contains(spec.AllowedProfiles, binding.Spec.Profile) {
+		return deny(ReasonProfileNotAllowed, "profile %q is not one of %v", binding.Spec.Profile, spec.AllowedProfiles)
+	}
+
+	if spec.MaxSessionsPerNamespace == nil && (spec.MaxSessionsPerUser == nil || binding.Spec.UserID == "") {
+		return nil, nil
+	}
+	bindings, err := e.listBindings()
+	if err != nil {
+		return nil, err
+	}
+	var inNamespace, forUser int32
+	for i := range bindings {
+		other := &bindings[i]
+		if !countsBefore(other, binding) {
+			continue
+		}
+		if other.Namespace == binding.Namespace {
+			inNamespace++
+		}
+		if binding.Spec.UserID != "" && other.Spec.UserID == binding.Spec.UserID {
+			selected, err := e.selects(policy, other.Namespace)
+			if err != nil {
+				return nil, err
+			}
+			if selected {
+				forUser++
+			}
+		}
+	}
+	if limit := spec.MaxSessionsPerNamespace; limit != nil && inNamespace >= *limit {
+		return deny(ReasonNamespaceQuotaExceeded, "namespace %s already has %d of %d allowed sessions", binding.Namespace, inNamespace, *limit)
+	}
+	if limit := spec.MaxSessionsPerUser; limit != nil && binding.Spec.UserID != "" && forUser >= *limit {
+		return deny(ReasonUserQuotaExceeded, "user %s already has %d of %d allowed sessions", binding.Spec.UserID, forUser, *limit)
+	}
+	return nil, nil
+}
+
+// selects reports whether policy applies to namespace.
+func (e *evaluator) selects(policy *v1alpha1.SessionPolicy, namespace string) (bool, error) {
+	if policy.Spec.NamespaceSelector == nil {
+		return true, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(policy.Spec.NamespaceSelector)
+	if err != nil {
+		return false, fmt.Errorf("SessionPolicy %s: %w", policy.Name, err)
+	}
+	if e.namespaces == nil {
+		list := &corev1.NamespaceList{}
+		if err := e.client.List(e.ctx, list); err != nil {
+			return false, err
+		}
+		e.namespaces = make(map[string]labels.Set, len(list.Items))
+		for _, ns := range list.Items {
+			e.namespaces[ns.Name] = labels.Set(ns.Labels)
+		}
+	}
+	return selector.Matches(e.namespaces[namespace]), nil
+}
+
+func (e *evaluator) listBindings() ([]v1alpha1.SessionBinding, error) {
+	if e.bindings == nil {
+		list := &v1alpha1.SessionBindingList{}
+		if err := e.client.List(e.ctx, list); err != nil {
+			return nil, err
+		}
+		e.bindings = list.Items
+	}
+	return e.bindings, nil
+}
+
+// countsBefore reports whether other takes up quota ahead of binding.
+func countsBefore(other, binding *v1alpha1.SessionBinding) bool {
+	if other.Namespace == binding.Namespace && other.Name == binding.Name {
+		return false
+	}
+	if !index.IsActive(other) {
+		return false
+	}
+	if cond := meta.FindStatusCondition(other.Status.Conditions, v1alpha1.ConditionAdmitted); cond != nil && cond.Status == metav1.ConditionFalse &&
+		(cond.Reason == ReasonTTLNotAllowed || cond.Reason == ReasonProfileNotAllowed) {
+		return false
+	}
+	if binding.CreationTimestamp.IsZero() {
+		return true
+	}
+	if !other.CreationTimestamp.Equal(&binding.CreationTimestamp) {
+		return other.CreationTimestamp.Before(&binding.CreationTimestamp)
+	}
+	return other.Namespace+"/"+other.Name < binding.Namespace+"/"+binding.Name
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,346 @@
+// Package provisioning serves a small REST API for services outside the
+// cluster to create and delete sessions without Kubernetes credentials.
+// Each session is a SessionBinding the API creates, so the operator handles
+// it exactly like one applied by hand.
+//
+//	POST   /v1/sessions                       create (or get) a session
+//	GET    /v1/sessions/{sessionID}?namespace= get a session
+//	DELETE /v1/sessions/{sessionID}?namespace= delete a session
+//
+// Requests carry "Authorization: Bearer <token>". POST and GET accept
+// ?wait=<duration> to hold the response until the route endpoint is known.
+package provisioning
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ProvisionedByLabelValue is the v1alpha1.ProvisionedByLabelKey value of
+// bindings created by the API. The API only deletes bindings carrying it.
+const ProvisionedByLabelValue = "provisioning-api"
+
+const (
+	// MaxWait caps ?wait.
+	MaxWait = time.Minute
+
+	fieldManager = "cloudflare-session-provisioning"
+	maxBodyBytes = 64 << 10
+	pollInterval = time.Second
+)
+
+var log = ctrl.Log.WithName("provisioning-api")
+
+// CreateRequest is the body of POST /v1/sessions.
+type CreateRequest struct {
+	// SessionID names the session and its SessionBinding, so it must be a
+	// DNS label.
+	SessionID string `json:"sessionID"`
+	UserID    string `json:"userID,omitempty"`
+	// Namespace defaults to the API's first namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// Exactly one of Target, a Deployment, and Pool must be set.
+	Target string `json:"target,omitempty"`
+	Pool   string `json:"pool,omitempty"`
+	// Profile and TTLSeconds are copied to the binding's spec.
+	Profile    string `json:"profile,omitempty"`
+	TTLSeconds *int64 `json:"ttlSeconds,omitempty"`
+}
+
+// Session is the response to every request but DELETE.
+type Session struct {
+	SessionID     string       `json:"sessionID"`
+	UserID        string       `json:"userID,omitempty"`
+	Namespace     string       `json:"namespace"`
+	Name          string       `json:"name"`
+	Phase         string       `json:"phase,omitempty"`
+	RouteEndpoint string       `json:"routeEndpoint,omitempty"`
+	ExpiresAt     *metav1.Time `json:"expiresAt,omitempty"`
+}
+
+// Handler serves the API.
+type Handler struct {
+	Client client.Client
+	// Token is the bearer token callers must present.
+	Token []byte
+	// Namespaces the API may create sessions in; the first is the default.
+	Namespaces []string
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !h.authorized(req) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+		return
+	}
+	waitFor, err := waitParam(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	path := strings.TrimSuffix(req.URL.Path, "/")
+	switch {
+	case path == "/v1/sessions" && req.Method == http.MethodPost:
+		h.create(w, req, waitFor)
+	case strings.HasPrefix(path, "/v1/sessions/"):
+		sessionID := strings.TrimPrefix(path, "/v1/sessions/")
+		namespace := req.URL.Query().Get("namespace")
+		switch req.Method {
+		case http.MethodGet:
+			h.get(w, req, namespace, sessionID, waitFor)
+		case http.MethodDelete:
+			h.delete(w, req, namespace, sessionID)
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	case path == "/v1/sessions":
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (h *Handler) authorized(req *http.Request) bool {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return ok && len(h.Token) > 0 && subtle.ConstantTimeCompare([]byte(token), h.Token) == 1
+}
+
+func (h *Handler) create(w http.ResponseWriter, req *http.Request, waitFor time.Duration) {
+	var in CreateRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	namespace, err := h.namespace(in.Namespace)
+	if err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	switch {
+	case in.SessionID == "":
+		writeError(w, http.StatusBadRequest, "sessionID is required")
+		return
+	case (in.Target == "") == (in.Pool == ""):
+		writeError(w, http.StatusBadRequest, "exactly one of target and pool is required")
+		return
+	}
+
+	binding := &v1alpha1.SessionBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      in.SessionID,
+			Labels:    map[string]string{v1alpha1.ProvisionedByLabelKey: ProvisionedByLabelValue},
+		},
+		Spec: v1alpha1.SessionBindingSpec{
+			SessionID:  in.SessionID,
+			UserID:     in.UserID,
+			Profile:    in.Profile,
+			TTLSeconds: in.TTLSeconds,
+		},
+	}
+	if in.Target != "" {
+		binding.Spec.TargetRef = &v1alpha1.TargetReference{Kind: v1alpha1.TargetKindDeployment, Name: in.Target}
+	} else {
+		binding.Spec.PoolRef = &corev1.LocalObjectReference{Name: in.Pool}
+	}
+
+	status := http.StatusCreated
+	err = h.Client.Create(req.Context(), binding, client.FieldOwner(fieldManager))
+	switch {
+	case apierrors.IsAlreadyExists(err):
+		// Creating is idempotent per session, so callers can retry freely;
+		// the existing session is returned whatever its spec.
+		status = http.StatusOK
+	case err != nil:
+		writeAPIError(w, err)
+		return
+	default:
+		log.Info("created SessionBinding", "namespace", namespace, "binding", binding.Name, "userID", in.UserID)
+	}
+	h.respond(w, req, types.NamespacedName{Namespace: namespace, Name: in.SessionID}, waitFor, status)
+}
+
+func (h *Handler) get(w http.ResponseWriter, req *http.Request, namespace, sessionID string, waitFor time.Duration) {
+	namespace, err := h.namespace(namespace)
+	if err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	h.respond(w, req, types.NamespacedName{Namespace: namespace, Name: sessionID}, waitFor, http.StatusOK)
+}
+
+func (h *Handler) delete(w http.ResponseWriter, req *http.Request, namespace, sessionID string) {
+	namespace, err := h.namespace(namespace)
+	if err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	binding := &v1alpha1.SessionBinding{}
+	if err := h.Client.Get(req.Context(), types.NamespacedName{Namespace: namespace, Name: sessionID}, binding); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if binding.Labels[v1alpha1.ProvisionedByLabelKey] != ProvisionedByLabelValue {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("session %s was not created through this API", sessionID))
+		return
+	}
+	if err := h.Client.Delete(req.Context(), binding, client.Preconditions{UID: &binding.UID}); err != nil && !apierrors.IsNotFound(err) {
+		writeAPIError(w, err)
+		return
+	}
+	log.Info("deleted SessionBinding", "namespace", namespace, "binding", binding.Name)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// respond writes the session of key, after waiting up to waitFor for its
+// route endpoint.
+func (h *Handler) respond(w http.ResponseWriter, req *http.Request, key types.NamespacedName, waitFor time.Duration, status int) {
+	binding := &v1alpha1.SessionBinding{}
+	// The cache may not have seen a binding created just now, so not found
+	// is retried like a missing endpoint until the wait is over.
+	settled := func(ctx context.Context) (bool, error) {
+		if err := h.Client.Get(ctx, key, binding); err != nil {
+			return false, client.IgnoreNotFound(err)
+		}
+		return binding.Status.RouteEndpoint != "" || binding.Status.Phase == v1alpha1.SessionBindingPhaseError, nil
+	}
+	var err error
+	if waitFor > 0 {
+		err = wait.PollUntilContextTimeout(req.Context(), pollInterval, waitFor, true, settled)
+	} else {
+		_, err = settled(req.Context())
+	}
+	if err != nil && !wait.Interrupted(err) {
+		writeAPIError(w, err)
+		return
+	}
+	if binding.UID == "" {
+		if status == http.StatusCreated {
+			// Created, but not in the cache yet.
+			writeJSON(w, http.StatusAccepted, Session{SessionID: key.Name, Namespace: key.Namespace, Name: key.Name})
+			return
+		}
+		writeAPIError(w, apierrors.NewNotFound(v1alpha1.GroupVersion.WithResource("sessionbindings").GroupResource(), key.Name))
+		return
+	}
+	if binding.Status.RouteEndpoint == "" && status == http.StatusCreated {
+		status = http.StatusAccepted
+	}
+	writeJSON(w, status, Session{
+		SessionID:     binding.Spec.SessionID,
+		UserID:        binding.Spec.UserID,
+		Namespace:     binding.Namespace,
+		Name:          binding.Name,
+		Phase:         string(binding.Status.Phase),
+		RouteEndpoint: binding.Status.RouteEndpoint,
+		ExpiresAt:     binding.Status.ExpiresAt,
+	})
+}
+
+// namespace resolves a requested namespace against h.Namespaces.
+func (h *Handler) namespace(requested string) (string, error) {
+	if requested == "" && len(h.Namespaces) > 0 {
+		return h.Namespaces[0], nil
+	}
+	for _, ns := range h.Namespaces {
+		if ns == requested {
+			return ns, nil
+		}
+	}
+	return "", fmt.Errorf("namespace %q is not served by this API", requested)
+}
+
+func waitParam(req *http.Request) (time.Duration, error) {
+	raw := req.URL.Query().Get("wait")
+	if raw == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid wait %q", raw)
+	}
+	if d > MaxWait {
+		d = MaxWait
+	}
+	return d, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// writeAPIError passes on the status of Kubernetes API errors, such as
+// admission webhook denials, and hides anything else.
+func writeAPIError(w http.ResponseWriter, err error) {
+	var status apierrors.APIStatus
+	if errors.As(err, &status) && status.Status().Code != 0 {
+		writeError(w, int(status.Status().Code), status.Status().Message)
+		return
+	}
+	log.Error(err, "request failed")
+	writeError(w, http.StatusInternalServerError, "internal error")
+}
+
+// Server serves Handler on Addr until its manager stops. The API writes
+// straight to the API server, so it runs on every replica.
+type Server struct {
+	Addr    string
+	Handler http.Handler
+	// CertFile and KeyFile, when both set, serve HTTPS.
+	CertFile string
+	KeyFile  string
+}
+
+// Start implements manager.Runnable.
+func (s *Server) Start(ctx context.Context) error {
+	srv := &http.Server{Addr: s.Addr, Handler: s.Handler, ReadHeaderTimeout: 10 * time.Second}
+
+	errs := make(chan error, 1)
+	go func() {
+		log.Info("serving provisioning API", "addr", s.Addr, "tls", s.CertFile != "")
+		if s.CertFile != "" && s.KeyFile != "" {
+			errs <- srv.ListenAndServeTLS(s.CertFile, s.KeyFile)
+		} else {
+			errs <- srv.ListenAndServe()
+		}
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,152 @@
+package provisioning
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const testToken = "s3cret"
+
+func newTestHandler(t *testing.T, objs ...client.Object) *Handler {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return &Handler{
+		Client:     fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(),
+		Token:      []byte(testToken),
+		Namespaces: []string{"sessions", "sessions-eu"},
+	}
+}
+
+func serve(h *Handler, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthorized(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		token  string
+		header string
+		want   bool
+	}{
+		{"matching token", testToken, "Bearer " + testToken, true},
+		{"no header", testToken, "", false},
+		{"other scheme", testToken, "Basic " + testToken, false},
+		{"wrong token", testToken, "Bearer nope", false},
+		{"token prefix", testToken, "Bearer " + testToken[:3], false},
+		{"no token configured", "", "Bearer ", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &Handler{Token: []byte(tc.token)}
+			req := httptest.NewRequest(http.MethodGet, "/v1/sessions/s1", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			if got := h.authorized(req); got != tc.want {
+				t.Fatalf("authorized = %t want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUnauthorizedRequestsAreRejected(t *testing.T) {
+	h := newTestHandler(t)
+	req := httptest.NewRequest(http.MethodDelete, "/v1/sessions/s1", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Fatalf("status = %d WWW-Authenticate = %q want 401 Bearer", rec.Code, rec.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	h := &Handler{Namespaces: []string{"sessions", "sessions-eu"}}
+	for _, tc := range []struct {
+		requested string
+		want      string
+		wantErr   bool
+	}{
+		{"", "sessions", false},
+		{"sessions-eu", "sessions-eu", false},
+		{"kube-system", "", true},
+	} {
+		got, err := h.namespace(tc.requested)
+		if got != tc.want || (err != nil) != tc.wantErr {
+			t.Errorf("namespace(%q) = %q, %v want %q, error %t", tc.requested, got, err, tc.want, tc.wantErr)
+		}
+	}
+
+	if _, err := (&Handler{}).namespace(""); err == nil {
+		t.Error("namespace resolved without any namespace configured")
+	}
+}
+
+func TestCreateOutsideServedNamespaces(t *testing.T) {
+	h := newTestHandler(t)
+	rec := serve(h, http.MethodPost, "/v1/sessions", `{"sessionID":"s1","namespace":"kube-system","target":"app"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d want 403, body %s", rec.Code, rec.Body)
+	}
+	list := &v1alpha1.SessionBindingList{}
+	if err := h.Client.List(context.Background(), list); err != nil || len(list.Items) != 0 {
+		t.Fatalf("bindings = %v, %v want none", list.Items, err)
+	}
+}
+
+func TestDeleteOnlyProvisionedBindings(t *testing.T) {
+	binding := func(name string, labels map[string]string) *v1alpha1.SessionBinding {
+		return &v1alpha1.SessionBinding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "sessions", Name: name, UID: types.UID(name), Labels: labels},
+			Spec:       v1alpha1.SessionBindingSpec{SessionID: name},
+		}
+	}
+	h := newTestHandler(t,
+		binding("provisioned", map[string]string{v1alpha1.ProvisionedByLabelKey: ProvisionedByLabelValue}),
+		binding("by-hand", nil),
+		binding("other-tool", map[string]string{v1alpha1.ProvisionedByLabelKey: "gitops"}),
+	)
+
+	for _, tc := range []struct {
+		target  string
+		want    int
+		deleted string
+		kept    string
+	}{
+		{target: "/v1/sessions/by-hand", want: http.StatusForbidden, kept: "by-hand"},
+		{target: "/v1/sessions/other-tool", want: http.StatusForbidden, kept: "other-tool"},
+		{target: "/v1/sessions/provisioned?namespace=kube-system", want: http.StatusForbidden, kept: "provisioned"},
+		{target: "/v1/sessions/missing", want: http.StatusNotFound},
+		{target: "/v1/sessions/provisioned?namespace=sessions", want: http.StatusAccepted, deleted: "provisioned"},
+	} {
+		rec := serve(h, http.MethodDelete, tc.target, "")
+		if rec.Code != tc.want {
+			t.Fatalf("DELETE %s status = %d want %d, body %s", tc.target, rec.Code, tc.want, rec.Body)
+		}
+		for name, wantGone := range map[string]bool{tc.kept: false, tc.deleted: true} {
+			if name == "" {
+				continue
+			}
+			err := h.Client.Get(context.Background(), types.NamespacedName{Namespace: "sessions", Name: name}, &v1alpha1.SessionBinding{})
+			if gone := apierrors.IsNotFound(err); gone != wantGone {
+				t.Fatalf("DELETE %s: binding %s gone = %t want %t (%v)", tc.target, name, gone, wantGone, err)
+			}
+		}
+	}
+}
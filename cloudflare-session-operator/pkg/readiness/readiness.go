@@ -0,0 +1,29 @@
+// Package readiness holds the readiness checks of the manager, which keep a
+// replica out of its Service while it could not do its work.
+package readiness
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// cacheSyncTimeout bounds how long a check waits for the caches.
+const cacheSyncTimeout = time.Second
+
+// CacheSynced returns a check failing until the informers of c have
+// started and synced, i.e. until reconciles see the cluster as it is.
+func CacheSynced(c cache.Cache) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), cacheSyncTimeout)
+		defer cancel()
+		if !c.WaitForCacheSync(ctx) {
+			return errors.New("informer caches have not synced")
+		}
+		return nil
+	}
+}
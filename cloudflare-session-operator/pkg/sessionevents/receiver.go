@@ -0,0 +1,209 @@
+// Package sessionevents receives session lifecycle events pushed by
+// Cloudflare-side automation, so bindings react to a created, revoked or
+// expired session right away instead of on their next EnsureSession poll.
+package sessionevents
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Event types.
+const (
+	EventCreated = "created"
+	EventRevoked = "revoked"
+	EventExpired = "expired"
+)
+
+const (
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256, keyed with
+	// the shared secret, of the timestamp header, a dot and the body.
+	SignatureHeader = "X-Session-Signature"
+	// TimestampHeader carries the Unix time the request was signed at.
+	TimestampHeader = "X-Session-Timestamp"
+	// MaxClockSkew is how far a request's timestamp may be from the
+	// receiver's clock, which bounds how long a captured request can be
+	// replayed.
+	MaxClockSkew = 5 * time.Minute
+
+	maxBodyBytes  = 64 << 10
+	notifyTimeout = 5 * time.Second
+)
+
+// Event is the JSON body of a request.
+type Event struct {
+	// Type is EventCreated, EventRevoked or EventExpired.
+	Type string `json:"type"`
+	// SessionID is the Cloudflare session the event is about.
+	SessionID string `json:"sessionID"`
+}
+
+var received = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cloudflare_session_events_received_total",
+	Help: "Number of session lifecycle events received, by type and result (accepted, rejected, failed).",
+}, []string{"type", "result"})
+
+func init() {
+	metrics.Registry.MustRegister(received)
+}
+
+var log = ctrl.Log.WithName("session-events")
+
+// Handler verifies and decodes events and passes them to Notify.
+type Handler struct {
+	// Secret is the HMAC key shared with the sender.
+	Secret []byte
+	// Notify requeues the bindings of the event's session and returns how
+	// many there are.
+	Notify func(ctx context.Context, event Event) (int, error)
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxBodyBytes+1))
+	if err != nil {
+		http.Error(w, "reading body failed", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxBodyBytes {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := h.verify(req.Header, body); err != nil {
+		log.Info("rejected unauthenticated session event", "remote", req.RemoteAddr, "reason", err.Error())
+		received.WithLabelValues("", "rejected").Inc()
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		received.WithLabelValues("", "rejected").Inc()
+		http.Error(w, "invalid event: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch {
+	case event.Type != EventCreated && event.Type != EventRevoked && event.Type != EventExpired:
+		received.WithLabelValues("", "rejected").Inc()
+		http.Error(w, fmt.Sprintf("unknown event type %q", event.Type), http.StatusBadRequest)
+		return
+	case event.SessionID == "":
+		received.WithLabelValues(event.Type, "rejected").Inc()
+		http.Error(w, "sessionID is empty", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), notifyTimeout)
+	defer cancel()
+	n, err := h.Notify(ctx, event)
+	if err != nil {
+		log.Error(err, "failed to requeue bindings for session event", "type", event.Type, "sessionID", event.SessionID)
+		received.WithLabelValues(event.Type, "failed").Inc()
+		http.Error(w, "event not processed, retry later", http.StatusServiceUnavailable)
+		return
+	}
+	log.V(1).Info("session event received", "type", event.Type, "sessionID", event.SessionID, "bindings", n)
+	received.WithLabelValues(event.Type, "accepted").Inc()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]int{"bindings": n})
+}
+
+func (h *Handler) verify(header http.Header, body []byte) error {
+	timestamp := header.Get(TimestampHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or invalid %s", TimestampHeader)
+	}
+	now := time.Now
+	if h.Now != nil {
+		now = h.Now
+	}
+	if skew := now().Sub(time.Unix(seconds, 0)); skew > MaxClockSkew || skew < -MaxClockSkew {
+		return fmt.Errorf("timestamp %s outside the allowed clock skew", timestamp)
+	}
+	signature, ok := strings.CutPrefix(header.Get(SignatureHeader), "sha256=")
+	if !ok {
+		return fmt.Errorf("missing or invalid %s", SignatureHeader)
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(got, mac(h.Secret, timestamp, body)) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// Sign returns the SignatureHeader value for body sent with the
+// TimestampHeader value timestamp.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	return "sha256=" + hex.EncodeToString(mac(secret, timestamp, body))
+}
+
+func mac(secret []byte, timestamp string, body []byte) []byte {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(timestamp))
+	m.Write([]byte("."))
+	m.Write(body)
+	return m.Sum(nil)
+}
+
+// Server serves Handler on Addr until its manager stops. It runs on every
+// replica, not only the leader; on the others Notify cannot hand events
+// over and the sender gets a 503 to retry.
+type Server struct {
+	Addr    string
+	Handler http.Handler
+	// CertFile and KeyFile, when both set, serve HTTPS.
+	CertFile string
+	KeyFile  string
+}
+
+// Start implements manager.Runnable.
+func (s *Server) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle("/events", s.Handler)
+	srv := &http.Server{Addr: s.Addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	errs := make(chan error, 1)
+	go func() {
+		log.Info("serving session events", "addr", s.Addr, "tls", s.CertFile != "")
+		if s.CertFile != "" && s.KeyFile != "" {
+			errs <- srv.ListenAndServeTLS(s.CertFile, s.KeyFile)
+		} else {
+			errs <- srv.ListenAndServe()
+		}
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
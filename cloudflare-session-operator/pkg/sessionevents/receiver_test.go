@@ -0,0 +1,89 @@
+package sessionevents
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("shared-secret")
+
+func TestHandler(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	signedAt := strconv.FormatInt(now.Unix(), 10)
+	valid := `{"type":"revoked","sessionID":"s1"}`
+
+	for _, tc := range []struct {
+		name      string
+		method    string
+		body      string
+		timestamp string
+		signature string
+		notifyErr error
+		want      int
+		notified  bool
+	}{
+		{name: "accepted", body: valid, want: http.StatusAccepted, notified: true},
+		{name: "wrong method", method: http.MethodGet, body: valid, want: http.StatusMethodNotAllowed},
+		{name: "bad signature", body: valid, signature: Sign([]byte("other-secret"), signedAt, []byte(valid)), want: http.StatusUnauthorized},
+		{name: "signature not hex", body: valid, signature: "sha256=zz", want: http.StatusUnauthorized},
+		{name: "signature without scheme", body: valid, signature: strings.TrimPrefix(Sign(testSecret, signedAt, []byte(valid)), "sha256="), want: http.StatusUnauthorized},
+		{name: "body changed after signing", body: `{"type":"revoked","sessionID":"s2"}`, signature: Sign(testSecret, signedAt, []byte(valid)), want: http.StatusUnauthorized},
+		{name: "missing timestamp", body: valid, timestamp: "-", want: http.StatusUnauthorized},
+		{name: "old timestamp", body: valid, timestamp: strconv.FormatInt(now.Add(-MaxClockSkew-time.Second).Unix(), 10), want: http.StatusUnauthorized},
+		{name: "future timestamp", body: valid, timestamp: strconv.FormatInt(now.Add(MaxClockSkew+time.Second).Unix(), 10), want: http.StatusUnauthorized},
+		{name: "timestamp within skew", body: valid, timestamp: strconv.FormatInt(now.Add(-MaxClockSkew).Unix(), 10), want: http.StatusAccepted, notified: true},
+		{name: "oversized body", body: `{"type":"revoked","sessionID":"` + strings.Repeat("x", maxBodyBytes) + `"}`, want: http.StatusRequestEntityTooLarge},
+		{name: "unknown type", body: `{"type":"renamed","sessionID":"s1"}`, want: http.StatusBadRequest},
+		{name: "missing session", body: `{"type":"expired"}`, want: http.StatusBadRequest},
+		{name: "invalid JSON", body: `{"type":`, want: http.StatusBadRequest},
+		{name: "notify fails", body: valid, notifyErr: errors.New("not the leader"), want: http.StatusServiceUnavailable, notified: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var notified []Event
+			h := &Handler{
+				Secret: testSecret,
+				Now:    func() time.Time { return now },
+				Notify: func(_ context.Context, event Event) (int, error) {
+					notified = append(notified, event)
+					return 2, tc.notifyErr
+				},
+			}
+			method := tc.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			timestamp := tc.timestamp
+			if timestamp == "" {
+				timestamp = signedAt
+			}
+			signature := tc.signature
+			if signature == "" {
+				signature = Sign(testSecret, timestamp, []byte(tc.body))
+			}
+			req := httptest.NewRequest(method, "/events", strings.NewReader(tc.body))
+			if timestamp != "-" {
+				req.Header.Set(TimestampHeader, timestamp)
+			}
+			req.Header.Set(SignatureHeader, signature)
+			rec := httptest.NewRecorder()
+
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tc.want {
+				t.Fatalf("status = %d want %d, body %s", rec.Code, tc.want, rec.Body)
+			}
+			if got := len(notified) > 0; got != tc.notified {
+				t.Fatalf("notified = %v, want notified %t", notified, tc.notified)
+			}
+			if tc.want == http.StatusAccepted && strings.TrimSpace(rec.Body.String()) != `{"bindings":2}` {
+				t.Fatalf("body = %s", rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/operatorconfig"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// SessionIDLabelKey mirrors spec.sessionID on the binding so bindings can
+	// be selected by session with kubectl.
+	SessionIDLabelKey = "cloudflare.example.com/session-id"
+	// TargetDeploymentLabelKey mirrors spec.targetRef.name for Deployment targets.
+	TargetDeploymentLabelKey = "cloudflare.example.com/target-deployment"
+)
+
+// SessionBindingDefaulter fills in spec defaults at admission time so the
+// effective configuration is stored on the object instead of being implied by
+// controller code.
+type SessionBindingDefaulter struct {
+	// Settings supplies DefaultTTLSeconds, applied to bindings without
+	// spec.ttlSeconds; zero leaves such bindings without a TTL.
+	Settings *operatorconfig.Store
+}
+
+//+kubebuilder:webhook:path=/mutate-cloudflare-example-com-v1alpha1-sessionbinding,mutating=true,failurePolicy=fail,sideEffects=None,groups=cloudflare.example.com,resources=sessionbindings,verbs=create;update,versions=v1alpha1,name=msessionbinding.cloudflare.example.com,admissionReviewVersions=v1
+
+// SetupWithManager registers the defaulting webhook with the manager's webhook server.
+func (d *SessionBindingDefaulter) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&v1alpha1.SessionBinding{}).
+		WithDefaulter(d).
+		Complete()
+}
+
+// Default implements admission.CustomDefaulter.
+func (d *SessionBindingDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	binding, ok := obj.(*v1alpha1.SessionBinding)
+	if !ok {
+		return fmt.Errorf("expected a SessionBinding but got %T", obj)
+	}
+	logf.FromContext(ctx).V(1).Info("defaulting SessionBinding", "name", binding.Name)
+
+	if ttl := d.Settings.Get().DefaultTTLSeconds; binding.Spec.TTLSeconds == nil && ttl > 0 {
+		binding.Spec.TTLSeconds = &ttl
+	}
+
+	// Migrate the deprecated targetDeployment field to targetRef.
+	if binding.Spec.TargetRef == nil && binding.Spec.TargetDeployment != "" {
+		binding.Spec.TargetRef = &v1alpha1.TargetReference{Kind: v1alpha1.TargetKindDeployment, Name: binding.Spec.TargetDeployment}
+		binding.Spec.TargetDeployment = ""
+	}
+
+	setLabelIfValid(binding, SessionIDLabelKey, binding.Spec.SessionID)
+	if target := binding.Spec.Target(); target.Kind == v1alpha1.TargetKindDeployment {
+		setLabelIfValid(binding, TargetDeploymentLabelKey, target.Name)
+	}
+	return nil
+}
+
+// setLabelIfValid keeps the label in sync with value; values that are not
+// valid label values (session IDs may be arbitrary strings) are skipped.
+func setLabelIfValid(binding *v1alpha1.SessionBinding, key, value string) {
+	if value == "" || len(validation.IsValidLabelValue(value)) > 0 {
+		return
+	}
+	if binding.Labels == nil {
+		binding.Labels = map[string]string{}
+	}
+	binding.Labels[key] = value
+}
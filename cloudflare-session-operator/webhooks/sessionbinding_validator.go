@@ -0,0 +1,99 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Creme-ala-creme/cloudflare-session-operator/api/v1alpha1"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/index"
+	"github.com/Creme-ala-creme/cloudflare-session-operator/pkg/policy"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// SessionBindingValidator rejects bindings whose session ID is already
+// claimed by another active SessionBinding anywhere in the cluster; two
+// bindings for one session would fight over the same Cloudflare route. It
+// also rejects bindings a SessionPolicy denies.
+type SessionBindingValidator struct {
+	// Reader must be backed by a cache with the index.SessionIDField index.
+	Reader client.Reader
+}
+
+//+kubebuilder:webhook:path=/validate-cloudflare-example-com-v1alpha1-sessionbinding,mutating=false,failurePolicy=fail,sideEffects=None,groups=cloudflare.example.com,resources=sessionbindings,verbs=create;update,versions=v1alpha1,name=vsessionbinding.cloudflare.example.com,admissionReviewVersions=v1
+
+// SetupWithManager registers the validating webhook with the manager's webhook server.
+func (v *SessionBindingValidator) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&v1alpha1.SessionBinding{}).
+		WithValidator(v).
+		Complete()
+}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *SessionBindingValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	binding, ok := obj.(*v1alpha1.SessionBinding)
+	if !ok {
+		return nil, fmt.Errorf("expected a SessionBinding but got %T", obj)
+	}
+	if err := v.validateUniqueSession(ctx, binding); err != nil {
+		return nil, err
+	}
+	return nil, v.validatePolicy(ctx, binding)
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *SessionBindingValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	binding, ok := newObj.(*v1alpha1.SessionBinding)
+	if !ok {
+		return nil, fmt.Errorf("expected a SessionBinding but got %T", newObj)
+	}
+	if !binding.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+	if err := v.validateUniqueSession(ctx, binding); err != nil {
+		return nil, err
+	}
+	// Only spec changes are checked against policies, so status and
+	// metadata updates of bindings admitted earlier keep working.
+	if old, ok := oldObj.(*v1alpha1.SessionBinding); ok && equality.Semantic.DeepEqual(old.Spec, binding.Spec) {
+		return nil, nil
+	}
+	return nil, v.validatePolicy(ctx, binding)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *SessionBindingValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *SessionBindingValidator) validateUniqueSession(ctx context.Context, binding *v1alpha1.SessionBinding) error {
+	if binding.Spec.SessionID == "" {
+		return nil
+	}
+	others, err := index.ActiveBindingsForSession(ctx, v.Reader, binding.Spec.SessionID)
+	if err != nil {
+		return fmt.Errorf("check for duplicate sessionID: %w", err)
+	}
+	for _, other := range others {
+		if other.Namespace == binding.Namespace && other.Name == binding.Name {
+			continue
+		}
+		return fmt.Errorf("sessionID %q is already bound by SessionBinding %s/%s", binding.Spec.SessionID, other.Namespace, other.Name)
+	}
+	return nil
+}
+
+func (v *SessionBindingValidator) validatePolicy(ctx context.Context, binding *v1alpha1.SessionBinding) error {
+	violation, err := policy.Evaluate(ctx, v.Reader, binding)
+	if err != nil {
+		return fmt.Errorf("evaluate SessionPolicies: %w", err)
+	}
+	if violation != nil {
+		return violation
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/open-feature/go-sdk/openfeature"
+)
+
+// Fault injection for chaos experiments, driven by flagd so faults can be
+// switched on per environment (and targeted by path) without a redeploy:
+//   - chaos_latency_ms    (int)   delay added before handling the request
+//   - chaos_error_rate    (float) fraction of requests answered with 500
+//   - chaos_drop_rate     (float) fraction of connections aborted without a response
+// The middleware is only installed when CHAOS_ENABLED=true, and probe and
+// metrics endpoints are never faulted so experiments do not restart pods.
+
+func chaosMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if probePaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		evalCtx := openfeature.NewTargetlessEvaluationContext(map[string]any{
+			"path":   r.URL.Path,
+			"method": r.Method,
+		})
+
+		if ms, err := ofClient.IntValue(ctx, "chaos_latency_ms", 0, evalCtx); err == nil && ms > 0 {
+			recordFault("latency")
+			select {
+			case <-time.After(time.Duration(ms) * time.Millisecond):
+			case <-ctx.Done():
+				return
+			}
+		}
+		if rate, err := ofClient.FloatValue(ctx, "chaos_drop_rate", 0, evalCtx); err == nil && rate > 0 && rand.Float64() < rate {
+			recordFault("drop")
+			// Aborts the handler and closes the connection without writing a response.
+			panic(http.ErrAbortHandler)
+		}
+		if rate, err := ofClient.FloatValue(ctx, "chaos_error_rate", 0, evalCtx); err == nil && rate > 0 && rand.Float64() < rate {
+			recordFault("error")
+			http.Error(w, "injected fault", http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func recordFault(kind string) {
+	if mtr != nil {
+		mtr.chaosFaults.WithLabelValues(kind).Inc()
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/open-feature/go-sdk/openfeature/memprovider"
+)
+
+// setChaosFlags serves the chaos flags from memory for the rest of the test.
+func setChaosFlags(t *testing.T, latencyMS int64, errorRate, dropRate float64) {
+	t.Helper()
+	if err := openfeature.SetProviderAndWait(memprovider.NewInMemoryProvider(map[string]memprovider.InMemoryFlag{
+		"chaos_latency_ms": {
+			Key:            "chaos_latency_ms",
+			State:          memprovider.Enabled,
+			DefaultVariant: "on",
+			Variants:       map[string]interface{}{"on": latencyMS},
+		},
+		"chaos_error_rate": {
+			Key:            "chaos_error_rate",
+			State:          memprovider.Enabled,
+			DefaultVariant: "on",
+			Variants:       map[string]interface{}{"on": errorRate},
+		},
+		"chaos_drop_rate": {
+			Key:            "chaos_drop_rate",
+			State:          memprovider.Enabled,
+			DefaultVariant: "on",
+			Variants:       map[string]interface{}{"on": dropRate},
+		},
+	})); err != nil {
+		t.Fatalf("set provider: %v", err)
+	}
+	t.Cleanup(func() { openfeature.SetProvider(openfeature.NewNoopProvider()) })
+	ofClient = openfeature.NewClient("test")
+	mtr = nil
+}
+
+// serveChaos serves path through the chaos middleware and reports whether
+// the handler behind it ran and whether the connection was dropped.
+func serveChaos(ctx context.Context, path string) (rr *httptest.ResponseRecorder, served, dropped bool) {
+	h := chaosMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	rr = httptest.NewRecorder()
+	defer func() {
+		if v := recover(); v != nil {
+			if v != http.ErrAbortHandler {
+				panic(v)
+			}
+			dropped = true
+		}
+	}()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx))
+	return rr, served, dropped
+}
+
+func TestChaosMiddlewareWithoutFaults(t *testing.T) {
+	setChaosFlags(t, 0, 0, 0)
+
+	rr, served, dropped := serveChaos(context.Background(), "/")
+	if !served || dropped || rr.Code != http.StatusNoContent {
+		t.Fatalf("GET / served=%v dropped=%v status=%d, want it served untouched", served, dropped, rr.Code)
+	}
+}
+
+func TestChaosMiddlewareLatency(t *testing.T) {
+	setChaosFlags(t, 50, 0, 0)
+
+	start := time.Now()
+	rr, served, _ := serveChaos(context.Background(), "/")
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("GET / took %v, want at least the injected 50ms", elapsed)
+	}
+	if !served || rr.Code != http.StatusNoContent {
+		t.Fatalf("GET / served=%v status=%d, want it served after the delay", served, rr.Code)
+	}
+
+	// A request given up on during the delay is not handled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, served, _ := serveChaos(ctx, "/"); served {
+		t.Fatalf("handled a request cancelled during the injected delay")
+	}
+}
+
+func TestChaosMiddlewareErrorRate(t *testing.T) {
+	setChaosFlags(t, 0, 1, 0)
+
+	rr, served, _ := serveChaos(context.Background(), "/")
+	if served || rr.Code != http.StatusInternalServerError {
+		t.Fatalf("GET / served=%v status=%d, want an injected 500", served, rr.Code)
+	}
+}
+
+func TestChaosMiddlewareDropRate(t *testing.T) {
+	// Drops win over errors.
+	setChaosFlags(t, 0, 1, 1)
+
+	_, served, dropped := serveChaos(context.Background(), "/")
+	if served || !dropped {
+		t.Fatalf("GET / served=%v dropped=%v, want the connection aborted", served, dropped)
+	}
+}
+
+func TestChaosMiddlewareExemptsProbes(t *testing.T) {
+	setChaosFlags(t, 1000, 1, 1)
+
+	for path := range probePaths {
+		start := time.Now()
+		rr, served, dropped := serveChaos(context.Background(), path)
+		if !served || dropped || rr.Code != http.StatusNoContent || time.Since(start) > 500*time.Millisecond {
+			t.Errorf("GET %s served=%v dropped=%v status=%d, want it never faulted", path, served, dropped, rr.Code)
+		}
+	}
+}
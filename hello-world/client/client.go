@@ -0,0 +1,338 @@
+// Package client is a typed Go client for the hello-world HTTP API.
+//
+// Every call takes a context, propagates the caller's trace context, records
+// a client span, and retries transient failures (connection errors, 429 and
+// 5xx responses) with exponential backoff. All calls are safe to retry: the
+// admin flag endpoints set absolute values rather than applying deltas.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultBaseDelay  = 100 * time.Millisecond
+	defaultMaxDelay   = 2 * time.Second
+	defaultUserAgent  = "hello-world-client"
+)
+
+// FlagOverrides mirrors the admin override payload; nil fields are not
+// overridden.
+type FlagOverrides struct {
+	Tracing *bool `json:"tracing,omitempty"`
+	Metrics *bool `json:"metrics,omitempty"`
+}
+
+// FlagDefaults are the values used when neither an override nor the flag
+// provider decides.
+type FlagDefaults struct {
+	Tracing bool `json:"tracing"`
+	Metrics bool `json:"metrics"`
+}
+
+// FlagState is returned by GET /admin/flags.
+type FlagState struct {
+	Defaults  FlagDefaults  `json:"defaults"`
+	Overrides FlagOverrides `json:"overrides"`
+}
+
+// APIError is returned for non-2xx responses once retries are exhausted.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("hello-world API: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// IsStatus reports whether err is an APIError with the given status code.
+func IsStatus(err error, code int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == code
+}
+
+// Client talks to a single hello-world instance or service address.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	userAgent  string
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	tracer     trace.Tracer
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient replaces the default http.Client (10s timeout).
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithRetries sets how many times a failed call is retried (0 disables
+// retries) and the backoff bounds between attempts.
+func WithRetries(maxRetries int, baseDelay, maxDelay time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.baseDelay = baseDelay
+		c.maxDelay = maxDelay
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) { c.userAgent = ua }
+}
+
+// WithTracerProvider overrides the global OpenTelemetry tracer provider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *Client) { c.tracer = tp.Tracer("hello-world/client") }
+}
+
+// New returns a client for the API served at baseURL, e.g.
+// "http://hello-world.hello-world.svc:8080".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("parse base URL: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("base URL %q must be absolute", baseURL)
+	}
+	c := &Client{
+		baseURL:    u,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		userAgent:  defaultUserAgent,
+		maxRetries: defaultMaxRetries,
+		baseDelay:  defaultBaseDelay,
+		maxDelay:   defaultMaxDelay,
+		tracer:     otel.Tracer("hello-world/client"),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Hello returns the greeting served at /.
+func (c *Client) Hello(ctx context.Context) (string, error) {
+	body, err := c.do(ctx, http.MethodGet, "/", nil)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// Ready returns nil when /readyz reports the instance ready.
+func (c *Client) Ready(ctx context.Context) error {
+	_, err := c.do(ctx, http.MethodGet, "/readyz", nil)
+	return err
+}
+
+// Live returns nil when /livez reports the instance alive.
+func (c *Client) Live(ctx context.Context) error {
+	_, err := c.do(ctx, http.MethodGet, "/livez", nil)
+	return err
+}
+
+// Flags returns the flag defaults and active overrides. The admin endpoints
+// are only served when the instance runs with ADMIN_FLAGS_ENABLED=true;
+// otherwise the call fails with a 404 APIError.
+func (c *Client) Flags(ctx context.Context) (FlagState, error) {
+	var state FlagState
+	body, err := c.do(ctx, http.MethodGet, "/admin/flags", nil)
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(body, &state); err != nil {
+		return state, fmt.Errorf("decode flag state: %w", err)
+	}
+	return state, nil
+}
+
+// SetFlags applies the non-nil overrides and returns the resulting set.
+func (c *Client) SetFlags(ctx context.Context, ov FlagOverrides) (FlagOverrides, error) {
+	payload, err := json.Marshal(ov)
+	if err != nil {
+		return FlagOverrides{}, fmt.Errorf("encode overrides: %w", err)
+	}
+	return c.overrides(ctx, "/admin/flags", payload)
+}
+
+// ResetFlags clears all overrides.
+func (c *Client) ResetFlags(ctx context.Context) (FlagOverrides, error) {
+	return c.overrides(ctx, "/admin/flags/reset", nil)
+}
+
+func (c *Client) overrides(ctx context.Context, path string, payload []byte) (FlagOverrides, error) {
+	var resp struct {
+		Overrides FlagOverrides `json:"overrides"`
+	}
+	body, err := c.do(ctx, http.MethodPost, path, payload)
+	if err != nil {
+		return FlagOverrides{}, err
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return FlagOverrides{}, fmt.Errorf("decode overrides: %w", err)
+	}
+	return resp.Overrides, nil
+}
+
+// do performs the request, retrying transient failures, and returns the
+// body of the first 2xx response.
+func (c *Client) do(ctx context.Context, method, path string, payload []byte) ([]byte, error) {
+	ctx, span := c.tracer.Start(ctx, method+" "+path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", method),
+			attribute.String("url.path", path),
+			attribute.String("server.address", c.baseURL.Host),
+		))
+	defer span.End()
+
+	var lastErr error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, c.backoff(attempt, lastErr)); err != nil {
+				lastErr = err
+				break
+			}
+		}
+		body, retry, err := c.attempt(ctx, method, path, payload)
+		span.SetAttributes(attribute.Int("http.request.resend_count", attempt))
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+		if !retry {
+			break
+		}
+	}
+	var ra *retryAfterError
+	if errors.As(lastErr, &ra) {
+		lastErr = ra.APIError
+	}
+	span.RecordError(lastErr)
+	span.SetStatus(codes.Error, lastErr.Error())
+	return nil, lastErr
+}
+
+func (c *Client) attempt(ctx context.Context, method, path string, payload []byte) (body []byte, retry bool, err error) {
+	var reqBody io.Reader
+	if payload != nil {
+		reqBody = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL.String()+path, reqBody)
+	if err != nil {
+		return nil, false, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("Accept", "application/json, text/plain")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// Connection-level failures are retried unless the caller gave up.
+		return nil, ctx.Err() == nil, fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, fmt.Errorf("%s %s: read body: %w", method, path, err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return body, false, nil
+	}
+	apiErr := &APIError{StatusCode: resp.StatusCode, Message: errorMessage(body)}
+	return nil, retryable(resp.StatusCode), &retryAfterError{APIError: apiErr, after: retryAfter(resp.Header)}
+}
+
+// retryAfterError carries the server's Retry-After hint to the backoff
+// without exposing it to callers, who see the embedded APIError.
+type retryAfterError struct {
+	*APIError
+	after time.Duration
+}
+
+func (e *retryAfterError) Unwrap() error { return e.APIError }
+
+func (c *Client) backoff(attempt int, lastErr error) time.Duration {
+	var ra *retryAfterError
+	if errors.As(lastErr, &ra) && ra.after > 0 {
+		if ra.after > c.maxDelay {
+			return c.maxDelay
+		}
+		return ra.after
+	}
+	d := c.baseDelay << (attempt - 1)
+	if d <= 0 || d > c.maxDelay {
+		d = c.maxDelay
+	}
+	// Full jitter keeps a fleet of callers from retrying in lockstep.
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+func retryable(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+func retryAfter(h http.Header) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// errorMessage extracts {"error": "..."} bodies and falls back to plain text.
+func errorMessage(body []byte) string {
+	var e struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &e) == nil && e.Error != "" {
+		return e.Error
+	}
+	return strings.TrimSpace(string(body))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHelloRetriesTransientFailures(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("hello world"))
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, WithRetries(3, time.Millisecond, 5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Hello(context.Background())
+	if err != nil {
+		t.Fatalf("Hello: %v", err)
+	}
+	if got != "hello world" || calls.Load() != 3 {
+		t.Fatalf("got %q after %d calls", got, calls.Load())
+	}
+}
+
+func TestClientErrorIsNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "bad overrides"})
+	}))
+	defer srv.Close()
+
+	c, _ := New(srv.URL, WithRetries(3, time.Millisecond, 5*time.Millisecond))
+	tr := true
+	_, err := c.SetFlags(context.Background(), FlagOverrides{Tracing: &tr})
+	if !IsStatus(err, http.StatusBadRequest) {
+		t.Fatalf("SetFlags error = %v, want 400 APIError", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("4xx was retried: %d calls", calls.Load())
+	}
+}
+
+func TestFlagsDecodesState(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/admin/flags" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"defaults":{"tracing":true,"metrics":false},"overrides":{"metrics":true}}`))
+	}))
+	defer srv.Close()
+
+	c, _ := New(srv.URL + "/")
+	state, err := c.Flags(context.Background())
+	if err != nil {
+		t.Fatalf("Flags: %v", err)
+	}
+	if !state.Defaults.Tracing || state.Defaults.Metrics || state.Overrides.Metrics == nil || !*state.Overrides.Metrics || state.Overrides.Tracing != nil {
+		t.Fatalf("unexpected state %+v", state)
+	}
+}
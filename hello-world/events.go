@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Optional event publishing to a message broker. EVENTS_BROKER selects the
+// backend (nats or kafka; empty disables publishing). Every event is wrapped
+// in a versioned envelope so consumers can evolve with the payload schema;
+// bump the version passed to Emit whenever a payload changes incompatibly.
+
+const (
+	eventRequestCompleted = "http.request.completed"
+	eventFlagsChanged     = "flags.overrides.changed"
+)
+
+type eventEnvelope struct {
+	ID            string          `json:"id"`
+	Type          string          `json:"type"`
+	SchemaVersion int             `json:"schemaVersion"`
+	Source        string          `json:"source"`
+	Time          time.Time       `json:"time"`
+	TraceID       string          `json:"traceId,omitempty"`
+	Data          json.RawMessage `json:"data"`
+}
+
+type eventPublisher interface {
+	Publish(ctx context.Context, subject, key string, body []byte) error
+	// Close flushes buffered events and releases the connection.
+	Close(ctx context.Context) error
+}
+
+type eventEmitter struct {
+	pub    eventPublisher
+	prefix string
+	source string
+}
+
+// events is nil when publishing is disabled; Emit is safe to call on nil.
+var events *eventEmitter
+
+func newEventEmitterFromEnv() (*eventEmitter, error) {
+	broker := strings.ToLower(strings.TrimSpace(os.Getenv("EVENTS_BROKER")))
+	if broker == "" {
+		return nil, nil
+	}
+
+	var (
+		pub eventPublisher
+		err error
+	)
+	switch broker {
+	case "nats":
+		pub, err = newNATSPublisher(getenvDefault("NATS_URL", nats.DefaultURL))
+	case "kafka":
+		pub, err = newKafkaPublisher(strings.Split(getenvDefault("KAFKA_BROKERS", "localhost:9092"), ","))
+	default:
+		return nil, fmt.Errorf("unsupported EVENTS_BROKER %q (want nats or kafka)", broker)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &eventEmitter{
+		pub:    pub,
+		prefix: getenvDefault("EVENTS_SUBJECT_PREFIX", "hello-world"),
+		source: getenvDefault("OTEL_SERVICE_NAME", "hello-world"),
+	}, nil
+}
+
+// Emit publishes data as an event of the given type and schema version.
+// Publishing failures are counted and logged, never returned to callers.
+func (e *eventEmitter) Emit(ctx context.Context, eventType string, schemaVersion int, data any) {
+	if e == nil {
+		return
+	}
+	env, err := newEventEnvelope(ctx, eventType, schemaVersion, e.source, data)
+	if err != nil {
+		e.record(eventType, "encode_error")
+		log.Printf("event %s: %v", eventType, err)
+		return
+	}
+	e.publish(ctx, env)
+}
+
+func (e *eventEmitter) publish(ctx context.Context, env eventEnvelope) {
+	msg, err := json.Marshal(env)
+	if err != nil {
+		e.record(env.Type, "encode_error")
+		log.Printf("event %s: encode envelope: %v", env.Type, err)
+		return
+	}
+
+	subject := e.prefix + "." + env.Type
+	if err := e.pub.Publish(ctx, subject, env.ID, msg); err != nil {
+		e.record(env.Type, "error")
+		log.Printf("event %s: publish: %v", env.Type, err)
+		return
+	}
+	e.record(env.Type, "published")
+}
+
+func newEventEnvelope(ctx context.Context, eventType string, schemaVersion int, source string, data any) (eventEnvelope, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return eventEnvelope{}, fmt.Errorf("encode payload: %w", err)
+	}
+	env := eventEnvelope{
+		ID:            uuid.NewString(),
+		Type:          eventType,
+		SchemaVersion: schemaVersion,
+		Source:        source,
+		Time:          time.Now().UTC(),
+		Data:          body,
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		env.TraceID = sc.TraceID().String()
+	}
+	return env, nil
+}
+
+// emitDomainEvent fans a domain event out to the broker and to subscribed
+// webhooks, using the same envelope for both.
+func emitDomainEvent(ctx context.Context, eventType string, schemaVersion int, data any) {
+	if events == nil && webhooks == nil {
+		return
+	}
+	env, err := newEventEnvelope(ctx, eventType, schemaVersion, getenvDefault("OTEL_SERVICE_NAME", "hello-world"), data)
+	if err != nil {
+		log.Printf("event %s: %v", eventType, err)
+		return
+	}
+	if events != nil {
+		events.publish(ctx, env)
+	}
+	if err := webhooks.Dispatch(ctx, env); err != nil {
+		log.Printf("event %s: webhook dispatch: %v", eventType, err)
+	}
+}
+
+func (e *eventEmitter) Close(ctx context.Context) error {
+	if e == nil {
+		return nil
+	}
+	return e.pub.Close(ctx)
+}
+
+func (e *eventEmitter) record(eventType, outcome string) {
+	if mtr != nil {
+		mtr.eventsPublished.WithLabelValues(eventType, outcome).Inc()
+	}
+}
+
+// requestEvents emits an http.request.completed event for every request.
+func requestEvents(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		events.Emit(r.Context(), eventRequestCompleted, 1, map[string]any{
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"status":     rec.status,
+			"durationMs": time.Since(start).Milliseconds(),
+		})
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+type natsPublisher struct {
+	conn *nats.Conn
+}
+
+func newNATSPublisher(url string) (*natsPublisher, error) {
+	conn, err := nats.Connect(url,
+		nats.Name("hello-world"),
+		nats.MaxReconnects(-1),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			log.Printf("nats async error: %v", err)
+			if mtr != nil {
+				mtr.eventsPublished.WithLabelValues("unknown", "delivery_error").Inc()
+			}
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("connect to nats %s: %w", url, err)
+	}
+	return &natsPublisher{conn: conn}, nil
+}
+
+func (p *natsPublisher) Publish(_ context.Context, subject, _ string, body []byte) error {
+	return p.conn.Publish(subject, body)
+}
+
+func (p *natsPublisher) Close(ctx context.Context) error {
+	timeout := 5 * time.Second
+	if dl, ok := ctx.Deadline(); ok {
+		timeout = time.Until(dl)
+	}
+	err := p.conn.FlushTimeout(timeout)
+	p.conn.Close()
+	if err != nil {
+		return fmt.Errorf("flush nats: %w", err)
+	}
+	return nil
+}
+
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func newKafkaPublisher(brokers []string) (*kafkaPublisher, error) {
+	w := &kafka.Writer{
+		Addr:                   kafka.TCP(brokers...),
+		Balancer:               &kafka.Hash{},
+		Async:                  true,
+		AllowAutoTopicCreation: true,
+		Completion: func(msgs []kafka.Message, err error) {
+			if err == nil {
+				return
+			}
+			log.Printf("kafka delivery of %d events failed: %v", len(msgs), err)
+			if mtr != nil {
+				for _, m := range msgs {
+					mtr.eventsPublished.WithLabelValues(kafkaEventType(m), "delivery_error").Inc()
+				}
+			}
+		},
+	}
+	return &kafkaPublisher{writer: w}, nil
+}
+
+func (p *kafkaPublisher) Publish(ctx context.Context, topic, key string, body []byte) error {
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Topic: topic,
+		Key:   []byte(key),
+		Value: body,
+		Headers: []kafka.Header{
+			{Key: "content-type", Value: []byte("application/json")},
+		},
+	})
+}
+
+func kafkaEventType(m kafka.Message) string {
+	var env struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(m.Value, &env); err != nil || env.Type == "" {
+		return "unknown"
+	}
+	return env.Type
+}
+
+// Close blocks until buffered messages are written (kafka-go has no
+// context-aware close, so the deadline is enforced by the caller's timeout).
+func (p *kafkaPublisher) Close(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() { done <- p.writer.Close() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type publishedEvent struct {
+	subject, key string
+	body         []byte
+}
+
+type fakePublisher struct {
+	published []publishedEvent
+	err       error
+}
+
+func (p *fakePublisher) Publish(_ context.Context, subject, key string, body []byte) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.published = append(p.published, publishedEvent{subject: subject, key: key, body: body})
+	return nil
+}
+
+func (p *fakePublisher) Close(context.Context) error { return nil }
+
+func TestEventEnvelopeEncoding(t *testing.T) {
+	traceID := trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+	}))
+
+	env, err := newEventEnvelope(ctx, eventFlagsChanged, 2, "hello-world", map[string]bool{"tracing": true})
+	if err != nil {
+		t.Fatalf("newEventEnvelope: %v", err)
+	}
+	msg, err := json.Marshal(env)
+	if err != nil {
+		t.Fatalf("marshal envelope: %v", err)
+	}
+
+	var got map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &got); err != nil {
+		t.Fatalf("envelope is not a JSON object: %v", err)
+	}
+	for field, want := range map[string]string{
+		"type":          `"flags.overrides.changed"`,
+		"schemaVersion": `2`,
+		"source":        `"hello-world"`,
+		"traceId":       `"` + traceID.String() + `"`,
+		"data":          `{"tracing":true}`,
+	} {
+		if string(got[field]) != want {
+			t.Errorf("%s = %s want %s", field, got[field], want)
+		}
+	}
+	for _, field := range []string{"id", "time"} {
+		if _, ok := got[field]; !ok {
+			t.Errorf("envelope has no %s", field)
+		}
+	}
+	if len(got) != 7 {
+		t.Errorf("envelope has %d fields want 7: %s", len(got), msg)
+	}
+}
+
+func TestEventEnvelopeOmitsTraceIDWithoutSpan(t *testing.T) {
+	env, err := newEventEnvelope(context.Background(), eventRequestCompleted, 1, "hello-world", nil)
+	if err != nil {
+		t.Fatalf("newEventEnvelope: %v", err)
+	}
+	msg, err := json.Marshal(env)
+	if err != nil {
+		t.Fatalf("marshal envelope: %v", err)
+	}
+	var got map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &got); err != nil {
+		t.Fatalf("envelope is not a JSON object: %v", err)
+	}
+	if _, ok := got["traceId"]; ok {
+		t.Fatalf("envelope without a span has traceId: %s", msg)
+	}
+	if string(got["data"]) != "null" {
+		t.Fatalf("data = %s want null", got["data"])
+	}
+}
+
+func TestEventEmitterEmit(t *testing.T) {
+	mtr = nil
+
+	t.Run("publishes envelope under prefixed subject", func(t *testing.T) {
+		pub := &fakePublisher{}
+		e := &eventEmitter{pub: pub, prefix: "hello-world", source: "hello-world"}
+		e.Emit(context.Background(), eventRequestCompleted, 1, map[string]int{"status": 200})
+
+		if len(pub.published) != 1 {
+			t.Fatalf("published %d events want 1", len(pub.published))
+		}
+		got := pub.published[0]
+		if got.subject != "hello-world.http.request.completed" {
+			t.Fatalf("subject = %q", got.subject)
+		}
+		var env eventEnvelope
+		if err := json.Unmarshal(got.body, &env); err != nil {
+			t.Fatalf("decode envelope: %v", err)
+		}
+		if got.key != env.ID || env.ID == "" {
+			t.Fatalf("key = %q want the envelope id %q", got.key, env.ID)
+		}
+		if env.Type != eventRequestCompleted || env.SchemaVersion != 1 || string(env.Data) != `{"status":200}` {
+			t.Fatalf("envelope = %+v", env)
+		}
+	})
+
+	t.Run("drops unencodable payload", func(t *testing.T) {
+		pub := &fakePublisher{}
+		e := &eventEmitter{pub: pub, prefix: "hello-world"}
+		e.Emit(context.Background(), eventRequestCompleted, 1, make(chan int))
+		if len(pub.published) != 0 {
+			t.Fatalf("published %d events want 0", len(pub.published))
+		}
+	})
+
+	t.Run("swallows publish errors", func(t *testing.T) {
+		e := &eventEmitter{pub: &fakePublisher{err: errors.New("broker down")}, prefix: "hello-world"}
+		e.Emit(context.Background(), eventRequestCompleted, 1, nil)
+	})
+
+	t.Run("nil emitter is a no-op", func(t *testing.T) {
+		var e *eventEmitter
+		e.Emit(context.Background(), eventRequestCompleted, 1, nil)
+		if err := e.Close(context.Background()); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	})
+}
+
+func TestKafkaEventType(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  string
+	}{
+		{`{"type":"flags.overrides.changed","schemaVersion":1}`, eventFlagsChanged},
+		{`{"schemaVersion":1}`, "unknown"},
+		{`not json`, "unknown"},
+	} {
+		if got := kafkaEventType(kafka.Message{Value: []byte(tc.value)}); got != tc.want {
+			t.Errorf("kafkaEventType(%s) = %q want %q", tc.value, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/open-feature/go-sdk/openfeature"
+)
+
+// Experiment assignment: GET /experiments/{key}/assignment returns the variant
+// of flag "experiment_<key>" for the caller's targeting key
+// (X-Targeting-Key header or targetingKey query param). Bucketing is left to
+// the flag provider (flagd fractional targeting hashes the targeting key), so
+// the same key always lands in the same variant and server- and client-side
+// evaluations agree. Callers outside any rollout get "control". Exposures
+// are only counted for flags the provider resolved, so the experiment label
+// is bounded by the flags defined rather than by the keys requested.
+
+const defaultExperimentVariant = "control"
+
+var experimentKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+type experimentAssignment struct {
+	Experiment   string `json:"experiment"`
+	Variant      string `json:"variant"`
+	TargetingKey string `json:"targetingKey"`
+}
+
+func experimentAssignmentHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if !experimentKeyPattern.MatchString(key) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid experiment key"})
+		return
+	}
+	targetingKey := strings.TrimSpace(r.Header.Get("X-Targeting-Key"))
+	if targetingKey == "" {
+		targetingKey = strings.TrimSpace(r.URL.Query().Get("targetingKey"))
+	}
+	if targetingKey == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "targeting key required (X-Targeting-Key header or targetingKey query param)"})
+		return
+	}
+
+	variant, resolved := assignExperimentVariant(r.Context(), key, targetingKey)
+	if resolved && mtr != nil {
+		mtr.experimentExposures.WithLabelValues(key, variant).Inc()
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, experimentAssignment{
+		Experiment:   key,
+		Variant:      variant,
+		TargetingKey: targetingKey,
+	})
+}
+
+// assignExperimentVariant returns the variant for targetingKey and whether
+// the experiment's flag resolved, rather than falling back to the default
+// because it is missing or failed to evaluate.
+func assignExperimentVariant(ctx context.Context, key, targetingKey string) (string, bool) {
+	evalCtx := openfeature.NewEvaluationContext(targetingKey, map[string]any{"experiment": key})
+	details, err := ofClient.StringValueDetails(ctx, "experiment_"+key, defaultExperimentVariant, evalCtx)
+	if err != nil || details.Reason == openfeature.ErrorReason || details.Reason == openfeature.DefaultReason || details.Value == "" {
+		return defaultExperimentVariant, false
+	}
+	return details.Value, true
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/open-feature/go-sdk/openfeature/memprovider"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// bucketByTargetingKey stands in for flagd fractional targeting: it hashes
+// the targeting key into one of the flag's variants.
+func bucketByTargetingKey(flag memprovider.InMemoryFlag, evalCtx openfeature.FlattenedContext) (interface{}, openfeature.ProviderResolutionDetail) {
+	key, _ := evalCtx[openfeature.TargetingKey].(string)
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	variant := "control"
+	if h.Sum32()%2 == 1 {
+		variant = "treatment"
+	}
+	return flag.Variants[variant], openfeature.ProviderResolutionDetail{Reason: openfeature.SplitReason, Variant: variant}
+}
+
+func TestExperimentAssignment(t *testing.T) {
+	evaluator := bucketByTargetingKey
+	if err := openfeature.SetProviderAndWait(memprovider.NewInMemoryProvider(map[string]memprovider.InMemoryFlag{
+		"experiment_checkout": {
+			Key:              "experiment_checkout",
+			State:            memprovider.Enabled,
+			DefaultVariant:   "control",
+			Variants:         map[string]interface{}{"control": "control", "treatment": "treatment"},
+			ContextEvaluator: &evaluator,
+		},
+	})); err != nil {
+		t.Fatalf("set provider: %v", err)
+	}
+	defer openfeature.SetProvider(openfeature.NewNoopProvider())
+	ofClient = openfeature.NewClient("test")
+	exposures := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "experiment_exposures_total"}, []string{"experiment", "variant"})
+	mtr = &appMetrics{experimentExposures: exposures}
+	defer func() { mtr = nil }()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /experiments/{key}/assignment", experimentAssignmentHandler)
+	assign := func(t *testing.T, path string, header string) experimentAssignment {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if header != "" {
+			req.Header.Set("X-Targeting-Key", header)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s status = %d body %s", path, rec.Code, rec.Body)
+		}
+		var got experimentAssignment
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return got
+	}
+
+	variants := map[string]bool{}
+	for _, user := range []string{"user-1", "user-2", "user-3", "user-4", "user-5", "user-6"} {
+		first := assign(t, "/experiments/checkout/assignment", user)
+		for i := 0; i < 3; i++ {
+			if again := assign(t, "/experiments/checkout/assignment?targetingKey="+user, ""); again.Variant != first.Variant {
+				t.Fatalf("user %s assigned %q then %q", user, first.Variant, again.Variant)
+			}
+		}
+		variants[first.Variant] = true
+	}
+	if !variants["control"] || !variants["treatment"] {
+		t.Fatalf("assignments did not use both variants: %v", variants)
+	}
+
+	for _, key := range []string{"unknown", "made-up-1", "made-up-2"} {
+		if got := assign(t, "/experiments/"+key+"/assignment", "user-1"); got.Variant != defaultExperimentVariant {
+			t.Fatalf("unknown experiment %s variant = %q want %q", key, got.Variant, defaultExperimentVariant)
+		}
+	}
+	if got := countSeries(exposures); got != len(variants) {
+		t.Fatalf("exposure series = %d want %d, one per variant of the defined experiment", got, len(variants))
+	}
+}
+
+func countSeries(c prometheus.Collector) int {
+	ch := make(chan prometheus.Metric, 16)
+	c.Collect(ch)
+	close(ch)
+	return len(ch)
+}
+
+func TestExperimentAssignmentRejectsInvalidRequests(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /experiments/{key}/assignment", experimentAssignmentHandler)
+	for _, tc := range []struct{ path, targetingKey string }{
+		{"/experiments/Bad.Key/assignment", "user-1"},
+		{"/experiments/checkout/assignment", ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.targetingKey != "" {
+			req.Header.Set("X-Targeting-Key", tc.targetingKey)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s status = %d want 400", tc.path, rec.Code)
+		}
+	}
+}
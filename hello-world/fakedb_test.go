@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeDB is a database/sql driver for tests that records every statement
+// and answers queries with respond, so handlers can run without Postgres.
+type fakeDB struct {
+	respond func(query string, args []driver.Value) (*fakeRows, error)
+
+	mu         sync.Mutex
+	statements []fakeStatement
+}
+
+type fakeStatement struct {
+	query string
+	args  []driver.Value
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+var (
+	fakeDBs     sync.Map
+	fakeDBCount atomic.Int64
+)
+
+func init() {
+	sql.Register("fakedb", fakeDriver{})
+}
+
+func openFakeDB(t *testing.T, respond func(query string, args []driver.Value) (*fakeRows, error)) (*sql.DB, *fakeDB) {
+	t.Helper()
+	f := &fakeDB{respond: respond}
+	name := fmt.Sprintf("fakedb-%d", fakeDBCount.Add(1))
+	fakeDBs.Store(name, f)
+	db, err := sql.Open("fakedb", name)
+	if err != nil {
+		t.Fatalf("open fake db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		fakeDBs.Delete(name)
+	})
+	return db, f
+}
+
+// statementsLike returns the statements run whose query contains substr.
+func (f *fakeDB) statementsLike(substr string) []fakeStatement {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var matched []fakeStatement
+	for _, s := range f.statements {
+		if strings.Contains(s.query, substr) {
+			matched = append(matched, s)
+		}
+	}
+	return matched
+}
+
+func (f *fakeDB) run(query string, args []driver.NamedValue) (*fakeRows, error) {
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	f.mu.Lock()
+	f.statements = append(f.statements, fakeStatement{query: query, args: values})
+	f.mu.Unlock()
+	if f.respond == nil {
+		return &fakeRows{}, nil
+	}
+	rows, err := f.respond(query, values)
+	if rows == nil && err == nil {
+		rows = &fakeRows{}
+	}
+	return rows, err
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	f, ok := fakeDBs.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("fakedb: unknown database %q", name)
+	}
+	return &fakeConn{db: f.(*fakeDB)}, nil
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fakedb: prepared statements are not supported")
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fakedb: transactions are not supported")
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRowsCursor{rows: rows}, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	rows, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	if rows.columns != nil {
+		return driver.RowsAffected(len(rows.values)), nil
+	}
+	return driver.RowsAffected(1), nil
+}
+
+type fakeRowsCursor struct {
+	rows *fakeRows
+	next int
+}
+
+func (r *fakeRowsCursor) Columns() []string { return r.rows.columns }
+
+func (r *fakeRowsCursor) Close() error { return nil }
+
+func (r *fakeRowsCursor) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows.values) {
+		return io.EOF
+	}
+	copy(dest, r.rows.values[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/open-feature/go-sdk/openfeature"
+)
+
+// Per-route feature gates for dark launches. ROUTE_FEATURE_GATES maps routes
+// to boolean flags, e.g.
+//
+//	ROUTE_FEATURE_GATES="/graphql=graphql_api_enabled;/experiments/=experiments_api_enabled:403"
+//
+// A route ending in "/" gates every path below it, otherwise the path must
+// match exactly; the longest matching route wins. While the flag is off the
+// route answers 404 (or the status given after ":", 403 being the only other
+// choice). Gates fail closed: if the flag cannot be evaluated the route stays
+// dark. Probe and metrics endpoints cannot be gated.
+
+type routeGate struct {
+	route  string
+	flag   string
+	status int
+}
+
+func parseRouteGates(v string) ([]routeGate, error) {
+	var gates []routeGate
+	for _, entry := range strings.Split(v, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, flag, ok := strings.Cut(entry, "=")
+		route, flag = strings.TrimSpace(route), strings.TrimSpace(flag)
+		if !ok || !strings.HasPrefix(route, "/") || flag == "" {
+			return nil, fmt.Errorf("invalid ROUTE_FEATURE_GATES entry %q (want /route=flag[:status])", entry)
+		}
+		if probePaths[route] {
+			return nil, fmt.Errorf("route %s cannot be feature gated", route)
+		}
+		g := routeGate{route: route, flag: flag, status: http.StatusNotFound}
+		if name, code, ok := strings.Cut(flag, ":"); ok {
+			status, err := strconv.Atoi(code)
+			if err != nil || (status != http.StatusNotFound && status != http.StatusForbidden) {
+				return nil, fmt.Errorf("invalid status in ROUTE_FEATURE_GATES entry %q (want 404 or 403)", entry)
+			}
+			g.flag, g.status = name, status
+		}
+		gates = append(gates, g)
+	}
+	// Longest route first so the most specific gate matches.
+	sort.SliceStable(gates, func(i, j int) bool { return len(gates[i].route) > len(gates[j].route) })
+	return gates, nil
+}
+
+func matchRouteGate(gates []routeGate, path string) (routeGate, bool) {
+	for _, g := range gates {
+		if g.route == path || (strings.HasSuffix(g.route, "/") && strings.HasPrefix(path, g.route)) {
+			return g, true
+		}
+	}
+	return routeGate{}, false
+}
+
+func featureGateMiddleware(gates []routeGate, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if probePaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		g, ok := matchRouteGate(gates, r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		evalCtx := openfeature.NewTargetlessEvaluationContext(map[string]any{
+			"path":   r.URL.Path,
+			"method": r.Method,
+		})
+		enabled, err := ofClient.BooleanValue(r.Context(), g.flag, false, evalCtx)
+		if err != nil || !enabled {
+			if mtr != nil {
+				mtr.featureGateRejections.WithLabelValues(g.route, g.flag).Inc()
+			}
+			if g.status == http.StatusForbidden {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "feature disabled"})
+				return
+			}
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/open-feature/go-sdk/openfeature/memprovider"
+)
+
+func TestParseRouteGates(t *testing.T) {
+	gates, err := parseRouteGates("/graphql=graphql_api_enabled; /experiments/=experiments_api_enabled:403 ;/experiments/beta/=beta_enabled")
+	if err != nil {
+		t.Fatalf("parseRouteGates: %v", err)
+	}
+
+	cases := []struct {
+		path   string
+		flag   string
+		status int
+	}{
+		{"/graphql", "graphql_api_enabled", http.StatusNotFound},
+		{"/experiments/checkout/assignment", "experiments_api_enabled", http.StatusForbidden},
+		{"/experiments/beta/x", "beta_enabled", http.StatusNotFound},
+		{"/graphql/extra", "", 0},
+		{"/", "", 0},
+	}
+	for _, tc := range cases {
+		g, ok := matchRouteGate(gates, tc.path)
+		if ok != (tc.flag != "") || g.flag != tc.flag || g.status != tc.status {
+			t.Errorf("match(%s) = %+v, %v; want flag %q status %d", tc.path, g, ok, tc.flag, tc.status)
+		}
+	}
+}
+
+func TestParseRouteGatesRejectsInvalidEntries(t *testing.T) {
+	for _, v := range []string{"graphql=flag", "/graphql=", "/graphql=flag:500", "/readyz=flag"} {
+		if _, err := parseRouteGates(v); err == nil {
+			t.Errorf("parseRouteGates(%q) succeeded, want error", v)
+		}
+	}
+}
+
+func TestFeatureGateMiddleware(t *testing.T) {
+	if err := openfeature.SetProviderAndWait(memprovider.NewInMemoryProvider(map[string]memprovider.InMemoryFlag{
+		"site_enabled": {
+			Key:            "site_enabled",
+			State:          memprovider.Enabled,
+			DefaultVariant: "off",
+			Variants:       map[string]interface{}{"on": true, "off": false},
+		},
+		"beta_enabled": {
+			Key:            "beta_enabled",
+			State:          memprovider.Enabled,
+			DefaultVariant: "on",
+			Variants:       map[string]interface{}{"on": true, "off": false},
+		},
+	})); err != nil {
+		t.Fatalf("set provider: %v", err)
+	}
+	defer openfeature.SetProvider(openfeature.NewNoopProvider())
+	ofClient = openfeature.NewClient("test")
+	mtr = nil
+
+	gates, err := parseRouteGates("/=site_enabled;/beta/=beta_enabled;/graphql=missing_flag:403")
+	if err != nil {
+		t.Fatalf("parseRouteGates: %v", err)
+	}
+	h := featureGateMiddleware(gates, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	cases := []struct {
+		path string
+		want int
+	}{
+		{"/", http.StatusNotFound},
+		{"/beta/x", http.StatusNoContent},
+		{"/graphql", http.StatusForbidden},
+		// A "/" gate covers every route, but never the probes.
+		{"/livez", http.StatusNoContent},
+		{"/readyz", http.StatusNoContent},
+		{"/metrics", http.StatusNoContent},
+	}
+	for _, tc := range cases {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if rr.Code != tc.want {
+			t.Errorf("GET %s status = %d want %d", tc.path, rr.Code, tc.want)
+		}
+	}
+}
@@ -138,6 +138,7 @@ func adminFlagsHandler(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		overridesValue.Store(ov)
+		emitDomainEvent(r.Context(), eventFlagsChanged, 1, map[string]any{"overrides": ov})
 		writeJSON(w, http.StatusOK, map[string]any{"overrides": ov})
 		return
 	default:
@@ -152,6 +153,7 @@ func adminFlagsResetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	overridesValue.Store(flagOverrides{})
+	emitDomainEvent(r.Context(), eventFlagsChanged, 1, map[string]any{"overrides": flagOverrides{}})
 	writeJSON(w, http.StatusOK, map[string]any{"overrides": overridesValue.Load()})
 }
 
@@ -3,14 +3,21 @@ module hello-world
 go 1.22
 
 require (
+    github.com/getkin/kin-openapi v0.123.0
     github.com/golang-migrate/migrate/v4 v4.17.0
+    github.com/google/uuid v1.6.0
+    github.com/graphql-go/graphql v0.8.1
     github.com/lib/pq v1.10.9
+    github.com/nats-io/nats.go v1.31.0
     github.com/prometheus/client_golang v1.17.0
+    github.com/robfig/cron/v3 v3.0.1
+    github.com/segmentio/kafka-go v0.4.47
     github.com/open-feature/flagd-go-sdk v0.12.0
     github.com/open-feature/go-sdk/openfeature v1.14.0
     go.opentelemetry.io/otel v1.38.0
     go.opentelemetry.io/otel/exporters/otlp/otlptrace v1.38.0
     go.opentelemetry.io/otel/sdk v1.38.0
+    golang.org/x/sync v0.11.0
 )
 
 require (
@@ -21,7 +28,6 @@ require (
         github.com/go-logr/logr v1.4.3 // indirect
         github.com/go-logr/stdr v1.2.2 // indirect
         github.com/golang/protobuf v1.5.4 // indirect
-        github.com/google/uuid v1.6.0 // indirect
         github.com/grpc-ecosystem/grpc-gateway/v2 v2.27.2 // indirect
         github.com/hashicorp/errwrap v1.1.0 // indirect
         github.com/hashicorp/go-multierror v1.1.1 // indirect
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Optional GraphQL surface (enable with GRAPHQL_ENABLED=true) exposing the
+// greeting and read-only flag state. Queries are rejected before execution
+// when their selection count exceeds GRAPHQL_MAX_COMPLEXITY.
+
+const defaultGraphQLMaxComplexity = 50
+
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+type graphQLHandler struct {
+	schema        graphql.Schema
+	maxComplexity int
+}
+
+func newGraphQLHandler(maxComplexity int) (*graphQLHandler, error) {
+	schema, err := newGraphQLSchema()
+	if err != nil {
+		return nil, fmt.Errorf("build graphql schema: %w", err)
+	}
+	if maxComplexity <= 0 {
+		maxComplexity = defaultGraphQLMaxComplexity
+	}
+	return &graphQLHandler{schema: schema, maxComplexity: maxComplexity}, nil
+}
+
+func newGraphQLSchema() (graphql.Schema, error) {
+	flagsType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Flags",
+		Description: "Effective feature flag values for the request, plus any admin overrides.",
+		Fields: graphql.Fields{
+			"tracing": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return isTracingEnabled(p.Context), nil
+				},
+			},
+			"metrics": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return isMetricsEnabled(p.Context), nil
+				},
+			},
+			"tracingOverride": &graphql.Field{
+				Type: graphql.Boolean,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					if ov := overridesValue.Load().(flagOverrides); ov.Tracing != nil {
+						return *ov.Tracing, nil
+					}
+					return nil, nil
+				},
+			},
+			"metricsOverride": &graphql.Field{
+				Type: graphql.Boolean,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					if ov := overridesValue.Load().(flagOverrides); ov.Metrics != nil {
+						return *ov.Metrics, nil
+					}
+					return nil, nil
+				},
+			},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"hello": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return "hello world", nil
+				},
+			},
+			"flags": &graphql.Field{
+				Type: graphql.NewNonNull(flagsType),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return struct{}{}, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+func (h *graphQLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if isTracingEnabled(ctx) {
+		var span trace.Span
+		ctx, span = otel.Tracer("hello-world").Start(ctx, "graphQLHandler")
+		defer span.End()
+	}
+
+	start := time.Now()
+	status := h.serve(w, r.WithContext(ctx))
+	dur := time.Since(start).Seconds()
+	if isMetricsEnabled(ctx) && mtr != nil {
+		mtr.reqCount.WithLabelValues("/graphql", r.Method, strconv.Itoa(status)).Inc()
+		mtr.reqDuration.WithLabelValues("/graphql", r.Method).Observe(dur)
+	}
+	logWithTraceID(ctx, fmt.Sprintf("Handled /graphql request from %s in %.4fs", r.RemoteAddr, dur))
+}
+
+func (h *graphQLHandler) serve(w http.ResponseWriter, r *http.Request) int {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return http.StatusMethodNotAllowed
+	}
+
+	var req graphQLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return writeGraphQLError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+	if err != nil {
+		return writeGraphQLError(w, http.StatusBadRequest, err.Error())
+	}
+	if c := queryComplexity(doc); c > h.maxComplexity {
+		return writeGraphQLError(w, http.StatusBadRequest, fmt.Sprintf("query complexity %d exceeds limit %d", c, h.maxComplexity))
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        r.Context(),
+	})
+	writeJSON(w, http.StatusOK, result)
+	return http.StatusOK
+}
+
+func writeGraphQLError(w http.ResponseWriter, code int, msg string) int {
+	writeJSON(w, code, map[string]any{
+		"errors": []map[string]string{{"message": msg}},
+	})
+	return code
+}
+
+// queryComplexity counts the field selections a document would resolve,
+// expanding fragment spreads so that fragments cannot hide work.
+func queryComplexity(doc *ast.Document) int {
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, def := range doc.Definitions {
+		if f, ok := def.(*ast.FragmentDefinition); ok && f.Name != nil {
+			fragments[f.Name.Value] = f
+		}
+	}
+
+	var count func(set *ast.SelectionSet, visiting map[string]bool) int
+	count = func(set *ast.SelectionSet, visiting map[string]bool) int {
+		if set == nil {
+			return 0
+		}
+		total := 0
+		for _, sel := range set.Selections {
+			switch s := sel.(type) {
+			case *ast.Field:
+				total += 1 + count(s.SelectionSet, visiting)
+			case *ast.InlineFragment:
+				total += count(s.SelectionSet, visiting)
+			case *ast.FragmentSpread:
+				name := s.Name.Value
+				frag, ok := fragments[name]
+				if !ok || visiting[name] {
+					continue
+				}
+				visiting[name] = true
+				total += count(frag.SelectionSet, visiting)
+				delete(visiting, name)
+			}
+		}
+		return total
+	}
+
+	total := 0
+	for _, def := range doc.Definitions {
+		if op, ok := def.(*ast.OperationDefinition); ok {
+			total += count(op.SelectionSet, map[string]bool{})
+		}
+	}
+	return total
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/open-feature/go-sdk/openfeature"
+)
+
+func TestGraphQLHandler(t *testing.T) {
+	defaultTracing.Store(false)
+	defaultMetrics.Store(true)
+	overridesValue.Store(flagOverrides{})
+	openfeature.SetProvider(openfeature.NewNoopProvider())
+	ofClient = openfeature.NewClient("test")
+	mtr = nil
+
+	h, err := newGraphQLHandler(5)
+	if err != nil {
+		t.Fatalf("newGraphQLHandler: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		wantBody string
+	}{
+		{name: "hello", query: `{ hello }`, wantCode: http.StatusOK, wantBody: `"hello":"hello world"`},
+		{name: "flags", query: `{ flags { tracing metrics tracingOverride } }`, wantCode: http.StatusOK, wantBody: `"metrics":true`},
+		{name: "fragments count toward limit", query: `query { flags { ...f } hello } fragment f on Flags { tracing metrics tracingOverride metricsOverride }`, wantCode: http.StatusBadRequest, wantBody: "exceeds limit"},
+		{name: "syntax error", query: `{ hello `, wantCode: http.StatusBadRequest, wantBody: "errors"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(graphQLRequest{Query: tt.query})
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body))))
+			if rr.Code != tt.wantCode {
+				t.Fatalf("status = %d want %d (body %s)", rr.Code, tt.wantCode, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Fatalf("body %s does not contain %s", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Process lifecycle: every long-lived piece of main (HTTP server, background
+// monitors, worker pool, queue, scheduler, publishers, database) is registered
+// as a component. Run starts the components' run functions in an errgroup;
+// the first failure or a shutdown signal cancels the group, after which the
+// components are stopped in reverse registration order, each bounded by its
+// own timeout. Register dependencies before the things that use them.
+
+type component struct {
+	name string
+	// run blocks until ctx is cancelled or the component fails; nil for
+	// components that are started eagerly and only need stopping.
+	run func(ctx context.Context) error
+	// stop releases the component; it is called even if run failed.
+	stop        func(ctx context.Context) error
+	stopTimeout time.Duration
+}
+
+type lifecycle struct {
+	components []component
+}
+
+func (l *lifecycle) Add(c component) {
+	if c.stopTimeout <= 0 {
+		c.stopTimeout = 5 * time.Second
+	}
+	l.components = append(l.components, c)
+}
+
+// Run blocks until ctx is cancelled or a component fails, then shuts every
+// component down. It returns the first component error, if any.
+func (l *lifecycle) Run(ctx context.Context) error {
+	g, gctx := errgroup.WithContext(ctx)
+	for _, c := range l.components {
+		if c.run == nil {
+			continue
+		}
+		c := c
+		g.Go(func() error {
+			if err := c.run(gctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("lifecycle: %s failed: %v", c.name, err)
+				return fmt.Errorf("%s: %w", c.name, err)
+			}
+			return nil
+		})
+	}
+	g.Go(func() error {
+		<-gctx.Done()
+		if ctx.Err() != nil {
+			log.Printf("lifecycle: shutdown requested, stopping components")
+		}
+		l.shutdown()
+		return nil
+	})
+	return g.Wait()
+}
+
+func (l *lifecycle) shutdown() {
+	for i := len(l.components) - 1; i >= 0; i-- {
+		c := l.components[i]
+		if c.stop == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), c.stopTimeout)
+		start := time.Now()
+		if err := c.stop(ctx); err != nil {
+			log.Printf("lifecycle: stop %s: %v", c.name, err)
+		} else {
+			log.Printf("lifecycle: stopped %s in %s", c.name, time.Since(start).Round(time.Millisecond))
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLifecycleStopsInReverseOrderAfterFailure(t *testing.T) {
+	var stopped []string
+	stopFn := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			stopped = append(stopped, name)
+			return nil
+		}
+	}
+
+	var lc lifecycle
+	lc.Add(component{name: "database", stop: stopFn("database")})
+	lc.Add(component{name: "worker pool", stop: stopFn("worker pool")})
+	lc.Add(component{
+		name: "server",
+		run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		},
+		stop: stopFn("server"),
+	})
+	boom := errors.New("boom")
+	lc.Add(component{name: "monitor", run: func(context.Context) error { return boom }})
+
+	done := make(chan error, 1)
+	go func() { done <- lc.Run(context.Background()) }()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, boom) {
+			t.Fatalf("Run = %v, want wrapped boom", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after a component failed")
+	}
+	if want := []string{"server", "worker pool", "database"}; !reflect.DeepEqual(stopped, want) {
+		t.Fatalf("stop order = %v, want %v", stopped, want)
+	}
+}
+
+func TestLifecycleCancelIsNotAnError(t *testing.T) {
+	var lc lifecycle
+	lc.Add(component{name: "server", run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := lc.Run(ctx); err != nil {
+		t.Fatalf("Run = %v, want nil on shutdown signal", err)
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -30,14 +32,48 @@ import (
 type appMetrics struct {
 	reqCount    *prometheus.CounterVec
 	reqDuration *prometheus.HistogramVec
+
+	poolQueueDepth    *prometheus.GaugeVec
+	poolTaskWait      *prometheus.HistogramVec
+	poolTaskDuration  *prometheus.HistogramVec
+	poolTasksRejected *prometheus.CounterVec
+
+	jobRuns        *prometheus.CounterVec
+	jobDuration    *prometheus.HistogramVec
+	jobLastSuccess *prometheus.GaugeVec
+	ordersByStatus *prometheus.GaugeVec
+
+	queueTasks *prometheus.CounterVec
+
+	eventsPublished *prometheus.CounterVec
+
+	experimentExposures *prometheus.CounterVec
+
+	chaosFaults *prometheus.CounterVec
+
+	warmupDuration *prometheus.GaugeVec
+
+	featureGateRejections *prometheus.CounterVec
+
+	sessionRejections *prometheus.CounterVec
 }
 
 var (
 	mtr *appMetrics
 )
 
+// probePaths are the probe and metrics endpoints, which the chaos, session
+// guard and feature gate middlewares leave alone so they never restart or
+// hide a pod.
+var probePaths = map[string]bool{
+	"/livez":   true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
 type dependencyChecker struct {
-	db *sql.DB
+	db     *sql.DB
+	warmup *warmup
 }
 
 func (c dependencyChecker) pingDatabase(ctx context.Context) error {
@@ -53,6 +89,10 @@ func (c dependencyChecker) pingDatabase(ctx context.Context) error {
 }
 
 func (c dependencyChecker) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	if !c.warmup.Ready() {
+		http.Error(w, "not ready: warming up", http.StatusServiceUnavailable)
+		return
+	}
 	if err := c.pingDatabase(r.Context()); err != nil {
 		http.Error(w, fmt.Sprintf("not ready: %v", err), http.StatusServiceUnavailable)
 		return
@@ -85,8 +125,131 @@ func enableMetrics() *appMetrics {
 		},
 		[]string{"handler", "method"},
 	)
-	prometheus.MustRegister(mc, mh)
-	return &appMetrics{reqCount: mc, reqDuration: mh}
+	pq := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "worker_pool_queue_depth",
+			Help: "Number of tasks waiting in a worker pool queue.",
+		},
+		[]string{"pool"},
+	)
+	pw := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "worker_pool_task_wait_seconds",
+			Help: "Time tasks spent queued before a worker picked them up.",
+		},
+		[]string{"pool", "task"},
+	)
+	pd := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "worker_pool_task_duration_seconds",
+			Help: "Histogram of task run time, labeled by outcome (ok, error, panic).",
+		},
+		[]string{"pool", "task", "outcome"},
+	)
+	pr := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "worker_pool_tasks_rejected_total",
+			Help: "Count of tasks rejected because the pool queue was full.",
+		},
+		[]string{"pool"},
+	)
+	jr := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "scheduled_job_runs_total",
+			Help: "Count of scheduled job triggers, labeled by outcome (ok, error, skipped_overlap, skipped_not_leader, rejected).",
+		},
+		[]string{"job", "outcome"},
+	)
+	jd := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "scheduled_job_duration_seconds",
+			Help: "Histogram of scheduled job run time.",
+		},
+		[]string{"job"},
+	)
+	jl := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "scheduled_job_last_success_timestamp_seconds",
+			Help: "Unix time of the last successful run of a scheduled job.",
+		},
+		[]string{"job"},
+	)
+	ob := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "orders_by_status",
+			Help: "Number of orders per status, refreshed by the orders_stats job.",
+		},
+		[]string{"status"},
+	)
+	qt := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "task_queue_tasks_total",
+			Help: "Count of task queue events, labeled by kind and outcome (enqueued, succeeded, retried, dead).",
+		},
+		[]string{"kind", "outcome"},
+	)
+	ep := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "events_published_total",
+			Help: "Count of broker events, labeled by event type and outcome (published, error, delivery_error, encode_error).",
+		},
+		[]string{"type", "outcome"},
+	)
+	ee := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "experiment_exposures_total",
+			Help: "Count of experiment assignments served, labeled by experiment and variant.",
+		},
+		[]string{"experiment", "variant"},
+	)
+	cf := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "chaos_faults_injected_total",
+			Help: "Count of injected faults, labeled by type (latency, error, drop).",
+		},
+		[]string{"type"},
+	)
+	wd := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "warmup_duration_seconds",
+			Help: "Duration of each startup warm-up step (step=\"total\" for the whole routine).",
+		},
+		[]string{"step"},
+	)
+	fg := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "feature_gate_rejections_total",
+			Help: "Requests rejected because the route's feature flag is off.",
+		},
+		[]string{"route", "flag"},
+	)
+	sr := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "session_requests_rejected_total",
+			Help: "Requests answered 421 because their CF-Session-ID does not match this pod's session, labeled by reason (mismatch, missing).",
+		},
+		[]string{"reason"},
+	)
+	prometheus.MustRegister(mc, mh, pq, pw, pd, pr, jr, jd, jl, ob, qt, ep, ee, cf, wd, fg, sr)
+	return &appMetrics{
+		reqCount:              mc,
+		reqDuration:           mh,
+		poolQueueDepth:        pq,
+		poolTaskWait:          pw,
+		poolTaskDuration:      pd,
+		poolTasksRejected:     pr,
+		jobRuns:               jr,
+		jobDuration:           jd,
+		jobLastSuccess:        jl,
+		ordersByStatus:        ob,
+		queueTasks:            qt,
+		eventsPublished:       ep,
+		experimentExposures:   ee,
+		chaosFaults:           cf,
+		warmupDuration:        wd,
+		featureGateRejections: fg,
+		sessionRejections:     sr,
+	}
 }
 
 func getBoolEnv(name string, def bool) bool {
@@ -104,13 +267,25 @@ func getBoolEnv(name string, def bool) bool {
 	}
 }
 
+func getIntEnv(name string, def int) int {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
 func logWithTraceID(ctx context.Context, msg string) {
 	sc := trace.SpanContextFromContext(ctx)
 	if sc.IsValid() {
 		log.Printf("trace_id=%s %s", sc.TraceID().String(), msg)
 		return
 	}
-	log.Printf(msg)
+	log.Print(msg)
 }
 
 func helloHandler(w http.ResponseWriter, r *http.Request) {
@@ -169,10 +344,27 @@ func main() {
 	metricsDefault := getBoolEnv("ENABLE_METRICS", false)
 	tracingDefault := getBoolEnv("ENABLE_TRACING", false)
 	adminFlagsEnabled := getBoolEnv("ADMIN_FLAGS_ENABLED", false)
+	requestValidation := getBoolEnv("OPENAPI_VALIDATION_ENABLED", true)
+	graphQLEnabled := getBoolEnv("GRAPHQL_ENABLED", false)
+	webhooksEnabled := getBoolEnv("WEBHOOKS_ENABLED", false)
+	chaosEnabled := getBoolEnv("CHAOS_ENABLED", false)
 
 	// Initialize OpenFeature (flagd) client for dynamic flags
 	initFeatureFlags(tracingDefault, metricsDefault)
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Components are stopped in reverse order of registration.
+	var lc lifecycle
+	lc.Add(component{name: "tracer provider", stop: func(ctx context.Context) error {
+		shutdownTracerProvider(ctx)
+		return nil
+	}})
+	if tracingDefault {
+		ensureTracerProvider(ctx)
+	}
+
 	var (
 		db    *sql.DB
 		err   error
@@ -183,31 +375,82 @@ func main() {
 		if err != nil {
 			log.Fatalf("database initialization failed: %v", err)
 		}
-		defer func() {
-			if cerr := db.Close(); cerr != nil {
-				log.Printf("database close error: %v", cerr)
-			}
-		}()
+		lc.Add(component{name: "database", stop: func(context.Context) error { return db.Close() }})
 	} else {
 		log.Printf("DATABASE_URL not set, skipping migrations")
 	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
-	defer shutdownTracerProvider(context.Background())
-	if tracingDefault {
-		ensureTracerProvider(ctx)
-	}
-
 	// Always register metrics collectors; recording/serving is gated dynamically
 	mtr = enableMetrics()
 
-	checker := dependencyChecker{db: db}
+	// Events are flushed after the worker pool drains, so work still running
+	// on the pool can publish.
+	emitter, err := newEventEmitterFromEnv()
+	if err != nil {
+		log.Fatalf("event publisher initialization failed: %v", err)
+	}
+	events = emitter
+	lc.Add(component{name: "event publisher", stop: events.Close, stopTimeout: 5 * time.Second})
+
+	workers := newWorkerPool("background", getIntEnv("WORKER_POOL_SIZE", 4), getIntEnv("WORKER_POOL_QUEUE_SIZE", 100))
+	lc.Add(component{name: "worker pool", stop: workers.Shutdown, stopTimeout: 10 * time.Second})
+
+	var queue *taskQueue
+	if db != nil {
+		queue = newTaskQueue(db, workers)
+		if webhooksEnabled {
+			webhooks = newWebhookDispatcher(db, queue)
+		}
+		queue.Start()
+		lc.Add(component{name: "task queue", stop: func(context.Context) error {
+			queue.Stop()
+			return nil
+		}})
+	} else if webhooksEnabled {
+		log.Printf("WEBHOOKS_ENABLED set but DATABASE_URL missing; webhooks disabled")
+	}
+
+	sched := newScheduler(workers, db)
+	if db != nil {
+		sched.Register("orders_stats", ordersStatsJob(db))
+	}
+	schedules, err := loadJobSchedules(ctx, db)
+	if err != nil {
+		log.Fatalf("scheduler initialization failed: %v", err)
+	}
+	if err := sched.Start(schedules); err != nil {
+		log.Fatalf("scheduler initialization failed: %v", err)
+	}
+	lc.Add(component{name: "scheduler", stop: func(context.Context) error {
+		sched.Stop()
+		return nil
+	}})
+
+	addr := ":8080"
+	if p := os.Getenv("PORT"); p != "" {
+		addr = ":" + p
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("listen on %s: %v", addr, err)
+	}
+
+	warm := newWarmup(db, fmt.Sprintf("http://127.0.0.1:%d/", ln.Addr().(*net.TCPAddr).Port), os.Getenv("SESSION_ID"))
+	checker := dependencyChecker{db: db, warmup: warm}
+
+	spec, err := loadAPISpec(ctx)
+	if err != nil {
+		log.Fatalf("openapi initialization failed: %v", err)
+	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", helloHandler)
 	mux.HandleFunc("/readyz", checker.readinessHandler)
 	mux.HandleFunc("/livez", checker.livenessHandler)
+	mux.HandleFunc("/openapi.json", spec.documentHandler)
+	mux.HandleFunc("/docs", swaggerUIHandler)
+	mux.Handle("/docs/assets/", swaggerUIAssets)
+	mux.HandleFunc("GET /experiments/{key}/assignment", experimentAssignmentHandler)
 
 	// Metrics endpoint gated dynamically per-request
 	promHandler := promhttp.Handler()
@@ -227,42 +470,92 @@ func main() {
 		log.Printf("Admin flags endpoint enabled (no auth): /admin/flags")
 	}
 
-	addr := ":8080"
-	if p := os.Getenv("PORT"); p != "" {
-		addr = ":" + p
+	if webhooks != nil && webhooks.adminToken != "" {
+		mux.HandleFunc("GET /admin/webhooks", webhooks.requireAdminToken(webhooks.listHandler))
+		mux.HandleFunc("POST /admin/webhooks", webhooks.requireAdminToken(webhooks.createHandler))
+		mux.HandleFunc("DELETE /admin/webhooks/{id}", webhooks.requireAdminToken(webhooks.deleteHandler))
+		mux.HandleFunc("GET /admin/webhooks/{id}/deliveries", webhooks.requireAdminToken(webhooks.deliveriesHandler))
+		log.Printf("Webhook admin endpoints enabled (bearer token): /admin/webhooks")
+	} else if webhooks != nil {
+		log.Printf("WEBHOOKS_ADMIN_TOKEN not set; webhook admin endpoints disabled")
 	}
-	srv := &http.Server{
-		Addr:    addr,
-		Handler: mux,
+
+	if graphQLEnabled {
+		gql, err := newGraphQLHandler(getIntEnv("GRAPHQL_MAX_COMPLEXITY", defaultGraphQLMaxComplexity))
+		if err != nil {
+			log.Fatalf("graphql initialization failed: %v", err)
+		}
+		mux.Handle("/graphql", gql)
+		log.Printf("GraphQL endpoint enabled: /graphql")
 	}
 
-	serverErr := make(chan error, 1)
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			serverErr <- err
+	var handler http.Handler = mux
+	if requestValidation {
+		handler = spec.validateRequests(handler)
+	}
+	routeGates, err := parseRouteGates(os.Getenv("ROUTE_FEATURE_GATES"))
+	if err != nil {
+		log.Fatalf("feature gate configuration invalid: %v", err)
+	}
+	if len(routeGates) > 0 {
+		handler = featureGateMiddleware(routeGates, handler)
+		for _, g := range routeGates {
+			log.Printf("Route %s gated by feature flag %s", g.route, g.flag)
 		}
-		close(serverErr)
-	}()
+	}
+	handler = sessionGuardFromEnv(handler)
+	if chaosEnabled {
+		handler = chaosMiddleware(handler)
+		log.Printf("Chaos fault injection enabled (chaos_latency_ms, chaos_error_rate, chaos_drop_rate flags)")
+	}
+	if events != nil && getBoolEnv("EVENTS_REQUESTS_ENABLED", true) {
+		handler = requestEvents(handler)
+	}
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
 
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
-	defer signal.Stop(sigCh)
+	lc.Add(component{
+		name: "http server",
+		run: func(context.Context) error {
+			if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		},
+		stop:        srv.Shutdown,
+		stopTimeout: 10 * time.Second,
+	})
+	// Registered after the server so the session is deregistered before the
+	// server stops accepting its traffic.
+	registrar, err := newSessionRegistrarFromEnv()
+	if err != nil {
+		log.Printf("session self-registration disabled: %v", err)
+	} else if registrar != nil {
+		lc.Add(component{
+			name: "session registration",
+			run: func(ctx context.Context) error {
+				if err := registrar.Register(ctx); err != nil {
+					log.Printf("session registration abandoned: %v", err)
+				}
+				return nil
+			},
+			stop: registrar.Deregister,
+		})
+	}
+	lc.Add(component{
+		name: "warm-up",
+		run: func(ctx context.Context) error {
+			warm.Run(ctx, time.Duration(getIntEnv("WARMUP_TIMEOUT_SECONDS", 30))*time.Second)
+			return nil
+		},
+	})
 
 	log.Printf("Starting hello-world on %s (feature flags via OpenFeature/flagd; admin=%v)", addr, adminFlagsEnabled)
 
-	select {
-	case err := <-serverErr:
-		if err != nil {
-			log.Fatalf("server failed: %v", err)
-		}
-	case sig := <-sigCh:
-		log.Printf("Received signal %s, initiating graceful shutdown", sig)
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		if err := srv.Shutdown(shutdownCtx); err != nil {
-			log.Printf("server shutdown error: %v", err)
-		}
-		cancel()
-		<-serverErr
+	if err := lc.Run(ctx); err != nil {
+		log.Fatalf("shutdown after failure: %v", err)
 	}
 }
 
@@ -274,23 +567,6 @@ func setupDatabase(databaseURL string) (*sql.DB, error) {
 	if err := runMigrations(db); err != nil {
 		db.Close()
 		return nil, err
-=======
-
-	srv := &http.Server{Addr: addr, Handler: mux}
-
-	go func() {
-		<-ctx.Done()
-		shutdownTracerProvider(context.Background())
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := srv.Shutdown(shutdownCtx); err != nil {
-			log.Printf("server shutdown error: %v", err)
-		}
-	}()
-
-	log.Printf("Starting hello-world on %s (feature flags via OpenFeature/flagd; admin=%v)", addr, adminFlagsEnabled)
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Printf("server failed: %v", err)
 	}
 	return db, nil
 }
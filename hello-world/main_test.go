@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 
@@ -14,16 +15,6 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
-func Test_parseBoolEnv(t *testing.T) {
-	tests := []struct {
-		in   string
-		def  bool
-		want bool
-=======
-	"os"
-	"testing"
-)
-
 func TestGetBoolEnv(t *testing.T) {
 	const envVar = "TEST_BOOL_FLAG"
 
@@ -65,7 +56,6 @@ func TestTracingExportsAfterAdminEnable(t *testing.T) {
 	defaultTracing.Store(false)
 	defaultMetrics.Store(false)
 	overridesValue.Store(flagOverrides{})
-	metricsEnabled = false
 	mtr = nil
 
 	// Reset tracer state
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPIDocumentServed(t *testing.T) {
+	spec, err := loadAPISpec(context.Background())
+	if err != nil {
+		t.Fatalf("loadAPISpec: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	spec.documentHandler(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d want 200", rr.Code)
+	}
+	var doc struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("document is not JSON: %v", err)
+	}
+	for _, p := range []string{"/", "/readyz", "/livez", "/admin/flags"} {
+		if _, ok := doc.Paths[p]; !ok {
+			t.Fatalf("document missing path %q", p)
+		}
+	}
+}
+
+func TestValidateRequests(t *testing.T) {
+	spec, err := loadAPISpec(context.Background())
+	if err != nil {
+		t.Fatalf("loadAPISpec: %v", err)
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	h := spec.validateRequests(next)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{name: "valid body", method: http.MethodPost, target: "/admin/flags", body: `{"tracing": true}`, want: http.StatusNoContent},
+		{name: "wrong body type", method: http.MethodPost, target: "/admin/flags", body: `{"tracing": "yes"}`, want: http.StatusBadRequest},
+		{name: "unknown body field", method: http.MethodPost, target: "/admin/flags", body: `{"debug": true}`, want: http.StatusBadRequest},
+		{name: "bad query param", method: http.MethodPost, target: "/admin/flags?metrics=maybe", want: http.StatusBadRequest},
+		{name: "undeclared method", method: http.MethodDelete, target: "/readyz", want: http.StatusMethodNotAllowed},
+		{name: "undocumented path passes through", method: http.MethodGet, target: "/docs", want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Fatalf("status = %d want %d (body %q)", rr.Code, tt.want, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestSwaggerUIServedLocally(t *testing.T) {
+	for _, ref := range []string{"http://", "https://", "//"} {
+		if strings.Contains(string(swaggerUIPage), `="`+ref) {
+			t.Fatalf("Swagger UI page loads an asset from %s...", ref)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	swaggerUIAssets.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs/assets/README.md", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET /docs/assets/README.md status = %d want 200", rr.Code)
+	}
+
+	// /docs is only served when the assets it loads are there.
+	rr = httptest.NewRecorder()
+	swaggerUIAssets.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs/assets/swagger-ui-bundle.js", nil))
+	vendored := rr.Code == http.StatusOK
+	rr = httptest.NewRecorder()
+	swaggerUIHandler(rr, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	want := http.StatusServiceUnavailable
+	if vendored {
+		want = http.StatusOK
+	}
+	if rr.Code != want {
+		t.Fatalf("GET /docs status = %d want %d (assets vendored: %t)", rr.Code, want, vendored)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Cron-style scheduler for periodic jobs. Jobs are registered in code by name;
+// their schedules come from SCHEDULED_JOBS ("name=cron expr;name2=@hourly")
+// and the scheduled_jobs table, which wins when both define a job. Runs are
+// executed on the background worker pool, never overlap within a replica and,
+// when a database is configured, only run on the leader: the replica holding
+// the scheduler's session-level Postgres advisory lock on a dedicated
+// connection. The lock is held for the scheduler's lifetime, so a replica
+// whose runs are short cannot hand the next tick to another replica.
+
+// schedulerLeaseInterval is how often a replica checks that it still holds,
+// or tries to take, the scheduler lock.
+const schedulerLeaseInterval = 15 * time.Second
+
+type scheduledJob struct {
+	name    string
+	run     func(context.Context) error
+	running atomic.Bool
+}
+
+type scheduler struct {
+	cron *cron.Cron
+	pool *workerPool
+	db   *sql.DB
+	jobs map[string]*scheduledJob
+
+	leader atomic.Bool
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newScheduler(pool *workerPool, db *sql.DB) *scheduler {
+	return &scheduler{
+		cron: cron.New(cron.WithLocation(time.UTC)),
+		pool: pool,
+		db:   db,
+		jobs: map[string]*scheduledJob{},
+	}
+}
+
+func (s *scheduler) Register(name string, fn func(context.Context) error) {
+	s.jobs[name] = &scheduledJob{name: name, run: fn}
+}
+
+// Start schedules every configured job that has been registered and starts
+// the cron loop. Schedules for unknown jobs are logged and ignored.
+func (s *scheduler) Start(schedules map[string]string) error {
+	for name, spec := range schedules {
+		job, ok := s.jobs[name]
+		if !ok {
+			log.Printf("scheduler: ignoring schedule for unknown job %q", name)
+			continue
+		}
+		if _, err := s.cron.AddFunc(spec, func() { s.trigger(job) }); err != nil {
+			return fmt.Errorf("schedule job %s (%q): %w", name, spec, err)
+		}
+		log.Printf("scheduler: job %s scheduled at %q", name, spec)
+	}
+	if s.db == nil {
+		s.leader.Store(true)
+	} else {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.cancel, s.done = cancel, make(chan struct{})
+		go s.lead(ctx)
+	}
+	s.cron.Start()
+	return nil
+}
+
+// Stop prevents new runs from being triggered and gives up leadership.
+// In-flight runs belong to the worker pool and are drained by its Shutdown.
+func (s *scheduler) Stop() {
+	s.cron.Stop()
+	if s.cancel != nil {
+		s.cancel()
+		<-s.done
+	}
+}
+
+// lead takes the scheduler lock when it is free and keeps the connection
+// holding it until ctx is done. Postgres releases a session-level lock when
+// its session ends, so a broken connection means leadership is lost.
+func (s *scheduler) lead(ctx context.Context) {
+	defer close(s.done)
+	var conn *sql.Conn
+	ticker := time.NewTicker(schedulerLeaseInterval)
+	defer ticker.Stop()
+	for {
+		if conn != nil {
+			if err := conn.PingContext(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("scheduler: lost lock connection, no longer leader: %v", err)
+				s.leader.Store(false)
+				conn.Close()
+				conn = nil
+			}
+		}
+		if conn == nil && ctx.Err() == nil {
+			conn = s.tryLock(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			if conn != nil {
+				s.leader.Store(false)
+				if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", schedulerLockKey); err != nil {
+					log.Printf("scheduler: release lock: %v", err)
+				}
+				conn.Close()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tryLock returns the connection holding the scheduler lock, or nil when
+// another replica holds it or the database is unreachable.
+func (s *scheduler) tryLock(ctx context.Context) *sql.Conn {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		log.Printf("scheduler: acquire connection for lock: %v", err)
+		return nil
+	}
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", schedulerLockKey).Scan(&acquired); err != nil || !acquired {
+		if err != nil {
+			log.Printf("scheduler: acquire lock: %v", err)
+		}
+		conn.Close()
+		return nil
+	}
+	log.Printf("scheduler: acquired lock, running scheduled jobs on this replica")
+	s.leader.Store(true)
+	return conn
+}
+
+func (s *scheduler) trigger(job *scheduledJob) {
+	if !job.running.CompareAndSwap(false, true) {
+		recordJobRun(job.name, "skipped_overlap")
+		return
+	}
+	err := s.pool.Submit("job:"+job.name, func(ctx context.Context) error {
+		defer job.running.Store(false)
+		return s.execute(ctx, job)
+	})
+	if err != nil {
+		job.running.Store(false)
+		recordJobRun(job.name, "rejected")
+		log.Printf("scheduler: job %s not queued: %v", job.name, err)
+	}
+}
+
+func (s *scheduler) execute(ctx context.Context, job *scheduledJob) error {
+	if !s.leader.Load() {
+		recordJobRun(job.name, "skipped_not_leader")
+		return nil
+	}
+
+	start := time.Now()
+	err := job.run(ctx)
+	if mtr != nil {
+		mtr.jobDuration.WithLabelValues(job.name).Observe(time.Since(start).Seconds())
+	}
+	if err != nil {
+		recordJobRun(job.name, "error")
+		return err
+	}
+	recordJobRun(job.name, "ok")
+	if mtr != nil {
+		mtr.jobLastSuccess.WithLabelValues(job.name).SetToCurrentTime()
+	}
+	return nil
+}
+
+func recordJobRun(name, outcome string) {
+	if mtr != nil {
+		mtr.jobRuns.WithLabelValues(name, outcome).Inc()
+	}
+}
+
+// schedulerLockKey is the advisory lock held by the leading replica.
+var schedulerLockKey = func() int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte("scheduler"))
+	return int64(h.Sum64())
+}()
+
+// jobScheduleRow is a row of the scheduled_jobs table.
+type jobScheduleRow struct {
+	name, spec string
+	enabled    bool
+}
+
+// loadJobSchedules merges SCHEDULED_JOBS with the scheduled_jobs table.
+func loadJobSchedules(ctx context.Context, db *sql.DB) (map[string]string, error) {
+	schedules, err := parseJobSchedules(os.Getenv("SCHEDULED_JOBS"))
+	if err != nil {
+		return nil, err
+	}
+	if db == nil {
+		return schedules, nil
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT name, schedule, enabled FROM scheduled_jobs")
+	if err != nil {
+		return nil, fmt.Errorf("load scheduled_jobs: %w", err)
+	}
+	defer rows.Close()
+	var table []jobScheduleRow
+	for rows.Next() {
+		var row jobScheduleRow
+		if err := rows.Scan(&row.name, &row.spec, &row.enabled); err != nil {
+			return nil, fmt.Errorf("scan scheduled_jobs: %w", err)
+		}
+		table = append(table, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return mergeJobSchedules(schedules, table), nil
+}
+
+// mergeJobSchedules applies table rows over the schedules from env: an
+// enabled row sets its job's schedule and a disabled row removes the job.
+func mergeJobSchedules(schedules map[string]string, table []jobScheduleRow) map[string]string {
+	for _, row := range table {
+		if !row.enabled {
+			delete(schedules, row.name)
+			continue
+		}
+		schedules[row.name] = row.spec
+	}
+	return schedules
+}
+
+func parseJobSchedules(v string) (map[string]string, error) {
+	schedules := map[string]string{}
+	for _, entry := range strings.Split(v, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, spec, ok := strings.Cut(entry, "=")
+		name, spec = strings.TrimSpace(name), strings.TrimSpace(spec)
+		if !ok || name == "" || spec == "" {
+			return nil, fmt.Errorf("invalid SCHEDULED_JOBS entry %q (want name=cron expression)", entry)
+		}
+		schedules[name] = spec
+	}
+	return schedules, nil
+}
+
+// ordersStatsJob refreshes the orders_by_status gauge from the orders table.
+func ordersStatsJob(db *sql.DB) func(context.Context) error {
+	return func(ctx context.Context) error {
+		rows, err := db.QueryContext(ctx, "SELECT status, count(*) FROM orders GROUP BY status")
+		if err != nil {
+			return fmt.Errorf("query order stats: %w", err)
+		}
+		defer rows.Close()
+
+		if mtr != nil {
+			mtr.ordersByStatus.Reset()
+		}
+		for rows.Next() {
+			var (
+				status string
+				count  int64
+			)
+			if err := rows.Scan(&status, &count); err != nil {
+				return fmt.Errorf("scan order stats: %w", err)
+			}
+			if mtr != nil {
+				mtr.ordersByStatus.WithLabelValues(status).Set(float64(count))
+			}
+		}
+		return rows.Err()
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMergeJobSchedules(t *testing.T) {
+	schedules, err := parseJobSchedules(" orders_stats = */5 * * * * ; cleanup=@hourly;report=@daily")
+	if err != nil {
+		t.Fatalf("parseJobSchedules: %v", err)
+	}
+	got := mergeJobSchedules(schedules, []jobScheduleRow{
+		{name: "orders_stats", spec: "*/1 * * * *", enabled: true},
+		{name: "cleanup", spec: "@hourly", enabled: false},
+		{name: "db_only", spec: "@weekly", enabled: true},
+	})
+	want := map[string]string{
+		"orders_stats": "*/1 * * * *",
+		"report":       "@daily",
+		"db_only":      "@weekly",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("merged schedules = %v want %v", got, want)
+	}
+}
+
+func TestParseJobSchedulesRejectsInvalidEntries(t *testing.T) {
+	for _, v := range []string{"orders_stats", "=@hourly", "orders_stats="} {
+		if _, err := parseJobSchedules(v); err == nil {
+			t.Errorf("parseJobSchedules(%q) succeeded, want error", v)
+		}
+	}
+}
+
+func TestSchedulerSkipsOverlappingRuns(t *testing.T) {
+	mtr = nil
+	pool := newWorkerPool("test", 2, 2)
+	s := newScheduler(pool, nil)
+	s.leader.Store(true)
+
+	var runs atomic.Int32
+	release := make(chan struct{})
+	s.Register("slow", func(context.Context) error {
+		runs.Add(1)
+		<-release
+		return nil
+	})
+	job := s.jobs["slow"]
+
+	s.trigger(job)
+	s.trigger(job)
+	close(release)
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if got := runs.Load(); got != 1 {
+		t.Fatalf("job ran %d times want 1", got)
+	}
+	if job.running.Load() {
+		t.Fatalf("job still marked running after its run finished")
+	}
+}
+
+func TestSchedulerResetsRunningWhenSubmitRejected(t *testing.T) {
+	mtr = nil
+	pool := newWorkerPool("test", 1, 1)
+	_ = pool.Shutdown(context.Background())
+	s := newScheduler(pool, nil)
+	s.leader.Store(true)
+	s.Register("rejected", func(context.Context) error { return nil })
+	job := s.jobs["rejected"]
+
+	s.trigger(job)
+	if job.running.Load() {
+		t.Fatalf("job left marked running after the pool rejected it")
+	}
+}
+
+func TestSchedulerRunsOnlyOnLeader(t *testing.T) {
+	mtr = nil
+	pool := newWorkerPool("test", 1, 1)
+	s := newScheduler(pool, nil)
+
+	var runs atomic.Int32
+	s.Register("job", func(context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+	s.trigger(s.jobs["job"])
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := pool.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if got := runs.Load(); got != 0 {
+		t.Fatalf("job ran %d times on a replica that does not lead", got)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Session-aware request validation. Pods created by cloudflare-session-operator
+// serve exactly one session and get it injected as SESSION_ID. Cloudflare tags
+// routed requests with a CF-Session-ID header; a request carrying a different
+// session was routed to the wrong pod and is answered 421 Misdirected Request
+// so the edge can retry elsewhere and the misroute shows up in metrics.
+// Requests without the header pass unless SESSION_HEADER_REQUIRED=true.
+// Probe and metrics endpoints are never checked.
+
+const sessionHeader = "CF-Session-ID"
+
+// sessionGuardFromEnv wraps next in the session guard when the pod serves a
+// session (SESSION_ID) and SESSION_VALIDATION_ENABLED is not false.
+func sessionGuardFromEnv(next http.Handler) http.Handler {
+	sessionID := os.Getenv("SESSION_ID")
+	if sessionID == "" || !getBoolEnv("SESSION_VALIDATION_ENABLED", true) {
+		return next
+	}
+	log.Printf("Session validation enabled: requests for other sessions get 421 (session %s)", sessionID)
+	return sessionGuardMiddleware(sessionID, getBoolEnv("SESSION_HEADER_REQUIRED", false), next)
+}
+
+func sessionGuardMiddleware(sessionID string, requireHeader bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if probePaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		got := strings.TrimSpace(r.Header.Get(sessionHeader))
+		switch {
+		case got == "" && !requireHeader:
+		case got == "":
+			rejectSession(w, "missing", "CF-Session-ID header required")
+			return
+		case got != sessionID:
+			rejectSession(w, "mismatch", "request is for a different session")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func rejectSession(w http.ResponseWriter, reason, msg string) {
+	if mtr != nil {
+		mtr.sessionRejections.WithLabelValues(reason).Inc()
+	}
+	writeJSON(w, http.StatusMisdirectedRequest, map[string]string{"error": msg})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/open-feature/go-sdk/openfeature"
+)
+
+func TestSessionGuard(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	cases := []struct {
+		name    string
+		path    string
+		header  string
+		require bool
+		want    int
+	}{
+		{"matching session", "/", "s1", false, http.StatusOK},
+		{"other session", "/", "s2", false, http.StatusMisdirectedRequest},
+		{"missing header allowed", "/", "", false, http.StatusOK},
+		{"missing header required", "/", "", true, http.StatusMisdirectedRequest},
+		{"probes exempt", "/readyz", "s2", true, http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.header != "" {
+				req.Header.Set(sessionHeader, tc.header)
+			}
+			rec := httptest.NewRecorder()
+			sessionGuardMiddleware("s1", tc.require, ok).ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.want)
+			}
+		})
+	}
+}
+
+func TestWarmupPassesRequiredSessionHeader(t *testing.T) {
+	t.Setenv("SESSION_ID", "s1")
+	t.Setenv("SESSION_HEADER_REQUIRED", "true")
+	defaultTracing.Store(false)
+	defaultMetrics.Store(false)
+	overridesValue.Store(flagOverrides{})
+	openfeature.SetProvider(openfeature.NewNoopProvider())
+	ofClient = openfeature.NewClient("test")
+
+	var served atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		served.Add(1)
+		helloHandler(w, r)
+	})
+	srv := httptest.NewServer(sessionGuardFromEnv(mux))
+	defer srv.Close()
+
+	warm := newWarmup(nil, srv.URL+"/", os.Getenv("SESSION_ID"))
+	start := time.Now()
+	warm.Run(context.Background(), 5*time.Second)
+	if !warm.Ready() {
+		t.Fatal("warm-up not marked ready")
+	}
+	if served.Load() != 1 {
+		t.Fatalf("self request reached the handler %d times, want 1", served.Load())
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("warm-up took %s; the self request was rejected until the budget ran out", elapsed)
+	}
+}
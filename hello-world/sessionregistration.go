@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Self-registration with the cloudflare-session-operator. When SESSION_ID and
+// SESSION_TARGET_DEPLOYMENT are set, hello-world creates a SessionBinding for
+// its session through the Kubernetes REST API at startup (or, if one already
+// exists, annotates it with this pod's name) and removes what it added on
+// shutdown: the binding if this pod created it, the annotation otherwise.
+// Session pods the operator created for a binding, which it marks with
+// SESSION_BINDING_NAME, do not register: their binding already exists and
+// must outlive them. Registration problems are logged, never fatal; the app
+// keeps serving.
+//
+// Requires a service account allowed to get/create/patch/delete
+// sessionbindings.cloudflare.example.com in the binding's namespace.
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	sessionBindingAPIPath       = "/apis/cloudflare.example.com/v1alpha1"
+	sessionRegisteredPodKey     = "hello-world.example.com/registered-pod"
+	sessionRegisteredAtKey      = "hello-world.example.com/registered-at"
+	sessionRegistrationFieldMgr = "hello-world"
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+type sessionBindingSpec struct {
+	SessionID  string          `json:"sessionID"`
+	UserID     string          `json:"userID,omitempty"`
+	TargetRef  targetReference `json:"targetRef"`
+	TTLSeconds *int64          `json:"ttlSeconds,omitempty"`
+}
+
+type targetReference struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+type sessionRegistrar struct {
+	apiURL    string
+	namespace string
+	name      string
+	podName   string
+	spec      sessionBindingSpec
+
+	client    *http.Client
+	tokenFile string
+
+	// registered is set once Register succeeded; created additionally
+	// when this pod created the binding and therefore owns its deletion.
+	registered atomic.Bool
+	created    atomic.Bool
+}
+
+// newSessionRegistrarFromEnv returns nil when self-registration is not
+// configured, or when the operator created this pod for a binding.
+func newSessionRegistrarFromEnv() (*sessionRegistrar, error) {
+	sessionID := strings.TrimSpace(os.Getenv("SESSION_ID"))
+	target := strings.TrimSpace(os.Getenv("SESSION_TARGET_DEPLOYMENT"))
+	if sessionID == "" || target == "" {
+		return nil, nil
+	}
+	if binding := os.Getenv("SESSION_BINDING_NAME"); binding != "" {
+		log.Printf("session registration: skipped, pod belongs to SessionBinding %s", binding)
+		return nil, nil
+	}
+
+	namespace := getenvDefault("SESSION_BINDING_NAMESPACE", os.Getenv("POD_NAMESPACE"))
+	if namespace == "" {
+		b, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("session registration: namespace not configured and not running in a pod: %w", err)
+		}
+		namespace = strings.TrimSpace(string(b))
+	}
+
+	apiURL := os.Getenv("KUBERNETES_API_URL")
+	if apiURL == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("session registration: KUBERNETES_API_URL or KUBERNETES_SERVICE_HOST/PORT must be set")
+		}
+		apiURL = "https://" + net.JoinHostPort(host, port)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if ca, err := os.ReadFile(getenvDefault("KUBERNETES_CA_FILE", serviceAccountDir+"/ca.crt")); err == nil {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca)
+		tlsConfig.RootCAs = pool
+	}
+
+	podName := getenvDefault("POD_NAME", os.Getenv("HOSTNAME"))
+	spec := sessionBindingSpec{
+		SessionID: sessionID,
+		UserID:    os.Getenv("SESSION_USER_ID"),
+		TargetRef: targetReference{Kind: "Deployment", Name: target},
+	}
+	if ttl := getIntEnv("SESSION_TTL_SECONDS", 0); ttl > 0 {
+		v := int64(ttl)
+		spec.TTLSeconds = &v
+	}
+
+	return &sessionRegistrar{
+		apiURL:    strings.TrimRight(apiURL, "/"),
+		namespace: namespace,
+		name:      sessionBindingName(sessionID),
+		podName:   podName,
+		spec:      spec,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		},
+		tokenFile: getenvDefault("KUBERNETES_TOKEN_FILE", serviceAccountDir+"/token"),
+	}, nil
+}
+
+// sessionBindingName derives a DNS-1123 compliant object name from the
+// session ID.
+func sessionBindingName(sessionID string) string {
+	name := "hello-world-" + invalidNameChars.ReplaceAllString(strings.ToLower(sessionID), "-")
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return strings.TrimRight(name, "-")
+}
+
+// Register creates or annotates the binding, retrying with backoff until it
+// succeeds or ctx is cancelled.
+func (s *sessionRegistrar) Register(ctx context.Context) error {
+	delay := time.Second
+	for {
+		err := s.register(ctx)
+		if err == nil {
+			s.registered.Store(true)
+			return nil
+		}
+		log.Printf("session registration for %s failed, retrying in %s: %v", s.spec.SessionID, delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		if delay < 30*time.Second {
+			delay *= 2
+		}
+	}
+}
+
+func (s *sessionRegistrar) register(ctx context.Context) error {
+	binding := map[string]any{
+		"apiVersion": "cloudflare.example.com/v1alpha1",
+		"kind":       "SessionBinding",
+		"metadata": map[string]any{
+			"name":        s.name,
+			"namespace":   s.namespace,
+			"labels":      map[string]string{"app.kubernetes.io/created-by": "hello-world"},
+			"annotations": s.annotations(),
+		},
+		"spec": s.spec,
+	}
+	status, body, err := s.do(ctx, http.MethodPost, s.collectionPath(), "application/json", binding)
+	if err != nil {
+		return err
+	}
+	switch status {
+	case http.StatusCreated, http.StatusOK:
+		s.created.Store(true)
+		log.Printf("session registration: created SessionBinding %s/%s for session %s", s.namespace, s.name, s.spec.SessionID)
+		return nil
+	case http.StatusConflict:
+		// Someone else (operator, another replica, a previous run) owns it.
+		patch := map[string]any{"metadata": map[string]any{"annotations": s.annotations()}}
+		status, body, err = s.do(ctx, http.MethodPatch, s.objectPath(), "application/merge-patch+json", patch)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK {
+			return fmt.Errorf("annotate SessionBinding %s/%s: %d %s", s.namespace, s.name, status, body)
+		}
+		log.Printf("session registration: annotated existing SessionBinding %s/%s", s.namespace, s.name)
+		return nil
+	default:
+		return fmt.Errorf("create SessionBinding %s/%s: %d %s", s.namespace, s.name, status, body)
+	}
+}
+
+// Deregister undoes Register: it deletes the binding this pod created, or
+// removes this pod's annotations from a binding it only joined.
+func (s *sessionRegistrar) Deregister(ctx context.Context) error {
+	if !s.registered.Load() {
+		return nil
+	}
+	if s.created.Load() {
+		status, body, err := s.do(ctx, http.MethodDelete, s.objectPath(), "", nil)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK && status != http.StatusAccepted && status != http.StatusNotFound {
+			return fmt.Errorf("delete SessionBinding %s/%s: %d %s", s.namespace, s.name, status, body)
+		}
+		log.Printf("session registration: deleted SessionBinding %s/%s", s.namespace, s.name)
+		return nil
+	}
+
+	patch := map[string]any{"metadata": map[string]any{"annotations": map[string]any{
+		sessionRegisteredPodKey: nil,
+		sessionRegisteredAtKey:  nil,
+	}}}
+	status, body, err := s.do(ctx, http.MethodPatch, s.objectPath(), "application/merge-patch+json", patch)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK && status != http.StatusNotFound {
+		return fmt.Errorf("remove registration from SessionBinding %s/%s: %d %s", s.namespace, s.name, status, body)
+	}
+	return nil
+}
+
+func (s *sessionRegistrar) annotations() map[string]string {
+	return map[string]string{
+		sessionRegisteredPodKey: s.podName,
+		sessionRegisteredAtKey:  time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func (s *sessionRegistrar) collectionPath() string {
+	return fmt.Sprintf("%s/namespaces/%s/sessionbindings", sessionBindingAPIPath, s.namespace)
+}
+
+func (s *sessionRegistrar) objectPath() string {
+	return s.collectionPath() + "/" + s.name
+}
+
+func (s *sessionRegistrar) do(ctx context.Context, method, path, contentType string, payload any) (int, string, error) {
+	var reqBody io.Reader
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return 0, "", fmt.Errorf("encode request: %w", err)
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	url := s.apiURL + path
+	if payload != nil {
+		url += "?fieldManager=" + sessionRegistrationFieldMgr
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return 0, "", err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	// Projected service account tokens rotate, so read the file per request.
+	if token, err := os.ReadFile(s.tokenFile); err == nil {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return resp.StatusCode, strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSessionBindingName(t *testing.T) {
+	if got := sessionBindingName("Abc_123.XYZ"); got != "hello-world-abc-123-xyz" {
+		t.Fatalf("sessionBindingName = %q", got)
+	}
+	if got := sessionBindingName(strings.Repeat("a", 80)); len(got) > 63 {
+		t.Fatalf("name too long: %d", len(got))
+	}
+}
+
+func TestSessionRegistrarAnnotatesExistingBinding(t *testing.T) {
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		if r.Header.Get("Authorization") != "Bearer t0ken" {
+			t.Errorf("missing bearer token on %s", r.Method)
+		}
+		switch r.Method {
+		case http.MethodPost:
+			w.WriteHeader(http.StatusConflict)
+		case http.MethodPatch:
+			if ct := r.Header.Get("Content-Type"); ct != "application/merge-patch+json" {
+				t.Errorf("patch content type = %s", ct)
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("unexpected %s", r.Method)
+		}
+	}))
+	defer srv.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("t0ken\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SESSION_ID", "s1")
+	t.Setenv("SESSION_TARGET_DEPLOYMENT", "hello-world")
+	t.Setenv("SESSION_BINDING_NAMESPACE", "demo")
+	t.Setenv("KUBERNETES_API_URL", srv.URL)
+	t.Setenv("KUBERNETES_TOKEN_FILE", tokenFile)
+
+	reg, err := newSessionRegistrarFromEnv()
+	if err != nil || reg == nil {
+		t.Fatalf("newSessionRegistrarFromEnv = %v, %v", reg, err)
+	}
+	if err := reg.Register(context.Background()); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	// The binding pre-existed, so deregistration only removes annotations.
+	if err := reg.Deregister(context.Background()); err != nil {
+		t.Fatalf("Deregister: %v", err)
+	}
+
+	path := "/apis/cloudflare.example.com/v1alpha1/namespaces/demo/sessionbindings"
+	want := []string{"POST " + path, "PATCH " + path + "/hello-world-s1", "PATCH " + path + "/hello-world-s1"}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestSessionRegistrarSkipsOperatorCreatedPods(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	t.Setenv("SESSION_ID", "s1")
+	t.Setenv("SESSION_TARGET_DEPLOYMENT", "hello-world")
+	t.Setenv("SESSION_BINDING_NAMESPACE", "demo")
+	t.Setenv("KUBERNETES_API_URL", srv.URL)
+	// Injected by the operator into the pods it creates for a binding.
+	t.Setenv("SESSION_BINDING_NAME", "session-s1")
+
+	reg, err := newSessionRegistrarFromEnv()
+	if err != nil || reg != nil {
+		t.Fatalf("newSessionRegistrarFromEnv = %v, %v; want no registrar", reg, err)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Postgres-backed task queue for async work that has to survive restarts.
+// Producers call Enqueue; the poller claims due tasks with FOR UPDATE SKIP
+// LOCKED so replicas never double-claim, runs them on the worker pool, and
+// retries failures with exponential backoff until max_attempts is reached, at
+// which point the task is parked with status 'dead' for inspection.
+
+const (
+	taskStatusPending = "pending"
+	taskStatusRunning = "running"
+	taskStatusDone    = "done"
+	taskStatusDead    = "dead"
+
+	maxTaskBackoff = 10 * time.Minute
+)
+
+type taskHandler func(ctx context.Context, payload json.RawMessage) error
+
+type queuedTask struct {
+	id          int64
+	kind        string
+	payload     json.RawMessage
+	attempts    int
+	maxAttempts int
+}
+
+type taskQueue struct {
+	db   *sql.DB
+	pool *workerPool
+
+	pollInterval      time.Duration
+	batchSize         int
+	maxAttempts       int
+	visibilityTimeout time.Duration
+
+	mu       sync.RWMutex
+	handlers map[string]taskHandler
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newTaskQueue(db *sql.DB, pool *workerPool) *taskQueue {
+	return &taskQueue{
+		db:                db,
+		pool:              pool,
+		pollInterval:      time.Duration(getIntEnv("TASK_QUEUE_POLL_INTERVAL_MS", 1000)) * time.Millisecond,
+		batchSize:         getIntEnv("TASK_QUEUE_BATCH_SIZE", 10),
+		maxAttempts:       getIntEnv("TASK_QUEUE_MAX_ATTEMPTS", 5),
+		visibilityTimeout: time.Duration(getIntEnv("TASK_QUEUE_VISIBILITY_TIMEOUT_SECONDS", 300)) * time.Second,
+		handlers:          map[string]taskHandler{},
+	}
+}
+
+// Handle registers the handler for a task kind. Only kinds with a handler are
+// claimed by this replica.
+func (q *taskQueue) Handle(kind string, h taskHandler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = h
+}
+
+// Enqueue stores a task that becomes runnable after delay.
+func (q *taskQueue) Enqueue(ctx context.Context, kind string, payload any, delay time.Duration) (int64, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("encode task payload: %w", err)
+	}
+	var id int64
+	err = q.db.QueryRowContext(ctx,
+		`INSERT INTO task_queue (kind, payload, max_attempts, run_at)
+		 VALUES ($1, $2, $3, now() + make_interval(secs => $4))
+		 RETURNING id`,
+		kind, body, q.maxAttempts, delay.Seconds(),
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("enqueue %s task: %w", kind, err)
+	}
+	if mtr != nil {
+		mtr.queueTasks.WithLabelValues(kind, "enqueued").Inc()
+	}
+	return id, nil
+}
+
+// Start launches the poll loop; Stop ends it. Tasks already handed to the
+// worker pool are drained by the pool's Shutdown.
+func (q *taskQueue) Start() {
+	q.stop = make(chan struct{})
+	q.done = make(chan struct{})
+	go q.loop()
+}
+
+func (q *taskQueue) Stop() {
+	if q.stop == nil {
+		return
+	}
+	close(q.stop)
+	<-q.done
+}
+
+func (q *taskQueue) loop() {
+	defer close(q.done)
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+			if err := q.poll(); err != nil {
+				log.Printf("task queue poll failed: %v", err)
+			}
+		}
+	}
+}
+
+func (q *taskQueue) kinds() []string {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	kinds := make([]string, 0, len(q.handlers))
+	for k := range q.handlers {
+		kinds = append(kinds, k)
+	}
+	return kinds
+}
+
+func (q *taskQueue) poll() error {
+	kinds := q.kinds()
+	if len(kinds) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tasks, err := q.claim(ctx, kinds)
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		if err := q.pool.Submit("task:"+t.kind, func(ctx context.Context) error { return q.process(ctx, t) }); err != nil {
+			// Hand the claim back untouched; another poll (or replica) will pick it up.
+			if rerr := q.release(ctx, t.id); rerr != nil {
+				log.Printf("task queue: release task %d: %v", t.id, rerr)
+			}
+		}
+	}
+	return nil
+}
+
+// claim marks up to batchSize due tasks as running. Tasks whose previous
+// claim outlived the visibility timeout (crashed replica) are reclaimed.
+func (q *taskQueue) claim(ctx context.Context, kinds []string) ([]queuedTask, error) {
+	rows, err := q.db.QueryContext(ctx,
+		`UPDATE task_queue
+		 SET status = 'running', attempts = attempts + 1,
+		     locked_until = now() + make_interval(secs => $3), updated_at = now()
+		 WHERE id IN (
+		     SELECT id FROM task_queue
+		     WHERE kind = ANY($1)
+		       AND ((status = 'pending' AND run_at <= now())
+		         OR (status = 'running' AND locked_until < now()))
+		     ORDER BY run_at
+		     LIMIT $2
+		     FOR UPDATE SKIP LOCKED)
+		 RETURNING id, kind, payload, attempts, max_attempts`,
+		pq.Array(kinds), q.batchSize, q.visibilityTimeout.Seconds(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("claim tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []queuedTask
+	for rows.Next() {
+		var t queuedTask
+		if err := rows.Scan(&t.id, &t.kind, &t.payload, &t.attempts, &t.maxAttempts); err != nil {
+			return nil, fmt.Errorf("scan claimed task: %w", err)
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+func (q *taskQueue) process(ctx context.Context, t queuedTask) error {
+	q.mu.RLock()
+	h := q.handlers[t.kind]
+	q.mu.RUnlock()
+
+	runErr := fmt.Errorf("no handler for task kind %q", t.kind)
+	if h != nil {
+		runErr = h(ctx, t.payload)
+	}
+
+	// Record the outcome even if the pool is cancelling task contexts.
+	finishCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if runErr == nil {
+		_, err := q.db.ExecContext(finishCtx,
+			`UPDATE task_queue SET status = $2, locked_until = NULL, last_error = NULL, updated_at = now() WHERE id = $1`,
+			t.id, taskStatusDone)
+		q.recordOutcome(t.kind, "succeeded")
+		return err
+	}
+
+	if t.attempts >= t.maxAttempts {
+		_, err := q.db.ExecContext(finishCtx,
+			`UPDATE task_queue SET status = $2, locked_until = NULL, last_error = $3, updated_at = now() WHERE id = $1`,
+			t.id, taskStatusDead, runErr.Error())
+		q.recordOutcome(t.kind, "dead")
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("task %d (%s) moved to dead letter after %d attempts: %w", t.id, t.kind, t.attempts, runErr)
+	}
+
+	_, err := q.db.ExecContext(finishCtx,
+		`UPDATE task_queue
+		 SET status = $2, locked_until = NULL, last_error = $3,
+		     run_at = now() + make_interval(secs => $4), updated_at = now()
+		 WHERE id = $1`,
+		t.id, taskStatusPending, runErr.Error(), taskBackoff(t.attempts).Seconds())
+	q.recordOutcome(t.kind, "retried")
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("task %d (%s) attempt %d failed: %w", t.id, t.kind, t.attempts, runErr)
+}
+
+func (q *taskQueue) release(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx,
+		`UPDATE task_queue SET status = $2, attempts = attempts - 1, locked_until = NULL, updated_at = now() WHERE id = $1 AND status = $3`,
+		id, taskStatusPending, taskStatusRunning)
+	return err
+}
+
+func (q *taskQueue) recordOutcome(kind, outcome string) {
+	if mtr != nil {
+		mtr.queueTasks.WithLabelValues(kind, outcome).Inc()
+	}
+}
+
+// taskBackoff doubles from one second per attempt, capped at maxTaskBackoff.
+func taskBackoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := time.Second
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= maxTaskBackoff {
+			return maxTaskBackoff
+		}
+	}
+	return d
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTaskBackoff(t *testing.T) {
+	for _, tc := range []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{10, 512 * time.Second},
+		{11, maxTaskBackoff},
+		{100, maxTaskBackoff},
+	} {
+		if got := taskBackoff(tc.attempt); got != tc.want {
+			t.Errorf("taskBackoff(%d) = %s want %s", tc.attempt, got, tc.want)
+		}
+	}
+}
+
+func newTestTaskQueue(t *testing.T, respond func(query string, args []driver.Value) (*fakeRows, error)) (*taskQueue, *fakeDB) {
+	t.Helper()
+	mtr = nil
+	db, fake := openFakeDB(t, respond)
+	pool := newWorkerPool("test", 1, 1)
+	t.Cleanup(func() { _ = pool.Shutdown(context.Background()) })
+	q := newTaskQueue(db, pool)
+	q.maxAttempts = 3
+	return q, fake
+}
+
+func TestTaskQueueProcess(t *testing.T) {
+	failing := func(context.Context, json.RawMessage) error { return errors.New("smtp unavailable") }
+	for _, tc := range []struct {
+		name     string
+		handler  taskHandler
+		attempts int
+		// want are the arguments of the UPDATE recording the outcome.
+		want    []driver.Value
+		wantErr string
+	}{
+		{
+			name:     "succeeds",
+			handler:  func(context.Context, json.RawMessage) error { return nil },
+			attempts: 1,
+			want:     []driver.Value{int64(7), taskStatusDone},
+		},
+		{
+			name:     "retried with backoff",
+			handler:  failing,
+			attempts: 2,
+			want:     []driver.Value{int64(7), taskStatusPending, "smtp unavailable", taskBackoff(2).Seconds()},
+			wantErr:  "attempt 2 failed",
+		},
+		{
+			name:     "dead letter after max attempts",
+			handler:  failing,
+			attempts: 3,
+			want:     []driver.Value{int64(7), taskStatusDead, "smtp unavailable"},
+			wantErr:  "moved to dead letter after 3 attempts",
+		},
+		{
+			name:     "no handler",
+			attempts: 1,
+			want:     []driver.Value{int64(7), taskStatusPending, `no handler for task kind "email"`, taskBackoff(1).Seconds()},
+			wantErr:  "no handler",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			q, fake := newTestTaskQueue(t, nil)
+			if tc.handler != nil {
+				q.Handle("email", tc.handler)
+			}
+			err := q.process(context.Background(), queuedTask{id: 7, kind: "email", attempts: tc.attempts, maxAttempts: 3})
+			if tc.wantErr == "" && err != nil {
+				t.Fatalf("process: %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("process error = %v want it to contain %q", err, tc.wantErr)
+			}
+			updates := fake.statementsLike("UPDATE task_queue")
+			if len(updates) != 1 {
+				t.Fatalf("ran %d updates want 1", len(updates))
+			}
+			if !reflect.DeepEqual(updates[0].args, tc.want) {
+				t.Fatalf("update args = %#v want %#v", updates[0].args, tc.want)
+			}
+		})
+	}
+}
+
+func TestTaskQueueClaim(t *testing.T) {
+	q, fake := newTestTaskQueue(t, func(query string, args []driver.Value) (*fakeRows, error) {
+		if !strings.Contains(query, "FOR UPDATE SKIP LOCKED") {
+			return nil, nil
+		}
+		return &fakeRows{
+			columns: []string{"id", "kind", "payload", "attempts", "max_attempts"},
+			values: [][]driver.Value{
+				{int64(1), "email", []byte(`{"to":"a@example.com"}`), int64(1), int64(3)},
+				{int64(2), "email", []byte(`{"to":"b@example.com"}`), int64(3), int64(3)},
+			},
+		}, nil
+	})
+	q.batchSize = 2
+	q.visibilityTimeout = time.Minute
+
+	tasks, err := q.claim(context.Background(), []string{"email"})
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	want := []queuedTask{
+		{id: 1, kind: "email", payload: json.RawMessage(`{"to":"a@example.com"}`), attempts: 1, maxAttempts: 3},
+		{id: 2, kind: "email", payload: json.RawMessage(`{"to":"b@example.com"}`), attempts: 3, maxAttempts: 3},
+	}
+	if !reflect.DeepEqual(tasks, want) {
+		t.Fatalf("claimed %+v want %+v", tasks, want)
+	}
+	claims := fake.statementsLike("FOR UPDATE SKIP LOCKED")
+	if len(claims) != 1 {
+		t.Fatalf("ran %d claims want 1", len(claims))
+	}
+	if got, want := claims[0].args, []driver.Value{`{"email"}`, int64(2), float64(60)}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("claim args = %#v want %#v", got, want)
+	}
+}
+
+func TestTaskQueueReleasesClaimWhenPoolRejects(t *testing.T) {
+	q, fake := newTestTaskQueue(t, func(query string, args []driver.Value) (*fakeRows, error) {
+		if !strings.Contains(query, "FOR UPDATE SKIP LOCKED") {
+			return nil, nil
+		}
+		return &fakeRows{
+			columns: []string{"id", "kind", "payload", "attempts", "max_attempts"},
+			values:  [][]driver.Value{{int64(4), "email", []byte(`{}`), int64(1), int64(3)}},
+		}, nil
+	})
+	q.Handle("email", func(context.Context, json.RawMessage) error { return nil })
+	_ = q.pool.Shutdown(context.Background())
+
+	if err := q.poll(); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	releases := fake.statementsLike("attempts = attempts - 1")
+	if len(releases) != 1 {
+		t.Fatalf("ran %d releases want 1", len(releases))
+	}
+	if want := []driver.Value{int64(4), taskStatusPending, taskStatusRunning}; !reflect.DeepEqual(releases[0].args, want) {
+		t.Fatalf("release args = %#v want %#v", releases[0].args, want)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Warm-up runs once after the listener is bound and before /readyz reports
+// ready: it opens database connections ahead of traffic, primes the flag
+// provider connection and exercises the HTTP stack with a request to itself.
+// The whole routine is bounded by WARMUP_TIMEOUT_SECONDS; when the budget runs
+// out the instance is marked ready anyway so a slow dependency cannot keep a
+// rollout from progressing (the failure is logged and visible in metrics).
+
+type warmupStep struct {
+	name string
+	run  func(context.Context) error
+}
+
+type warmup struct {
+	steps []warmupStep
+	done  atomic.Bool
+}
+
+func newWarmup(db *sql.DB, selfURL, sessionID string) *warmup {
+	w := &warmup{}
+	if db != nil {
+		w.steps = append(w.steps, warmupStep{name: "database", run: warmDatabase(db, getIntEnv("WARMUP_DB_CONNECTIONS", 4))})
+	}
+	w.steps = append(w.steps,
+		warmupStep{name: "feature_flags", run: func(ctx context.Context) error {
+			isTracingEnabled(ctx)
+			isMetricsEnabled(ctx)
+			return nil
+		}},
+		warmupStep{name: "self_request", run: warmSelfRequest(selfURL, sessionID)},
+	)
+	return w
+}
+
+// Ready reports whether warm-up has finished; a nil warmup is always ready.
+func (w *warmup) Ready() bool {
+	return w == nil || w.done.Load()
+}
+
+func (w *warmup) Run(ctx context.Context, budget time.Duration) {
+	defer w.done.Store(true)
+
+	ctx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+
+	start := time.Now()
+	for _, step := range w.steps {
+		stepStart := time.Now()
+		err := step.run(ctx)
+		observeWarmup(step.name, time.Since(stepStart))
+		if err != nil {
+			log.Printf("warm-up step %s failed after %s: %v", step.name, time.Since(stepStart).Round(time.Millisecond), err)
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+	observeWarmup("total", time.Since(start))
+	log.Printf("warm-up finished in %s", time.Since(start).Round(time.Millisecond))
+}
+
+func observeWarmup(step string, d time.Duration) {
+	if mtr != nil {
+		mtr.warmupDuration.WithLabelValues(step).Set(d.Seconds())
+	}
+}
+
+// warmDatabase opens n connections concurrently and returns them to the idle
+// pool, so the first requests do not pay for connection setup.
+func warmDatabase(db *sql.DB, n int) func(context.Context) error {
+	return func(ctx context.Context) error {
+		if n <= 0 {
+			return nil
+		}
+		db.SetMaxIdleConns(n)
+		conns := make([]*sql.Conn, n)
+		errs := make([]error, n)
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				conn, err := db.Conn(ctx)
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				conns[i] = conn
+				errs[i] = conn.PingContext(ctx)
+			}(i)
+		}
+		wg.Wait()
+		for _, c := range conns {
+			if c != nil {
+				c.Close()
+			}
+		}
+		for _, err := range errs {
+			if err != nil {
+				return fmt.Errorf("open warm connection: %w", err)
+			}
+		}
+		return nil
+	}
+}
+
+// warmSelfRequest retries GET selfURL until it answers 200 or ctx expires.
+// The request carries the pod's session, when it has one, so it passes the
+// session guard like routed traffic does.
+func warmSelfRequest(selfURL, sessionID string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		client := &http.Client{Timeout: 2 * time.Second}
+		for {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, selfURL, nil)
+			if err != nil {
+				return err
+			}
+			if sessionID != "" {
+				req.Header.Set(sessionHeader, sessionID)
+			}
+			resp, err := client.Do(req)
+			if err == nil {
+				_, _ = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				if resp.StatusCode == http.StatusOK {
+					return nil
+				}
+				err = fmt.Errorf("self request returned %s", resp.Status)
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+			case <-time.After(200 * time.Millisecond):
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// useWarmupMetrics records warm-up durations in a registry of their own for
+// the rest of the test and returns a function reading them back by step.
+func useWarmupMetrics(t *testing.T) func() map[string]float64 {
+	t.Helper()
+	durations := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "warmup_duration_seconds"}, []string{"step"})
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(durations)
+	mtr = &appMetrics{warmupDuration: durations}
+	t.Cleanup(func() { mtr = nil })
+
+	return func() map[string]float64 {
+		t.Helper()
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("gather: %v", err)
+		}
+		got := map[string]float64{}
+		for _, f := range families {
+			for _, m := range f.GetMetric() {
+				for _, l := range m.GetLabel() {
+					if l.GetName() == "step" {
+						got[l.GetValue()] = m.GetGauge().GetValue()
+					}
+				}
+			}
+		}
+		return got
+	}
+}
+
+func readyzStatus(c dependencyChecker) int {
+	rr := httptest.NewRecorder()
+	c.readinessHandler(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	return rr.Code
+}
+
+func TestWarmupFailingSelfRequestHoldsReadinessUntilBudget(t *testing.T) {
+	openfeature.SetProvider(openfeature.NewNoopProvider())
+	ofClient = openfeature.NewClient("test")
+	durations := useWarmupMetrics(t)
+
+	var selfRequests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		selfRequests.Add(1)
+		http.Error(w, "not yet", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	warm := newWarmup(nil, srv.URL+"/", "")
+	checker := dependencyChecker{warmup: warm}
+	if got := readyzStatus(checker); got != http.StatusServiceUnavailable {
+		t.Fatalf("readyz before warm-up = %d want 503", got)
+	}
+
+	const budget = 700 * time.Millisecond
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		warm.Run(context.Background(), budget)
+	}()
+
+	// The self request keeps failing, so readiness waits for the budget.
+	for selfRequests.Load() < 2 {
+		select {
+		case <-done:
+			t.Fatalf("warm-up finished after %d self requests, want it to retry until the budget runs out", selfRequests.Load())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if got := readyzStatus(checker); got != http.StatusServiceUnavailable {
+		t.Fatalf("readyz while the self request fails = %d want 503", got)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("warm-up did not give up when its budget ran out")
+	}
+	if elapsed := time.Since(start); elapsed < budget {
+		t.Fatalf("warm-up gave up after %s, before its %s budget", elapsed, budget)
+	}
+	if got := readyzStatus(checker); got != http.StatusOK {
+		t.Fatalf("readyz after the budget ran out = %d want 200", got)
+	}
+
+	got := durations()
+	for _, step := range []string{"feature_flags", "self_request", "total"} {
+		if _, ok := got[step]; !ok {
+			t.Fatalf("no warm-up duration for %s: %v", step, got)
+		}
+	}
+	if got["self_request"] < (budget - 100*time.Millisecond).Seconds() {
+		t.Fatalf("self_request took %.3fs, want about the %s budget", got["self_request"], budget)
+	}
+	if got["total"] < got["self_request"] {
+		t.Fatalf("total %.3fs is shorter than the self_request step %.3fs", got["total"], got["self_request"])
+	}
+}
+
+func TestWarmupFailedStepDoesNotStopTheOthers(t *testing.T) {
+	durations := useWarmupMetrics(t)
+
+	var ran []string
+	warm := &warmup{steps: []warmupStep{
+		{name: "broken", run: func(context.Context) error {
+			ran = append(ran, "broken")
+			return errors.New("boom")
+		}},
+		{name: "next", run: func(context.Context) error {
+			ran = append(ran, "next")
+			return nil
+		}},
+	}}
+	warm.Run(context.Background(), time.Second)
+
+	if !warm.Ready() {
+		t.Fatal("warm-up not marked ready after a failed step")
+	}
+	if len(ran) != 2 {
+		t.Fatalf("ran steps %v, want the step after the failed one too", ran)
+	}
+	if got := durations(); len(got) != 3 {
+		t.Fatalf("warm-up durations = %v, want broken, next and total", got)
+	}
+}
+
+func TestWarmupBudgetExpirySkipsRemainingSteps(t *testing.T) {
+	durations := useWarmupMetrics(t)
+
+	ranAfter := false
+	warm := &warmup{steps: []warmupStep{
+		{name: "slow", run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+		{name: "after", run: func(context.Context) error {
+			ranAfter = true
+			return nil
+		}},
+	}}
+	start := time.Now()
+	warm.Run(context.Background(), 50*time.Millisecond)
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("warm-up took %s with a 50ms budget", elapsed)
+	}
+	if !warm.Ready() {
+		t.Fatal("warm-up not marked ready once its budget ran out")
+	}
+	if ranAfter {
+		t.Fatal("ran a step after the budget ran out")
+	}
+	got := durations()
+	if _, ok := got["after"]; ok || got["slow"] < 0.05 {
+		t.Fatalf("warm-up durations = %v, want slow of at least the budget and no after", got)
+	}
+}
+
+func TestNilWarmupIsReady(t *testing.T) {
+	var warm *warmup
+	if !warm.Ready() {
+		t.Fatal("nil warm-up not ready")
+	}
+	if got := readyzStatus(dependencyChecker{}); got != http.StatusOK {
+		t.Fatalf("readyz without warm-up = %d want 200", got)
+	}
+}
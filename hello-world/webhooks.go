@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Outbound webhooks (enable with WEBHOOKS_ENABLED=true; requires DATABASE_URL).
+// Subscriptions are managed through the admin API below. Each matching domain
+// event becomes a webhook_deliveries row plus a task on the task queue, which
+// owns retries and backoff; the delivery status reported by the API is derived
+// from the task state.
+//
+// Requests carry the event envelope as JSON and are signed with
+// X-Webhook-Signature: sha256=HMAC-SHA256(secret, "<timestamp>.<body>")
+// where <timestamp> is the X-Webhook-Timestamp header (unix seconds).
+//
+// Webhooks are only sent to public addresses: targets that are, or resolve
+// to, loopback, private or link-local addresses are refused unless
+// WEBHOOKS_ALLOW_PRIVATE_TARGETS=true, so a subscription cannot reach the
+// pod's network neighbours.
+//
+// Admin endpoints (served only when WEBHOOKS_ADMIN_TOKEN is set, and requiring
+// "Authorization: Bearer <token>"):
+// GET    /admin/webhooks                   -> list subscriptions
+// POST   /admin/webhooks                   -> {"url": "...", "secret": "...", "eventTypes": ["..."]}
+// DELETE /admin/webhooks/{id}              -> remove a subscription and its history
+// GET    /admin/webhooks/{id}/deliveries   -> most recent deliveries and their status
+
+const taskKindWebhookDelivery = "webhook.deliver"
+
+type webhook struct {
+	ID         int64     `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"eventTypes"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type webhookDelivery struct {
+	ID             int64      `json:"id"`
+	EventType      string     `json:"eventType"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	LastStatusCode *int       `json:"lastStatusCode,omitempty"`
+	LastError      *string    `json:"lastError,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty"`
+}
+
+type webhookDispatcher struct {
+	db     *sql.DB
+	queue  *taskQueue
+	client *http.Client
+
+	adminToken   string
+	allowPrivate bool
+}
+
+// webhooks is nil when webhooks are disabled; Dispatch is safe to call on nil.
+var webhooks *webhookDispatcher
+
+func newWebhookDispatcher(db *sql.DB, queue *taskQueue) *webhookDispatcher {
+	allowPrivate := getBoolEnv("WEBHOOKS_ALLOW_PRIVATE_TARGETS", false)
+	d := &webhookDispatcher{
+		db:           db,
+		queue:        queue,
+		client:       newWebhookClient(allowPrivate),
+		adminToken:   os.Getenv("WEBHOOKS_ADMIN_TOKEN"),
+		allowPrivate: allowPrivate,
+	}
+	queue.Handle(taskKindWebhookDelivery, d.deliver)
+	return d
+}
+
+// newWebhookClient returns the client deliveries are sent with. Unless
+// allowPrivate, it refuses to connect to non-public addresses; checking the
+// address dialled, rather than the URL, also covers DNS names and redirects
+// that lead there.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		dialer := &net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+					return fmt.Errorf("webhook target %s is not a public address", host)
+				}
+				return nil
+			},
+		}
+		transport.DialContext = dialer.DialContext
+		// A proxy would make the dialled address the proxy's.
+		transport.Proxy = nil
+	}
+	return &http.Client{Timeout: 10 * time.Second, Transport: transport}
+}
+
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast()
+}
+
+// validateTarget rejects subscription URLs that are not absolute http(s)
+// URLs or, unless private targets are allowed, name a non-public host.
+func (d *webhookDispatcher) validateTarget(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http(s) URL")
+	}
+	if d.allowPrivate {
+		return nil
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errors.New("url must not target a loopback, private or link-local address")
+	}
+	if ip := net.ParseIP(host); ip != nil && !publicIP(ip) {
+		return errors.New("url must not target a loopback, private or link-local address")
+	}
+	return nil
+}
+
+// Dispatch records a delivery for every webhook subscribed to env.Type and
+// queues it for sending.
+func (d *webhookDispatcher) Dispatch(ctx context.Context, env eventEnvelope) error {
+	if d == nil {
+		return nil
+	}
+	body, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("encode webhook payload: %w", err)
+	}
+
+	rows, err := d.db.QueryContext(ctx, `SELECT id FROM webhooks WHERE $1 = ANY(event_types)`, env.Type)
+	if err != nil {
+		return fmt.Errorf("find webhooks for %s: %w", env.Type, err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan webhook: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		var deliveryID int64
+		if err := d.db.QueryRowContext(ctx,
+			`INSERT INTO webhook_deliveries (webhook_id, event_type, payload) VALUES ($1, $2, $3) RETURNING id`,
+			id, env.Type, body,
+		).Scan(&deliveryID); err != nil {
+			return fmt.Errorf("record webhook delivery: %w", err)
+		}
+		taskID, err := d.queue.Enqueue(ctx, taskKindWebhookDelivery, map[string]int64{"deliveryId": deliveryID}, 0)
+		if err != nil {
+			return err
+		}
+		if _, err := d.db.ExecContext(ctx, `UPDATE webhook_deliveries SET task_id = $2 WHERE id = $1`, deliveryID, taskID); err != nil {
+			return fmt.Errorf("link webhook delivery to task: %w", err)
+		}
+	}
+	return nil
+}
+
+func (d *webhookDispatcher) deliver(ctx context.Context, payload json.RawMessage) error {
+	var task struct {
+		DeliveryID int64 `json:"deliveryId"`
+	}
+	if err := json.Unmarshal(payload, &task); err != nil {
+		return fmt.Errorf("decode webhook task: %w", err)
+	}
+
+	var (
+		target, secret string
+		body           []byte
+		eventType      string
+	)
+	err := d.db.QueryRowContext(ctx,
+		`SELECT w.url, w.secret, d.payload, d.event_type
+		 FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		 WHERE d.id = $1`, task.DeliveryID,
+	).Scan(&target, &secret, &body, &eventType)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Subscription was deleted after the event was queued.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("load webhook delivery %d: %w", task.DeliveryID, err)
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return d.recordAttempt(task.DeliveryID, 0, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "hello-world-webhooks/1")
+	req.Header.Set("X-Webhook-Event", eventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(task.DeliveryID, 10))
+	req.Header.Set("X-Webhook-Timestamp", ts)
+	req.Header.Set("X-Webhook-Signature", "sha256="+signWebhook(secret, ts, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return d.recordAttempt(task.DeliveryID, 0, err)
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return d.recordAttempt(task.DeliveryID, resp.StatusCode, fmt.Errorf("webhook responded %s", resp.Status))
+	}
+	return d.recordAttempt(task.DeliveryID, resp.StatusCode, nil)
+}
+
+// recordAttempt stores the outcome of one attempt and returns attemptErr so
+// the task queue can schedule a retry.
+func (d *webhookDispatcher) recordAttempt(deliveryID int64, statusCode int, attemptErr error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var code sql.NullInt64
+	if statusCode > 0 {
+		code = sql.NullInt64{Int64: int64(statusCode), Valid: true}
+	}
+	var errText sql.NullString
+	if attemptErr != nil {
+		errText = sql.NullString{String: attemptErr.Error(), Valid: true}
+	}
+	_, err := d.db.ExecContext(ctx,
+		`UPDATE webhook_deliveries
+		 SET attempts = attempts + 1, last_status_code = $2, last_error = $3,
+		     delivered_at = CASE WHEN $3::text IS NULL THEN now() ELSE delivered_at END
+		 WHERE id = $1`,
+		deliveryID, code, errText)
+	if err != nil && attemptErr == nil {
+		return fmt.Errorf("record webhook delivery %d: %w", deliveryID, err)
+	}
+	return attemptErr
+}
+
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// requireAdminToken serves next only to requests bearing the admin token.
+func (d *webhookDispatcher) requireAdminToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || d.adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(d.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// internalError logs err and answers with a generic error, so database
+// details do not reach API clients.
+func internalError(w http.ResponseWriter, op string, err error) {
+	log.Printf("webhooks: %s: %v", op, err)
+	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+}
+
+func (d *webhookDispatcher) listHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := d.db.QueryContext(r.Context(), `SELECT id, url, event_types, created_at FROM webhooks ORDER BY id`)
+	if err != nil {
+		internalError(w, "list webhooks", err)
+		return
+	}
+	defer rows.Close()
+	hooks := []webhook{}
+	for rows.Next() {
+		var h webhook
+		if err := rows.Scan(&h.ID, &h.URL, pq.Array(&h.EventTypes), &h.CreatedAt); err != nil {
+			internalError(w, "scan webhook", err)
+			return
+		}
+		hooks = append(hooks, h)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"webhooks": hooks})
+}
+
+func (d *webhookDispatcher) createHandler(w http.ResponseWriter, r *http.Request) {
+	var h webhook
+	if err := json.NewDecoder(r.Body).Decode(&h); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid body: %v", err)})
+		return
+	}
+	if err := d.validateTarget(h.URL); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if len(h.EventTypes) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "eventTypes must not be empty"})
+		return
+	}
+	if h.Secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			internalError(w, "generate webhook secret", err)
+			return
+		}
+		h.Secret = hex.EncodeToString(buf)
+	}
+
+	err := d.db.QueryRowContext(r.Context(),
+		`INSERT INTO webhooks (url, secret, event_types) VALUES ($1, $2, $3) RETURNING id, created_at`,
+		h.URL, h.Secret, pq.Array(h.EventTypes),
+	).Scan(&h.ID, &h.CreatedAt)
+	if err != nil {
+		internalError(w, "create webhook", err)
+		return
+	}
+	// The secret is only ever returned in the create response.
+	writeJSON(w, http.StatusCreated, h)
+}
+
+func (d *webhookDispatcher) deleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid webhook id"})
+		return
+	}
+	res, err := d.db.ExecContext(r.Context(), `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		internalError(w, "delete webhook", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "webhook not found"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (d *webhookDispatcher) deliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid webhook id"})
+		return
+	}
+	rows, err := d.db.QueryContext(r.Context(),
+		`SELECT d.id, d.event_type,
+		        CASE t.status WHEN 'done' THEN 'delivered' WHEN 'dead' THEN 'failed' ELSE 'pending' END,
+		        d.attempts, d.last_status_code, d.last_error, d.created_at, d.delivered_at
+		 FROM webhook_deliveries d LEFT JOIN task_queue t ON t.id = d.task_id
+		 WHERE d.webhook_id = $1
+		 ORDER BY d.id DESC
+		 LIMIT 50`, id)
+	if err != nil {
+		internalError(w, "list webhook deliveries", err)
+		return
+	}
+	defer rows.Close()
+	deliveries := []webhookDelivery{}
+	for rows.Next() {
+		var dl webhookDelivery
+		if err := rows.Scan(&dl.ID, &dl.EventType, &dl.Status, &dl.Attempts, &dl.LastStatusCode, &dl.LastError, &dl.CreatedAt, &dl.DeliveredAt); err != nil {
+			internalError(w, "scan webhook delivery", err)
+			return
+		}
+		deliveries = append(deliveries, dl)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"deliveries": deliveries})
+}
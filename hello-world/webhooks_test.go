@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"type":"flags.overrides.changed"}`)
+	got := signWebhook("s3cret", "1700000000", body)
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte("1700000000." + string(body)))
+	if want := hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Fatalf("signWebhook = %s want %s", got, want)
+	}
+	if other := signWebhook("s3cret", "1700000001", body); other == got {
+		t.Fatalf("signature must depend on the timestamp")
+	}
+}
+
+func TestValidateWebhookTarget(t *testing.T) {
+	d := &webhookDispatcher{}
+	for _, tc := range []struct {
+		url string
+		ok  bool
+	}{
+		{"https://hooks.example.com/in", true},
+		{"http://203.0.113.10:8080/in", true},
+		{"ftp://hooks.example.com/in", false},
+		{"/relative", false},
+		{"http://localhost:8080/", false},
+		{"http://api.localhost./", false},
+		{"http://127.0.0.1/", false},
+		{"http://[::1]/", false},
+		{"http://10.0.0.5/", false},
+		{"http://192.168.1.1/", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://[fe80::1]/", false},
+		{"http://0.0.0.0/", false},
+	} {
+		if err := d.validateTarget(tc.url); (err == nil) != tc.ok {
+			t.Errorf("validateTarget(%q) err = %v, want ok=%v", tc.url, err, tc.ok)
+		}
+	}
+	d.allowPrivate = true
+	if err := d.validateTarget("http://10.0.0.5/"); err != nil {
+		t.Errorf("validateTarget with private targets allowed: %v", err)
+	}
+}
+
+func TestWebhookAdminRequiresToken(t *testing.T) {
+	d := &webhookDispatcher{adminToken: "s3cret"}
+	h := d.requireAdminToken(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	for _, tc := range []struct {
+		auth string
+		want int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"s3cret", http.StatusUnauthorized},
+		{"Bearer s3cret", http.StatusNoContent},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/webhooks", nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("Authorization %q: status = %d want %d", tc.auth, rec.Code, tc.want)
+		}
+	}
+}
+
+func deliveryRow(target string) func(string, []driver.Value) (*fakeRows, error) {
+	return func(query string, _ []driver.Value) (*fakeRows, error) {
+		if strings.Contains(query, "FROM webhook_deliveries d JOIN webhooks w") {
+			return &fakeRows{
+				columns: []string{"url", "secret", "payload", "event_type"},
+				values:  [][]driver.Value{{target, "s3cret", []byte(`{"type":"flags.overrides.changed"}`), "flags.overrides.changed"}},
+			}, nil
+		}
+		return nil, nil
+	}
+}
+
+func TestWebhookDeliveryRecordsAttempts(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Webhook-Signature") == "" || r.Header.Get("X-Webhook-Delivery") != "7" {
+			t.Errorf("unsigned or unlabelled delivery: %v", r.Header)
+		}
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	db, fake := openFakeDB(t, deliveryRow(srv.URL))
+	d := &webhookDispatcher{db: db, client: srv.Client()}
+	payload := json.RawMessage(`{"deliveryId":7}`)
+
+	// A failed attempt is recorded and returned, so the task queue retries it.
+	if err := d.deliver(context.Background(), payload); err == nil {
+		t.Fatalf("deliver to a 503 succeeded, want an error for the task queue to retry")
+	}
+	if err := d.deliver(context.Background(), payload); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+
+	attempts := fake.statementsLike("UPDATE webhook_deliveries")
+	if len(attempts) != 2 {
+		t.Fatalf("recorded %d attempts want 2", len(attempts))
+	}
+	if code, errText := attempts[0].args[1], attempts[0].args[2]; code != int64(503) || errText == nil {
+		t.Errorf("first attempt recorded code %v error %v, want 503 and an error", code, errText)
+	}
+	if code, errText := attempts[1].args[1], attempts[1].args[2]; code != int64(200) || errText != nil {
+		t.Errorf("second attempt recorded code %v error %v, want 200 and no error", code, errText)
+	}
+}
+
+func TestWebhookDeliveryRefusesPrivateTargets(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls.Add(1) }))
+	defer srv.Close()
+
+	db, fake := openFakeDB(t, deliveryRow(srv.URL))
+	d := &webhookDispatcher{db: db, client: newWebhookClient(false)}
+	if err := d.deliver(context.Background(), json.RawMessage(`{"deliveryId":7}`)); err == nil || !strings.Contains(err.Error(), "not a public address") {
+		t.Fatalf("deliver to loopback err = %v, want refusal", err)
+	}
+	if n := calls.Load(); n != 0 {
+		t.Fatalf("loopback receiver called %d times", n)
+	}
+	if attempts := fake.statementsLike("UPDATE webhook_deliveries"); len(attempts) != 1 || attempts[0].args[1] != nil {
+		t.Fatalf("refused attempt not recorded without a status code: %v", attempts)
+	}
+}
+
+func TestWebhookDeliveriesHandler(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	db, fake := openFakeDB(t, func(query string, args []driver.Value) (*fakeRows, error) {
+		if args[0] == int64(13) {
+			return nil, errors.New(`pq: relation "webhook_deliveries" does not exist`)
+		}
+		return &fakeRows{
+			columns: []string{"id", "event_type", "status", "attempts", "last_status_code", "last_error", "created_at", "delivered_at"},
+			values: [][]driver.Value{
+				{int64(2), "flags.overrides.changed", "pending", int64(1), int64(503), "webhook responded 503 Service Unavailable", created, nil},
+				{int64(1), "flags.overrides.changed", "delivered", int64(1), int64(200), nil, created, created},
+			},
+		}, nil
+	})
+	d := &webhookDispatcher{db: db, adminToken: "s3cret"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/webhooks/{id}/deliveries", d.requireAdminToken(d.deliveriesHandler))
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/admin/webhooks/12/deliveries")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d body %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Deliveries []webhookDelivery `json:"deliveries"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(body.Deliveries) != 2 {
+		t.Fatalf("deliveries = %d want 2", len(body.Deliveries))
+	}
+	pending, delivered := body.Deliveries[0], body.Deliveries[1]
+	if pending.Status != "pending" || pending.LastStatusCode == nil || *pending.LastStatusCode != 503 || pending.LastError == nil || pending.DeliveredAt != nil {
+		t.Errorf("pending delivery = %+v", pending)
+	}
+	if delivered.Status != "delivered" || delivered.LastError != nil || delivered.DeliveredAt == nil || !delivered.DeliveredAt.Equal(created) {
+		t.Errorf("delivered delivery = %+v", delivered)
+	}
+	if q := fake.statementsLike("FROM webhook_deliveries d LEFT JOIN task_queue"); len(q) != 1 || q[0].args[0] != int64(12) {
+		t.Errorf("deliveries query = %v, want one for webhook 12", q)
+	}
+
+	if rec := get("/admin/webhooks/abc/deliveries"); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid id status = %d want 400", rec.Code)
+	}
+	rec = get("/admin/webhooks/13/deliveries")
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "pq:") {
+		t.Errorf("database error answered %d %s, want 500 without the database error", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Bounded pool of background workers. Async work (relays, writers, scheduled
+// jobs) is submitted here instead of being started with bare goroutines so
+// that a panic in one task cannot take down the process and shutdown can wait
+// for queued work to drain.
+
+var (
+	errPoolFull   = errors.New("worker pool queue is full")
+	errPoolClosed = errors.New("worker pool is shut down")
+)
+
+type poolTask struct {
+	name     string
+	fn       func(context.Context) error
+	enqueued time.Time
+}
+
+type workerPool struct {
+	name  string
+	tasks chan poolTask
+
+	// ctx is handed to tasks and cancelled when a drain exceeds its deadline.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func newWorkerPool(name string, workers, queueSize int) *workerPool {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &workerPool{
+		name:   name,
+		tasks:  make(chan poolTask, queueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.worker()
+	}
+	return p
+}
+
+// Submit queues fn without blocking. It returns errPoolFull when the queue is
+// at capacity and errPoolClosed once Shutdown has been called.
+func (p *workerPool) Submit(name string, fn func(context.Context) error) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return errPoolClosed
+	}
+	select {
+	case p.tasks <- poolTask{name: name, fn: fn, enqueued: time.Now()}:
+		p.observeQueueDepth()
+		return nil
+	default:
+		if mtr != nil {
+			mtr.poolTasksRejected.WithLabelValues(p.name).Inc()
+		}
+		return errPoolFull
+	}
+}
+
+// Shutdown stops accepting tasks and waits for queued and running tasks to
+// finish. If ctx expires first, the context passed to tasks is cancelled and
+// ctx.Err() is returned once the workers exit.
+func (p *workerPool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.tasks)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (p *workerPool) worker() {
+	defer p.wg.Done()
+	for t := range p.tasks {
+		p.observeQueueDepth()
+		p.run(t)
+	}
+}
+
+func (p *workerPool) run(t poolTask) {
+	start := time.Now()
+	outcome := "ok"
+	defer func() {
+		if rec := recover(); rec != nil {
+			outcome = "panic"
+			log.Printf("worker pool %s: task %s panicked: %v\n%s", p.name, t.name, rec, debug.Stack())
+		}
+		if mtr != nil {
+			mtr.poolTaskWait.WithLabelValues(p.name, t.name).Observe(start.Sub(t.enqueued).Seconds())
+			mtr.poolTaskDuration.WithLabelValues(p.name, t.name, outcome).Observe(time.Since(start).Seconds())
+		}
+	}()
+
+	if err := t.fn(p.ctx); err != nil {
+		outcome = "error"
+		log.Printf("worker pool %s: task %s failed: %v", p.name, t.name, err)
+	}
+}
+
+func (p *workerPool) observeQueueDepth() {
+	if mtr != nil {
+		mtr.poolQueueDepth.WithLabelValues(p.name).Set(float64(len(p.tasks)))
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolIsolatesPanicsAndDrains(t *testing.T) {
+	mtr = nil
+	p := newWorkerPool("test", 2, 10)
+
+	var ran atomic.Int32
+	if err := p.Submit("panics", func(context.Context) error { panic("boom") }); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := p.Submit("counts", func(context.Context) error {
+			time.Sleep(5 * time.Millisecond)
+			ran.Add(1)
+			return nil
+		}); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if got := ran.Load(); got != 5 {
+		t.Fatalf("ran %d tasks want 5", got)
+	}
+	if err := p.Submit("late", func(context.Context) error { return nil }); !errors.Is(err, errPoolClosed) {
+		t.Fatalf("submit after shutdown err = %v want errPoolClosed", err)
+	}
+}
+
+func TestWorkerPoolRejectsWhenFull(t *testing.T) {
+	mtr = nil
+	p := newWorkerPool("test", 1, 1)
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	_ = p.Submit("block", func(context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+	if err := p.Submit("queued", func(context.Context) error { return nil }); err != nil {
+		t.Fatalf("submit into free slot: %v", err)
+	}
+	if err := p.Submit("overflow", func(context.Context) error { return nil }); !errors.Is(err, errPoolFull) {
+		t.Fatalf("submit err = %v want errPoolFull", err)
+	}
+	close(release)
+	_ = p.Shutdown(context.Background())
+}
+
+func TestWorkerPoolShutdownDeadlineCancelsTasks(t *testing.T) {
+	mtr = nil
+	p := newWorkerPool("test", 1, 1)
+	started := make(chan struct{})
+	_ = p.Submit("waits", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown err = %v want deadline exceeded", err)
+	}
+}